@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	tokenPasswordReset = "password_reset"
+	tokenEmailVerify   = "email_verify"
+
+	// authTokenCooldown is the shortest gap between two emails of the same
+	// kind to one account.
+	authTokenCooldown = time.Minute
+)
+
+var (
+	errAuthTokenInvalid  = errors.New("link is invalid or has expired")
+	errAuthTokenCooldown = errors.New("an email was sent recently, try again in a minute")
+	errEmailVerified     = errors.New("email is already verified")
+	errEmailUnverified   = errors.New("verify your email address first")
+)
+
+// newAuthToken returns a random token for the emailed link and the hash that
+// is stored in its place.
+func newAuthToken() (string, string) {
+	random := make([]byte, 32)
+	rand.Read(random)
+	token := base64.RawURLEncoding.EncodeToString(random)
+	return token, hashAuthToken(token)
+}
+
+func hashAuthToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// expiresIn spells out a token lifetime for emails, e.g. "1 hour".
+func expiresIn(ttl time.Duration) string {
+	count, unit := int(ttl/time.Minute), "minute"
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		count, unit = int(ttl/time.Hour), "hour"
+	}
+	if count != 1 {
+		unit += "s"
+	}
+	return strconv.Itoa(count) + " " + unit
+}
+
+type accountMailData struct {
+	Name      string
+	Email     string
+	URL       string
+	ExpiresIn string
+}
+
+// sendAccountMail issues a token for purpose and queues the email carrying
+// its link to the user's current address.
+func sendAccountMail(repo Repository, cfg Config, user *AuthUser, purpose string) error {
+	name, path, ttl := "verify_email", "/auth/verify", cfg.EmailVerifyTTL
+	if purpose == tokenPasswordReset {
+		name, path, ttl = "password_reset", "/auth/reset", cfg.PasswordResetTTL
+	}
+	token, hash := newAuthToken()
+	if err := repo.IssueAuthToken(user.ID, purpose, hash, user.Email, time.Now().Add(ttl)); err != nil {
+		return err
+	}
+	msg, err := renderMail(repo, cfg.SiteURL, name, user.Email, accountMailData{
+		Name:      user.Name,
+		Email:     user.Email,
+		URL:       cfg.SiteURL + path + "?token=" + url.QueryEscape(token),
+		ExpiresIn: expiresIn(ttl),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = repo.EnqueueMail(name, msg)
+	return err
+}
+
+// requireVerifiedEmail rejects users whose email is unverified when enabled.
+// It runs after userAuth.
+func requireVerifiedEmail(enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if enabled && !c.GetBool("emailVerified") {
+			c.JSON(http.StatusForbidden, gin.H{"error": errEmailUnverified.Error()})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func respondAccountError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errAuthTokenInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errEmailVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errAuthTokenCooldown):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		respondNotFound(c, err)
+	}
+}
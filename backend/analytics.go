@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	analyticsDateLayout = "2006-01-02"
+	maxAnalyticsDays    = 366
+)
+
+var errAnalyticsRange = errors.New("from and to must be YYYY-MM-DD dates at most 366 days apart")
+
+// analyticsPeriods maps the top novels period to the number of days it spans,
+// ending today. Zero means every day on record.
+var analyticsPeriods = map[string]int{
+	"day":   1,
+	"week":  7,
+	"month": 30,
+	"year":  365,
+	"all":   0,
+}
+
+// viewVisitorHash identifies a visitor for view deduplication without keeping
+// the raw IP. The day is mixed in so hashes cannot be joined across days.
+func viewVisitorHash(secret string, identity string, now time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(now.UTC().Format(analyticsDateLayout) + "|" + identity))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// viewVisitorIdentity tells visitors apart by IP and user agent, so signed-in
+// and anonymous readers are counted the same way.
+func viewVisitorIdentity(c *gin.Context) string {
+	return c.ClientIP() + "|" + c.GetHeader("User-Agent")
+}
+
+// parseAnalyticsRange reads the inclusive from/to days, defaulting to the
+// last 30 days.
+func parseAnalyticsRange(c *gin.Context, now time.Time) (time.Time, time.Time, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	from, to := today.AddDate(0, 0, -29), today
+	if raw := strings.TrimSpace(c.Query("from")); raw != "" {
+		parsed, err := time.Parse(analyticsDateLayout, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, errAnalyticsRange
+		}
+		from = parsed
+	}
+	if raw := strings.TrimSpace(c.Query("to")); raw != "" {
+		parsed, err := time.Parse(analyticsDateLayout, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, errAnalyticsRange
+		}
+		to = parsed
+	}
+	if to.Before(from) || to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		return time.Time{}, time.Time{}, errAnalyticsRange
+	}
+	return from, to, nil
+}
+
+// computeDropOff fills retention against the first chapter and the drop from
+// the previous chapter, both as fractions.
+func computeDropOff(chapters []*ChapterDropOff) {
+	for i, chapter := range chapters {
+		if first := chapters[0].Views; first > 0 {
+			chapter.Retention = math.Round(float64(chapter.Views)/float64(first)*1000) / 1000
+		}
+		if i > 0 && chapters[i-1].Views > 0 {
+			chapter.DropOff = math.Round((1-float64(chapter.Views)/float64(chapters[i-1].Views))*1000) / 1000
+		}
+	}
+}
+
+func respondAnalyticsError(c *gin.Context, err error) {
+	if errors.Is(err, errAnalyticsRange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respondNotFound(c, err)
+}
+
+// runViewPruner drops view deduplication rows once their window has passed.
+// The daily rollups are kept.
+func runViewPruner(ctx context.Context, repo Repository, window time.Duration) {
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		removed, err := repo.PruneChapterViewVisitors(time.Now().Truncate(window))
+		if err != nil {
+			log.Printf("view pruner: %v", err)
+		} else if removed > 0 {
+			log.Printf("view pruner: removed %d expired visitor windows", removed)
+		}
+	}
+}
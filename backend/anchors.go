@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// anchorSimilarity is the word overlap an edited paragraph must exceed to
+// keep its comments.
+const anchorSimilarity = 0.5
+
+var errCommentAnchor = errors.New("paragraphIndex is outside the chapter")
+
+// commentAnchor is the paragraph position stored on a comment.
+type commentAnchor struct {
+	CommentID int
+	Index     int
+	Hash      string
+	Orphaned  bool
+}
+
+// paragraphHash fingerprints a paragraph ignoring case and whitespace so
+// reflowed text keeps its anchor.
+func paragraphHash(paragraph string) string {
+	normalized := strings.ToLower(strings.Join(strings.Fields(paragraph), " "))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:8])
+}
+
+// anchorParagraph returns the hash of paragraph index in content.
+func anchorParagraph(content string, index int) (string, error) {
+	paragraphs := splitParagraphs(content)
+	if index < 0 || index >= len(paragraphs) {
+		return "", errCommentAnchor
+	}
+	return paragraphHash(paragraphs[index]), nil
+}
+
+// reanchorComments moves anchors from oldContent onto newContent and returns
+// only the anchors that changed. An anchor follows its exact paragraph first,
+// then the most similar paragraph if the old one was edited, and is orphaned
+// when neither is found. Orphans reattach if their paragraph comes back.
+func reanchorComments(oldContent, newContent string, anchors []commentAnchor) []commentAnchor {
+	oldParagraphs := splitParagraphs(oldContent)
+	newParagraphs := splitParagraphs(newContent)
+	newHashes := make([]string, len(newParagraphs))
+	for i, paragraph := range newParagraphs {
+		newHashes[i] = paragraphHash(paragraph)
+	}
+
+	changed := make([]commentAnchor, 0)
+	for _, anchor := range anchors {
+		next := anchor
+		if index := nearestHash(newHashes, anchor.Hash, anchor.Index); index >= 0 {
+			next.Index, next.Orphaned = index, false
+		} else if !anchor.Orphaned && anchor.Index < len(oldParagraphs) && paragraphHash(oldParagraphs[anchor.Index]) == anchor.Hash {
+			if index := mostSimilarParagraph(oldParagraphs[anchor.Index], newParagraphs, anchor.Index); index >= 0 {
+				next.Index, next.Hash = index, newHashes[index]
+			} else {
+				next.Orphaned = true
+			}
+		} else {
+			next.Orphaned = true
+		}
+		if next != anchor {
+			changed = append(changed, next)
+		}
+	}
+	return changed
+}
+
+func nearestHash(hashes []string, hash string, near int) int {
+	best := -1
+	for i, candidate := range hashes {
+		if candidate == hash && (best < 0 || absInt(i-near) < absInt(best-near)) {
+			best = i
+		}
+	}
+	return best
+}
+
+func mostSimilarParagraph(paragraph string, candidates []string, near int) int {
+	words := paragraphWords(paragraph)
+	best, bestScore := -1, anchorSimilarity
+	for i, candidate := range candidates {
+		score := wordOverlap(words, paragraphWords(candidate))
+		if score > bestScore || (score == bestScore && best >= 0 && absInt(i-near) < absInt(best-near)) {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+func paragraphWords(paragraph string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(strings.ToLower(paragraph)) {
+		words[word] = true
+	}
+	return words
+}
+
+// wordOverlap is the Jaccard index of two word sets.
+func wordOverlap(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func absInt(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -9,20 +9,24 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// authClaims are carried by access tokens. SessionID ties the token to a row
+// in sessions, so revoking the session cuts it off before it expires.
 type authClaims struct {
-	UserID int    `json:"uid"`
-	Role   string `json:"role"`
+	UserID    int    `json:"uid"`
+	SessionID int    `json:"sid"`
+	Role      string `json:"role"`
 	jwt.RegisteredClaims
 }
 
-func generateToken(userID int, role, secret string, ttl time.Duration) (string, error) {
+func generateToken(userID int, sessionID int, role, secret string, ttl time.Duration) (string, error) {
 	if strings.TrimSpace(secret) == "" {
 		return "", errors.New("jwt secret not configured")
 	}
 	now := time.Now()
 	claims := authClaims{
-		UserID: userID,
-		Role:   role,
+		UserID:    userID,
+		SessionID: sessionID,
+		Role:      role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
@@ -48,14 +52,18 @@ func normalizeEmail(email string) string {
 	return strings.ToLower(strings.TrimSpace(email))
 }
 
-func toAuthUserInfo(user *AuthUser) AuthUserInfo {
+// toAuthUserInfo describes a user to themselves, with what their role allows.
+func toAuthUserInfo(user *AuthUser, permissions []string) AuthUserInfo {
 	return AuthUserInfo{
-		ID:        user.ID,
-		Name:      user.Name,
-		Email:     user.Email,
-		Role:      user.Role,
-		Status:    user.Status,
-		CreatedAt: user.CreatedAt,
+		ID:                 user.ID,
+		Name:               user.Name,
+		Email:              user.Email,
+		Role:               user.Role,
+		Status:             user.Status,
+		EmailVerifiedAt:    user.EmailVerifiedAt,
+		TwoFactorEnabledAt: user.TwoFactorEnabledAt,
+		Permissions:        permissions,
+		CreatedAt:          user.CreatedAt,
 	}
 }
 
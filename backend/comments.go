@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCommentDepth is the deepest reply allowed; top-level comments are depth 0.
+const maxCommentDepth = 3
+
+var (
+	errCommentDepth     = errors.New("replies cannot be nested any deeper")
+	errCommentParent    = errors.New("parent comment belongs to another chapter")
+	errCommentDeleted   = errors.New("comment has been deleted")
+	errCommentForbidden = errors.New("only the author can change this comment")
+	errInvalidReaction  = errors.New("reaction must be a single emoji")
+)
+
+// replyDepth validates parent as the target of a new reply on chapterID and
+// returns the depth of that reply.
+func replyDepth(parent *Comment, chapterID int) (int, error) {
+	switch {
+	case parent.ChapterID != chapterID:
+		return 0, errCommentParent
+	case parent.Deleted:
+		return 0, errCommentDeleted
+	case parent.Depth >= maxCommentDepth:
+		return 0, errCommentDepth
+	}
+	return parent.Depth + 1, nil
+}
+
+// normalizeReaction accepts a short run of non-ASCII symbols, which covers
+// emoji with skin tone modifiers and joiners.
+func normalizeReaction(raw string) (string, error) {
+	emoji := strings.TrimSpace(raw)
+	if emoji == "" || len(emoji) > 32 || utf8.RuneCountInString(emoji) > 8 {
+		return "", errInvalidReaction
+	}
+	for _, r := range emoji {
+		if r < utf8.RuneSelf || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+			return "", errInvalidReaction
+		}
+	}
+	return emoji, nil
+}
+
+// redactComment blanks what a soft-deleted comment showed while keeping its
+// place in the thread.
+func redactComment(comment *Comment) {
+	comment.Deleted = true
+	comment.Body = ""
+	comment.AuthorName = ""
+	comment.UserID = 0
+	comment.EditedAt = nil
+}
+
+// buildCommentThreads attaches replies (oldest first) under their parents,
+// starting from roots.
+func buildCommentThreads(roots []*Comment, replies []*Comment) {
+	byID := make(map[int]*Comment, len(roots)+len(replies))
+	for _, comment := range roots {
+		byID[comment.ID] = comment
+	}
+	for _, comment := range replies {
+		byID[comment.ID] = comment
+	}
+	sort.SliceStable(replies, func(i, j int) bool {
+		if replies[i].CreatedAt.Equal(replies[j].CreatedAt) {
+			return replies[i].ID < replies[j].ID
+		}
+		return replies[i].CreatedAt.Before(replies[j].CreatedAt)
+	})
+	for _, comment := range replies {
+		if comment.ParentID == nil {
+			continue
+		}
+		if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		}
+	}
+}
+
+// flattenCommentThreads lists each thread depth first, leaving ParentID to
+// describe the structure.
+func flattenCommentThreads(roots []*Comment) []*Comment {
+	items := make([]*Comment, 0, len(roots))
+	var walk func(comments []*Comment)
+	walk = func(comments []*Comment) {
+		for _, comment := range comments {
+			replies := comment.Replies
+			comment.Replies = nil
+			items = append(items, comment)
+			walk(replies)
+		}
+	}
+	walk(roots)
+	return items
+}
+
+func respondCommentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errCommentForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, errCommentDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errCommentDepth), errors.Is(err, errCommentParent), errors.Is(err, errInvalidReaction),
+		errors.Is(err, errCommentAnchor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondNotFound(c, err)
+	}
+}
@@ -14,17 +14,102 @@ type Config struct {
 	DBMaxConns         int
 	DBMaxIdleConns     int
 	DBConnMaxLifetime  time.Duration
+	DBAutoMigrate      bool
 	JWTSecret          string
 	JWTTTL             time.Duration
+	RefreshTTL         time.Duration
+	SessionCleanup     time.Duration
+	PasswordResetTTL   time.Duration
+	EmailVerifyTTL     time.Duration
+	RequireVerified    bool
+	OAuthProviders     []OAuthProvider
+	OAuthStateTTL      time.Duration
 	AdminEmails        []string
 	ModerationPassword string
+	ModerationStepUp   bool
+	StepUpTTL          time.Duration
+	RequireAdmin2FA    bool
+	TwoFactorKey       string
 	CorsOrigins        []string
+	SiteURL            string
+	APIURL             string
+	FeedCacheTTL       time.Duration
+	ReleaseInterval    time.Duration
+	ViewWindow         time.Duration
+	ViewHashSecret     string
+	HistoryRetention   time.Duration
+	HistoryCleanup     time.Duration
+	NotifyInterval     time.Duration
+	MailTransport      string
+	MailFrom           string
+	MailDir            string
+	SMTPHost           string
+	SMTPPort           int
+	SMTPUsername       string
+	SMTPPassword       string
+	MailInterval       time.Duration
+	DigestInterval     time.Duration
+	WebhookInterval    time.Duration
+	WebhookTimeout     time.Duration
 	TrustedProxies     []string
 	ServerReadTimeout  time.Duration
 	ServerWriteTimeout time.Duration
 	ServerIdleTimeout  time.Duration
 }
 
+// OAuthProvider is an external sign-in. Providers with an Issuer are OpenID
+// Connect and find their endpoints through discovery; the others list them.
+type OAuthProvider struct {
+	ID           string
+	Name         string
+	ClientID     string
+	ClientSecret string
+	Issuer       string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	Scopes       []string
+}
+
+// loadOAuthProviders returns the providers whose client ID is set, in the
+// order they are shown on the sign-in page.
+func loadOAuthProviders() []OAuthProvider {
+	providers := make([]OAuthProvider, 0)
+	if clientID := os.Getenv("DISCORD_CLIENT_ID"); clientID != "" {
+		providers = append(providers, OAuthProvider{
+			ID:           oauthDiscord,
+			Name:         "Discord",
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("DISCORD_CLIENT_SECRET"),
+			AuthURL:      "https://discord.com/oauth2/authorize",
+			TokenURL:     "https://discord.com/api/oauth2/token",
+			UserInfoURL:  "https://discord.com/api/users/@me",
+			Scopes:       []string{"identify", "email"},
+		})
+	}
+	if clientID := os.Getenv("GOOGLE_CLIENT_ID"); clientID != "" {
+		providers = append(providers, OAuthProvider{
+			ID:           oauthGoogle,
+			Name:         "Google",
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			Issuer:       "https://accounts.google.com",
+			Scopes:       []string{"openid", "email", "profile"},
+		})
+	}
+	if clientID := os.Getenv("OIDC_CLIENT_ID"); clientID != "" && os.Getenv("OIDC_ISSUER") != "" {
+		providers = append(providers, OAuthProvider{
+			ID:           oauthOIDC,
+			Name:         getEnv("OIDC_NAME", "Single sign-on"),
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			Issuer:       strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/"),
+			Scopes:       strings.Fields(getEnv("OIDC_SCOPES", "openid email profile")),
+		})
+	}
+	return providers
+}
+
 func LoadConfig() Config {
 	loadDotEnv()
 	return Config{
@@ -34,11 +119,43 @@ func LoadConfig() Config {
 		DBMaxConns:         getEnvInt("DB_MAX_CONNS", 10),
 		DBMaxIdleConns:     getEnvInt("DB_MAX_IDLE_CONNS", 5),
 		DBConnMaxLifetime:  getEnvDuration("DB_CONN_MAX_LIFETIME", "30m"),
+		DBAutoMigrate:      getEnvBool("DB_AUTO_MIGRATE", true),
 		JWTSecret:          getEnv("JWT_SECRET", "dev-secret"),
-		JWTTTL:             getEnvDuration("JWT_TTL", "24h"),
+		JWTTTL:             getEnvDuration("JWT_TTL", "15m"),
+		RefreshTTL:         getEnvDuration("REFRESH_TOKEN_TTL", "720h"),
+		SessionCleanup:     getEnvDuration("SESSION_CLEANUP_INTERVAL", "1h"),
+		PasswordResetTTL:   getEnvDuration("PASSWORD_RESET_TTL", "1h"),
+		EmailVerifyTTL:     getEnvDuration("EMAIL_VERIFY_TTL", "48h"),
+		RequireVerified:    getEnvBool("REQUIRE_VERIFIED_EMAIL", false),
+		OAuthProviders:     loadOAuthProviders(),
+		OAuthStateTTL:      getEnvDuration("OAUTH_STATE_TTL", "10m"),
 		AdminEmails:        getEnvList("ADMIN_EMAILS"),
 		ModerationPassword: os.Getenv("MODERATION_PASSWORD"),
+		ModerationStepUp:   getEnvBool("MODERATION_STEP_UP", false),
+		StepUpTTL:          getEnvDuration("STEP_UP_TTL", "10m"),
+		RequireAdmin2FA:    getEnvBool("REQUIRE_ADMIN_2FA", false),
+		TwoFactorKey:       getEnv("TWO_FACTOR_KEY", getEnv("JWT_SECRET", "dev-secret")),
 		CorsOrigins:        getEnvList("CORS_ORIGINS"),
+		SiteURL:            strings.TrimRight(getEnv("SITE_URL", "http://localhost:3000"), "/"),
+		APIURL:             strings.TrimRight(getEnv("API_URL", ""), "/"),
+		FeedCacheTTL:       getEnvDuration("FEED_CACHE_TTL", "2m"),
+		ReleaseInterval:    getEnvDuration("RELEASE_SCHEDULER_INTERVAL", "30s"),
+		ViewWindow:         getEnvDuration("VIEW_DEDUP_WINDOW", "30m"),
+		ViewHashSecret:     getEnv("VIEW_HASH_SECRET", getEnv("JWT_SECRET", "dev-secret")),
+		HistoryRetention:   time.Duration(getEnvInt("HISTORY_RETENTION_DAYS", 0)) * 24 * time.Hour,
+		HistoryCleanup:     getEnvDuration("HISTORY_CLEANUP_INTERVAL", "1h"),
+		NotifyInterval:     getEnvDuration("NOTIFICATION_INTERVAL", "10s"),
+		MailTransport:      strings.ToLower(getEnv("MAIL_TRANSPORT", "log")),
+		MailFrom:           getEnv("MAIL_FROM", "Novel Reader <no-reply@localhost>"),
+		MailDir:            getEnv("MAIL_DIR", "outbox"),
+		SMTPHost:           getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:           getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:       os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:       os.Getenv("SMTP_PASSWORD"),
+		MailInterval:       getEnvDuration("MAIL_INTERVAL", "30s"),
+		DigestInterval:     getEnvDuration("DIGEST_INTERVAL", "1h"),
+		WebhookInterval:    getEnvDuration("WEBHOOK_INTERVAL", "10s"),
+		WebhookTimeout:     getEnvDuration("WEBHOOK_TIMEOUT", "10s"),
 		TrustedProxies:     getEnvList("TRUSTED_PROXIES"),
 		ServerReadTimeout:  getEnvDuration("SERVER_READ_TIMEOUT", "15s"),
 		ServerWriteTimeout: getEnvDuration("SERVER_WRITE_TIMEOUT", "15s"),
@@ -66,6 +183,18 @@ func getEnvInt(key string, fallback int) int {
 	return parsed
 }
 
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
 func getEnvDuration(key, fallback string) time.Duration {
 	value := os.Getenv(key)
 	if value == "" {
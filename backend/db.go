@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"strings"
 	"time"
 
@@ -28,189 +27,21 @@ func OpenDB(cfg Config) (*sql.DB, error) {
 	return db, nil
 }
 
-func RunMigrations(db *sql.DB) error {
-	statements := []string{
-		`CREATE TABLE IF NOT EXISTS auth_users (
-			id SERIAL PRIMARY KEY,
-			name TEXT NOT NULL,
-			email TEXT NOT NULL UNIQUE,
-			password_hash TEXT NOT NULL,
-			role TEXT NOT NULL,
-			status TEXT NOT NULL DEFAULT 'active',
-			created_at TIMESTAMPTZ NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS novels (
-			id SERIAL PRIMARY KEY,
-			slug TEXT NOT NULL UNIQUE,
-			title TEXT NOT NULL,
-			author TEXT NOT NULL,
-			summary TEXT NOT NULL,
-			tags TEXT[] NOT NULL DEFAULT '{}',
-			cover_url TEXT NOT NULL DEFAULT '',
-			status TEXT NOT NULL DEFAULT 'ongoing',
-			created_at TIMESTAMPTZ NOT NULL,
-			updated_at TIMESTAMPTZ NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS chapters (
-			id SERIAL PRIMARY KEY,
-			novel_id INTEGER NOT NULL REFERENCES novels(id) ON DELETE CASCADE,
-			number INTEGER NOT NULL,
-			volume INTEGER NOT NULL DEFAULT 1,
-			title TEXT NOT NULL,
-			content TEXT NOT NULL,
-			word_count INTEGER NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL,
-			updated_at TIMESTAMPTZ NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS comments (
-			id SERIAL PRIMARY KEY,
-			chapter_id INTEGER NOT NULL REFERENCES chapters(id) ON DELETE CASCADE,
-			user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
-			body TEXT NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS ratings (
-			id SERIAL PRIMARY KEY,
-			novel_id INTEGER NOT NULL REFERENCES novels(id) ON DELETE CASCADE,
-			user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
-			score INTEGER NOT NULL,
-			note TEXT NOT NULL DEFAULT '',
-			at TIMESTAMPTZ NOT NULL,
-			UNIQUE (novel_id, user_id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS reading_history (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
-			novel_slug TEXT NOT NULL,
-			novel_title TEXT NOT NULL,
-			chapter_id INTEGER NOT NULL,
-			chapter_title TEXT NOT NULL,
-			read_at TIMESTAMPTZ NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS follows (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
-			novel_id INTEGER NOT NULL REFERENCES novels(id) ON DELETE CASCADE,
-			created_at TIMESTAMPTZ NOT NULL,
-			UNIQUE (user_id, novel_id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS bookmarks (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
-			novel_id INTEGER NOT NULL REFERENCES novels(id) ON DELETE CASCADE,
-			created_at TIMESTAMPTZ NOT NULL,
-			UNIQUE (user_id, novel_id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS site_settings (
-			id INTEGER PRIMARY KEY,
-			title TEXT NOT NULL,
-			tagline TEXT NOT NULL,
-			logo_url TEXT NOT NULL,
-			logo_alt TEXT NOT NULL DEFAULT '',
-			headline TEXT NOT NULL DEFAULT '',
-			hero_description TEXT NOT NULL DEFAULT '',
-			primary_button TEXT NOT NULL DEFAULT '',
-			secondary_button TEXT NOT NULL DEFAULT '',
-			accent_color TEXT NOT NULL DEFAULT '',
-			highlight_label TEXT NOT NULL DEFAULT '',
-			facebook_url TEXT NOT NULL DEFAULT '',
-			discord_url TEXT NOT NULL DEFAULT '',
-			footer_updates_label TEXT NOT NULL DEFAULT '',
-			footer_updates_url TEXT NOT NULL DEFAULT '',
-			footer_series_label TEXT NOT NULL DEFAULT '',
-			footer_series_url TEXT NOT NULL DEFAULT '',
-			footer_admin_label TEXT NOT NULL DEFAULT '',
-			footer_admin_url TEXT NOT NULL DEFAULT '',
-			footer_link4_label TEXT NOT NULL DEFAULT '',
-			footer_link4_url TEXT NOT NULL DEFAULT '',
-			footer_link5_label TEXT NOT NULL DEFAULT '',
-			footer_link5_url TEXT NOT NULL DEFAULT '',
-			updated_at TIMESTAMPTZ NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS announcements (
-			id SERIAL PRIMARY KEY,
-			title TEXT NOT NULL,
-			body TEXT NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS release_queue (
-			id SERIAL PRIMARY KEY,
-			novel_id INTEGER NOT NULL REFERENCES novels(id) ON DELETE CASCADE,
-			chapter_number INTEGER NOT NULL,
-			title TEXT NOT NULL,
-			status TEXT NOT NULL DEFAULT 'Queued',
-			eta TEXT NOT NULL DEFAULT '',
-			notes TEXT NOT NULL DEFAULT '',
-			created_at TIMESTAMPTZ NOT NULL,
-			updated_at TIMESTAMPTZ NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS moderation_reports (
-			id SERIAL PRIMARY KEY,
-			novel_id INTEGER REFERENCES novels(id) ON DELETE SET NULL,
-			novel_title TEXT NOT NULL DEFAULT '',
-			note TEXT NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS illustrations (
-			id SERIAL PRIMARY KEY,
-			url TEXT NOT NULL,
-			original_name TEXT NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL
-		)`,
-		`CREATE INDEX IF NOT EXISTS reading_history_user_id_idx ON reading_history(user_id)`,
-		`CREATE INDEX IF NOT EXISTS chapters_novel_id_idx ON chapters(novel_id)`,
-		`CREATE INDEX IF NOT EXISTS comments_chapter_id_idx ON comments(chapter_id)`,
-		`CREATE INDEX IF NOT EXISTS ratings_novel_id_idx ON ratings(novel_id)`,
-		`CREATE INDEX IF NOT EXISTS follows_user_id_idx ON follows(user_id)`,
-		`ALTER TABLE chapters ADD COLUMN IF NOT EXISTS volume INTEGER NOT NULL DEFAULT 1`,
-		`ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS logo_alt TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS headline TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS hero_description TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS primary_button TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS secondary_button TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS accent_color TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS highlight_label TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS facebook_url TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS discord_url TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS footer_updates_label TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS footer_updates_url TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS footer_series_label TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS footer_series_url TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS footer_admin_label TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS footer_admin_url TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS footer_link4_label TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS footer_link4_url TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS footer_link5_label TEXT NOT NULL DEFAULT ''`,
-		`ALTER TABLE site_settings ADD COLUMN IF NOT EXISTS footer_link5_url TEXT NOT NULL DEFAULT ''`,
-		`CREATE INDEX IF NOT EXISTS bookmarks_user_id_idx ON bookmarks(user_id)`,
-		`CREATE INDEX IF NOT EXISTS announcements_created_at_idx ON announcements(created_at)`,
-		`CREATE INDEX IF NOT EXISTS release_queue_created_at_idx ON release_queue(created_at)`,
-		`CREATE INDEX IF NOT EXISTS release_queue_novel_id_idx ON release_queue(novel_id)`,
-		`CREATE INDEX IF NOT EXISTS moderation_reports_created_at_idx ON moderation_reports(created_at)`,
-		`CREATE INDEX IF NOT EXISTS illustrations_created_at_idx ON illustrations(created_at)`,
-	}
-
-	for i, stmt := range statements {
-		if _, err := db.Exec(stmt); err != nil {
-			return fmt.Errorf("migration %d failed: %w", i+1, err)
-		}
-	}
-	if err := migrateChapterContentToText(db); err != nil {
-		return fmt.Errorf("chapter content migration failed: %w", err)
-	}
-	return nil
-}
-
-func migrateChapterContentToText(db *sql.DB) error {
-	rows, err := db.Query(
+// migrateChapterContentToText rewrites chapters still stored as Plate JSON into
+// the plain-text format. Rows are read up front because the transaction's
+// connection cannot run updates while a result set is open.
+func migrateChapterContentToText(tx *sql.Tx) error {
+	rows, err := tx.Query(
 		`SELECT id, content FROM chapters WHERE content LIKE '[%' OR content LIKE '{%'`,
 	)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-
+	type pending struct {
+		id   int
+		text string
+	}
+	updates := make([]pending, 0)
 	for rows.Next() {
 		var id int
 		var content string
@@ -221,18 +52,27 @@ func migrateChapterContentToText(db *sql.DB) error {
 		if !ok || strings.TrimSpace(text) == "" {
 			continue
 		}
-		_, err := db.Exec(
+		updates = append(updates, pending{id: id, text: text})
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+
+	for _, item := range updates {
+		_, err := tx.Exec(
 			`UPDATE chapters SET content = $1, word_count = $2, updated_at = $3 WHERE id = $4`,
-			text,
-			len(strings.Fields(text)),
+			item.text,
+			len(strings.Fields(item.text)),
 			time.Now(),
-			id,
+			item.id,
 		)
 		if err != nil {
 			return err
 		}
 	}
-	return rows.Err()
+	return nil
 }
 
 func plateJSONToText(raw string) (string, bool) {
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	diffEqual  = "equal"
+	diffInsert = "insert"
+	diffDelete = "delete"
+
+	// maxDiffEdits bounds the Myers search; past it the changed middle is
+	// reported as one delete and one insert.
+	maxDiffEdits = 2000
+)
+
+var diffTokenPattern = regexp.MustCompile(`\s+|[^\s]+`)
+
+type diffEdit struct {
+	op    string
+	token string
+}
+
+// diffWords returns a word-level diff of a and b. Whitespace runs are kept as
+// tokens so the ops concatenate back into either text.
+func diffWords(a, b string) ([]DiffOp, int, int) {
+	x := diffTokenPattern.FindAllString(a, -1)
+	y := diffTokenPattern.FindAllString(b, -1)
+
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]diffEdit, 0, len(x)+len(y))
+	for _, token := range x[:prefix] {
+		edits = append(edits, diffEdit{diffEqual, token})
+	}
+	middle, ok := myersDiff(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])
+	if !ok {
+		middle = middle[:0]
+		for _, token := range x[prefix : len(x)-suffix] {
+			middle = append(middle, diffEdit{diffDelete, token})
+		}
+		for _, token := range y[prefix : len(y)-suffix] {
+			middle = append(middle, diffEdit{diffInsert, token})
+		}
+	}
+	edits = append(edits, middle...)
+	for _, token := range x[len(x)-suffix:] {
+		edits = append(edits, diffEdit{diffEqual, token})
+	}
+
+	ops := make([]DiffOp, 0)
+	added, removed := 0, 0
+	for _, edit := range edits {
+		if strings.TrimSpace(edit.token) != "" {
+			switch edit.op {
+			case diffInsert:
+				added++
+			case diffDelete:
+				removed++
+			}
+		}
+		if len(ops) > 0 && ops[len(ops)-1].Op == edit.op {
+			ops[len(ops)-1].Text += edit.token
+			continue
+		}
+		ops = append(ops, DiffOp{Op: edit.op, Text: edit.token})
+	}
+	return ops, added, removed
+}
+
+// myersDiff is the greedy O(ND) shortest edit script. It keeps the frontier
+// of every step for the backtrack, so it gives up after maxDiffEdits.
+func myersDiff(x, y []string) ([]diffEdit, bool) {
+	n, m := len(x), len(y)
+	limit := n + m
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	trace := make([][]int, 0)
+
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		if d > maxDiffEdits {
+			return nil, false
+		}
+		for k := -d; k <= d; k += 2 {
+			var i int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				i = v[offset+k+1]
+			} else {
+				i = v[offset+k-1] + 1
+			}
+			j := i - k
+			for i < n && j < m && x[i] == y[j] {
+				i++
+				j++
+			}
+			v[offset+k] = i
+			if i >= n && j >= m {
+				found = true
+				break
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+
+	edits := make([]diffEdit, 0, n+m)
+	i, j := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := i - j
+		var prevK int
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevI := prev[prevK+d-1]
+		prevJ := prevI - prevK
+		for i > prevI && j > prevJ {
+			i--
+			j--
+			edits = append(edits, diffEdit{diffEqual, x[i]})
+		}
+		if i == prevI {
+			edits = append(edits, diffEdit{diffInsert, y[prevJ]})
+		} else {
+			edits = append(edits, diffEdit{diffDelete, x[prevI]})
+		}
+		i, j = prevI, prevJ
+	}
+	for i > 0 && j > 0 {
+		i--
+		j--
+		edits = append(edits, diffEdit{diffEqual, x[i]})
+	}
+	for left, right := 0, len(edits)-1; left < right; left, right = left+1, right-1 {
+		edits[left], edits[right] = edits[right], edits[left]
+	}
+	return edits, true
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		ops     []DiffOp
+		added   int
+		removed int
+	}{
+		{
+			name: "identical",
+			a:    "the night was long",
+			b:    "the night was long",
+			ops:  []DiffOp{{Op: diffEqual, Text: "the night was long"}},
+		},
+		{
+			name: "both empty",
+			ops:  []DiffOp{},
+		},
+		{
+			name:  "from empty",
+			b:     "new text",
+			ops:   []DiffOp{{Op: diffInsert, Text: "new text"}},
+			added: 2,
+		},
+		{
+			name:    "to empty",
+			a:       "old text",
+			ops:     []DiffOp{{Op: diffDelete, Text: "old text"}},
+			removed: 2,
+		},
+		{
+			name: "replaced word",
+			a:    "the night was long",
+			b:    "the night was short",
+			ops: []DiffOp{
+				{Op: diffEqual, Text: "the night was "},
+				{Op: diffDelete, Text: "long"},
+				{Op: diffInsert, Text: "short"},
+			},
+			added:   1,
+			removed: 1,
+		},
+		{
+			name: "inserted in the middle",
+			a:    "she drew her sword",
+			b:    "she slowly drew her sword",
+			ops: []DiffOp{
+				{Op: diffEqual, Text: "she "},
+				{Op: diffInsert, Text: "slowly "},
+				{Op: diffEqual, Text: "drew her sword"},
+			},
+			added: 1,
+		},
+		{
+			name: "removed at the start",
+			a:    "Chapter one begins",
+			b:    "one begins",
+			ops: []DiffOp{
+				{Op: diffDelete, Text: "Chapter "},
+				{Op: diffEqual, Text: "one begins"},
+			},
+			removed: 1,
+		},
+		{
+			name: "whitespace only",
+			a:    "a b",
+			b:    "a  b",
+			ops: []DiffOp{
+				{Op: diffEqual, Text: "a"},
+				{Op: diffDelete, Text: " "},
+				{Op: diffInsert, Text: "  "},
+				{Op: diffEqual, Text: "b"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, added, removed := diffWords(tt.a, tt.b)
+			if !reflect.DeepEqual(ops, tt.ops) {
+				t.Errorf("ops = %#v, want %#v", ops, tt.ops)
+			}
+			if added != tt.added || removed != tt.removed {
+				t.Errorf("added, removed = %d, %d, want %d, %d", added, removed, tt.added, tt.removed)
+			}
+		})
+	}
+}
+
+// The ops must rebuild both texts, including for edits past maxDiffEdits
+// where the changed middle is reported whole.
+func TestDiffWordsReconstructs(t *testing.T) {
+	long := func(word string) string {
+		return strings.TrimSpace(strings.Repeat(word+" ", maxDiffEdits))
+	}
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"reordered", "one two three four", "four three two one"},
+		{"multiline", "First line.\n\nSecond line.", "First line.\nInserted.\n\nSecond line!"},
+		{"past the edit limit", "start " + long("old") + " end", "start " + long("new") + " end"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, _, _ := diffWords(tt.a, tt.b)
+			var before, after strings.Builder
+			for _, op := range ops {
+				if op.Op != diffInsert {
+					before.WriteString(op.Text)
+				}
+				if op.Op != diffDelete {
+					after.WriteString(op.Text)
+				}
+			}
+			if before.String() != tt.a {
+				t.Errorf("old side = %q, want %q", before.String(), tt.a)
+			}
+			if after.String() != tt.b {
+				t.Errorf("new side = %q, want %q", after.String(), tt.b)
+			}
+		})
+	}
+}
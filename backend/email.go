@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"novelreader/mail"
+)
+
+const (
+	outboxPending = "pending"
+	outboxSent    = "sent"
+	outboxFailed  = "failed"
+
+	// maxMailAttempts is how often delivery is tried before a message is
+	// marked failed.
+	maxMailAttempts = 8
+	mailBatch       = 20
+
+	digestOff    = "off"
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+)
+
+var (
+	errInvalidDigest = errors.New("digest must be off, daily or weekly")
+	errOutboxSent    = errors.New("message was already sent")
+)
+
+// digestPeriods is how long each digest mode waits between emails.
+var digestPeriods = map[string]time.Duration{
+	digestDaily:  24 * time.Hour,
+	digestWeekly: 7 * 24 * time.Hour,
+}
+
+func normalizeDigest(raw string) (string, error) {
+	switch value := strings.ToLower(strings.TrimSpace(raw)); value {
+	case digestOff, digestDaily, digestWeekly:
+		return value, nil
+	default:
+		return "", errInvalidDigest
+	}
+}
+
+func respondMailError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errOutboxSent):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errInvalidDigest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondNotFound(c, err)
+	}
+}
+
+func newMailer(cfg Config) mail.Mailer {
+	switch cfg.MailTransport {
+	case "smtp":
+		return &mail.SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}
+	case "file":
+		return &mail.FileMailer{Dir: cfg.MailDir, From: cfg.MailFrom}
+	default:
+		return mail.LogMailer{}
+	}
+}
+
+func mailBranding(settings *SiteSettings, siteURL string) mail.Branding {
+	brand := mail.Branding{SiteName: "Novel Reader", SiteURL: siteURL}
+	if settings != nil {
+		if settings.Title != "" {
+			brand.SiteName = settings.Title
+		}
+		brand.Tagline = settings.Tagline
+		brand.LogoURL = settings.LogoURL
+		brand.AccentColor = settings.AccentColor
+	}
+	return brand
+}
+
+// renderMail renders a template with the current site branding, falling back
+// to the defaults when the settings cannot be read.
+func renderMail(repo Repository, siteURL string, name string, to string, data any) (mail.Message, error) {
+	settings, _ := repo.GetSiteSettings()
+	return mail.Render(name, to, mailBranding(settings, siteURL), data)
+}
+
+type digestData struct {
+	Name         string
+	Period       string
+	PeriodName   string
+	ChapterCount int
+	Novels       []digestNovel
+}
+
+type digestNovel struct {
+	Title    string
+	Chapters []digestChapter
+}
+
+type digestChapter struct {
+	Number int
+	Title  string
+	URL    string
+}
+
+// buildDigest groups chapters by novel, keeping their order.
+func buildDigest(recipient *DigestRecipient, chapters []*DigestChapter, siteURL string) digestData {
+	data := digestData{Name: recipient.Name, Period: recipient.Digest, PeriodName: "this week", ChapterCount: len(chapters)}
+	if recipient.Digest == digestDaily {
+		data.PeriodName = "today"
+	}
+	index := make(map[int]int)
+	for _, chapter := range chapters {
+		position, ok := index[chapter.NovelID]
+		if !ok {
+			position = len(data.Novels)
+			index[chapter.NovelID] = position
+			data.Novels = append(data.Novels, digestNovel{Title: chapter.NovelTitle})
+		}
+		data.Novels[position].Chapters = append(data.Novels[position].Chapters, digestChapter{
+			Number: chapter.Number,
+			Title:  chapter.Title,
+			URL:    siteURL + "/read/" + chapter.NovelSlug + "/" + strconv.Itoa(chapter.ChapterID),
+		})
+	}
+	return data
+}
+
+// queueDigests puts a digest in the outbox for every reader whose period has
+// passed and who has new chapters; readers with nothing new just move their
+// window forward. It returns how many digests were rendered.
+func queueDigests(repo Repository, siteURL string, now time.Time) (int, error) {
+	recipients, err := repo.ListDueDigests(now)
+	if err != nil {
+		return 0, err
+	}
+	queued := 0
+	for _, recipient := range recipients {
+		since := now.Add(-digestPeriods[recipient.Digest])
+		if recipient.LastSentAt != nil {
+			since = *recipient.LastSentAt
+		}
+		chapters, err := repo.ListDigestChapters(recipient.UserID, since, now)
+		if err != nil {
+			return queued, err
+		}
+		var msg *mail.Message
+		if len(chapters) > 0 {
+			rendered, err := renderMail(repo, siteURL, "digest", recipient.Email, buildDigest(recipient, chapters, siteURL))
+			if err != nil {
+				return queued, err
+			}
+			msg = &rendered
+			queued++
+		}
+		if err := repo.CompleteDigest(recipient, now, msg); err != nil {
+			return queued, err
+		}
+	}
+	return queued, nil
+}
+
+// runMailDispatcher delivers due outbox messages every interval until ctx is
+// cancelled. Rows are claimed with SKIP LOCKED, so every replica may run it.
+func runMailDispatcher(ctx context.Context, repo Repository, mailer mail.Mailer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		processed, err := repo.DeliverOutbox(mailer, mailBatch)
+		if err != nil {
+			log.Printf("mail dispatcher: %v", err)
+		}
+		if err == nil && processed == mailBatch && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDigestScheduler queues due digests every interval until ctx is
+// cancelled.
+func runDigestScheduler(ctx context.Context, repo Repository, siteURL string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		queued, err := queueDigests(repo, siteURL, time.Now())
+		if err != nil {
+			log.Printf("digest scheduler: %v", err)
+		} else if queued > 0 {
+			log.Printf("digest scheduler: queued %d digests", queued)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
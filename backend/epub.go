@@ -0,0 +1,421 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var imageMarkerCapture = regexp.MustCompile(`\[\[img:([^\]]+)\]\]`)
+
+type epubChapter struct {
+	ID     string
+	File   string
+	Title  string
+	Number int
+	Volume int
+	Body   string
+}
+
+type epubVolume struct {
+	Number   int
+	Chapters []*epubChapter
+}
+
+type epubImage struct {
+	ID        string
+	File      string
+	MediaType string
+	Source    string
+	Cover     bool
+}
+
+type epubPackage struct {
+	Identifier  string
+	Title       string
+	Author      string
+	Summary     string
+	Tags        []string
+	Language    string
+	Modified    string
+	Cover       *epubImage
+	Images      []*epubImage
+	Chapters    []*epubChapter
+	Volumes     []*epubVolume
+	SummaryHTML string
+}
+
+// epubBuilder collects the images referenced by chapters so each file under
+// ./uploads is packaged once.
+type epubBuilder struct {
+	uploadsDir string
+	images     map[string]*epubImage
+	order      []*epubImage
+}
+
+// filterExportChapters keeps the chapters inside the requested volume and
+// chapter-number range; zero values leave that bound open.
+func filterExportChapters(chapters []*Chapter, volume, from, to int) []*Chapter {
+	items := make([]*Chapter, 0, len(chapters))
+	for _, chapter := range chapters {
+		if volume > 0 && chapter.Volume != volume {
+			continue
+		}
+		if from > 0 && chapter.Number < from {
+			continue
+		}
+		if to > 0 && chapter.Number > to {
+			continue
+		}
+		items = append(items, chapter)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Volume != items[j].Volume {
+			return items[i].Volume < items[j].Volume
+		}
+		return items[i].Number < items[j].Number
+	})
+	return items
+}
+
+// buildEPUB renders novel and chapters as an EPUB 3 package.
+func buildEPUB(w io.Writer, novel *Novel, chapters []*Chapter, uploadsDir string) error {
+	builder := &epubBuilder{uploadsDir: uploadsDir, images: make(map[string]*epubImage)}
+	pkg := &epubPackage{
+		Identifier:  fmt.Sprintf("urn:novelreader:novel:%d", novel.ID),
+		Title:       novel.Title,
+		Author:      novel.Author,
+		Summary:     novel.Summary,
+		Tags:        novel.Tags,
+		Language:    "en",
+		SummaryHTML: renderChapterBody(novel.Summary, nil),
+	}
+	if cover := builder.addImage(novel.CoverURL); cover != nil {
+		cover.Cover = true
+		pkg.Cover = cover
+	}
+
+	modified := novel.UpdatedAt
+	volumes := make(map[int]*epubVolume)
+	for i, chapter := range chapters {
+		item := &epubChapter{
+			ID:     fmt.Sprintf("chapter-%04d", i+1),
+			File:   fmt.Sprintf("chapters/chapter-%04d.xhtml", i+1),
+			Title:  chapter.Title,
+			Number: chapter.Number,
+			Volume: chapter.Volume,
+		}
+		item.Body = renderChapterBody(chapter.Content, builder)
+		pkg.Chapters = append(pkg.Chapters, item)
+
+		volume, ok := volumes[chapter.Volume]
+		if !ok {
+			volume = &epubVolume{Number: chapter.Volume}
+			volumes[chapter.Volume] = volume
+			pkg.Volumes = append(pkg.Volumes, volume)
+		}
+		volume.Chapters = append(volume.Chapters, item)
+		if chapter.UpdatedAt.After(modified) {
+			modified = chapter.UpdatedAt
+		}
+	}
+	pkg.Images = builder.order
+	pkg.Modified = modified.UTC().Format("2006-01-02T15:04:05Z")
+
+	archive := zip.NewWriter(w)
+	// The mimetype entry must come first and be stored uncompressed.
+	mimetypeWriter, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetypeWriter, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name     string
+		template *template.Template
+		data     any
+	}{
+		{"META-INF/container.xml", epubContainerTemplate, pkg},
+		{"OEBPS/content.opf", epubPackageTemplate, pkg},
+		{"OEBPS/nav.xhtml", epubNavTemplate, pkg},
+		{"OEBPS/title.xhtml", epubTitleTemplate, pkg},
+	}
+	for _, file := range files {
+		var buf bytes.Buffer
+		if err := file.template.Execute(&buf, file.data); err != nil {
+			return err
+		}
+		if err := writeZipFile(archive, file.name, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := writeZipFile(archive, "OEBPS/style.css", []byte(epubStylesheet)); err != nil {
+		return err
+	}
+	for _, chapter := range pkg.Chapters {
+		var buf bytes.Buffer
+		if err := epubChapterTemplate.Execute(&buf, chapter); err != nil {
+			return err
+		}
+		if err := writeZipFile(archive, "OEBPS/"+chapter.File, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	for _, image := range pkg.Images {
+		contents, err := os.ReadFile(image.Source)
+		if err != nil {
+			return err
+		}
+		if err := writeZipFile(archive, "OEBPS/"+image.File, contents); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func writeZipFile(archive *zip.Writer, name string, contents []byte) error {
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(contents)
+	return err
+}
+
+// addImage registers an upload for packaging. URLs that do not point at an
+// existing file under ./uploads are ignored.
+func (b *epubBuilder) addImage(url string) *epubImage {
+	source := localUploadPath(url, b.uploadsDir)
+	if source == "" {
+		return nil
+	}
+	if image, ok := b.images[source]; ok {
+		return image
+	}
+	ext := strings.ToLower(filepath.Ext(source))
+	mediaType := mime.TypeByExtension(ext)
+	if ext == ".jpg" || ext == ".jpeg" {
+		mediaType = "image/jpeg"
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil
+	}
+	image := &epubImage{
+		ID:        fmt.Sprintf("image-%03d", len(b.order)+1),
+		File:      fmt.Sprintf("images/image-%03d%s", len(b.order)+1, ext),
+		MediaType: strings.Split(mediaType, ";")[0],
+		Source:    source,
+	}
+	b.images[source] = image
+	b.order = append(b.order, image)
+	return image
+}
+
+// localUploadPath maps an /uploads/... URL (absolute or relative) to the file
+// in uploadsDir, refusing anything that would escape it.
+func localUploadPath(url, uploadsDir string) string {
+	url = strings.TrimSpace(url)
+	index := strings.Index(url, "/uploads/")
+	if index < 0 {
+		return ""
+	}
+	name := url[index+len("/uploads/"):]
+	if cut := strings.IndexAny(name, "?#"); cut >= 0 {
+		name = name[:cut]
+	}
+	if name == "" || strings.Contains(name, "/") || strings.Contains(name, "\\") || strings.Contains(name, "..") {
+		return ""
+	}
+	source := filepath.Join(uploadsDir, name)
+	info, err := os.Stat(source)
+	if err != nil || info.IsDir() {
+		return ""
+	}
+	return source
+}
+
+// renderChapterBody turns plain-text chapter content (blank-line separated
+// paragraphs with [[img:url]] markers) into XHTML. When builder is nil image
+// markers are dropped.
+func renderChapterBody(content string, builder *epubBuilder) string {
+	var out strings.Builder
+	for _, paragraph := range splitParagraphs(content) {
+		var text strings.Builder
+		last := 0
+		for _, match := range imageMarkerCapture.FindAllStringSubmatchIndex(paragraph, -1) {
+			text.WriteString(escapeParagraphText(paragraph[last:match[0]]))
+			last = match[1]
+			if builder == nil {
+				continue
+			}
+			if image := builder.addImage(paragraph[match[2]:match[3]]); image != nil {
+				if strings.TrimSpace(text.String()) != "" {
+					out.WriteString("<p>" + strings.TrimSpace(text.String()) + "</p>\n")
+				}
+				text.Reset()
+				out.WriteString(`<div class="illustration"><img src="../` + image.File + `" alt=""/></div>` + "\n")
+			}
+		}
+		text.WriteString(escapeParagraphText(paragraph[last:]))
+		if trimmed := strings.TrimSpace(text.String()); trimmed != "" {
+			out.WriteString("<p>" + trimmed + "</p>\n")
+		}
+	}
+	return out.String()
+}
+
+func escapeParagraphText(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = html.EscapeString(strings.TrimSpace(line))
+	}
+	return strings.Join(lines, "<br/>")
+}
+
+// splitParagraphs splits chapter content on the blank lines serializePlateValue
+// places between blocks.
+func splitParagraphs(content string) []string {
+	normalized := strings.ReplaceAll(content, "\r\n", "\n")
+	parts := strings.Split(normalized, "\n\n")
+	paragraphs := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			paragraphs = append(paragraphs, trimmed)
+		}
+	}
+	return paragraphs
+}
+
+var epubTemplateFuncs = template.FuncMap{
+	"xml": func(value string) string {
+		var buf bytes.Buffer
+		_ = xml.EscapeText(&buf, []byte(value))
+		return buf.String()
+	},
+}
+
+var epubContainerTemplate = template.Must(template.New("container").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`))
+
+var epubPackageTemplate = template.Must(template.New("opf").Funcs(epubTemplateFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{.Language}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{xml .Identifier}}</dc:identifier>
+    <dc:title>{{xml .Title}}</dc:title>
+    <dc:creator>{{xml .Author}}</dc:creator>
+    <dc:language>{{.Language}}</dc:language>
+    <dc:description>{{xml .Summary}}</dc:description>
+{{- range .Tags}}
+    <dc:subject>{{xml .}}</dc:subject>
+{{- end}}
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+{{- if .Cover}}
+    <meta name="cover" content="{{.Cover.ID}}"/>
+{{- end}}
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="title-page" href="title.xhtml" media-type="application/xhtml+xml"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+{{- range .Chapters}}
+    <item id="{{.ID}}" href="{{.File}}" media-type="application/xhtml+xml"/>
+{{- end}}
+{{- range .Images}}
+    <item id="{{.ID}}" href="{{.File}}" media-type="{{.MediaType}}"{{if .Cover}} properties="cover-image"{{end}}/>
+{{- end}}
+  </manifest>
+  <spine>
+    <itemref idref="title-page"/>
+{{- range .Chapters}}
+    <itemref idref="{{.ID}}"/>
+{{- end}}
+  </spine>
+</package>
+`))
+
+var epubNavTemplate = template.Must(template.New("nav").Funcs(epubTemplateFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language}}">
+<head>
+  <title>{{xml .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>Contents</h1>
+    <ol>
+{{- range .Volumes}}
+      <li>
+        <a href="{{(index .Chapters 0).File}}">Volume {{.Number}}</a>
+        <ol>
+{{- range .Chapters}}
+          <li><a href="{{.File}}">Chapter {{.Number}}: {{xml .Title}}</a></li>
+{{- end}}
+        </ol>
+      </li>
+{{- end}}
+    </ol>
+  </nav>
+</body>
+</html>
+`))
+
+var epubTitleTemplate = template.Must(template.New("title").Funcs(epubTemplateFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="{{.Language}}">
+<head>
+  <title>{{xml .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body class="title-page">
+{{- if .Cover}}
+  <div class="cover"><img src="{{.Cover.File}}" alt="{{xml .Title}}"/></div>
+{{- end}}
+  <h1>{{xml .Title}}</h1>
+  <p class="author">{{xml .Author}}</p>
+  {{.SummaryHTML}}
+</body>
+</html>
+`))
+
+var epubChapterTemplate = template.Must(template.New("chapter").Funcs(epubTemplateFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+  <title>{{xml .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="../style.css"/>
+</head>
+<body>
+  <section epub:type="chapter">
+    <h2>Chapter {{.Number}}: {{xml .Title}}</h2>
+    {{.Body}}
+  </section>
+</body>
+</html>
+`))
+
+const epubStylesheet = `body { font-family: serif; line-height: 1.5; margin: 0 5%; }
+h1, h2 { text-align: center; }
+p { text-indent: 1.5em; margin: 0 0 0.6em 0; }
+.author { text-align: center; font-style: italic; text-indent: 0; }
+.illustration, .cover { text-align: center; margin: 1em 0; }
+.illustration img, .cover img { max-width: 100%; }
+`
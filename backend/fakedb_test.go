@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+)
+
+// fakeTables stands in for the tables a repository method touches so it can
+// run without Postgres. run answers one statement, with whitespace collapsed,
+// and returns its rows and affected count; begin, commit and rollback bracket
+// a transaction.
+type fakeTables interface {
+	run(query string, args []driver.Value) ([][]driver.Value, int64, error)
+	begin()
+	commit()
+	rollback()
+}
+
+func openFakeDB(tables fakeTables) *sql.DB {
+	return sql.OpenDB(fakeConn{tables})
+}
+
+type fakeConn struct {
+	tables fakeTables
+}
+
+func (c fakeConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c fakeConn) Driver() driver.Driver                        { return nil }
+func (c fakeConn) Close() error                                 { return nil }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{tables: c.tables, query: strings.Join(strings.Fields(query), " ")}, nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	c.tables.begin()
+	return c, nil
+}
+
+func (c fakeConn) Commit() error {
+	c.tables.commit()
+	return nil
+}
+
+func (c fakeConn) Rollback() error {
+	c.tables.rollback()
+	return nil
+}
+
+type fakeStmt struct {
+	tables fakeTables
+	query  string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	_, affected, err := s.tables.run(s.query, args)
+	return driver.RowsAffected(affected), err
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, _, err := s.tables.run(s.query, args)
+	return &fakeRows{rows: rows}, err
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
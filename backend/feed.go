@@ -0,0 +1,439 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const feedItemLimit = 50
+
+// feedDocument is the format-neutral form of a feed, rendered as RSS 2.0 or Atom.
+type feedDocument struct {
+	Title    string
+	Subtitle string
+	Link     string
+	SelfURL  string
+	Updated  time.Time
+	Items    []feedItem
+}
+
+type feedItem struct {
+	Title     string
+	Link      string
+	Author    string
+	Summary   string
+	Published time.Time
+	Updated   time.Time
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      rssLink   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	Author      string  `xml:"dc:creator,omitempty"`
+	Description string  `xml:"description"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr"`
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    *atomAuthor `xml:"author,omitempty"`
+	Summary   string      `xml:"summary"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+func renderRSS(doc *feedDocument) ([]byte, error) {
+	feed := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       doc.Title,
+			Link:        doc.Link,
+			Description: doc.Subtitle,
+			AtomLink:    rssLink{Href: doc.SelfURL, Rel: "self", Type: "application/rss+xml"},
+			Items:       make([]rssItem, 0, len(doc.Items)),
+		},
+	}
+	if !doc.Updated.IsZero() {
+		feed.Channel.LastBuildDate = doc.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, item := range doc.Items {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{Value: item.Link, IsPermaLink: "true"},
+			Author:      item.Author,
+			Description: item.Summary,
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+		})
+	}
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func renderAtom(doc *feedDocument) ([]byte, error) {
+	feed := atomFeed{
+		Title:    doc.Title,
+		Subtitle: doc.Subtitle,
+		ID:       doc.SelfURL,
+		Updated:  doc.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: doc.Link, Rel: "alternate", Type: "text/html"},
+			{Href: doc.SelfURL, Rel: "self", Type: "application/atom+xml"},
+		},
+		Entries: make([]atomEntry, 0, len(doc.Items)),
+	}
+	for _, item := range doc.Items {
+		entry := atomEntry{
+			Title:     item.Title,
+			ID:        item.Link,
+			Link:      atomLink{Href: item.Link, Rel: "alternate", Type: "text/html"},
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Updated:   item.Updated.UTC().Format(time.RFC3339),
+			Summary:   item.Summary,
+		}
+		if item.Author != "" {
+			entry.Author = &atomAuthor{Name: item.Author}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// feedExcerpt is the plain-text opening of a chapter used as an item summary.
+func feedExcerpt(content string, maxWords int) string {
+	words := strings.Fields(imageMarkerPattern.ReplaceAllString(content, " "))
+	if len(words) <= maxWords {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(words[:maxWords], " ") + " …"
+}
+
+func chapterFeedItem(cfg Config, novel *Novel, chapter *Chapter) feedItem {
+	return feedItem{
+		Title:     novel.Title + " — Chapter " + strconv.Itoa(chapter.Number) + ": " + chapter.Title,
+		Link:      cfg.SiteURL + "/read/" + novel.Slug + "/" + strconv.Itoa(chapter.ID),
+		Author:    novel.Author,
+		Summary:   feedExcerpt(chapter.Content, 80),
+		Published: chapter.CreatedAt,
+		Updated:   chapter.UpdatedAt,
+	}
+}
+
+func announcementFeedItem(cfg Config, item *Announcement) feedItem {
+	return feedItem{
+		Title:     item.Title,
+		Link:      cfg.SiteURL + "/updates#announcement-" + strconv.Itoa(item.ID),
+		Summary:   item.Body,
+		Published: item.CreatedAt,
+		Updated:   item.CreatedAt,
+	}
+}
+
+// newestFeedUpdate is the Last-Modified time of a feed.
+func newestFeedUpdate(items []feedItem, fallback time.Time) time.Time {
+	newest := fallback
+	for _, item := range items {
+		if item.Updated.After(newest) {
+			newest = item.Updated
+		}
+	}
+	return newest
+}
+
+type cachedFeed struct {
+	body         []byte
+	contentType  string
+	etag         string
+	lastModified time.Time
+	expires      time.Time
+}
+
+// feedCacheLimit caps how many rendered feeds are held at once.
+const feedCacheLimit = 512
+
+// feedCache keeps rendered feeds in memory for ttl so frequent polling by feed
+// readers is answered without touching the database. apiURL, when set, is the
+// origin used for absolute links in place of the request's host.
+type feedCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	apiURL  string
+	entries map[string]*cachedFeed
+}
+
+func newFeedCache(ttl time.Duration, apiURL string) *feedCache {
+	return &feedCache{ttl: ttl, apiURL: apiURL, entries: make(map[string]*cachedFeed)}
+}
+
+// baseURL is the origin feeds link to: API_URL, or else the scheme and host
+// the client used.
+func (f *feedCache) baseURL(c *gin.Context) string {
+	if f.apiURL != "" {
+		return f.apiURL
+	}
+	return requestBaseURL(c)
+}
+
+func (f *feedCache) get(key string) *cachedFeed {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	entry, ok := f.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil
+	}
+	return entry
+}
+
+func (f *feedCache) put(key string, entry *cachedFeed) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for existing, cached := range f.entries {
+		if now.After(cached.expires) {
+			delete(f.entries, existing)
+		}
+	}
+	if _, ok := f.entries[key]; !ok && len(f.entries) >= feedCacheLimit {
+		oldest := ""
+		for existing, cached := range f.entries {
+			if oldest == "" || cached.expires.Before(f.entries[oldest].expires) {
+				oldest = existing
+			}
+		}
+		delete(f.entries, oldest)
+	}
+	entry.expires = now.Add(f.ttl)
+	f.entries[key] = entry
+}
+
+// feedCacheKey identifies a feed by its route, path parameters and the query
+// parameters it reads, so unrelated query strings do not add entries. The
+// link origin is part of the key because rendered links are absolute.
+func feedCacheKey(c *gin.Context, base string, query ...string) string {
+	parts := []string{base, c.FullPath()}
+	for _, param := range c.Params {
+		parts = append(parts, param.Key+"="+param.Value)
+	}
+	for _, name := range query {
+		parts = append(parts, name+"="+c.Query(name))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// serveFeed renders a feed document as RSS or Atom through serveCachedXML.
+func serveFeed(c *gin.Context, cache *feedCache, format string, build func(selfURL string) (*feedDocument, error)) {
+	base := cache.baseURL(c)
+	serveCachedXML(c, cache, feedCacheKey(c, base), func() ([]byte, string, time.Time, error) {
+		doc, err := build(base + c.Request.URL.Path)
+		if err != nil {
+			return nil, "", time.Time{}, err
+		}
+		if format == "atom" {
+			body, err := renderAtom(doc)
+			return body, "application/atom+xml; charset=utf-8", doc.Updated, err
+		}
+		body, err := renderRSS(doc)
+		return body, "application/rss+xml; charset=utf-8", doc.Updated, err
+	})
+}
+
+// serveCachedXML answers a request from the cache entry under key when
+// possible, rebuilding the document with render otherwise, and honours
+// If-None-Match and If-Modified-Since.
+func serveCachedXML(c *gin.Context, cache *feedCache, key string, render func() ([]byte, string, time.Time, error)) {
+	entry := cache.get(key)
+	if entry == nil {
+		body, contentType, updated, err := render()
+		if err != nil {
+			respondListError(c, err)
+			return
+		}
+		sum := sha256.Sum256(body)
+		entry = &cachedFeed{
+			body:         body,
+			contentType:  contentType,
+			etag:         `"` + hex.EncodeToString(sum[:16]) + `"`,
+			lastModified: updated.UTC().Truncate(time.Second),
+		}
+		cache.put(key, entry)
+	}
+
+	c.Header("ETag", entry.etag)
+	if !entry.lastModified.IsZero() {
+		c.Header("Last-Modified", entry.lastModified.Format(http.TimeFormat))
+	}
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(cache.ttl.Seconds())))
+	if feedNotModified(c.Request, entry) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, entry.contentType, entry.body)
+}
+
+func feedNotModified(r *http.Request, entry *cachedFeed) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == entry.etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if since := r.Header.Get("If-Modified-Since"); since != "" && !entry.lastModified.IsZero() {
+		parsed, err := http.ParseTime(since)
+		return err == nil && !entry.lastModified.After(parsed)
+	}
+	return false
+}
+
+// requestBaseURL is the scheme and host the client used to reach the API.
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	} else if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func siteFeedTitle(repo Repository, suffix string) (string, string, time.Time) {
+	title, tagline, updated := "Nocturne Shelf", "", time.Time{}
+	if settings, err := repo.GetSiteSettings(); err == nil && settings != nil {
+		if strings.TrimSpace(settings.Title) != "" {
+			title = settings.Title
+		}
+		tagline, updated = settings.Tagline, settings.UpdatedAt
+	}
+	if suffix != "" {
+		title += " — " + suffix
+	}
+	return title, tagline, updated
+}
+
+func buildSiteFeed(repo Repository, cfg Config, selfURL string) (*feedDocument, error) {
+	chapters, err := repo.ListLatestChapters(feedItemLimit)
+	if err != nil {
+		return nil, err
+	}
+	novels := make(map[int]*Novel)
+	for _, novel := range repo.ListNovels() {
+		novels[novel.ID] = novel
+	}
+	title, tagline, updated := siteFeedTitle(repo, "")
+	doc := &feedDocument{Title: title, Subtitle: tagline, Link: cfg.SiteURL + "/updates", SelfURL: selfURL}
+	for _, chapter := range chapters {
+		if novel, ok := novels[chapter.NovelID]; ok {
+			doc.Items = append(doc.Items, chapterFeedItem(cfg, novel, chapter))
+		}
+	}
+	doc.Updated = newestFeedUpdate(doc.Items, updated)
+	return doc, nil
+}
+
+func buildNovelFeed(repo Repository, cfg Config, novelID int, selfURL string) (*feedDocument, error) {
+	novel, err := repo.GetNovel(novelID)
+	if err != nil {
+		return nil, err
+	}
+	if !isViewable(novel.Visibility) {
+		return nil, errNotFound
+	}
+	page, err := repo.QueryChapters(ChapterQuery{NovelID: novelID, Descending: true, Limit: feedItemLimit})
+	if err != nil {
+		return nil, err
+	}
+	doc := &feedDocument{
+		Title:    novel.Title,
+		Subtitle: novel.Summary,
+		Link:     cfg.SiteURL + "/novels/" + novel.Slug,
+		SelfURL:  selfURL,
+	}
+	for _, chapter := range page.Items {
+		doc.Items = append(doc.Items, chapterFeedItem(cfg, novel, chapter))
+	}
+	doc.Updated = newestFeedUpdate(doc.Items, novel.UpdatedAt)
+	return doc, nil
+}
+
+func buildAnnouncementsFeed(repo Repository, cfg Config, selfURL string) (*feedDocument, error) {
+	title, tagline, updated := siteFeedTitle(repo, "Announcements")
+	doc := &feedDocument{Title: title, Subtitle: tagline, Link: cfg.SiteURL + "/updates", SelfURL: selfURL}
+	for _, item := range repo.ListAnnouncements() {
+		doc.Items = append(doc.Items, announcementFeedItem(cfg, item))
+		if len(doc.Items) == feedItemLimit {
+			break
+		}
+	}
+	doc.Updated = newestFeedUpdate(doc.Items, updated)
+	return doc, nil
+}
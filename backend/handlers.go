@@ -1,7 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -10,31 +17,48 @@ import (
 )
 
 type NovelInput struct {
-	Title    string   `json:"title"`
-	Author   string   `json:"author"`
-	Summary  string   `json:"summary"`
-	Tags     []string `json:"tags"`
-	CoverURL string   `json:"coverUrl"`
-	Status   string   `json:"status"`
-	Slug     string   `json:"slug"`
+	Title      string   `json:"title"`
+	Author     string   `json:"author"`
+	Summary    string   `json:"summary"`
+	Tags       []string `json:"tags"`
+	CoverURL   string   `json:"coverUrl"`
+	Status     string   `json:"status"`
+	Slug       string   `json:"slug"`
+	Visibility string   `json:"visibility"`
 }
 
 type ChapterInput struct {
-	Number  int    `json:"number"`
-	Volume  int    `json:"volume"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	Number     int    `json:"number"`
+	Volume     int    `json:"volume"`
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	Visibility string `json:"visibility"`
+	// EditorID is the signed-in admin recorded on the revision.
+	EditorID int `json:"-"`
 }
 
 type CommentInput struct {
-	UserID int    `json:"userId"`
-	Body   string `json:"body"`
+	UserID   int    `json:"userId"`
+	ParentID int    `json:"parentId"`
+	Body     string `json:"body"`
+	// ParagraphIndex anchors a top-level comment; replies inherit the
+	// parent's anchor.
+	ParagraphIndex *int `json:"paragraphIndex"`
 }
 
+// RatingInput upserts a reader's rating. Review fields left out keep their
+// previous values, so score-only updates do not wipe a review.
 type RatingInput struct {
-	UserID int    `json:"userId"`
-	Score  int    `json:"score"`
-	Note   string `json:"note"`
+	UserID  int     `json:"userId"`
+	Score   int     `json:"score"`
+	Note    string  `json:"note"`
+	Title   *string `json:"title"`
+	Body    *string `json:"body"`
+	Spoiler *bool   `json:"spoiler"`
+}
+
+type RatingVoteInput struct {
+	Helpful bool `json:"helpful"`
 }
 
 type UserInput struct {
@@ -46,6 +70,12 @@ type UserRoleInput struct {
 	Role string `json:"role"`
 }
 
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
 type UserStatusInput struct {
 	Status string `json:"status"`
 }
@@ -54,33 +84,88 @@ type AuthRegisterInput struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
 	Role     string `json:"-"`
 }
 
 type AuthLoginInput struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
+}
+
+type AuthRefreshInput struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type OAuthCallbackInput struct {
+	Code   string `json:"code"`
+	State  string `json:"state"`
+	Device string `json:"device"`
+}
+
+type SessionInput struct {
+	Device    string
+	IP        string
+	UserAgent string
+	TwoFactor bool
+}
+
+type TwoFactorLoginInput struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code"`
+}
+
+type AuthForgotInput struct {
+	Email string `json:"email"`
+}
+
+type AuthResetInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type AuthVerifyInput struct {
+	Token string `json:"token"`
 }
 
 type AuthUserInfo struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Role      string    `json:"role"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID                 int        `json:"id"`
+	Name               string     `json:"name"`
+	Email              string     `json:"email"`
+	Role               string     `json:"role"`
+	Status             string     `json:"status"`
+	EmailVerifiedAt    *time.Time `json:"emailVerifiedAt"`
+	TwoFactorEnabledAt *time.Time `json:"twoFactorEnabledAt"`
+	Permissions        []string   `json:"permissions"`
+	CreatedAt          time.Time  `json:"createdAt"`
 }
 
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  AuthUserInfo `json:"user"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refreshToken"`
+	ExpiresAt    time.Time    `json:"expiresAt"`
+	User         AuthUserInfo `json:"user"`
 }
 
+// ReadingHistoryInput names the chapter that was opened; the novel is taken
+// from the chapter.
 type ReadingHistoryInput struct {
-	NovelSlug    string `json:"novelSlug"`
-	NovelTitle   string `json:"novelTitle"`
-	ChapterID    int    `json:"chapterId"`
-	ChapterTitle string `json:"chapterTitle"`
+	ChapterID int `json:"chapterId"`
+}
+
+type ReadingProgressInput struct {
+	ChapterID      int     `json:"chapterId"`
+	ScrollPercent  float64 `json:"scrollPercent"`
+	ParagraphIndex *int    `json:"paragraphIndex"`
+	Device         string  `json:"device"`
+	// ReadAt is the device clock when the position was reached; it decides
+	// which of two devices wins.
+	ReadAt *time.Time `json:"readAt"`
 }
 
 type NovelActionInput struct {
@@ -118,12 +203,15 @@ type AnnouncementInput struct {
 }
 
 type ReleaseQueueInput struct {
-	NovelID       int    `json:"novelId"`
-	ChapterNumber int    `json:"chapterNumber"`
-	Title         string `json:"title"`
-	Status        string `json:"status"`
-	Eta           string `json:"eta"`
-	Notes         string `json:"notes"`
+	NovelID       int        `json:"novelId"`
+	ChapterNumber int        `json:"chapterNumber"`
+	Volume        int        `json:"volume"`
+	Title         string     `json:"title"`
+	Content       string     `json:"content"`
+	Status        string     `json:"status"`
+	Eta           string     `json:"eta"`
+	Notes         string     `json:"notes"`
+	PublishAt     *time.Time `json:"publishAt"`
 }
 
 type ReleaseQueueStatusInput struct {
@@ -136,11 +224,101 @@ type ModerationReportInput struct {
 	Note       string `json:"note"`
 }
 
+type ImportOptions struct {
+	Format       string
+	HeadingLevel int
+	Volume       int
+	StartNumber  int
+	Visibility   string
+}
+
 type IllustrationInput struct {
 	URL          string `json:"url"`
 	OriginalName string `json:"originalName"`
 }
 
+type NovelQuery struct {
+	Tags     []string
+	MatchAll bool
+	Status   string
+	Author   string
+	Sort     string
+	Cursor   string
+	Limit    int
+	// IncludeHidden lists every visibility; Visibility then narrows to one.
+	IncludeHidden bool
+	Visibility    string
+}
+
+type ChapterQuery struct {
+	NovelID       int
+	Volume        int
+	Descending    bool
+	Cursor        string
+	Limit         int
+	IncludeHidden bool
+}
+
+type CommentQuery struct {
+	ChapterID int
+	// Paragraph limits the threads to one paragraph anchor when set.
+	Paragraph *int
+	Cursor    string
+	Limit     int
+}
+
+type RatingQuery struct {
+	NovelID int
+	// Sort is newest (default) or helpful.
+	Sort        string
+	ReviewsOnly bool
+	Cursor      string
+	Limit       int
+}
+
+type HistoryQuery struct {
+	UserID        int
+	NovelID       int
+	Cursor        string
+	Limit         int
+	IncludeHidden bool
+}
+
+type NotificationQuery struct {
+	UserID     int
+	UnreadOnly bool
+	Cursor     string
+	Limit      int
+}
+
+type NotificationPreferenceInput struct {
+	Notify bool `json:"notify"`
+}
+
+type EmailPreferencesInput struct {
+	Digest string `json:"digest"`
+}
+
+type WebhookInput struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Format string   `json:"format"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+type SearchQuery struct {
+	Text          string
+	Type          string
+	Tag           string
+	Status        string
+	NovelID       int
+	Limit         int
+	Offset        int
+	IncludeHidden bool
+}
+
 func normalizeRole(role string) string {
 	return strings.ToLower(strings.TrimSpace(role))
 }
@@ -149,15 +327,6 @@ func normalizeStatus(status string) string {
 	return strings.ToLower(strings.TrimSpace(status))
 }
 
-func isValidRole(role string) bool {
-	switch normalizeRole(role) {
-	case "admin", "user":
-		return true
-	default:
-		return false
-	}
-}
-
 func isValidStatus(status string) bool {
 	switch normalizeStatus(status) {
 	case "active", "banned":
@@ -211,12 +380,15 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		token, err := generateToken(user.ID, user.Role, cfg.JWTSecret, cfg.JWTTTL)
+		if err := sendAccountMail(repo, cfg, user, tokenEmailVerify); err != nil {
+			log.Printf("register: verification email for user %d: %v", user.ID, err)
+		}
+		response, err := startSession(c, repo, cfg, user, input.Device, false)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusCreated, AuthResponse{Token: token, User: toAuthUserInfo(user)})
+		c.JSON(http.StatusCreated, response)
 	})
 
 	router.POST("/auth/login", func(c *gin.Context) {
@@ -243,325 +415,708 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "account banned"})
 			return
 		}
-		token, err := generateToken(user.ID, user.Role, cfg.JWTSecret, cfg.JWTTTL)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, AuthResponse{Token: token, User: toAuthUserInfo(user)})
+		signIn(c, repo, cfg, user, input.Device, http.StatusOK)
 	})
-
-	me := router.Group("/me")
-	me.Use(userAuth(cfg.JWTSecret, repo))
-	me.GET("/history", func(c *gin.Context) {
-		userID := c.GetInt("userID")
-		items := repo.ListReadingHistory(userID)
-		c.JSON(http.StatusOK, items)
-	})
-	me.POST("/history", func(c *gin.Context) {
-		userID := c.GetInt("userID")
-		var input ReadingHistoryInput
+	router.POST("/auth/2fa", func(c *gin.Context) {
+		var input TwoFactorLoginInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if strings.TrimSpace(input.NovelSlug) == "" || strings.TrimSpace(input.ChapterTitle) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "novelSlug and chapterTitle are required"})
+		if input.Challenge == "" || input.Code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "challenge and code are required"})
 			return
 		}
-		entry, err := repo.AddReadingHistory(userID, input)
+		hash := hashAuthToken(input.Challenge)
+		userID, device, err := repo.GetTwoFactorChallenge(hash)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusCreated, entry)
-	})
-	me.DELETE("/history", func(c *gin.Context) {
-		userID := c.GetInt("userID")
-		if err := repo.ClearReadingHistory(userID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondTwoFactorError(c, err)
 			return
 		}
-		c.Status(http.StatusNoContent)
-	})
-
-	router.GET("/settings", func(c *gin.Context) {
-		settings, err := repo.GetSiteSettings()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := checkTwoFactor(repo, cfg, userID, input.Code); err != nil {
+			respondTwoFactorError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, settings)
-	})
-
-	router.GET("/announcements", func(c *gin.Context) {
-		items := repo.ListAnnouncements()
-		c.JSON(http.StatusOK, items)
-	})
-
-	router.GET("/novels", func(c *gin.Context) {
-		items := repo.ListNovels()
-		limit, offset := readPagination(c)
-		start, end := sliceRange(len(items), limit, offset)
-		c.JSON(http.StatusOK, items[start:end])
-	})
-
-	router.GET("/novels/stats", func(c *gin.Context) {
-		c.JSON(http.StatusOK, repo.ListNovelChapterStats())
-	})
-
-	adminAuthed := router.Group("/")
-	adminAuthed.Use(adminAccess(cfg.APIKey, cfg.JWTSecret, repo))
-
-	moderationAuthed := adminAuthed.Group("/")
-	moderationAuthed.Use(moderationAccess(cfg.ModerationPassword))
-
-	userAuthed := router.Group("/")
-	userAuthed.Use(userAuth(cfg.JWTSecret, repo))
-
-	adminAuthed.POST("/novels", func(c *gin.Context) {
-		var input NovelInput
-		if err := c.ShouldBindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := repo.DeleteTwoFactorChallenge(hash); err != nil {
+			respondTwoFactorError(c, err)
 			return
 		}
-		if strings.TrimSpace(input.Title) == "" || strings.TrimSpace(input.Author) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "title and author are required"})
+		user, err := repo.GetAuthUserByID(userID)
+		if err != nil {
+			respondNotFound(c, err)
 			return
 		}
-		if strings.TrimSpace(input.Summary) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "summary is required"})
+		if strings.EqualFold(user.Status, "banned") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "account banned"})
 			return
 		}
-		novel, err := repo.CreateNovel(input)
+		response, err := startSession(c, repo, cfg, user, device, true)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusCreated, novel)
+		c.JSON(http.StatusOK, response)
 	})
 
-	adminAuthed.PUT("/settings", func(c *gin.Context) {
-		var input SiteSettingsInput
+	router.POST("/auth/refresh", func(c *gin.Context) {
+		var input AuthRefreshInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if strings.TrimSpace(input.Title) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+		if input.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refreshToken is required"})
 			return
 		}
-		if strings.TrimSpace(input.Tagline) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "tagline is required"})
+		refreshToken, hash := newAuthToken()
+		session, user, err := repo.RotateSession(hashAuthToken(input.RefreshToken), hash, newSessionInput(c, ""), time.Now().Add(cfg.RefreshTTL))
+		if err != nil {
+			respondSessionError(c, err)
 			return
 		}
-		settings, err := repo.UpdateSiteSettings(input)
+		response, err := newAuthResponse(repo, cfg, user, session.ID, refreshToken)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, settings)
+		c.JSON(http.StatusOK, response)
 	})
-
-	adminAuthed.POST("/uploads/logo", func(c *gin.Context) {
-		file, err := c.FormFile("file")
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+	router.POST("/auth/logout", func(c *gin.Context) {
+		var input AuthRefreshInput
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		url, err := saveUploadedFile(file, "logo", c)
+		// Either the refresh token or a still-valid access token identifies
+		// the session to end.
+		var err error
+		if input.RefreshToken != "" {
+			err = repo.RevokeSessionByToken(hashAuthToken(input.RefreshToken), sessionRevokedLogout)
+		} else if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			if claims, parseErr := parseToken(strings.TrimPrefix(header, "Bearer "), cfg.JWTSecret); parseErr == nil {
+				if revokeErr := repo.RevokeSession(claims.UserID, claims.SessionID, sessionRevokedLogout); !errors.Is(revokeErr, errNotFound) {
+					err = revokeErr
+				}
+			}
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"url": url})
+		c.Status(http.StatusNoContent)
 	})
 
-	adminAuthed.POST("/uploads/cover", func(c *gin.Context) {
-		file, err := c.FormFile("file")
+	oauth := newOAuthClient(cfg)
+	router.GET("/auth/oauth/providers", func(c *gin.Context) {
+		c.JSON(http.StatusOK, oauth.list())
+	})
+	router.POST("/auth/oauth/:provider/start", func(c *gin.Context) {
+		start, err := beginOAuth(c.Request.Context(), repo, oauth, c.Param("provider"), 0, cfg.OAuthStateTTL)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			respondOAuthError(c, err)
 			return
 		}
-		url, err := saveUploadedFile(file, "cover", c)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusOK, start)
+	})
+	router.POST("/auth/oauth/:provider/callback", func(c *gin.Context) {
+		var input OAuthCallbackInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"url": url})
-	})
-
-	adminAuthed.POST("/uploads/illustration", func(c *gin.Context) {
-		file, err := c.FormFile("file")
+		identity, err := finishOAuth(c.Request.Context(), repo, oauth, c.Param("provider"), input, 0)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			respondOAuthError(c, err)
 			return
 		}
-		url, err := saveUploadedFile(file, "illustration", c)
+		user, created, err := repo.SignInWithIdentity(identity, oauthRole(identity, cfg))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondOAuthError(c, err)
 			return
 		}
-		_, err = repo.CreateIllustration(IllustrationInput{
-			URL:          url,
-			OriginalName: file.Filename,
-		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if strings.EqualFold(user.Status, "banned") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "account banned"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"url": url})
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		signIn(c, repo, cfg, user, input.Device, status)
 	})
 
-	adminAuthed.POST("/announcements", func(c *gin.Context) {
-		var input AnnouncementInput
+	router.POST("/auth/forgot", func(c *gin.Context) {
+		var input AuthForgotInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if strings.TrimSpace(input.Title) == "" || strings.TrimSpace(input.Body) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "title and body are required"})
+		email := normalizeEmail(input.Email)
+		if email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
 			return
 		}
-		announcement, err := repo.CreateAnnouncement(input)
+		// The answer is the same whether or not the address has an account,
+		// so the endpoint cannot be used to discover who is registered.
+		user, err := repo.GetAuthUserByEmail(email)
+		if err == nil && !strings.EqualFold(user.Status, "banned") {
+			if err := sendAccountMail(repo, cfg, user, tokenPasswordReset); err != nil && !errors.Is(err, errAuthTokenCooldown) {
+				log.Printf("forgot: reset email for user %d: %v", user.ID, err)
+			}
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": "if the address has an account, a reset link is on its way"})
+	})
+	router.POST("/auth/reset", func(c *gin.Context) {
+		var input AuthResetInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.Token == "" || input.Password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token and password are required"})
+			return
+		}
+		hash, err := hashPassword(input.Password)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusCreated, announcement)
-	})
-
-	adminAuthed.GET("/release-queue", func(c *gin.Context) {
-		items, err := repo.ListReleaseQueue()
+		user, err := repo.ResetPassword(hashAuthToken(input.Token), hash)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondAccountError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, items)
+		c.JSON(http.StatusOK, toAuthUserInfo(user, rolePermissions(repo, user.Role)))
 	})
-
-	adminAuthed.POST("/release-queue", func(c *gin.Context) {
-		var input ReleaseQueueInput
+	router.POST("/auth/verify", func(c *gin.Context) {
+		var input AuthVerifyInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if input.NovelID <= 0 || input.ChapterNumber <= 0 || strings.TrimSpace(input.Title) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "novelId, chapterNumber, and title are required"})
+		if input.Token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
 			return
 		}
-		item, err := repo.CreateReleaseQueue(input)
+		user, err := repo.VerifyEmail(hashAuthToken(input.Token))
 		if err != nil {
-			respondNotFound(c, err)
+			respondAccountError(c, err)
 			return
 		}
-		c.JSON(http.StatusCreated, item)
+		c.JSON(http.StatusOK, toAuthUserInfo(user, rolePermissions(repo, user.Role)))
 	})
 
-	adminAuthed.PUT("/release-queue/:id", func(c *gin.Context) {
-		id := parseID(c.Param("id"))
-		var input ReleaseQueueStatusInput
-		if err := c.ShouldBindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
+	// isAdmin lets public routes show drafts to callers that would pass
+	// adminAccess.
+	isAdmin := func(c *gin.Context) bool {
+		return isAdminRequest(c, cfg.APIKey, cfg.JWTSecret, repo, cfg.RequireAdmin2FA)
+	}
+	// viewableNovel and viewableChapter respond 404 for items the caller may
+	// not open.
+	viewableNovel := func(c *gin.Context, id int) (*Novel, bool) {
+		novel, err := repo.GetNovel(id)
+		if err != nil {
+			respondNotFound(c, err)
+			return nil, false
 		}
-		if strings.TrimSpace(input.Status) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "status is required"})
-			return
+		if !novelViewable(novel, isAdmin(c)) {
+			respondNotFound(c, errNotFound)
+			return nil, false
 		}
-		item, err := repo.UpdateReleaseQueueStatus(id, input.Status)
+		return novel, true
+	}
+	viewableChapter := func(c *gin.Context, id int) (*Chapter, bool) {
+		chapter, err := repo.GetChapter(id)
 		if err != nil {
 			respondNotFound(c, err)
-			return
+			return nil, false
 		}
-		c.JSON(http.StatusOK, item)
-	})
-
-	adminAuthed.DELETE("/release-queue/:id", func(c *gin.Context) {
-		id := parseID(c.Param("id"))
-		if err := repo.DeleteReleaseQueue(id); err != nil {
+		novel, err := repo.GetNovel(chapter.NovelID)
+		if err != nil {
 			respondNotFound(c, err)
-			return
+			return nil, false
 		}
-		c.Status(http.StatusNoContent)
-	})
+		if !chapterViewable(novel, chapter, isAdmin(c)) {
+			respondNotFound(c, errNotFound)
+			return nil, false
+		}
+		return chapter, true
+	}
 
-	adminAuthed.GET("/reports", func(c *gin.Context) {
-		items, err := repo.ListModerationReports()
+	me := router.Group("/me")
+	me.Use(userAuth(cfg.JWTSecret, repo))
+	me.POST("/verify-email", func(c *gin.Context) {
+		user, err := repo.GetAuthUserByID(c.GetInt("userID"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondNotFound(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, items)
-	})
-
-	adminAuthed.POST("/reports", func(c *gin.Context) {
-		var input ModerationReportInput
-		if err := c.ShouldBindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if user.EmailVerifiedAt != nil {
+			respondAccountError(c, errEmailVerified)
 			return
 		}
-		if strings.TrimSpace(input.Note) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "note is required"})
+		if err := sendAccountMail(repo, cfg, user, tokenEmailVerify); err != nil {
+			respondAccountError(c, err)
 			return
 		}
-		item, err := repo.CreateModerationReport(input)
+		c.JSON(http.StatusAccepted, gin.H{"status": "verification email sent"})
+	})
+	me.GET("/sessions", func(c *gin.Context) {
+		items, err := repo.ListSessions(c.GetInt("userID"))
 		if err != nil {
-			respondNotFound(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusCreated, item)
+		for _, item := range items {
+			item.Current = item.ID == c.GetInt("sessionID")
+		}
+		c.JSON(http.StatusOK, items)
 	})
-
-	adminAuthed.DELETE("/reports/:id", func(c *gin.Context) {
-		id := parseID(c.Param("id"))
-		if err := repo.DeleteModerationReport(id); err != nil {
+	me.DELETE("/sessions/:id", func(c *gin.Context) {
+		if err := repo.RevokeSession(c.GetInt("userID"), parseID(c.Param("id")), sessionRevokedUser); err != nil {
 			respondNotFound(c, err)
 			return
 		}
 		c.Status(http.StatusNoContent)
 	})
-
-	adminAuthed.PUT("/announcements/:id", func(c *gin.Context) {
-		id := parseID(c.Param("id"))
-		var input AnnouncementInput
-		if err := c.ShouldBindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		if strings.TrimSpace(input.Title) == "" || strings.TrimSpace(input.Body) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "title and body are required"})
-			return
-		}
-		announcement, err := repo.UpdateAnnouncement(id, input)
+	me.GET("/2fa", func(c *gin.Context) {
+		state, err := repo.GetTwoFactor(c.GetInt("userID"))
 		if err != nil {
 			respondNotFound(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, announcement)
+		c.JSON(http.StatusOK, state)
 	})
-
-	adminAuthed.DELETE("/announcements/:id", func(c *gin.Context) {
-		id := parseID(c.Param("id"))
-		if err := repo.DeleteAnnouncement(id); err != nil {
+	me.POST("/2fa/setup", func(c *gin.Context) {
+		user, err := repo.GetAuthUserByID(c.GetInt("userID"))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		secret := newTOTPSecret()
+		sealed, err := sealTOTPSecret(cfg.TwoFactorKey, secret)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := repo.SetTwoFactorSecret(user.ID, sealed); err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		settings, _ := repo.GetSiteSettings()
+		c.JSON(http.StatusOK, gin.H{
+			"secret":     totpEncoding.EncodeToString(secret),
+			"otpauthUri": totpURI(mailBranding(settings, cfg.SiteURL).SiteName, user.Email, secret),
+		})
+	})
+	me.POST("/2fa/enable", func(c *gin.Context) {
+		var input TwoFactorCodeInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		state, err := repo.GetTwoFactor(c.GetInt("userID"))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		if state.Enabled {
+			respondTwoFactorError(c, errTwoFactorOn)
+			return
+		}
+		if state.Secret == "" {
+			respondTwoFactorError(c, errTwoFactorSetup)
+			return
+		}
+		secret, err := openTOTPSecret(cfg.TwoFactorKey, state.Secret)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		step, ok := matchTOTP(secret, normalizeTwoFactorCode(input.Code), time.Now())
+		if !ok {
+			respondTwoFactorError(c, errTwoFactorCode)
+			return
+		}
+		codes, hashes := newRecoveryCodes()
+		if err := repo.EnableTwoFactor(c.GetInt("userID"), step, hashes, c.GetInt("sessionID")); err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+	})
+	me.POST("/2fa/disable", func(c *gin.Context) {
+		var input TwoFactorCodeInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkTwoFactor(repo, cfg, c.GetInt("userID"), input.Code); err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		if err := repo.DisableTwoFactor(c.GetInt("userID")); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	me.POST("/2fa/recovery-codes", func(c *gin.Context) {
+		var input TwoFactorCodeInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkTwoFactor(repo, cfg, c.GetInt("userID"), input.Code); err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		codes, hashes := newRecoveryCodes()
+		if err := repo.ReplaceRecoveryCodes(c.GetInt("userID"), hashes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+	})
+	me.POST("/2fa/step-up", func(c *gin.Context) {
+		var input TwoFactorCodeInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkTwoFactor(repo, cfg, c.GetInt("userID"), input.Code); err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+		at, err := repo.MarkSessionTwoFactor(c.GetInt("userID"), c.GetInt("sessionID"))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"twoFactorAt": at, "expiresAt": at.Add(cfg.StepUpTTL)})
+	})
+	me.GET("/identities", func(c *gin.Context) {
+		items, err := repo.ListIdentities(c.GetInt("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+	me.POST("/identities/:provider/start", func(c *gin.Context) {
+		start, err := beginOAuth(c.Request.Context(), repo, oauth, c.Param("provider"), c.GetInt("userID"), cfg.OAuthStateTTL)
+		if err != nil {
+			respondOAuthError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, start)
+	})
+	me.POST("/identities/:provider/callback", func(c *gin.Context) {
+		var input OAuthCallbackInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		identity, err := finishOAuth(c.Request.Context(), repo, oauth, c.Param("provider"), input, c.GetInt("userID"))
+		if err != nil {
+			respondOAuthError(c, err)
+			return
+		}
+		item, err := repo.LinkIdentity(c.GetInt("userID"), identity)
+		if err != nil {
+			respondOAuthError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, item)
+	})
+	me.DELETE("/identities/:id", func(c *gin.Context) {
+		if err := repo.DeleteIdentity(c.GetInt("userID"), parseID(c.Param("id"))); err != nil {
+			respondOAuthError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	me.GET("/history", func(c *gin.Context) {
+		limit, ok := readCursorPagination(c)
+		if !ok {
+			return
+		}
+		query := HistoryQuery{
+			UserID:        c.GetInt("userID"),
+			NovelID:       parseID(c.Query("novelId")),
+			Cursor:        c.Query("cursor"),
+			Limit:         limit,
+			IncludeHidden: isAdmin(c),
+		}
+		switch c.DefaultQuery("group", "none") {
+		case "none":
+			page, err := repo.QueryReadingHistory(query)
+			if err != nil {
+				respondListError(c, err)
+				return
+			}
+			writePageHeaders(c, page)
+			c.JSON(http.StatusOK, page.Items)
+		case "novel":
+			page, err := repo.QueryHistoryNovels(query)
+			if err != nil {
+				respondListError(c, err)
+				return
+			}
+			writePageHeaders(c, page)
+			c.JSON(http.StatusOK, page.Items)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "group must be none or novel"})
+		}
+	})
+	me.GET("/history/export", func(c *gin.Context) {
+		items, err := repo.ListReadingHistory(c.GetInt("userID"), isAdmin(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		switch c.DefaultQuery("format", "json") {
+		case "json":
+			c.Header("Content-Disposition", `attachment; filename="reading-history.json"`)
+			c.JSON(http.StatusOK, items)
+		case "csv":
+			var buf bytes.Buffer
+			if err := writeHistoryCSV(&buf, items); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.Header("Content-Disposition", `attachment; filename="reading-history.csv"`)
+			c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		}
+	})
+	me.POST("/history", func(c *gin.Context) {
+		userID := c.GetInt("userID")
+		var input ReadingHistoryInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.ChapterID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "chapterId is required"})
+			return
+		}
+		if _, ok := viewableChapter(c, input.ChapterID); !ok {
+			return
+		}
+		entry, err := repo.AddReadingHistory(userID, input)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, entry)
+	})
+	me.DELETE("/history/:id", func(c *gin.Context) {
+		if err := repo.DeleteReadingHistoryEntry(c.GetInt("userID"), parseID(c.Param("id"))); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	me.DELETE("/history/novels/:novelId", func(c *gin.Context) {
+		if err := repo.DeleteNovelHistory(c.GetInt("userID"), parseID(c.Param("novelId"))); err != nil {
 			respondNotFound(c, err)
 			return
 		}
 		c.Status(http.StatusNoContent)
 	})
+	me.DELETE("/history", func(c *gin.Context) {
+		userID := c.GetInt("userID")
+		if err := repo.ClearReadingHistory(userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
 
-	router.GET("/novels/:id", func(c *gin.Context) {
+	router.GET("/settings", func(c *gin.Context) {
+		settings, err := repo.GetSiteSettings()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	router.GET("/announcements", func(c *gin.Context) {
+		items := repo.ListAnnouncements()
+		c.JSON(http.StatusOK, items)
+	})
+
+	feeds := newFeedCache(cfg.FeedCacheTTL, cfg.APIURL)
+	for format, ext := range map[string]string{"rss": "xml", "atom": "atom"} {
+		router.GET("/feed."+ext, func(c *gin.Context) {
+			serveFeed(c, feeds, format, func(selfURL string) (*feedDocument, error) {
+				return buildSiteFeed(repo, cfg, selfURL)
+			})
+		})
+		router.GET("/novels/:id/feed."+ext, func(c *gin.Context) {
+			id := parseID(c.Param("id"))
+			serveFeed(c, feeds, format, func(selfURL string) (*feedDocument, error) {
+				return buildNovelFeed(repo, cfg, id, selfURL)
+			})
+		})
+		router.GET("/announcements/feed."+ext, func(c *gin.Context) {
+			serveFeed(c, feeds, format, func(selfURL string) (*feedDocument, error) {
+				return buildAnnouncementsFeed(repo, cfg, selfURL)
+			})
+		})
+	}
+
+	router.GET("/opds", func(c *gin.Context) {
+		serveOPDS(c, feeds, repo, cfg, opdsNavigationType, opdsCatalog.Root)
+	})
+	router.GET("/opds/new", func(c *gin.Context) {
+		serveOPDS(c, feeds, repo, cfg, opdsAcquisitionType, func(o opdsCatalog) (*opdsFeed, time.Time, error) {
+			return o.Novels("new", "Newest", "/opds/new", NovelQuery{Sort: "created", Cursor: c.Query("cursor")})
+		})
+	})
+	router.GET("/opds/popular", func(c *gin.Context) {
+		serveOPDS(c, feeds, repo, cfg, opdsAcquisitionType, func(o opdsCatalog) (*opdsFeed, time.Time, error) {
+			return o.Novels("popular", "Most followed", "/opds/popular", NovelQuery{Sort: "popularity", Cursor: c.Query("cursor")})
+		})
+	})
+	router.GET("/opds/tags", func(c *gin.Context) {
+		serveOPDS(c, feeds, repo, cfg, opdsNavigationType, opdsCatalog.Tags)
+	})
+	router.GET("/opds/tags/:tag", func(c *gin.Context) {
+		tag := c.Param("tag")
+		serveOPDS(c, feeds, repo, cfg, opdsAcquisitionType, func(o opdsCatalog) (*opdsFeed, time.Time, error) {
+			return o.Novels("tags:"+tag, tag, "/opds/tags/"+url.PathEscape(tag), NovelQuery{Tags: []string{tag}, Sort: "latest", Cursor: c.Query("cursor")})
+		})
+	})
+	router.GET("/opds/status", func(c *gin.Context) {
+		serveOPDS(c, feeds, repo, cfg, opdsNavigationType, opdsCatalog.Statuses)
+	})
+	router.GET("/opds/status/:status", func(c *gin.Context) {
+		status := c.Param("status")
+		serveOPDS(c, feeds, repo, cfg, opdsAcquisitionType, func(o opdsCatalog) (*opdsFeed, time.Time, error) {
+			return o.Novels("status:"+status, status, "/opds/status/"+url.PathEscape(status), NovelQuery{Status: status, Sort: "latest", Cursor: c.Query("cursor")})
+		})
+	})
+	router.GET("/opds/novels/:id", func(c *gin.Context) {
 		id := parseID(c.Param("id"))
-		novel, err := repo.GetNovel(id)
+		serveOPDS(c, feeds, repo, cfg, opdsAcquisitionType, func(o opdsCatalog) (*opdsFeed, time.Time, error) {
+			return o.Novel(id)
+		})
+	})
+	router.GET("/opds/search", func(c *gin.Context) {
+		text := strings.TrimSpace(c.Query("q"))
+		serveOPDS(c, feeds, repo, cfg, opdsAcquisitionType, func(o opdsCatalog) (*opdsFeed, time.Time, error) {
+			return o.Search(text)
+		})
+	})
+	router.GET("/opds/opensearch.xml", func(c *gin.Context) {
+		catalog := opdsCatalog{repo: repo, cfg: cfg, base: feeds.baseURL(c)}
+		c.Data(http.StatusOK, openSearchType+"; charset=utf-8", catalog.OpenSearch())
+	})
+
+	router.GET("/novels", func(c *gin.Context) {
+		limit, ok := readCursorPagination(c)
+		if !ok {
+			return
+		}
+		query := NovelQuery{
+			Tags:     readListQuery(c, "tags"),
+			MatchAll: strings.EqualFold(c.Query("match"), "all"),
+			Status:   strings.TrimSpace(c.Query("status")),
+			Author:   strings.TrimSpace(c.Query("author")),
+			Sort:     strings.ToLower(strings.TrimSpace(c.DefaultQuery("sort", "latest"))),
+			Cursor:   c.Query("cursor"),
+			Limit:    limit,
+		}
+		if isAdmin(c) {
+			visibility, err := normalizeVisibility(c.Query("visibility"), "")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			query.IncludeHidden = true
+			query.Visibility = visibility
+		}
+		if _, ok := novelSortColumns[query.Sort]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be latest, created, title, rating, popularity, or latest_chapter"})
+			return
+		}
+		page, err := repo.QueryNovels(query)
 		if err != nil {
-			respondNotFound(c, err)
+			respondListError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, novel)
+		writePageHeaders(c, page)
+		c.JSON(http.StatusOK, page.Items)
+	})
+
+	router.GET("/novels/stats", func(c *gin.Context) {
+		items, err := repo.ListNovelStats(isAdmin(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
 	})
 
-	adminAuthed.PUT("/novels/:id", func(c *gin.Context) {
+	router.GET("/novels/:id/stats", func(c *gin.Context) {
 		id := parseID(c.Param("id"))
+		if _, ok := viewableNovel(c, id); !ok {
+			return
+		}
+		stats, err := repo.GetNovelStats(id)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, stats)
+	})
+
+	router.GET("/search", func(c *gin.Context) {
+		text := strings.TrimSpace(c.Query("q"))
+		if text == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+			return
+		}
+		searchType := strings.ToLower(strings.TrimSpace(c.DefaultQuery("type", "all")))
+		switch searchType {
+		case "all", "novels", "chapters":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "type must be all, novels, or chapters"})
+			return
+		}
+		limit, offset := readPagination(c)
+		results, err := repo.Search(SearchQuery{
+			Text:          text,
+			Type:          searchType,
+			Tag:           strings.TrimSpace(c.Query("tag")),
+			Status:        strings.TrimSpace(c.Query("status")),
+			NovelID:       parseID(c.Query("novel")),
+			Limit:         limit,
+			Offset:        offset,
+			IncludeHidden: isAdmin(c),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, results)
+	})
+
+	adminAuthed := router.Group("/")
+	adminAuthed.Use(adminAccess(cfg.APIKey, cfg.JWTSecret, repo, cfg.RequireAdmin2FA))
+
+	moderationAuthed := adminAuthed.Group("/")
+	moderationAuthed.Use(moderationAccess(cfg.ModerationPassword, cfg.ModerationStepUp, cfg.StepUpTTL))
+
+	userAuthed := router.Group("/")
+	userAuthed.Use(userAuth(cfg.JWTSecret, repo))
+	verified := requireVerifiedEmail(cfg.RequireVerified)
+
+	adminAuthed.POST("/novels", requirePermission(permNovelEdit), func(c *gin.Context) {
 		var input NovelInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -575,154 +1130,1025 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "summary is required"})
 			return
 		}
-		novel, err := repo.UpdateNovel(id, input)
+		visibility, err := normalizeVisibility(input.Visibility, "")
 		if err != nil {
-			respondNotFound(c, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, novel)
+		input.Visibility = visibility
+		novel, err := repo.CreateNovel(input)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if novel.Visibility == visibilityPublished {
+			emitWebhookEvent(repo, novelCreatedEvent(novel))
+		}
+		c.JSON(http.StatusCreated, novel)
 	})
 
-	adminAuthed.DELETE("/novels/:id", func(c *gin.Context) {
-		id := parseID(c.Param("id"))
-		if err := repo.DeleteNovel(id); err != nil {
-			respondNotFound(c, err)
+	adminAuthed.PUT("/settings", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		var input SiteSettingsInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		c.Status(http.StatusNoContent)
+		if strings.TrimSpace(input.Title) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+			return
+		}
+		if strings.TrimSpace(input.Tagline) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tagline is required"})
+			return
+		}
+		settings, err := repo.UpdateSiteSettings(input)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	adminAuthed.POST("/uploads/logo", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		url, err := saveUploadedFile(file, "logo", c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"url": url})
+	})
+
+	adminAuthed.POST("/uploads/cover", requirePermission(permNovelEdit), func(c *gin.Context) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		url, err := saveUploadedFile(file, "cover", c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"url": url})
+	})
+
+	adminAuthed.POST("/uploads/illustration", requirePermission(permChapterEdit), func(c *gin.Context) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		url, err := saveUploadedFile(file, "illustration", c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		_, err = repo.CreateIllustration(IllustrationInput{
+			URL:          url,
+			OriginalName: file.Filename,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"url": url})
+	})
+
+	adminAuthed.POST("/announcements", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		var input AnnouncementInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(input.Title) == "" || strings.TrimSpace(input.Body) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title and body are required"})
+			return
+		}
+		announcement, err := repo.CreateAnnouncement(input)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		emitWebhookEvent(repo, announcementEvent(announcement))
+		c.JSON(http.StatusCreated, announcement)
+	})
+
+	adminAuthed.GET("/release-queue", requirePermission(permChapterEdit), func(c *gin.Context) {
+		items, err := repo.ListReleaseQueue()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+
+	adminAuthed.POST("/release-queue", requirePermission(permChapterPublish), func(c *gin.Context) {
+		var input ReleaseQueueInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.NovelID <= 0 || input.ChapterNumber <= 0 || strings.TrimSpace(input.Title) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "novelId, chapterNumber, and title are required"})
+			return
+		}
+		item, err := repo.CreateReleaseQueue(input)
+		if err != nil {
+			respondReleaseError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, item)
+	})
+
+	adminAuthed.PUT("/release-queue/:id/draft", requirePermission(permChapterPublish), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		var input ReleaseQueueInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.ChapterNumber <= 0 || strings.TrimSpace(input.Title) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "chapterNumber and title are required"})
+			return
+		}
+		item, err := repo.UpdateReleaseQueue(id, input)
+		if err != nil {
+			respondReleaseError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, item)
+	})
+
+	adminAuthed.PUT("/release-queue/:id", requirePermission(permChapterPublish), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		var input ReleaseQueueStatusInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(input.Status) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status is required"})
+			return
+		}
+		item, err := repo.UpdateReleaseQueueStatus(id, input.Status)
+		if err != nil {
+			respondReleaseError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, item)
+	})
+
+	adminAuthed.DELETE("/release-queue/:id", requirePermission(permChapterPublish), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		if err := repo.DeleteReleaseQueue(id); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	adminAuthed.GET("/reports", requirePermission(permCommentModerate), func(c *gin.Context) {
+		items, err := repo.ListModerationReports()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+
+	adminAuthed.POST("/reports", requirePermission(permCommentModerate), func(c *gin.Context) {
+		var input ModerationReportInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(input.Note) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "note is required"})
+			return
+		}
+		item, err := repo.CreateModerationReport(input)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		emitWebhookEvent(repo, reportEvent(item))
+		c.JSON(http.StatusCreated, item)
+	})
+
+	adminAuthed.DELETE("/reports/:id", requirePermission(permCommentModerate), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		if err := repo.DeleteModerationReport(id); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	adminAuthed.PUT("/announcements/:id", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		var input AnnouncementInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(input.Title) == "" || strings.TrimSpace(input.Body) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title and body are required"})
+			return
+		}
+		announcement, err := repo.UpdateAnnouncement(id, input)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, announcement)
+	})
+
+	adminAuthed.DELETE("/announcements/:id", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		if err := repo.DeleteAnnouncement(id); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	router.GET("/novels/:id", func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		novel, ok := viewableNovel(c, id)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, novel)
+	})
+
+	adminAuthed.PUT("/novels/:id", requirePermission(permNovelEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		var input NovelInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(input.Title) == "" || strings.TrimSpace(input.Author) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title and author are required"})
+			return
+		}
+		if strings.TrimSpace(input.Summary) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "summary is required"})
+			return
+		}
+		visibility, err := normalizeVisibility(input.Visibility, "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input.Visibility = visibility
+		novel, err := repo.UpdateNovel(id, input)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, novel)
+	})
+
+	adminAuthed.DELETE("/novels/:id", requirePermission(permNovelEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		if err := repo.DeleteNovel(id); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	router.GET("/novels/:id/chapters", func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		if _, ok := viewableNovel(c, id); !ok {
+			return
+		}
+		limit, ok := readCursorPagination(c)
+		if !ok {
+			return
+		}
+		page, err := repo.QueryChapters(ChapterQuery{
+			NovelID:       id,
+			Volume:        parseID(c.Query("volume")),
+			Descending:    strings.EqualFold(c.Query("order"), "desc"),
+			Cursor:        c.Query("cursor"),
+			Limit:         limit,
+			IncludeHidden: isAdmin(c),
+		})
+		if err != nil {
+			respondListError(c, err)
+			return
+		}
+		writePageHeaders(c, page)
+		c.JSON(http.StatusOK, page.Items)
+	})
+
+	router.GET("/novels/:id/export.epub", func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		novel, ok := viewableNovel(c, id)
+		if !ok {
+			return
+		}
+		chapters, err := repo.ListChaptersByNovel(id)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		if !isAdmin(c) {
+			chapters = listedChapters(chapters)
+		}
+		volume := parseID(c.Query("volume"))
+		chapters = filterExportChapters(chapters, volume, parseID(c.Query("from")), parseID(c.Query("to")))
+		if len(chapters) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no chapters in range"})
+			return
+		}
+		var buf bytes.Buffer
+		if err := buildEPUB(&buf, novel, chapters, "uploads"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		filename := strings.ReplaceAll(novel.Slug, `"`, "")
+		if volume > 0 {
+			filename += "-vol-" + strconv.Itoa(volume)
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.epub"`)
+		c.Data(http.StatusOK, "application/epub+zip", buf.Bytes())
+	})
+
+	adminAuthed.POST("/novels/:id/import", requirePermission(permChapterEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		if _, err := repo.GetNovel(id); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		if file.Size > maxImportSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is too large"})
+			return
+		}
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(src, maxImportSize))
+		src.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		existing, err := repo.ListChaptersByNovel(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		options := ImportOptions{
+			Format:       detectImportFormat(file.Filename, c.PostForm("format")),
+			HeadingLevel: parseID(c.PostForm("headingLevel")),
+			Volume:       parseID(c.PostForm("volume")),
+			StartNumber:  parseID(c.PostForm("startNumber")),
+		}
+		if options.Visibility, err = normalizeVisibility(c.PostForm("visibility"), ""); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if c.PostForm("dryRun") == "false" && !canPublish(c, options.Visibility) {
+			respondRoleError(c, errPublishRequired)
+			return
+		}
+		if options.HeadingLevel == 0 {
+			options.HeadingLevel = 1
+		}
+		if options.StartNumber == 0 {
+			for _, chapter := range existing {
+				if chapter.Number >= options.StartNumber {
+					options.StartNumber = chapter.Number + 1
+				}
+			}
+		}
+		if options.Volume == 0 && len(existing) > 0 {
+			options.Volume = existing[len(existing)-1].Volume
+		}
+
+		drafts, warnings, err := parseImport(data, options)
+		if errors.Is(err, errImportTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		warnings = append(warnings, warnExistingChapters(drafts, existing)...)
+		preview := buildImportPreview(options.Format, drafts, warnings)
+		if c.DefaultPostForm("dryRun", "true") != "false" {
+			c.JSON(http.StatusOK, preview)
+			return
+		}
+
+		chapters, err := commitImport(repo, id, drafts, options.Visibility)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		preview.DryRun = false
+		preview.Created = chapters
+		c.JSON(http.StatusCreated, preview)
+	})
+
+	adminAuthed.POST("/novels/:id/chapters", requirePermission(permChapterEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		var input ChapterInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.Number <= 0 || strings.TrimSpace(input.Title) == "" || strings.TrimSpace(input.Content) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "number, title, and content are required"})
+			return
+		}
+		visibility, err := normalizeVisibility(input.Visibility, "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !canPublish(c, visibility) {
+			respondRoleError(c, errPublishRequired)
+			return
+		}
+		input.Visibility = visibility
+		input.EditorID = c.GetInt("userID")
+		chapter, err := repo.CreateChapter(id, input)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, chapter)
+	})
+
+	router.GET("/chapters/:id", func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		chapter, ok := viewableChapter(c, id)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, chapter)
+	})
+
+	router.POST("/chapters/:id/views", func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		if _, ok := viewableChapter(c, id); !ok {
+			return
+		}
+		if cfg.ViewWindow <= 0 || isAdmin(c) {
+			c.JSON(http.StatusAccepted, gin.H{"counted": false})
+			return
+		}
+		now := time.Now()
+		visitor := viewVisitorHash(cfg.ViewHashSecret, viewVisitorIdentity(c), now)
+		counted, err := repo.RecordChapterView(id, visitor, now, cfg.ViewWindow)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"counted": counted})
+	})
+
+	adminAuthed.GET("/analytics/novels/:id/views", requirePermission(permAnalyticsView), func(c *gin.Context) {
+		from, to, err := parseAnalyticsRange(c, time.Now())
+		if err != nil {
+			respondAnalyticsError(c, err)
+			return
+		}
+		series, err := repo.GetNovelViewSeries(parseID(c.Param("id")), from, to)
+		if err != nil {
+			respondAnalyticsError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, series)
+	})
+
+	adminAuthed.GET("/analytics/chapters/:id/views", requirePermission(permAnalyticsView), func(c *gin.Context) {
+		from, to, err := parseAnalyticsRange(c, time.Now())
+		if err != nil {
+			respondAnalyticsError(c, err)
+			return
+		}
+		series, err := repo.GetChapterViewSeries(parseID(c.Param("id")), from, to)
+		if err != nil {
+			respondAnalyticsError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, series)
+	})
+
+	adminAuthed.GET("/analytics/novels/:id/dropoff", requirePermission(permAnalyticsView), func(c *gin.Context) {
+		from, to, err := parseAnalyticsRange(c, time.Now())
+		if err != nil {
+			respondAnalyticsError(c, err)
+			return
+		}
+		items, err := repo.ListNovelDropOff(parseID(c.Param("id")), from, to)
+		if err != nil {
+			respondAnalyticsError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+
+	adminAuthed.GET("/analytics/top-novels", requirePermission(permAnalyticsView), func(c *gin.Context) {
+		days, ok := analyticsPeriods[strings.ToLower(c.DefaultQuery("period", "week"))]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "period must be day, week, month, year or all"})
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+		limit, _ = clampPagination(limit, 0)
+		to := time.Now().UTC().Truncate(24 * time.Hour)
+		var from time.Time
+		if days > 0 {
+			from = to.AddDate(0, 0, 1-days)
+		}
+		items, err := repo.ListTopNovelsByViews(from, to, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+
+	webhookClient := &http.Client{Timeout: cfg.WebhookTimeout}
+	adminAuthed.GET("/webhooks", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		items, err := repo.ListWebhooks()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+	adminAuthed.POST("/webhooks", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		var input WebhookInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input, err := normalizeWebhookInput(input)
+		if err != nil {
+			respondWebhookError(c, err)
+			return
+		}
+		if input.Secret == "" {
+			input.Secret = newWebhookSecret()
+		}
+		hook, err := repo.CreateWebhook(input)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, hook)
+	})
+	adminAuthed.GET("/webhooks/:id", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		hook, err := repo.GetWebhook(parseID(c.Param("id")))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, hook)
+	})
+	adminAuthed.PUT("/webhooks/:id", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		var input WebhookInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input, err := normalizeWebhookInput(input)
+		if err != nil {
+			respondWebhookError(c, err)
+			return
+		}
+		hook, err := repo.UpdateWebhook(parseID(c.Param("id")), input)
+		if err != nil {
+			respondWebhookError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, hook)
+	})
+	adminAuthed.DELETE("/webhooks/:id", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		if err := repo.DeleteWebhook(parseID(c.Param("id"))); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	adminAuthed.POST("/webhooks/:id/test", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		hook, err := repo.GetWebhook(parseID(c.Param("id")))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		delivery, err := repo.QueueWebhookTest(hook.ID, testEvent(hook, time.Now()))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		// Send right away so the admin sees the endpoint's answer; a failed
+		// test stays queued and is retried like any other delivery.
+		delivery, err = repo.DeliverWebhook(delivery.ID, newWebhookSender(repo, webhookClient, cfg.SiteURL).send)
+		if err != nil {
+			respondWebhookError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, delivery)
+	})
+	adminAuthed.GET("/webhooks/:id/deliveries", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		status := strings.ToLower(c.Query("status"))
+		switch status {
+		case "", deliveryPending, deliveryDelivered, deliveryFailed:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, delivered or failed"})
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		limit, _ = clampPagination(limit, 0)
+		items, err := repo.ListWebhookDeliveries(parseID(c.Param("id")), status, limit)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+	adminAuthed.POST("/webhook-deliveries/:id/retry", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		delivery, err := repo.RetryWebhookDelivery(parseID(c.Param("id")))
+		if err != nil {
+			respondWebhookError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, delivery)
+	})
+
+	adminAuthed.GET("/mail/outbox", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		status := strings.ToLower(c.Query("status"))
+		switch status {
+		case "", outboxPending, outboxSent, outboxFailed:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, sent or failed"})
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		limit, _ = clampPagination(limit, 0)
+		items, err := repo.ListOutbox(status, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+	adminAuthed.POST("/mail/outbox/:id/retry", requirePermission(permSettingsEdit), func(c *gin.Context) {
+		item, err := repo.RetryOutbox(parseID(c.Param("id")))
+		if err != nil {
+			respondMailError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, item)
+	})
+
+	adminAuthed.PUT("/chapters/:id", requirePermission(permChapterEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		var input ChapterInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.Number <= 0 || strings.TrimSpace(input.Title) == "" || strings.TrimSpace(input.Content) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "number, title, and content are required"})
+			return
+		}
+		visibility, err := normalizeVisibility(input.Visibility, "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		current, err := repo.GetChapter(id)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		if !canPublish(c, cmp.Or(visibility, current.Visibility)) || !canPublish(c, current.Visibility) {
+			respondRoleError(c, errPublishRequired)
+			return
+		}
+		input.Visibility = visibility
+		input.EditorID = c.GetInt("userID")
+		chapter, err := repo.UpdateChapter(id, input)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, chapter)
+	})
+
+	adminAuthed.DELETE("/chapters/:id", requirePermission(permChapterEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		chapter, err := repo.GetChapter(id)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		if !canPublish(c, chapter.Visibility) {
+			respondRoleError(c, errPublishRequired)
+			return
+		}
+		if err := repo.DeleteChapter(id); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	adminAuthed.GET("/chapters/:id/revisions", requirePermission(permChapterEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		items, err := repo.ListChapterRevisions(id)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+
+	adminAuthed.GET("/chapters/:id/revisions/:revision", requirePermission(permChapterEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		revision, err := repo.GetChapterRevision(id, parseID(c.Param("revision")))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, revision)
+	})
+
+	adminAuthed.GET("/chapters/:id/diff", requirePermission(permChapterEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		fromNumber, toNumber := parseID(c.Query("from")), parseID(c.Query("to"))
+		if fromNumber <= 0 || toNumber <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from and to revisions are required"})
+			return
+		}
+		from, err := repo.GetChapterRevision(id, fromNumber)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		to, err := repo.GetChapterRevision(id, toNumber)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		ops, added, removed := diffWords(from.Content, to.Content)
+		c.JSON(http.StatusOK, RevisionDiff{
+			ChapterID: id,
+			From:      from.Revision,
+			To:        to.Revision,
+			Added:     added,
+			Removed:   removed,
+			Ops:       ops,
+		})
+	})
+
+	adminAuthed.POST("/chapters/:id/revisions/:revision/restore", requirePermission(permChapterEdit), func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		current, err := repo.GetChapter(id)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		if !canPublish(c, current.Visibility) {
+			respondRoleError(c, errPublishRequired)
+			return
+		}
+		chapter, err := repo.RestoreChapterRevision(id, parseID(c.Param("revision")), c.GetInt("userID"))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, chapter)
+	})
+
+	router.GET("/chapters/:id/comments", func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		if _, ok := viewableChapter(c, id); !ok {
+			return
+		}
+		limit, ok := readCursorPagination(c)
+		if !ok {
+			return
+		}
+		query := CommentQuery{ChapterID: id, Cursor: c.Query("cursor"), Limit: limit}
+		if raw := c.Query("paragraph"); raw != "" {
+			paragraph, err := strconv.Atoi(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "paragraph must be a number"})
+				return
+			}
+			query.Paragraph = &paragraph
+		}
+		page, err := repo.QueryComments(query)
+		if err != nil {
+			respondListError(c, err)
+			return
+		}
+		writePageHeaders(c, page)
+		if strings.EqualFold(c.Query("view"), "flat") {
+			c.JSON(http.StatusOK, flattenCommentThreads(page.Items))
+			return
+		}
+		c.JSON(http.StatusOK, page.Items)
 	})
 
-	router.GET("/novels/:id/chapters", func(c *gin.Context) {
+	router.GET("/chapters/:id/paragraph-comments", func(c *gin.Context) {
 		id := parseID(c.Param("id"))
-		chapters, err := repo.ListChaptersByNovel(id)
+		if _, ok := viewableChapter(c, id); !ok {
+			return
+		}
+		counts, err := repo.ListParagraphCommentCounts(id)
 		if err != nil {
 			respondNotFound(c, err)
 			return
 		}
-		limit, offset := readPagination(c)
-		start, end := sliceRange(len(chapters), limit, offset)
-		c.JSON(http.StatusOK, chapters[start:end])
+		c.JSON(http.StatusOK, counts)
 	})
 
-	adminAuthed.POST("/novels/:id/chapters", func(c *gin.Context) {
+	userAuthed.POST("/chapters/:id/comments", verified, func(c *gin.Context) {
 		id := parseID(c.Param("id"))
-		var input ChapterInput
+		var input CommentInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if input.Number <= 0 || strings.TrimSpace(input.Title) == "" || strings.TrimSpace(input.Content) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "number, title, and content are required"})
+		input.UserID = c.GetInt("userID")
+		if strings.TrimSpace(input.Body) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "comment body is required"})
 			return
 		}
-		chapter, err := repo.CreateChapter(id, input)
-		if err != nil {
-			respondNotFound(c, err)
+		if _, ok := viewableChapter(c, id); !ok {
 			return
 		}
-		c.JSON(http.StatusCreated, chapter)
-	})
-
-	router.GET("/chapters/:id", func(c *gin.Context) {
-		id := parseID(c.Param("id"))
-		chapter, err := repo.GetChapter(id)
+		comment, err := repo.CreateComment(id, input)
 		if err != nil {
-			respondNotFound(c, err)
+			respondCommentError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, chapter)
+		c.JSON(http.StatusCreated, comment)
 	})
 
-	adminAuthed.PUT("/chapters/:id", func(c *gin.Context) {
+	userAuthed.PUT("/comments/:id", verified, func(c *gin.Context) {
 		id := parseID(c.Param("id"))
-		var input ChapterInput
+		var input CommentInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if input.Number <= 0 || strings.TrimSpace(input.Title) == "" || strings.TrimSpace(input.Content) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "number, title, and content are required"})
+		if strings.TrimSpace(input.Body) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "comment body is required"})
 			return
 		}
-		chapter, err := repo.UpdateChapter(id, input)
+		comment, err := repo.UpdateComment(id, c.GetInt("userID"), input.Body)
 		if err != nil {
-			respondNotFound(c, err)
+			respondCommentError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, chapter)
+		c.JSON(http.StatusOK, comment)
 	})
 
-	adminAuthed.DELETE("/chapters/:id", func(c *gin.Context) {
+	userAuthed.DELETE("/comments/:id", func(c *gin.Context) {
 		id := parseID(c.Param("id"))
-		if err := repo.DeleteChapter(id); err != nil {
-			respondNotFound(c, err)
+		moderator := slices.Contains(rolePermissions(repo, c.GetString("role")), permCommentModerate)
+		if err := repo.DeleteComment(id, c.GetInt("userID"), moderator); err != nil {
+			respondCommentError(c, err)
 			return
 		}
 		c.Status(http.StatusNoContent)
 	})
 
-	router.GET("/chapters/:id/comments", func(c *gin.Context) {
+	for method, active := range map[string]bool{http.MethodPut: true, http.MethodDelete: false} {
+		userAuthed.Handle(method, "/comments/:id/reactions/:emoji", func(c *gin.Context) {
+			id := parseID(c.Param("id"))
+			emoji, err := normalizeReaction(c.Param("emoji"))
+			if err != nil {
+				respondCommentError(c, err)
+				return
+			}
+			reactions, err := repo.SetCommentReaction(id, c.GetInt("userID"), emoji, active)
+			if err != nil {
+				respondCommentError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, reactions)
+		})
+	}
+
+	router.GET("/novels/:id/ratings", func(c *gin.Context) {
 		id := parseID(c.Param("id"))
-		comments, err := repo.ListCommentsByChapter(id)
+		if _, ok := viewableNovel(c, id); !ok {
+			return
+		}
+		limit, ok := readCursorPagination(c)
+		if !ok {
+			return
+		}
+		query := RatingQuery{
+			NovelID:     id,
+			Sort:        strings.ToLower(strings.TrimSpace(c.DefaultQuery("sort", "newest"))),
+			ReviewsOnly: c.Query("reviews") == "true",
+			Cursor:      c.Query("cursor"),
+			Limit:       limit,
+		}
+		if _, ok := ratingSortColumns[query.Sort]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be newest or helpful"})
+			return
+		}
+		page, err := repo.QueryRatings(query)
 		if err != nil {
-			respondNotFound(c, err)
+			respondListError(c, err)
 			return
 		}
-		limit, offset := readPagination(c)
-		start, end := sliceRange(len(comments), limit, offset)
-		c.JSON(http.StatusOK, comments[start:end])
+		writePageHeaders(c, page)
+		c.JSON(http.StatusOK, page.Items)
 	})
 
-	userAuthed.POST("/chapters/:id/comments", func(c *gin.Context) {
+	userAuthed.POST("/novels/:id/ratings", verified, func(c *gin.Context) {
 		id := parseID(c.Param("id"))
-		var input CommentInput
+		var input RatingInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if input.Score < 1 || input.Score > 5 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "score must be 1-5"})
+			return
+		}
+		if err := validateReview(input); err != nil {
+			respondReviewError(c, err)
+			return
+		}
 		input.UserID = c.GetInt("userID")
-		if strings.TrimSpace(input.Body) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "comment body is required"})
+		if _, ok := viewableNovel(c, id); !ok {
 			return
 		}
-		comment, err := repo.CreateComment(id, input)
+		rating, err := repo.CreateRating(id, input)
 		if err != nil {
 			respondNotFound(c, err)
 			return
 		}
-		c.JSON(http.StatusCreated, comment)
+		c.JSON(http.StatusCreated, rating)
 	})
 
-	router.GET("/novels/:id/ratings", func(c *gin.Context) {
+	router.GET("/novels/:id/ratings/summary", func(c *gin.Context) {
 		id := parseID(c.Param("id"))
-		ratings, err := repo.ListRatingsByNovel(id)
+		if _, ok := viewableNovel(c, id); !ok {
+			return
+		}
+		summary, err := repo.GetRatingSummary(id)
 		if err != nil {
 			respondNotFound(c, err)
 			return
 		}
-		limit, offset := readPagination(c)
-		start, end := sliceRange(len(ratings), limit, offset)
-		c.JSON(http.StatusOK, ratings[start:end])
+		c.JSON(http.StatusOK, summary)
 	})
 
-	userAuthed.POST("/novels/:id/ratings", func(c *gin.Context) {
+	userAuthed.PUT("/ratings/:id/vote", func(c *gin.Context) {
 		id := parseID(c.Param("id"))
-		var input RatingInput
+		var input RatingVoteInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if input.Score < 1 || input.Score > 5 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "score must be 1-5"})
+		rating, err := repo.VoteRating(id, c.GetInt("userID"), &input.Helpful)
+		if err != nil {
+			respondReviewError(c, err)
 			return
 		}
-		input.UserID = c.GetInt("userID")
-		rating, err := repo.CreateRating(id, input)
+		c.JSON(http.StatusOK, rating)
+	})
+
+	userAuthed.DELETE("/ratings/:id/vote", func(c *gin.Context) {
+		id := parseID(c.Param("id"))
+		rating, err := repo.VoteRating(id, c.GetInt("userID"), nil)
 		if err != nil {
-			respondNotFound(c, err)
+			respondReviewError(c, err)
 			return
 		}
-		c.JSON(http.StatusCreated, rating)
+		c.JSON(http.StatusOK, rating)
 	})
 
 	userAuthed.GET("/me/follows", func(c *gin.Context) {
@@ -762,6 +2188,95 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 		c.Status(http.StatusNoContent)
 	})
 
+	userAuthed.GET("/me/notifications", func(c *gin.Context) {
+		limit, ok := readCursorPagination(c)
+		if !ok {
+			return
+		}
+		page, err := repo.QueryNotifications(NotificationQuery{
+			UserID:     c.GetInt("userID"),
+			UnreadOnly: c.Query("unread") == "true",
+			Cursor:     c.Query("cursor"),
+			Limit:      limit,
+		})
+		if err != nil {
+			respondListError(c, err)
+			return
+		}
+		writePageHeaders(c, page)
+		c.JSON(http.StatusOK, page.Items)
+	})
+	userAuthed.GET("/me/notifications/unread-count", func(c *gin.Context) {
+		count, err := repo.CountUnreadNotifications(c.GetInt("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"unread": count})
+	})
+	userAuthed.POST("/me/notifications/:id/read", func(c *gin.Context) {
+		if err := repo.MarkNotificationRead(c.GetInt("userID"), parseID(c.Param("id"))); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	userAuthed.POST("/me/notifications/read-all", func(c *gin.Context) {
+		marked, err := repo.MarkAllNotificationsRead(c.GetInt("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"marked": marked})
+	})
+	userAuthed.GET("/me/notifications/preferences", func(c *gin.Context) {
+		items, err := repo.ListNotificationPreferences(c.GetInt("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+	userAuthed.PUT("/me/notifications/preferences/:novelId", func(c *gin.Context) {
+		var input NotificationPreferenceInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		item, err := repo.SetNotificationPreference(c.GetInt("userID"), parseID(c.Param("novelId")), input.Notify)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, item)
+	})
+	userAuthed.GET("/me/email-preferences", func(c *gin.Context) {
+		prefs, err := repo.GetEmailPreferences(c.GetInt("userID"))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, prefs)
+	})
+	userAuthed.PUT("/me/email-preferences", func(c *gin.Context) {
+		var input EmailPreferencesInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		digest, err := normalizeDigest(input.Digest)
+		if err != nil {
+			respondMailError(c, err)
+			return
+		}
+		prefs, err := repo.SetEmailDigest(c.GetInt("userID"), digest)
+		if err != nil {
+			respondMailError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, prefs)
+	})
+
 	userAuthed.GET("/me/bookmarks", func(c *gin.Context) {
 		userID := c.GetInt("userID")
 		items := repo.ListBookmarks(userID)
@@ -799,15 +2314,62 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 		c.Status(http.StatusNoContent)
 	})
 
+	userAuthed.GET("/me/continue", func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		limit, _ = clampPagination(limit, 0)
+		items, err := repo.ListContinueReading(c.GetInt("userID"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+	userAuthed.GET("/me/progress/:novelId", func(c *gin.Context) {
+		progress, err := repo.GetReadingProgress(c.GetInt("userID"), parseID(c.Param("novelId")))
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, progress)
+	})
+	userAuthed.PUT("/me/progress/:novelId", func(c *gin.Context) {
+		novelID := parseID(c.Param("novelId"))
+		var input ReadingProgressInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.ChapterID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "chapterId is required"})
+			return
+		}
+		if _, ok := viewableChapter(c, input.ChapterID); !ok {
+			return
+		}
+		progress, err := repo.SaveReadingProgress(c.GetInt("userID"), novelID, input)
+		if err != nil {
+			respondProgressError(c, err, progress)
+			return
+		}
+		c.JSON(http.StatusOK, progress)
+	})
+	userAuthed.DELETE("/me/progress/:novelId", func(c *gin.Context) {
+		if err := repo.DeleteReadingProgress(c.GetInt("userID"), parseID(c.Param("novelId"))); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
 	router.GET("/users", func(c *gin.Context) {
 		c.JSON(http.StatusOK, repo.ListUsers())
 	})
 
-	moderationAuthed.GET("/admin/users", func(c *gin.Context) {
+	moderationAuthed.GET("/admin/users", requirePermission(permUserManage), func(c *gin.Context) {
 		c.JSON(http.StatusOK, repo.ListAuthUsers())
 	})
 
-	moderationAuthed.PUT("/admin/users/:id/role", func(c *gin.Context) {
+	moderationAuthed.PUT("/admin/users/:id/role", requirePermission(permUserManage), func(c *gin.Context) {
 		userID := parseID(c.Param("id"))
 		if userID <= 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "id is required"})
@@ -828,8 +2390,17 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "role is required"})
 			return
 		}
-		if !isValidRole(role) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+		next, err := findRole(repo, role)
+		if err != nil {
+			respondRoleError(c, err)
+			return
+		}
+		if !canManageUser(c, repo, current) {
+			respondRoleError(c, errUserOutranks)
+			return
+		}
+		if !coversPermissions(c.GetStringSlice("permissions"), next.Permissions) {
+			respondRoleError(c, errRoleEscalation)
 			return
 		}
 		if strings.EqualFold(current.Role, "admin") && role != "admin" && isLastActiveAdmin(repo, current) {
@@ -844,7 +2415,7 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 		c.JSON(http.StatusOK, user)
 	})
 
-	moderationAuthed.PUT("/admin/users/:id/status", func(c *gin.Context) {
+	moderationAuthed.PUT("/admin/users/:id/status", requirePermission(permUserManage), func(c *gin.Context) {
 		userID := parseID(c.Param("id"))
 		if userID <= 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "id is required"})
@@ -855,6 +2426,10 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 			respondNotFound(c, err)
 			return
 		}
+		if !canManageUser(c, repo, current) {
+			respondRoleError(c, errUserOutranks)
+			return
+		}
 		var input UserStatusInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -881,7 +2456,7 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 		c.JSON(http.StatusOK, user)
 	})
 
-	moderationAuthed.DELETE("/admin/users/:id", func(c *gin.Context) {
+	moderationAuthed.DELETE("/admin/users/:id", requirePermission(permUserManage), func(c *gin.Context) {
 		userID := parseID(c.Param("id"))
 		if userID <= 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "id is required"})
@@ -892,6 +2467,10 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 			respondNotFound(c, err)
 			return
 		}
+		if !canManageUser(c, repo, current) {
+			respondRoleError(c, errUserOutranks)
+			return
+		}
 		if strings.EqualFold(current.Role, "admin") && isLastActiveAdmin(repo, current) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot delete the last active admin"})
 			return
@@ -903,12 +2482,43 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 		c.Status(http.StatusNoContent)
 	})
 
-	moderationAuthed.DELETE("/admin/users/:id/history", func(c *gin.Context) {
+	moderationAuthed.DELETE("/admin/users/:id/2fa", requirePermission(permUserManage), func(c *gin.Context) {
+		userID := parseID(c.Param("id"))
+		if userID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id is required"})
+			return
+		}
+		current, err := repo.GetAuthUserByID(userID)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		if !canManageUser(c, repo, current) {
+			respondRoleError(c, errUserOutranks)
+			return
+		}
+		if err := repo.DisableTwoFactor(userID); err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	moderationAuthed.DELETE("/admin/users/:id/history", requirePermission(permUserManage), func(c *gin.Context) {
 		userID := parseID(c.Param("id"))
 		if userID <= 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "id is required"})
 			return
 		}
+		current, err := repo.GetAuthUserByID(userID)
+		if err != nil {
+			respondNotFound(c, err)
+			return
+		}
+		if !canManageUser(c, repo, current) {
+			respondRoleError(c, errUserOutranks)
+			return
+		}
 		if err := repo.ClearReadingHistory(userID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -916,7 +2526,80 @@ func registerRoutes(router *gin.Engine, repo Repository, cfg Config) {
 		c.Status(http.StatusNoContent)
 	})
 
-	adminAuthed.POST("/users", func(c *gin.Context) {
+	adminAuthed.GET("/admin/permissions", requirePermission(permRoleManage), func(c *gin.Context) {
+		c.JSON(http.StatusOK, permissionCatalog)
+	})
+
+	adminAuthed.GET("/admin/roles", requirePermission(permRoleManage), func(c *gin.Context) {
+		items, err := listRoles(repo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	})
+
+	moderationAuthed.POST("/admin/roles", requirePermission(permRoleManage), func(c *gin.Context) {
+		var input RoleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input, err := normalizeRoleInput(input)
+		if err != nil {
+			respondRoleError(c, err)
+			return
+		}
+		if !coversPermissions(c.GetStringSlice("permissions"), input.Permissions) {
+			respondRoleError(c, errRoleEscalation)
+			return
+		}
+		role, err := repo.CreateRole(input)
+		if err != nil {
+			respondRoleError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, role)
+	})
+
+	moderationAuthed.PUT("/admin/roles/:name", requirePermission(permRoleManage), func(c *gin.Context) {
+		var input RoleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input.Name = c.Param("name")
+		input, err := normalizeRoleInput(input)
+		if err != nil {
+			respondRoleError(c, err)
+			return
+		}
+		if !coversPermissions(c.GetStringSlice("permissions"), input.Permissions) {
+			respondRoleError(c, errRoleEscalation)
+			return
+		}
+		role, err := repo.UpdateRole(input)
+		if err != nil {
+			respondRoleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, role)
+	})
+
+	moderationAuthed.DELETE("/admin/roles/:name", requirePermission(permRoleManage), func(c *gin.Context) {
+		name := normalizeRole(c.Param("name"))
+		if _, ok := builtinRole(name); ok {
+			respondRoleError(c, errRoleBuiltIn)
+			return
+		}
+		if err := repo.DeleteRole(name); err != nil {
+			respondRoleError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	adminAuthed.POST("/users", requirePermission(permUserManage), func(c *gin.Context) {
 		var input UserInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -946,8 +2629,23 @@ func apiKeyAuth(apiKey string) gin.HandlerFunc {
 	}
 }
 
-func moderationAccess(password string) gin.HandlerFunc {
+// moderationAccess guards user management. With stepUp it ignores the shared
+// password and instead wants the admin's session to have passed a two-factor
+// check within stepUpTTL, which API key requests cannot do. It runs after
+// adminAccess.
+func moderationAccess(password string, stepUp bool, stepUpTTL time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if stepUp {
+			twoFactorAt, _ := c.Get("twoFactorAt")
+			at, ok := twoFactorAt.(*time.Time)
+			if c.GetInt("sessionID") == 0 || !ok || at == nil || time.Since(*at) > stepUpTTL {
+				c.JSON(http.StatusForbidden, gin.H{"error": errStepUpRequired.Error(), "stepUpRequired": true})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
 		if strings.TrimSpace(password) == "" {
 			c.Next()
 			return
@@ -961,9 +2659,13 @@ func moderationAccess(password string) gin.HandlerFunc {
 	}
 }
 
-func adminAccess(apiKey string, secret string, repo Repository) gin.HandlerFunc {
+// adminAccess admits the API key and signed-in staff, meaning anyone whose
+// role grants at least one permission, and stores those permissions for
+// requirePermission. The API key holds every permission.
+func adminAccess(apiKey string, secret string, repo Repository, requireTwoFactor bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if apiKey != "" && c.GetHeader("X-API-Key") == apiKey {
+			c.Set("permissions", allPermissions())
 			c.Next()
 			return
 		}
@@ -971,7 +2673,7 @@ func adminAccess(apiKey string, secret string, repo Repository) gin.HandlerFunc
 		if strings.HasPrefix(header, "Bearer ") {
 			claims, err := parseToken(strings.TrimPrefix(header, "Bearer "), secret)
 			if err == nil {
-				user, userErr := repo.GetAuthUserByID(claims.UserID)
+				user, twoFactorAt, userErr := repo.GetSessionUser(claims.SessionID, claims.UserID)
 				if userErr != nil {
 					c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 					c.Abort()
@@ -982,9 +2684,17 @@ func adminAccess(apiKey string, secret string, repo Repository) gin.HandlerFunc
 					c.Abort()
 					return
 				}
-				if user.Role == "admin" {
+				if permissions := rolePermissions(repo, user.Role); len(permissions) > 0 {
+					if err := adminTwoFactorError(user, twoFactorAt, requireTwoFactor); err != nil {
+						c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+						c.Abort()
+						return
+					}
 					c.Set("userID", user.ID)
 					c.Set("role", user.Role)
+					c.Set("permissions", permissions)
+					c.Set("sessionID", claims.SessionID)
+					c.Set("twoFactorAt", twoFactorAt)
 					c.Next()
 					return
 				}
@@ -1009,7 +2719,7 @@ func userAuth(secret string, repo Repository) gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		user, userErr := repo.GetAuthUserByID(claims.UserID)
+		user, _, userErr := repo.GetSessionUser(claims.SessionID, claims.UserID)
 		if userErr != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			c.Abort()
@@ -1022,6 +2732,8 @@ func userAuth(secret string, repo Repository) gin.HandlerFunc {
 		}
 		c.Set("userID", user.ID)
 		c.Set("role", user.Role)
+		c.Set("emailVerified", user.EmailVerifiedAt != nil)
+		c.Set("sessionID", claims.SessionID)
 		c.Next()
 	}
 }
@@ -1044,6 +2756,22 @@ func readPagination(c *gin.Context) (int, int) {
 	return clampPagination(limit, offset)
 }
 
+// readListQuery accepts both repeated (?tag=a&tag=b) and comma-separated
+// (?tags=a,b) forms of a list parameter.
+func readListQuery(c *gin.Context, key string) []string {
+	values := append([]string{}, c.QueryArray(key)...)
+	values = append(values, c.QueryArray(strings.TrimSuffix(key, "s"))...)
+	items := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if trimmed := strings.TrimSpace(part); trimmed != "" {
+				items = append(items, trimmed)
+			}
+		}
+	}
+	return items
+}
+
 func sliceRange(length int, limit int, offset int) (int, int) {
 	if offset > length {
 		return length, length
@@ -1,6 +1,9 @@
 package main
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
 func slugify(input string) string {
 	clean := strings.ToLower(strings.TrimSpace(input))
@@ -21,3 +24,13 @@ func clampPagination(limit int, offset int) (int, int) {
 	}
 	return limit, offset
 }
+
+// retryBackoff is the wait before the next delivery attempt of an outbox
+// message or webhook: one minute, doubling per failure, capped at six hours.
+func retryBackoff(attempts int) time.Duration {
+	wait := time.Minute
+	for i := 1; i < attempts && wait < 6*time.Hour; i++ {
+		wait *= 2
+	}
+	return min(wait, 6*time.Hour)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"log"
+	"strconv"
+	"time"
+)
+
+// historyExportColumns is the header row of the CSV history export.
+var historyExportColumns = []string{
+	"read_at", "novel_id", "novel_slug", "novel_title", "chapter_id", "volume", "number", "chapter_title",
+}
+
+func writeHistoryCSV(w io.Writer, entries []*ReadingHistory) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(historyExportColumns); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := writer.Write([]string{
+			entry.ReadAt.UTC().Format(time.RFC3339),
+			strconv.Itoa(entry.NovelID),
+			entry.NovelSlug,
+			entry.NovelTitle,
+			strconv.Itoa(entry.ChapterID),
+			strconv.Itoa(entry.ChapterVolume),
+			strconv.Itoa(entry.ChapterNumber),
+			entry.ChapterTitle,
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// runHistoryCleanup deletes reading history older than retention every
+// interval until ctx is cancelled.
+func runHistoryCleanup(ctx context.Context, repo Repository, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		removed, err := repo.PruneReadingHistory(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("history cleanup: %v", err)
+		} else if removed > 0 {
+			log.Printf("history cleanup: removed %d entries", removed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
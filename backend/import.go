@@ -0,0 +1,946 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxImportSize caps how much of an uploaded manuscript is read into memory.
+const maxImportSize = 64 << 20
+
+var (
+	errUnsupportedImport = errors.New("unsupported import format; upload .epub, .docx, .md or a .zip of markdown files")
+	errImportTooLarge    = errors.New("archive expands to more than 64 MB")
+)
+
+var (
+	chapterHeadingPattern = regexp.MustCompile(`(?i)^\s*(?:(?:vol(?:ume)?|book)\.?\s*(\d+)\s*[,:.\-–—]?\s*)?(?:chapter|ch\.?|episode|ep\.?)\s*(\d+)\s*(?:[:.\-–—]\s*)?(.*)$`)
+	volumeHeadingPattern  = regexp.MustCompile(`(?i)^\s*(?:vol(?:ume)?|book)\.?\s*(\d+)\b\s*[:.\-–—]?\s*(.*)$`)
+	markdownImagePattern  = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+	markdownHeadingLine   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	docxHeadingStyle      = regexp.MustCompile(`(?i)^heading\s*(\d)$`)
+)
+
+type importImage struct {
+	Name string
+	Data []byte
+	URL  string
+}
+
+// importBlock is one paragraph of an imported chapter, either text or an image.
+type importBlock struct {
+	Text  string
+	Image *importImage
+}
+
+// importDraft is one chapter split out of an upload. Source is the file it
+// came from inside an archive, used when the heading carries no number.
+type importDraft struct {
+	Title  string
+	Number int
+	Volume int
+	Source string
+	Blocks []importBlock
+}
+
+func (d *importDraft) addText(text string) {
+	if trimmed := strings.TrimSpace(text); trimmed != "" {
+		d.Blocks = append(d.Blocks, importBlock{Text: trimmed})
+	}
+}
+
+func (d *importDraft) content() string {
+	parts := make([]string, 0, len(d.Blocks))
+	for _, block := range d.Blocks {
+		if block.Image != nil {
+			ref := block.Image.URL
+			if ref == "" {
+				ref = "import:" + block.Image.Name
+			}
+			parts = append(parts, "[[img:"+ref+"]]")
+			continue
+		}
+		parts = append(parts, block.Text)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (d *importDraft) images() []*importImage {
+	items := make([]*importImage, 0)
+	for _, block := range d.Blocks {
+		if block.Image != nil {
+			items = append(items, block.Image)
+		}
+	}
+	return items
+}
+
+func detectImportFormat(filename, requested string) string {
+	if requested = strings.ToLower(strings.TrimSpace(requested)); requested != "" {
+		return requested
+	}
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".epub":
+		return "epub"
+	case ".docx":
+		return "docx"
+	case ".md", ".markdown":
+		return "markdown"
+	case ".zip":
+		return "markdown-zip"
+	default:
+		return ""
+	}
+}
+
+// parseImport splits an uploaded manuscript into chapter drafts.
+func parseImport(data []byte, options ImportOptions) ([]*importDraft, []string, error) {
+	var drafts []*importDraft
+	var err error
+	switch options.Format {
+	case "epub":
+		drafts, err = parseEPUBImport(data)
+	case "docx":
+		drafts, err = parseDOCXImport(data, options.HeadingLevel)
+	case "markdown":
+		drafts = parseMarkdownDocument(string(data), options.HeadingLevel, nil)
+	case "markdown-zip":
+		drafts, err = parseMarkdownZipImport(data, options.HeadingLevel)
+	default:
+		return nil, nil, errUnsupportedImport
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kept := make([]*importDraft, 0, len(drafts))
+	for _, draft := range drafts {
+		if len(draft.Blocks) > 0 {
+			kept = append(kept, draft)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, nil, errors.New("no chapters found in file")
+	}
+	warnings := assignChapterNumbers(kept, options)
+	return kept, warnings, nil
+}
+
+// assignChapterNumbers applies numbers and volumes detected from headings and
+// fills the gaps sequentially from options.StartNumber.
+func assignChapterNumbers(drafts []*importDraft, options ImportOptions) []string {
+	warnings := make([]string, 0)
+	next := options.StartNumber
+	if next < 1 {
+		next = 1
+	}
+	volume := options.Volume
+	if volume < 1 {
+		volume = 1
+	}
+	seen := make(map[string]bool)
+	for i, draft := range drafts {
+		if draft.Volume > 0 {
+			volume = draft.Volume
+		}
+		draft.Volume = volume
+		if match := chapterHeadingPattern.FindStringSubmatch(draft.Title); match != nil {
+			if match[1] != "" {
+				draft.Volume, _ = strconv.Atoi(match[1])
+				volume = draft.Volume
+			}
+			draft.Number, _ = strconv.Atoi(match[2])
+			draft.Title = strings.TrimSpace(match[3])
+			if draft.Title == "" {
+				draft.Title = fmt.Sprintf("Chapter %d", draft.Number)
+			}
+		} else if match := chapterHeadingPattern.FindStringSubmatch(draft.Source); match != nil {
+			draft.Number, _ = strconv.Atoi(match[2])
+		} else if digits := leadingDigits(draft.Source); digits > 0 {
+			draft.Number, _ = strconv.Atoi(draft.Source[:digits])
+		}
+		if draft.Number <= 0 {
+			draft.Number = next
+		}
+		next = draft.Number + 1
+		if strings.TrimSpace(draft.Title) == "" {
+			draft.Title = fmt.Sprintf("Chapter %d", draft.Number)
+			warnings = append(warnings, fmt.Sprintf("section %d has no heading; titled %q", i+1, draft.Title))
+		}
+		key := fmt.Sprintf("%d/%d", draft.Volume, draft.Number)
+		if seen[key] {
+			warnings = append(warnings, fmt.Sprintf("chapter %d appears more than once in volume %d", draft.Number, draft.Volume))
+		}
+		seen[key] = true
+	}
+	return warnings
+}
+
+func buildImportPreview(format string, drafts []*importDraft, warnings []string) *ImportPreview {
+	preview := &ImportPreview{
+		Format:   format,
+		Chapters: make([]*ImportPreviewChapter, 0, len(drafts)),
+		Warnings: warnings,
+		DryRun:   true,
+	}
+	for _, draft := range drafts {
+		content := draft.content()
+		images := len(draft.images())
+		preview.Images += images
+		excerpt := strings.Join(strings.Fields(imageMarkerPattern.ReplaceAllString(content, "")), " ")
+		if runes := []rune(excerpt); len(runes) > 200 {
+			excerpt = string(runes[:200]) + "…"
+		}
+		preview.Chapters = append(preview.Chapters, &ImportPreviewChapter{
+			Number:    draft.Number,
+			Volume:    draft.Volume,
+			Title:     draft.Title,
+			WordCount: len(strings.Fields(content)),
+			Images:    images,
+			Excerpt:   excerpt,
+		})
+	}
+	return preview
+}
+
+// warnExistingChapters flags drafts whose number is already taken in the novel.
+func warnExistingChapters(drafts []*importDraft, existing []*Chapter) []string {
+	taken := make(map[int]bool, len(existing))
+	for _, chapter := range existing {
+		taken[chapter.Number] = true
+	}
+	warnings := make([]string, 0)
+	for _, draft := range drafts {
+		if taken[draft.Number] {
+			warnings = append(warnings, fmt.Sprintf("chapter %d already exists in this novel", draft.Number))
+		}
+	}
+	return warnings
+}
+
+// commitImport saves the extracted images, creates every chapter in one
+// transaction and then records the images as illustrations. Saved files are
+// removed if the chapters fail. Once the chapters exist the import has
+// succeeded, so an illustration that fails to record is only logged; its file
+// is still served from the chapter. An empty visibility publishes the
+// chapters.
+func commitImport(repo Repository, novelID int, drafts []*importDraft, visibility string) ([]*Chapter, error) {
+	saved := make([]string, 0)
+	cleanup := func() {
+		for _, url := range saved {
+			_ = os.Remove(filepath.Join("uploads", path.Base(url)))
+		}
+	}
+	for _, draft := range drafts {
+		for _, image := range draft.images() {
+			if image.URL != "" {
+				continue
+			}
+			url, err := saveUploadBytes(image.Name, "illustration", image.Data)
+			if err != nil {
+				cleanup()
+				return nil, err
+			}
+			saved = append(saved, url)
+			image.URL = url
+		}
+	}
+
+	inputs := make([]ChapterInput, 0, len(drafts))
+	for _, draft := range drafts {
+		inputs = append(inputs, ChapterInput{
+			Number:     draft.Number,
+			Volume:     draft.Volume,
+			Title:      draft.Title,
+			Content:    draft.content(),
+			Visibility: visibility,
+		})
+	}
+	chapters, err := repo.CreateChapters(novelID, inputs)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	recorded := make(map[*importImage]bool)
+	for _, draft := range drafts {
+		for _, image := range draft.images() {
+			if recorded[image] {
+				continue
+			}
+			recorded[image] = true
+			if _, err := repo.CreateIllustration(IllustrationInput{URL: image.URL, OriginalName: image.Name}); err != nil {
+				log.Printf("import: record illustration %s for novel %d: %v", image.URL, novelID, err)
+			}
+		}
+	}
+	return chapters, nil
+}
+
+// zipArchive indexes an uploaded archive by cleaned path. remaining is how
+// many more decompressed bytes may be read from it, so that many small
+// entries cannot add up to more than maxImportSize between them.
+type zipArchive struct {
+	files     map[string]*zip.File
+	remaining int64
+}
+
+// readZip opens an in-memory archive and indexes its files by cleaned path.
+func readZip(data []byte) (*zipArchive, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	archive := &zipArchive{files: make(map[string]*zip.File, len(reader.File)), remaining: maxImportSize}
+	for _, file := range reader.File {
+		archive.files[path.Clean(file.Name)] = file
+	}
+	return archive, nil
+}
+
+// readZipFile decompresses one entry and charges it against the archive's
+// remaining budget.
+func readZipFile(archive *zipArchive, name string) ([]byte, error) {
+	file, ok := archive.files[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("missing %s in archive", name)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, archive.remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > archive.remaining {
+		archive.remaining = 0
+		return nil, errImportTooLarge
+	}
+	archive.remaining -= int64(len(data))
+	return data, nil
+}
+
+func parseEPUBImport(data []byte) ([]*importDraft, error) {
+	archive, err := readZip(data)
+	if err != nil {
+		return nil, err
+	}
+	containerXML, err := readZipFile(archive, "META-INF/container.xml")
+	if err != nil {
+		return nil, err
+	}
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.Unmarshal(containerXML, &container); err != nil || len(container.Rootfiles) == 0 {
+		return nil, errors.New("invalid EPUB container")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	opfXML, err := readZipFile(archive, opfPath)
+	if err != nil {
+		return nil, err
+	}
+	var pkg struct {
+		Manifest []struct {
+			ID         string `xml:"id,attr"`
+			Href       string `xml:"href,attr"`
+			MediaType  string `xml:"media-type,attr"`
+			Properties string `xml:"properties,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := xml.Unmarshal(opfXML, &pkg); err != nil {
+		return nil, errors.New("invalid EPUB package document")
+	}
+	baseDir := path.Dir(opfPath)
+	hrefs := make(map[string]string)
+	toc := make(map[string]epubTOCEntry)
+	for _, item := range pkg.Manifest {
+		itemPath := resolveArchivePath(baseDir, item.Href)
+		switch {
+		case strings.Contains(item.Properties, "nav"):
+			document, err := readZipFile(archive, itemPath)
+			if errors.Is(err, errImportTooLarge) {
+				return nil, err
+			}
+			if err == nil {
+				readNavTOC(document, path.Dir(itemPath), toc)
+			}
+			continue
+		case item.MediaType == "application/x-dtbncx+xml" && len(toc) == 0:
+			document, err := readZipFile(archive, itemPath)
+			if errors.Is(err, errImportTooLarge) {
+				return nil, err
+			}
+			if err == nil {
+				readNCXTOC(document, path.Dir(itemPath), toc)
+			}
+			continue
+		}
+		hrefs[item.ID] = itemPath
+	}
+
+	images := make(map[string]*importImage)
+	drafts := make([]*importDraft, 0, len(pkg.Spine))
+	for _, itemref := range pkg.Spine {
+		docPath, ok := hrefs[itemref.IDRef]
+		if !ok {
+			continue
+		}
+		// With a table of contents, spine items it leaves out (covers, title
+		// pages, copyright notices) are not chapters.
+		entry, listed := toc[docPath]
+		if len(toc) > 0 && !listed {
+			continue
+		}
+		document, err := readZipFile(archive, docPath)
+		if err != nil {
+			return nil, err
+		}
+		draft := &importDraft{}
+		for _, block := range extractHTMLBlocks(document) {
+			switch {
+			case block.image != "":
+				imagePath := resolveArchivePath(path.Dir(docPath), block.image)
+				image, err := loadArchiveImage(archive, images, imagePath)
+				if err != nil {
+					return nil, err
+				}
+				if image != nil {
+					draft.Blocks = append(draft.Blocks, importBlock{Image: image})
+				}
+			case block.heading > 0 && draft.Title == "" && len(draft.Blocks) == 0:
+				draft.Title = block.text
+			default:
+				draft.addText(block.text)
+			}
+		}
+		if !draftHasText(draft) {
+			continue
+		}
+		if entry.Label != "" && (draft.Title == "" || chapterHeadingPattern.MatchString(entry.Label)) {
+			draft.Title = entry.Label
+		}
+		draft.Volume = entry.Volume
+		drafts = append(drafts, draft)
+	}
+	return drafts, nil
+}
+
+type epubTOCEntry struct {
+	Label  string
+	Volume int
+}
+
+type navList struct {
+	Items []navItem `xml:"li"`
+}
+
+type navItem struct {
+	Link struct {
+		Href  string `xml:"href,attr"`
+		Label string `xml:",innerxml"`
+	} `xml:"a"`
+	Span     string   `xml:"span"`
+	Children *navList `xml:"ol"`
+}
+
+type ncxPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Children []ncxPoint `xml:"navPoint"`
+}
+
+// readNavTOC indexes the EPUB 3 navigation document's toc by chapter file.
+func readNavTOC(document []byte, baseDir string, toc map[string]epubTOCEntry) {
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "nav" || xmlAttr(start, "type") != "toc" {
+			continue
+		}
+		var nav struct {
+			List navList `xml:"ol"`
+		}
+		if err := decoder.DecodeElement(&nav, &start); err != nil {
+			return
+		}
+		var walk func(list *navList, volume int)
+		walk = func(list *navList, volume int) {
+			for _, item := range list.Items {
+				label := collapseSpaces(stripTags(item.Link.Label))
+				if label == "" {
+					label = collapseSpaces(item.Span)
+				}
+				if item.Children != nil {
+					if match := volumeHeadingPattern.FindStringSubmatch(label); match != nil {
+						childVolume, _ := strconv.Atoi(match[1])
+						walk(item.Children, childVolume)
+						continue
+					}
+					walk(item.Children, volume)
+				}
+				addTOCEntry(toc, resolveArchivePath(baseDir, item.Link.Href), item.Link.Href, label, volume)
+			}
+		}
+		walk(&nav.List, 0)
+		return
+	}
+}
+
+// readNCXTOC is the EPUB 2 fallback for readNavTOC.
+func readNCXTOC(document []byte, baseDir string, toc map[string]epubTOCEntry) {
+	var ncx struct {
+		Points []ncxPoint `xml:"navMap>navPoint"`
+	}
+	if err := xml.Unmarshal(document, &ncx); err != nil {
+		return
+	}
+	var walk func(points []ncxPoint, volume int)
+	walk = func(points []ncxPoint, volume int) {
+		for _, point := range points {
+			label := collapseSpaces(point.Label)
+			if len(point.Children) > 0 {
+				if match := volumeHeadingPattern.FindStringSubmatch(label); match != nil {
+					childVolume, _ := strconv.Atoi(match[1])
+					walk(point.Children, childVolume)
+					continue
+				}
+				walk(point.Children, volume)
+			}
+			addTOCEntry(toc, resolveArchivePath(baseDir, point.Content.Src), point.Content.Src, label, volume)
+		}
+	}
+	walk(ncx.Points, 0)
+}
+
+func addTOCEntry(toc map[string]epubTOCEntry, docPath, href, label string, volume int) {
+	if href == "" {
+		return
+	}
+	if _, ok := toc[docPath]; !ok {
+		toc[docPath] = epubTOCEntry{Label: label, Volume: volume}
+	}
+}
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+func stripTags(fragment string) string {
+	return html.UnescapeString(htmlTagPattern.ReplaceAllString(fragment, ""))
+}
+
+// draftHasText skips cover pages and other image-only spine items.
+func draftHasText(draft *importDraft) bool {
+	for _, block := range draft.Blocks {
+		if block.Image == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func resolveArchivePath(baseDir, href string) string {
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	if cut := strings.IndexAny(href, "#?"); cut >= 0 {
+		href = href[:cut]
+	}
+	return path.Clean(path.Join(baseDir, href))
+}
+
+// loadArchiveImage reads an image a chapter references. Entries that are
+// missing, or that are not raster images by both extension and content, are
+// skipped: they would otherwise be served from uploads/ as HTML or SVG.
+func loadArchiveImage(archive *zipArchive, cache map[string]*importImage, name string) (*importImage, error) {
+	if image, ok := cache[name]; ok {
+		return image, nil
+	}
+	if _, ok := archive.files[name]; !ok || !rasterImageExt(name) {
+		return nil, nil
+	}
+	data, err := readZipFile(archive, name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, nil
+	}
+	image := &importImage{Name: path.Base(name), Data: data}
+	cache[name] = image
+	return image, nil
+}
+
+// rasterImageExt reports whether name has the extension of an image type
+// browsers display without running anything. SVG is refused because it can
+// carry script.
+func rasterImageExt(name string) bool {
+	mediaType, _, _ := strings.Cut(mime.TypeByExtension(strings.ToLower(path.Ext(name))), ";")
+	return strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml"
+}
+
+type htmlBlock struct {
+	heading int
+	text    string
+	image   string
+}
+
+// extractHTMLBlocks flattens an (X)HTML document into headings, paragraphs
+// and images in reading order.
+func extractHTMLBlocks(document []byte) []htmlBlock {
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	blocks := make([]htmlBlock, 0)
+	var text strings.Builder
+	heading := 0
+	inBody := false
+	skipDepth := 0
+	flush := func() {
+		if trimmed := strings.TrimSpace(text.String()); trimmed != "" {
+			blocks = append(blocks, htmlBlock{heading: heading, text: collapseSpaces(trimmed)})
+		}
+		text.Reset()
+		heading = 0
+	}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(element.Name.Local)
+			switch {
+			case name == "body":
+				inBody = true
+			case name == "script" || name == "style" || name == "head":
+				skipDepth++
+			case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6':
+				flush()
+				heading = int(name[1] - '0')
+			case name == "p" || name == "div" || name == "li" || name == "blockquote" || name == "section":
+				flush()
+			case name == "br":
+				text.WriteString("\n")
+			case name == "img" || name == "image":
+				for _, attr := range element.Attr {
+					if attr.Name.Local == "src" || attr.Name.Local == "href" {
+						flush()
+						blocks = append(blocks, htmlBlock{image: attr.Value})
+						break
+					}
+				}
+			}
+		case xml.EndElement:
+			name := strings.ToLower(element.Name.Local)
+			switch {
+			case name == "script" || name == "style" || name == "head":
+				if skipDepth > 0 {
+					skipDepth--
+				}
+			case name == "p" || name == "div" || name == "li" || name == "blockquote" || name == "section" ||
+				(len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6'):
+				flush()
+			}
+		case xml.CharData:
+			if inBody && skipDepth == 0 {
+				text.Write(element)
+			}
+		}
+	}
+	flush()
+	return blocks
+}
+
+func collapseSpaces(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func parseDOCXImport(data []byte, headingLevel int) ([]*importDraft, error) {
+	if headingLevel < 1 {
+		headingLevel = 1
+	}
+	archive, err := readZip(data)
+	if err != nil {
+		return nil, err
+	}
+	document, err := readZipFile(archive, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	relationships := make(map[string]string)
+	rels, err := readZipFile(archive, "word/_rels/document.xml.rels")
+	if errors.Is(err, errImportTooLarge) {
+		return nil, err
+	}
+	if err == nil {
+		var parsed struct {
+			Items []struct {
+				ID     string `xml:"Id,attr"`
+				Target string `xml:"Target,attr"`
+			} `xml:"Relationship"`
+		}
+		if err := xml.Unmarshal(rels, &parsed); err == nil {
+			for _, item := range parsed.Items {
+				relationships[item.ID] = resolveArchivePath("word", item.Target)
+			}
+		}
+	}
+
+	images := make(map[string]*importImage)
+	drafts := make([]*importDraft, 0)
+	current := &importDraft{}
+	volume := 0
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+
+	var text strings.Builder
+	style := ""
+	var paragraphImages []*importImage
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid DOCX document: %w", err)
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "p":
+				text.Reset()
+				style = ""
+				paragraphImages = nil
+			case "pStyle":
+				style = xmlAttr(element, "val")
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			case "blip":
+				if target, ok := relationships[xmlAttr(element, "embed")]; ok {
+					image, err := loadArchiveImage(archive, images, target)
+					if err != nil {
+						return nil, err
+					}
+					if image != nil {
+						paragraphImages = append(paragraphImages, image)
+					}
+				}
+			case "t":
+				var value string
+				if err := decoder.DecodeElement(&value, &element); err == nil {
+					text.WriteString(value)
+				}
+			}
+		case xml.EndElement:
+			if element.Name.Local != "p" {
+				continue
+			}
+			paragraph := strings.TrimSpace(text.String())
+			level := docxHeadingLevel(style)
+			switch {
+			case level != 0 && level < headingLevel:
+				// Headings above the split level mark volumes when they say so.
+				if match := volumeHeadingPattern.FindStringSubmatch(paragraph); match != nil {
+					volume, _ = strconv.Atoi(match[1])
+				}
+			case level == headingLevel && paragraph != "":
+				drafts = append(drafts, current)
+				current = &importDraft{Title: paragraph, Volume: volume}
+			default:
+				current.addText(paragraph)
+			}
+			for _, image := range paragraphImages {
+				current.Blocks = append(current.Blocks, importBlock{Image: image})
+			}
+		}
+	}
+	drafts = append(drafts, current)
+	return drafts, nil
+}
+
+// docxHeadingLevel returns the outline level of a paragraph style; the
+// document Title sits above every heading.
+func docxHeadingLevel(style string) int {
+	if strings.EqualFold(style, "Title") {
+		return -1
+	}
+	if match := docxHeadingStyle.FindStringSubmatch(style); match != nil {
+		level, _ := strconv.Atoi(match[1])
+		return level
+	}
+	return 0
+}
+
+func xmlAttr(element xml.StartElement, local string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func parseMarkdownZipImport(data []byte, headingLevel int) ([]*importDraft, error) {
+	archive, err := readZip(data)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for name, file := range archive.files {
+		ext := strings.ToLower(path.Ext(name))
+		if file.FileInfo().IsDir() || (ext != ".md" && ext != ".markdown") {
+			continue
+		}
+		if strings.HasPrefix(path.Base(name), ".") || strings.HasPrefix(name, "__MACOSX/") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return naturalLess(names[i], names[j]) })
+
+	images := make(map[string]*importImage)
+	drafts := make([]*importDraft, 0, len(names))
+	for _, name := range names {
+		document, err := readZipFile(archive, name)
+		if err != nil {
+			return nil, err
+		}
+		resolve := func(ref string) (*importImage, error) {
+			return loadArchiveImage(archive, images, resolveArchivePath(path.Dir(name), ref))
+		}
+		// Each file is one chapter; headings only provide its title.
+		source := strings.TrimSuffix(path.Base(name), path.Ext(name))
+		for _, draft := range parseMarkdownDocument(string(document), 0, resolve) {
+			draft.Source = source
+			drafts = append(drafts, draft)
+		}
+	}
+	return drafts, nil
+}
+
+// parseMarkdownDocument splits markdown at headings of headingLevel (0 keeps
+// the whole document as one chapter titled by its first heading).
+func parseMarkdownDocument(document string, headingLevel int, resolve func(string) (*importImage, error)) []*importDraft {
+	if headingLevel < 0 {
+		headingLevel = 0
+	}
+	drafts := make([]*importDraft, 0)
+	current := &importDraft{}
+	volume := 0
+	var paragraph []string
+	flush := func() {
+		text := strings.Join(paragraph, " ")
+		paragraph = nil
+		last := 0
+		for _, match := range markdownImagePattern.FindAllStringSubmatchIndex(text, -1) {
+			current.addText(text[last:match[0]])
+			last = match[1]
+			ref := text[match[2]:match[3]]
+			if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+				current.addText("[[img:" + ref + "]]")
+				continue
+			}
+			if resolve == nil {
+				continue
+			}
+			if image, err := resolve(ref); err == nil && image != nil {
+				current.Blocks = append(current.Blocks, importBlock{Image: image})
+			}
+		}
+		current.addText(text[last:])
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(document, "\r\n", "\n"), "\n") {
+		if match := markdownHeadingLine.FindStringSubmatch(line); match != nil {
+			level := len(match[1])
+			title := strings.TrimSpace(match[2])
+			flush()
+			switch {
+			case headingLevel == 0 && current.Title == "" && len(current.Blocks) == 0:
+				current.Title = title
+			case headingLevel > 0 && level < headingLevel && volumeHeadingPattern.MatchString(title):
+				volume, _ = strconv.Atoi(volumeHeadingPattern.FindStringSubmatch(title)[1])
+			case headingLevel > 0 && level == headingLevel:
+				drafts = append(drafts, current)
+				current = &importDraft{Title: title, Volume: volume}
+			default:
+				current.addText(title)
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		paragraph = append(paragraph, strings.TrimSpace(line))
+	}
+	flush()
+	return append(drafts, current)
+}
+
+// naturalLess orders "ch2.md" before "ch10.md".
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		ai, bi := leadingDigits(a), leadingDigits(b)
+		if ai > 0 && bi > 0 {
+			an, _ := strconv.Atoi(a[:ai])
+			bn, _ := strconv.Atoi(b[:bi])
+			if an != bn {
+				return an < bn
+			}
+			a, b = a[ai:], b[bi:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func leadingDigits(value string) int {
+	count := 0
+	for count < len(value) && value[count] >= '0' && value[count] <= '9' {
+		count++
+	}
+	return count
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func TestLoadArchiveImage(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01")
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
+	page := []byte(`<!DOCTYPE html><html><script>alert(1)</script></html>`)
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, data := range map[string][]byte{
+		"images/map.png":       png,
+		"images/Cover.JPG":     jpeg,
+		"images/logo.svg":      svg,
+		"images/page.html":     page,
+		"images/disguised.png": page,
+		"images/noext":         png,
+	} {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write(data)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := readZip(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"images/map.png", true},
+		{"images/Cover.JPG", true},
+		{"images/logo.svg", false},
+		{"images/page.html", false},
+		{"images/disguised.png", false},
+		{"images/noext", false},
+		{"images/missing.png", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image, err := loadArchiveImage(archive, make(map[string]*importImage), tt.name)
+			if err != nil {
+				t.Fatalf("loadArchiveImage: %v", err)
+			}
+			if (image != nil) != tt.want {
+				t.Errorf("loaded = %t, want %t", image != nil, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadZipFileTotalLimit(t *testing.T) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, name := range []string{"a.md", "b.md"} {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write(bytes.Repeat([]byte("x"), 600))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := readZip(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.remaining = 1000
+	if _, err := readZipFile(archive, "a.md"); err != nil {
+		t.Fatalf("first entry: %v", err)
+	}
+	if _, err := readZipFile(archive, "b.md"); err != errImportTooLarge {
+		t.Errorf("second entry error = %v, want errImportTooLarge", err)
+	}
+}
@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*
+var templateFiles embed.FS
+
+// Branding is the site identity shared by every template, normally taken
+// from the site settings.
+type Branding struct {
+	SiteName    string
+	Tagline     string
+	LogoURL     string
+	AccentColor string
+	SiteURL     string
+}
+
+// templateData is what templates see: the branding as .Brand and the
+// message-specific values as .Data.
+type templateData struct {
+	Brand Branding
+	Data  any
+}
+
+// Render builds the message named name for to. templates/<name>.txt defines
+// "subject" and "text"; templates/<name>.html, when present, defines the
+// "content" placed inside layout.html.
+func Render(name string, to string, brand Branding, data any) (Message, error) {
+	if brand.AccentColor == "" {
+		brand.AccentColor = "#18181b"
+	}
+	values := templateData{Brand: brand, Data: data}
+	msg := Message{To: to}
+
+	text, err := texttemplate.ParseFS(templateFiles, "templates/"+name+".txt")
+	if err != nil {
+		return Message{}, err
+	}
+	var buf bytes.Buffer
+	if err := text.ExecuteTemplate(&buf, "subject", values); err != nil {
+		return Message{}, err
+	}
+	msg.Subject = strings.Join(strings.Fields(buf.String()), " ")
+	buf.Reset()
+	if err := text.ExecuteTemplate(&buf, "text", values); err != nil {
+		return Message{}, err
+	}
+	msg.Text = strings.TrimSpace(buf.String()) + "\n"
+
+	if _, err := templateFiles.Open("templates/" + name + ".html"); err != nil {
+		return msg, nil
+	}
+	html, err := htmltemplate.ParseFS(templateFiles, "templates/layout.html", "templates/"+name+".html")
+	if err != nil {
+		return Message{}, err
+	}
+	buf.Reset()
+	if err := html.ExecuteTemplate(&buf, "layout", values); err != nil {
+		return Message{}, err
+	}
+	msg.HTML = buf.String()
+	return msg, nil
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -11,16 +13,51 @@ import (
 
 func main() {
 	cfg := LoadConfig()
-	store := NewStore()
 	db, err := OpenDB(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
-	if err := RunMigrations(db); err != nil {
-		log.Fatal(err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(db, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
+	if cfg.DBAutoMigrate {
+		if err := RunMigrations(db); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cfg.ModerationStepUp && cfg.ModerationPassword != "" {
+		log.Print("MODERATION_STEP_UP is on, so MODERATION_PASSWORD is ignored")
+	}
+	store := NewStore()
 	repo := NewAppRepository(store, db)
+	if cfg.ReleaseInterval > 0 {
+		go runReleaseScheduler(context.Background(), repo, cfg.ReleaseInterval)
+	}
+	if cfg.ViewWindow > 0 {
+		go runViewPruner(context.Background(), repo, cfg.ViewWindow)
+	}
+	if cfg.HistoryRetention > 0 && cfg.HistoryCleanup > 0 {
+		go runHistoryCleanup(context.Background(), repo, cfg.HistoryRetention, cfg.HistoryCleanup)
+	}
+	if cfg.SessionCleanup > 0 {
+		go runSessionCleanup(context.Background(), repo, cfg.SessionCleanup)
+	}
+	if cfg.NotifyInterval > 0 {
+		go runNotificationDispatcher(context.Background(), repo, cfg.NotifyInterval)
+	}
+	if cfg.MailInterval > 0 {
+		go runMailDispatcher(context.Background(), repo, newMailer(cfg), cfg.MailInterval)
+	}
+	if cfg.DigestInterval > 0 {
+		go runDigestScheduler(context.Background(), repo, cfg.SiteURL, cfg.DigestInterval)
+	}
+	if cfg.WebhookInterval > 0 {
+		go runWebhookDispatcher(context.Background(), repo, &http.Client{Timeout: cfg.WebhookTimeout}, cfg.SiteURL, cfg.WebhookInterval)
+	}
 	router := gin.Default()
 	corsConfig := cors.DefaultConfig()
 	if len(cfg.CorsOrigins) > 0 {
@@ -30,6 +67,7 @@ func main() {
 		corsConfig.AllowAllOrigins = true
 	}
 	corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, "Authorization", "X-API-Key", "X-Moderation-Password")
+	corsConfig.ExposeHeaders = append(corsConfig.ExposeHeaders, "X-Total-Count", "X-Next-Cursor")
 	router.Use(cors.New(corsConfig))
 	if len(cfg.TrustedProxies) > 0 {
 		if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the pg_advisory_lock key held while migrations run so
+// replicas booting at the same time apply each version exactly once.
+const migrationLockKey int64 = 7316420514
+
+type migrationFunc func(tx *sql.Tx) error
+
+type migration struct {
+	Version int
+	Name    string
+	Up      migrationFunc
+	Down    migrationFunc
+}
+
+type migrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// dataMigrations are Go migrations that run in the same sequence as the SQL
+// files. A nil Down makes the rollback a no-op.
+var dataMigrations = []migration{
+	{Version: 2, Name: "chapter_content_to_text", Up: migrateChapterContentToText},
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		rawVersion, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", name)
+		}
+		contents, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+		item, ok := byVersion[version]
+		if !ok {
+			item = &migration{Version: version, Name: label}
+			byVersion[version] = item
+		} else if item.Name != label {
+			return nil, fmt.Errorf("migration %d has mismatched names %q and %q", version, item.Name, label)
+		}
+		run := sqlMigration(string(contents))
+		if direction == "up" {
+			item.Up = run
+		} else {
+			item.Down = run
+		}
+	}
+	for _, data := range dataMigrations {
+		if _, ok := byVersion[data.Version]; ok {
+			return nil, fmt.Errorf("migration %d is defined twice", data.Version)
+		}
+		item := data
+		byVersion[data.Version] = &item
+	}
+
+	items := make([]migration, 0, len(byVersion))
+	for _, item := range byVersion {
+		if item.Up == nil {
+			return nil, fmt.Errorf("migration %d (%s) has no up step", item.Version, item.Name)
+		}
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Version < items[j].Version })
+	return items, nil
+}
+
+func sqlMigration(statements string) migrationFunc {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// RunMigrations applies every pending migration. It is called on boot.
+func RunMigrations(db *sql.DB) error {
+	_, err := migrateUp(db, 0)
+	return err
+}
+
+// migrateUp applies up to steps pending migrations (all of them when steps <= 0)
+// and returns the ones that ran.
+func migrateUp(db *sql.DB, steps int) ([]migration, error) {
+	items, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]migration, 0)
+	err = withMigrationLock(db, func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if steps > 0 && len(applied) >= steps {
+				break
+			}
+			if _, ok := done[item.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, item, item.Up, func(tx *sql.Tx) error {
+				_, err := tx.Exec(
+					`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+					item.Version, item.Name, time.Now(),
+				)
+				return err
+			}); err != nil {
+				return err
+			}
+			applied = append(applied, item)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// migrateDown rolls back the last steps applied migrations (one when steps <= 0).
+func migrateDown(db *sql.DB, steps int) ([]migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	items, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	rolledBack := make([]migration, 0)
+	err = withMigrationLock(db, func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(items) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			item := items[i]
+			if _, ok := done[item.Version]; !ok {
+				continue
+			}
+			down := item.Down
+			if down == nil {
+				down = func(*sql.Tx) error { return nil }
+			}
+			if err := runMigration(ctx, conn, item, down, func(tx *sql.Tx) error {
+				_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, item.Version)
+				return err
+			}); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, item)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+func migrationStatus(db *sql.DB) ([]migrationState, error) {
+	items, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]migrationState, 0, len(items))
+	err = withMigrationLock(db, func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			state := migrationState{Version: item.Version, Name: item.Name}
+			if appliedAt, ok := done[item.Version]; ok {
+				state.AppliedAt = &appliedAt
+			}
+			states = append(states, state)
+		}
+		return nil
+	})
+	return states, err
+}
+
+func runMigration(ctx context.Context, conn *sql.Conn, item migration, step migrationFunc, record migrationFunc) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := step(tx); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("migration %04d_%s failed: %w", item.Version, item.Name, err)
+	}
+	if err := record(tx); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("migration %04d_%s failed: %w", item.Version, item.Name, err)
+	}
+	return tx.Commit()
+}
+
+// withMigrationLock pins a single connection for the session-scoped advisory
+// lock and hands it to fn once the schema_migrations table exists.
+func withMigrationLock(db *sql.DB, fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`); err != nil {
+		return err
+	}
+	return fn(ctx, conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = appliedAt
+	}
+	return done, rows.Err()
+}
+
+// runMigrateCommand implements `migrate up [n]`, `migrate down [n]` and
+// `migrate status`.
+func runMigrateCommand(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up [n] | down [n] | status")
+	}
+	steps := 0
+	if len(args) > 1 {
+		parsed, err := strconv.Atoi(args[1])
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid step count %q", args[1])
+		}
+		steps = parsed
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrateUp(db, steps)
+		for _, item := range applied {
+			fmt.Printf("applied %04d_%s\n", item.Version, item.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+	case "down":
+		rolledBack, err := migrateDown(db, steps)
+		for _, item := range rolledBack {
+			fmt.Printf("rolled back %04d_%s\n", item.Version, item.Name)
+		}
+		if err == nil && len(rolledBack) == 0 {
+			fmt.Println("no applied migrations")
+		}
+		return err
+	case "status":
+		states, err := migrationStatus(db)
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.AppliedAt != nil {
+				appliedAt = state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(writer, "%04d\t%s\t%s\n", state.Version, state.Name, appliedAt)
+		}
+		return writer.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS illustrations;
+DROP TABLE IF EXISTS moderation_reports;
+DROP TABLE IF EXISTS release_queue;
+DROP TABLE IF EXISTS announcements;
+DROP TABLE IF EXISTS site_settings;
+DROP TABLE IF EXISTS bookmarks;
+DROP TABLE IF EXISTS follows;
+DROP TABLE IF EXISTS reading_history;
+DROP TABLE IF EXISTS ratings;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS chapters;
+DROP TABLE IF EXISTS novels;
+DROP TABLE IF EXISTS auth_users;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS novels_tags_idx;
+DROP INDEX IF EXISTS chapters_search_vector_idx;
+DROP INDEX IF EXISTS novels_search_vector_idx;
+ALTER TABLE chapters DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE novels DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS novel_tags_text(TEXT[]);
@@ -0,0 +1,22 @@
+-- array_to_string is only STABLE, so generated columns need an IMMUTABLE wrapper.
+CREATE OR REPLACE FUNCTION novel_tags_text(tags TEXT[]) RETURNS TEXT
+	LANGUAGE sql IMMUTABLE PARALLEL SAFE
+	AS $$ SELECT array_to_string(tags, ' ') $$;
+
+ALTER TABLE novels ADD COLUMN IF NOT EXISTS search_vector tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+		setweight(to_tsvector('simple', coalesce(author, '')), 'B') ||
+		setweight(to_tsvector('simple', novel_tags_text(tags)), 'B') ||
+		setweight(to_tsvector('english', coalesce(summary, '')), 'C')
+	) STORED;
+
+ALTER TABLE chapters ADD COLUMN IF NOT EXISTS search_vector tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(content, '')), 'D')
+	) STORED;
+
+CREATE INDEX IF NOT EXISTS novels_search_vector_idx ON novels USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS chapters_search_vector_idx ON chapters USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS novels_tags_idx ON novels USING GIN (tags);
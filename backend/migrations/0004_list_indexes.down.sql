@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS follows_novel_id_idx;
+DROP INDEX IF EXISTS ratings_novel_at_id_idx;
+DROP INDEX IF EXISTS comments_chapter_created_id_idx;
+DROP INDEX IF EXISTS chapters_novel_number_id_idx;
+DROP INDEX IF EXISTS novels_lower_title_id_idx;
+DROP INDEX IF EXISTS novels_created_at_id_idx;
+DROP INDEX IF EXISTS novels_updated_at_id_idx;
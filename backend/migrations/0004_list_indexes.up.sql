@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS novels_updated_at_id_idx ON novels(updated_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS novels_created_at_id_idx ON novels(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS novels_lower_title_id_idx ON novels(lower(title), id);
+CREATE INDEX IF NOT EXISTS chapters_novel_number_id_idx ON chapters(novel_id, number, id);
+CREATE INDEX IF NOT EXISTS comments_chapter_created_id_idx ON comments(chapter_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS ratings_novel_at_id_idx ON ratings(novel_id, at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS follows_novel_id_idx ON follows(novel_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS chapters_created_at_id_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS chapters_created_at_id_idx ON chapters(created_at DESC, id DESC);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS release_queue_due_idx;
+ALTER TABLE release_queue DROP CONSTRAINT IF EXISTS release_queue_scheduled_check;
+ALTER TABLE release_queue DROP CONSTRAINT IF EXISTS release_queue_status_check;
+ALTER TABLE release_queue DROP COLUMN IF EXISTS last_error;
+ALTER TABLE release_queue DROP COLUMN IF EXISTS chapter_id;
+ALTER TABLE release_queue DROP COLUMN IF EXISTS published_at;
+ALTER TABLE release_queue DROP COLUMN IF EXISTS publish_at;
+ALTER TABLE release_queue DROP COLUMN IF EXISTS content;
+ALTER TABLE release_queue DROP COLUMN IF EXISTS volume;
@@ -0,0 +1,22 @@
+ALTER TABLE release_queue ADD COLUMN IF NOT EXISTS volume INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE release_queue ADD COLUMN IF NOT EXISTS content TEXT NOT NULL DEFAULT '';
+ALTER TABLE release_queue ADD COLUMN IF NOT EXISTS publish_at TIMESTAMPTZ;
+ALTER TABLE release_queue ADD COLUMN IF NOT EXISTS published_at TIMESTAMPTZ;
+ALTER TABLE release_queue ADD COLUMN IF NOT EXISTS chapter_id INTEGER REFERENCES chapters(id) ON DELETE SET NULL;
+ALTER TABLE release_queue ADD COLUMN IF NOT EXISTS last_error TEXT NOT NULL DEFAULT '';
+
+-- Free-text statuses collapse onto the state machine. Nothing was ever
+-- scheduled for real, so everything not already finished goes back to Queued.
+UPDATE release_queue
+SET status = CASE lower(trim(status))
+	WHEN 'published' THEN 'Published'
+	WHEN 'failed' THEN 'Failed'
+	ELSE 'Queued'
+END;
+
+ALTER TABLE release_queue ADD CONSTRAINT release_queue_status_check
+	CHECK (status IN ('Queued', 'Scheduled', 'Published', 'Failed'));
+ALTER TABLE release_queue ADD CONSTRAINT release_queue_scheduled_check
+	CHECK (status <> 'Scheduled' OR publish_at IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS release_queue_due_idx ON release_queue(publish_at, id) WHERE status = 'Scheduled';
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS chapters_published_novel_number_idx;
+ALTER TABLE chapters DROP CONSTRAINT IF EXISTS chapters_visibility_check;
+ALTER TABLE chapters DROP COLUMN IF EXISTS published_at;
+ALTER TABLE chapters DROP COLUMN IF EXISTS visibility;
+ALTER TABLE novels DROP CONSTRAINT IF EXISTS novels_visibility_check;
+ALTER TABLE novels DROP COLUMN IF EXISTS published_at;
+ALTER TABLE novels DROP COLUMN IF EXISTS visibility;
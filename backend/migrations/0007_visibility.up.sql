@@ -0,0 +1,13 @@
+ALTER TABLE novels ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'published';
+ALTER TABLE novels ADD COLUMN IF NOT EXISTS published_at TIMESTAMPTZ;
+UPDATE novels SET published_at = created_at WHERE published_at IS NULL AND visibility = 'published';
+ALTER TABLE novels ADD CONSTRAINT novels_visibility_check
+	CHECK (visibility IN ('draft', 'published', 'unlisted', 'archived'));
+
+ALTER TABLE chapters ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'published';
+ALTER TABLE chapters ADD COLUMN IF NOT EXISTS published_at TIMESTAMPTZ;
+UPDATE chapters SET published_at = created_at WHERE published_at IS NULL AND visibility = 'published';
+ALTER TABLE chapters ADD CONSTRAINT chapters_visibility_check
+	CHECK (visibility IN ('draft', 'published', 'unlisted', 'archived'));
+
+CREATE INDEX IF NOT EXISTS chapters_published_novel_number_idx ON chapters(novel_id, number, id) WHERE visibility = 'published';
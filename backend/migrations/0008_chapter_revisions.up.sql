@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS chapter_revisions (
+	id SERIAL PRIMARY KEY,
+	chapter_id INTEGER NOT NULL REFERENCES chapters(id) ON DELETE CASCADE,
+	revision INTEGER NOT NULL,
+	editor_id INTEGER REFERENCES auth_users(id) ON DELETE SET NULL,
+	title TEXT NOT NULL,
+	content TEXT NOT NULL,
+	word_count INTEGER NOT NULL DEFAULT 0,
+	restored_from INTEGER,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (chapter_id, revision)
+);
+
+INSERT INTO chapter_revisions (chapter_id, revision, title, content, word_count, created_at)
+SELECT id, 1, title, content, word_count, updated_at FROM chapters;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS comment_reactions;
+DROP INDEX IF EXISTS comments_chapter_roots_idx;
+DROP INDEX IF EXISTS comments_parent_id_idx;
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS edited_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS depth;
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,15 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS depth INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS comments_parent_id_idx ON comments(parent_id) WHERE parent_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS comments_chapter_roots_idx ON comments(chapter_id, created_at DESC, id DESC) WHERE parent_id IS NULL;
+
+CREATE TABLE IF NOT EXISTS comment_reactions (
+	comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
+	emoji TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (comment_id, user_id, emoji)
+);
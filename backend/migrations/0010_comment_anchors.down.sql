@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS comments_chapter_paragraph_idx;
+ALTER TABLE comments DROP COLUMN IF EXISTS orphaned;
+ALTER TABLE comments DROP COLUMN IF EXISTS paragraph_hash;
+ALTER TABLE comments DROP COLUMN IF EXISTS paragraph_index;
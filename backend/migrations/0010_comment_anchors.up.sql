@@ -0,0 +1,5 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS paragraph_index INTEGER;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS paragraph_hash TEXT;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS orphaned BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS comments_chapter_paragraph_idx ON comments(chapter_id, paragraph_index) WHERE paragraph_index IS NOT NULL;
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS ratings_novel_helpful_idx;
+DROP TABLE IF EXISTS rating_votes;
+ALTER TABLE ratings DROP COLUMN IF EXISTS unhelpful_count;
+ALTER TABLE ratings DROP COLUMN IF EXISTS helpful_count;
+ALTER TABLE ratings DROP COLUMN IF EXISTS chapters_read;
+ALTER TABLE ratings DROP COLUMN IF EXISTS spoiler;
+ALTER TABLE ratings DROP COLUMN IF EXISTS body;
+ALTER TABLE ratings DROP COLUMN IF EXISTS title;
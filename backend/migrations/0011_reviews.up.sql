@@ -0,0 +1,16 @@
+ALTER TABLE ratings ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';
+ALTER TABLE ratings ADD COLUMN IF NOT EXISTS body TEXT NOT NULL DEFAULT '';
+ALTER TABLE ratings ADD COLUMN IF NOT EXISTS spoiler BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE ratings ADD COLUMN IF NOT EXISTS chapters_read INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE ratings ADD COLUMN IF NOT EXISTS helpful_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE ratings ADD COLUMN IF NOT EXISTS unhelpful_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS rating_votes (
+	rating_id INTEGER NOT NULL REFERENCES ratings(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
+	helpful BOOLEAN NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (rating_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS ratings_novel_helpful_idx ON ratings(novel_id, (helpful_count - unhelpful_count) DESC, id DESC);
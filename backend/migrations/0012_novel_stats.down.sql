@@ -0,0 +1,12 @@
+DROP TRIGGER IF EXISTS reading_history_readers ON reading_history;
+DROP TRIGGER IF EXISTS ratings_stats ON ratings;
+DROP TRIGGER IF EXISTS bookmarks_stats ON bookmarks;
+DROP TRIGGER IF EXISTS follows_stats ON follows;
+DROP TRIGGER IF EXISTS chapters_stats ON chapters;
+DROP TRIGGER IF EXISTS novels_stats ON novels;
+DROP FUNCTION IF EXISTS novel_readers_trigger();
+DROP FUNCTION IF EXISTS novel_stats_novel_trigger();
+DROP FUNCTION IF EXISTS novel_stats_row_trigger();
+DROP FUNCTION IF EXISTS refresh_novel_stats(INTEGER);
+DROP TABLE IF EXISTS novel_readers;
+DROP TABLE IF EXISTS novel_stats;
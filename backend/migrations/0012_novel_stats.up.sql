@@ -0,0 +1,151 @@
+CREATE TABLE IF NOT EXISTS novel_stats (
+	novel_id INTEGER PRIMARY KEY REFERENCES novels(id) ON DELETE CASCADE,
+	chapter_count INTEGER NOT NULL DEFAULT 0,
+	word_count BIGINT NOT NULL DEFAULT 0,
+	volume_chapters JSONB NOT NULL DEFAULT '{}',
+	latest_chapter_id INTEGER,
+	latest_chapter_number INTEGER,
+	latest_published_at TIMESTAMPTZ,
+	follower_count INTEGER NOT NULL DEFAULT 0,
+	bookmark_count INTEGER NOT NULL DEFAULT 0,
+	rating_count INTEGER NOT NULL DEFAULT 0,
+	rating_average NUMERIC(4, 2) NOT NULL DEFAULT 0,
+	reader_count INTEGER NOT NULL DEFAULT 0,
+	last_updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- novel_readers keeps one row per reader and novel so reader_count can grow
+-- without scanning reading_history.
+CREATE TABLE IF NOT EXISTS novel_readers (
+	novel_id INTEGER NOT NULL REFERENCES novels(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
+	first_read_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (novel_id, user_id)
+);
+
+-- refresh_novel_stats recomputes one novel's row. Only published chapters
+-- count, matching what readers can see.
+CREATE OR REPLACE FUNCTION refresh_novel_stats(p_novel_id INTEGER) RETURNS void AS $$
+BEGIN
+	INSERT INTO novel_stats (
+		novel_id, chapter_count, word_count, volume_chapters, latest_chapter_id, latest_chapter_number,
+		latest_published_at, follower_count, bookmark_count, rating_count, rating_average, reader_count, last_updated_at
+	)
+	SELECT n.id,
+		COALESCE(ch.chapter_count, 0),
+		COALESCE(ch.word_count, 0),
+		COALESCE(vol.volume_chapters, '{}'::jsonb),
+		latest.id,
+		latest.number,
+		ch.latest_published_at,
+		(SELECT COUNT(*) FROM follows WHERE novel_id = n.id),
+		(SELECT COUNT(*) FROM bookmarks WHERE novel_id = n.id),
+		COALESCE(rt.rating_count, 0),
+		COALESCE(rt.rating_average, 0),
+		(SELECT COUNT(*) FROM novel_readers WHERE novel_id = n.id),
+		GREATEST(n.updated_at, COALESCE(ch.latest_updated_at, n.updated_at))
+	FROM novels n
+	LEFT JOIN LATERAL (
+		SELECT COUNT(*) AS chapter_count, SUM(word_count) AS word_count,
+			MAX(published_at) AS latest_published_at, MAX(updated_at) AS latest_updated_at
+		FROM chapters WHERE novel_id = n.id AND visibility = 'published'
+	) ch ON true
+	LEFT JOIN LATERAL (
+		SELECT jsonb_object_agg(volume, chapters) AS volume_chapters
+		FROM (
+			SELECT volume, COUNT(*) AS chapters
+			FROM chapters WHERE novel_id = n.id AND visibility = 'published'
+			GROUP BY volume
+		) v
+	) vol ON true
+	LEFT JOIN LATERAL (
+		SELECT id, number FROM chapters
+		WHERE novel_id = n.id AND visibility = 'published'
+		ORDER BY number DESC, id DESC
+		LIMIT 1
+	) latest ON true
+	LEFT JOIN LATERAL (
+		SELECT COUNT(*) AS rating_count, ROUND(AVG(score)::NUMERIC, 2) AS rating_average
+		FROM ratings WHERE novel_id = n.id
+	) rt ON true
+	WHERE n.id = p_novel_id
+	ON CONFLICT (novel_id) DO UPDATE SET
+		chapter_count = EXCLUDED.chapter_count,
+		word_count = EXCLUDED.word_count,
+		volume_chapters = EXCLUDED.volume_chapters,
+		latest_chapter_id = EXCLUDED.latest_chapter_id,
+		latest_chapter_number = EXCLUDED.latest_chapter_number,
+		latest_published_at = EXCLUDED.latest_published_at,
+		follower_count = EXCLUDED.follower_count,
+		bookmark_count = EXCLUDED.bookmark_count,
+		rating_count = EXCLUDED.rating_count,
+		rating_average = EXCLUDED.rating_average,
+		reader_count = EXCLUDED.reader_count,
+		last_updated_at = EXCLUDED.last_updated_at;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION novel_stats_row_trigger() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		PERFORM refresh_novel_stats(NEW.novel_id);
+	ELSIF TG_OP = 'DELETE' THEN
+		PERFORM refresh_novel_stats(OLD.novel_id);
+	ELSE
+		PERFORM refresh_novel_stats(NEW.novel_id);
+		IF NEW.novel_id <> OLD.novel_id THEN
+			PERFORM refresh_novel_stats(OLD.novel_id);
+		END IF;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION novel_stats_novel_trigger() RETURNS trigger AS $$
+BEGIN
+	PERFORM refresh_novel_stats(NEW.id);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Reading a chapter only touches the stats row the first time a reader opens
+-- the novel.
+CREATE OR REPLACE FUNCTION novel_readers_trigger() RETURNS trigger AS $$
+DECLARE
+	target INTEGER;
+BEGIN
+	SELECT novel_id INTO target FROM chapters WHERE id = NEW.chapter_id;
+	IF target IS NULL THEN
+		RETURN NULL;
+	END IF;
+	INSERT INTO novel_readers (novel_id, user_id, first_read_at)
+	VALUES (target, NEW.user_id, NEW.read_at)
+	ON CONFLICT DO NOTHING;
+	IF FOUND THEN
+		UPDATE novel_stats SET reader_count = reader_count + 1 WHERE novel_id = target;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER novels_stats AFTER INSERT OR UPDATE ON novels
+	FOR EACH ROW EXECUTE FUNCTION novel_stats_novel_trigger();
+CREATE TRIGGER chapters_stats AFTER INSERT OR UPDATE OR DELETE ON chapters
+	FOR EACH ROW EXECUTE FUNCTION novel_stats_row_trigger();
+CREATE TRIGGER follows_stats AFTER INSERT OR UPDATE OR DELETE ON follows
+	FOR EACH ROW EXECUTE FUNCTION novel_stats_row_trigger();
+CREATE TRIGGER bookmarks_stats AFTER INSERT OR UPDATE OR DELETE ON bookmarks
+	FOR EACH ROW EXECUTE FUNCTION novel_stats_row_trigger();
+CREATE TRIGGER ratings_stats AFTER INSERT OR DELETE OR UPDATE OF novel_id, score ON ratings
+	FOR EACH ROW EXECUTE FUNCTION novel_stats_row_trigger();
+CREATE TRIGGER reading_history_readers AFTER INSERT ON reading_history
+	FOR EACH ROW EXECUTE FUNCTION novel_readers_trigger();
+
+INSERT INTO novel_readers (novel_id, user_id, first_read_at)
+SELECT c.novel_id, h.user_id, MIN(h.read_at)
+FROM reading_history h
+JOIN chapters c ON c.id = h.chapter_id
+GROUP BY c.novel_id, h.user_id
+ON CONFLICT DO NOTHING;
+
+SELECT refresh_novel_stats(id) FROM novels;
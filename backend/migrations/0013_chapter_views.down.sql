@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS chapter_views_daily;
+DROP TABLE IF EXISTS chapter_view_visitors;
@@ -0,0 +1,21 @@
+-- One row per visitor, chapter and dedup window. Visitors are HMAC hashes, never
+-- raw IPs, and rows are pruned once their window has passed.
+CREATE TABLE IF NOT EXISTS chapter_view_visitors (
+	chapter_id INTEGER NOT NULL REFERENCES chapters(id) ON DELETE CASCADE,
+	visitor_hash TEXT NOT NULL,
+	window_start TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (chapter_id, visitor_hash, window_start)
+);
+
+CREATE INDEX IF NOT EXISTS chapter_view_visitors_window_idx ON chapter_view_visitors(window_start);
+
+CREATE TABLE IF NOT EXISTS chapter_views_daily (
+	chapter_id INTEGER NOT NULL REFERENCES chapters(id) ON DELETE CASCADE,
+	novel_id INTEGER NOT NULL REFERENCES novels(id) ON DELETE CASCADE,
+	day DATE NOT NULL,
+	views INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (chapter_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS chapter_views_daily_novel_day_idx ON chapter_views_daily(novel_id, day);
+CREATE INDEX IF NOT EXISTS chapter_views_daily_day_idx ON chapter_views_daily(day);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS reading_progress (
+	user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
+	novel_id INTEGER NOT NULL REFERENCES novels(id) ON DELETE CASCADE,
+	chapter_id INTEGER NOT NULL REFERENCES chapters(id) ON DELETE CASCADE,
+	scroll_percent DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (scroll_percent BETWEEN 0 AND 100),
+	paragraph_index INTEGER,
+	device TEXT NOT NULL DEFAULT '',
+	read_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (user_id, novel_id)
+);
+
+CREATE INDEX IF NOT EXISTS reading_progress_user_read_at_idx ON reading_progress(user_id, read_at DESC);
@@ -0,0 +1,20 @@
+ALTER TABLE reading_history
+	ADD COLUMN novel_slug TEXT NOT NULL DEFAULT '',
+	ADD COLUMN novel_title TEXT NOT NULL DEFAULT '',
+	ADD COLUMN chapter_title TEXT NOT NULL DEFAULT '';
+
+UPDATE reading_history h
+SET novel_slug = n.slug, novel_title = n.title, chapter_title = c.title
+FROM novels n, chapters c
+WHERE n.id = h.novel_id AND c.id = h.chapter_id;
+
+ALTER TABLE reading_history
+	ALTER COLUMN novel_slug DROP DEFAULT,
+	ALTER COLUMN novel_title DROP DEFAULT,
+	ALTER COLUMN chapter_title DROP DEFAULT,
+	DROP CONSTRAINT IF EXISTS reading_history_chapter_id_fkey,
+	DROP COLUMN novel_id;
+
+DROP INDEX IF EXISTS reading_history_read_at_idx;
+DROP INDEX IF EXISTS reading_history_user_read_at_idx;
+CREATE INDEX IF NOT EXISTS reading_history_user_id_idx ON reading_history(user_id);
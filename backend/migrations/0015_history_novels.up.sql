@@ -0,0 +1,30 @@
+ALTER TABLE reading_history ADD COLUMN IF NOT EXISTS novel_id INTEGER;
+
+UPDATE reading_history h
+SET novel_id = c.novel_id
+FROM chapters c
+WHERE c.id = h.chapter_id;
+
+-- Entries whose chapter is gone cannot be linked to a novel any more.
+DELETE FROM reading_history WHERE novel_id IS NULL;
+
+-- Collapse runs of the same chapter into their latest read.
+DELETE FROM reading_history h
+USING (
+	SELECT id, chapter_id, LEAD(chapter_id) OVER (PARTITION BY user_id ORDER BY read_at, id) AS next_chapter_id
+	FROM reading_history
+) ordered
+WHERE ordered.id = h.id AND ordered.next_chapter_id = ordered.chapter_id;
+
+ALTER TABLE reading_history
+	ALTER COLUMN novel_id SET NOT NULL,
+	ADD CONSTRAINT reading_history_novel_id_fkey FOREIGN KEY (novel_id) REFERENCES novels(id) ON DELETE CASCADE,
+	ADD CONSTRAINT reading_history_chapter_id_fkey FOREIGN KEY (chapter_id) REFERENCES chapters(id) ON DELETE CASCADE,
+	DROP COLUMN novel_slug,
+	DROP COLUMN novel_title,
+	DROP COLUMN chapter_title;
+
+DROP INDEX IF EXISTS reading_history_user_id_idx;
+CREATE INDEX IF NOT EXISTS reading_history_user_read_at_idx ON reading_history(user_id, read_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS reading_history_user_novel_idx ON reading_history(user_id, novel_id);
+CREATE INDEX IF NOT EXISTS reading_history_read_at_idx ON reading_history(read_at);
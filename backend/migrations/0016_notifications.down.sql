@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS chapters_notify_publish ON chapters;
+DROP TRIGGER IF EXISTS chapters_notify_insert ON chapters;
+DROP FUNCTION IF EXISTS queue_chapter_notification();
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS notification_jobs;
+ALTER TABLE follows DROP COLUMN IF EXISTS notify;
@@ -0,0 +1,43 @@
+ALTER TABLE follows ADD COLUMN IF NOT EXISTS notify BOOLEAN NOT NULL DEFAULT true;
+
+-- notification_jobs is the queue between publishing a chapter and fanning
+-- out to followers, so publishing never waits on the follower count.
+CREATE TABLE IF NOT EXISTS notification_jobs (
+	id SERIAL PRIMARY KEY,
+	chapter_id INTEGER NOT NULL REFERENCES chapters(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	processed_at TIMESTAMPTZ,
+	recipients INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS notification_jobs_pending_idx ON notification_jobs(id) WHERE processed_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS notifications (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
+	kind TEXT NOT NULL,
+	novel_id INTEGER NOT NULL REFERENCES novels(id) ON DELETE CASCADE,
+	chapter_id INTEGER NOT NULL REFERENCES chapters(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL,
+	read_at TIMESTAMPTZ,
+	UNIQUE (user_id, chapter_id)
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_created_idx ON notifications(user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications(user_id) WHERE read_at IS NULL;
+
+-- A chapter is announced once, the first time it gets a publish time; that
+-- covers direct creates, imports, draft edits and the release scheduler.
+CREATE OR REPLACE FUNCTION queue_chapter_notification() RETURNS trigger AS $$
+BEGIN
+	INSERT INTO notification_jobs (chapter_id) VALUES (NEW.id);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER chapters_notify_insert AFTER INSERT ON chapters
+	FOR EACH ROW WHEN (NEW.published_at IS NOT NULL)
+	EXECUTE FUNCTION queue_chapter_notification();
+CREATE TRIGGER chapters_notify_publish AFTER UPDATE OF published_at ON chapters
+	FOR EACH ROW WHEN (OLD.published_at IS NULL AND NEW.published_at IS NOT NULL)
+	EXECUTE FUNCTION queue_chapter_notification();
@@ -0,0 +1,2 @@
+ALTER TABLE auth_users DROP COLUMN IF EXISTS digest_sent_at, DROP COLUMN IF EXISTS email_digest;
+DROP TABLE IF EXISTS mail_outbox;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS mail_outbox (
+	id SERIAL PRIMARY KEY,
+	kind TEXT NOT NULL DEFAULT '',
+	to_address TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	text_body TEXT NOT NULL,
+	html_body TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS mail_outbox_due_idx ON mail_outbox(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS mail_outbox_status_idx ON mail_outbox(status, created_at DESC);
+
+ALTER TABLE auth_users
+	ADD COLUMN IF NOT EXISTS email_digest TEXT NOT NULL DEFAULT 'off' CHECK (email_digest IN ('off', 'daily', 'weekly')),
+	ADD COLUMN IF NOT EXISTS digest_sent_at TIMESTAMPTZ;
@@ -0,0 +1,25 @@
+-- External sign-in accounts linked to a user, one per provider subject.
+CREATE TABLE IF NOT EXISTS identities (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	last_login_at TIMESTAMPTZ NOT NULL,
+	UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS identities_user_idx ON identities(user_id);
+
+-- Sign-ins in flight. The row holds the PKCE verifier and nonce for a state
+-- handed to the provider and is deleted when the callback uses it.
+CREATE TABLE IF NOT EXISTS oauth_states (
+	state_hash TEXT PRIMARY KEY,
+	provider TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	link_user_id INTEGER REFERENCES auth_users(id) ON DELETE CASCADE,
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
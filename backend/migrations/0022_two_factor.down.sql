@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS two_factor_challenges;
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE sessions DROP COLUMN IF EXISTS two_factor_at;
+ALTER TABLE auth_users DROP COLUMN IF EXISTS totp_locked_until;
+ALTER TABLE auth_users DROP COLUMN IF EXISTS totp_failures;
+ALTER TABLE auth_users DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE auth_users DROP COLUMN IF EXISTS totp_enabled_at;
+ALTER TABLE auth_users DROP COLUMN IF EXISTS totp_secret;
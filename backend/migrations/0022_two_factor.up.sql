@@ -0,0 +1,28 @@
+-- totp_secret is sealed with TWO_FACTOR_KEY. It is set while enrolling and
+-- counts once totp_enabled_at is set. totp_last_step stops a code from being
+-- used twice.
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMPTZ;
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS totp_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS totp_locked_until TIMESTAMPTZ;
+
+-- When the session last passed a second-factor check.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS two_factor_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	UNIQUE (user_id, code_hash)
+);
+
+-- Password or provider sign-ins waiting for the second factor.
+CREATE TABLE IF NOT EXISTS two_factor_challenges (
+	token_hash TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
+	device TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
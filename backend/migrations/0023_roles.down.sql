@@ -0,0 +1,3 @@
+-- Earlier versions only know admin and user.
+UPDATE auth_users SET role = 'user' WHERE role NOT IN ('admin', 'user');
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,9 @@
+-- Custom roles defined by admins. The built-in roles (user, translator,
+-- editor, moderator, admin) are defined in code and not stored here.
+CREATE TABLE IF NOT EXISTS roles (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT '',
+	permissions TEXT[] NOT NULL DEFAULT '{}',
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
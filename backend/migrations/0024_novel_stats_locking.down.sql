@@ -0,0 +1,21 @@
+-- refresh_novel_stats keeps its lock, which the row triggers are fine with.
+DROP TRIGGER IF EXISTS ratings_stats_update ON ratings;
+DROP TRIGGER IF EXISTS ratings_stats_delete ON ratings;
+DROP TRIGGER IF EXISTS ratings_stats_insert ON ratings;
+DROP TRIGGER IF EXISTS bookmarks_stats_delete ON bookmarks;
+DROP TRIGGER IF EXISTS bookmarks_stats_insert ON bookmarks;
+DROP TRIGGER IF EXISTS follows_stats_delete ON follows;
+DROP TRIGGER IF EXISTS follows_stats_insert ON follows;
+DROP TRIGGER IF EXISTS chapters_stats_delete ON chapters;
+DROP TRIGGER IF EXISTS chapters_stats_update ON chapters;
+DROP TRIGGER IF EXISTS chapters_stats_insert ON chapters;
+DROP FUNCTION IF EXISTS novel_stats_statement_trigger();
+
+CREATE TRIGGER chapters_stats AFTER INSERT OR UPDATE OR DELETE ON chapters
+	FOR EACH ROW EXECUTE FUNCTION novel_stats_row_trigger();
+CREATE TRIGGER follows_stats AFTER INSERT OR UPDATE OR DELETE ON follows
+	FOR EACH ROW EXECUTE FUNCTION novel_stats_row_trigger();
+CREATE TRIGGER bookmarks_stats AFTER INSERT OR UPDATE OR DELETE ON bookmarks
+	FOR EACH ROW EXECUTE FUNCTION novel_stats_row_trigger();
+CREATE TRIGGER ratings_stats AFTER INSERT OR DELETE OR UPDATE OF novel_id, score ON ratings
+	FOR EACH ROW EXECUTE FUNCTION novel_stats_row_trigger();
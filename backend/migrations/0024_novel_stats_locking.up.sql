@@ -0,0 +1,128 @@
+-- refresh_novel_stats recounts from its statement's snapshot, so two
+-- transactions writing to the same novel could each save a count missing the
+-- other's row. An advisory lock per novel, held until commit, makes the second
+-- wait and recount after the first commits.
+CREATE OR REPLACE FUNCTION refresh_novel_stats(p_novel_id INTEGER) RETURNS void AS $$
+BEGIN
+	PERFORM pg_advisory_xact_lock(hashtext('novel_stats'), p_novel_id);
+	INSERT INTO novel_stats (
+		novel_id, chapter_count, word_count, volume_chapters, latest_chapter_id, latest_chapter_number,
+		latest_published_at, follower_count, bookmark_count, rating_count, rating_average, reader_count, last_updated_at
+	)
+	SELECT n.id,
+		COALESCE(ch.chapter_count, 0),
+		COALESCE(ch.word_count, 0),
+		COALESCE(vol.volume_chapters, '{}'::jsonb),
+		latest.id,
+		latest.number,
+		ch.latest_published_at,
+		(SELECT COUNT(*) FROM follows WHERE novel_id = n.id),
+		(SELECT COUNT(*) FROM bookmarks WHERE novel_id = n.id),
+		COALESCE(rt.rating_count, 0),
+		COALESCE(rt.rating_average, 0),
+		(SELECT COUNT(*) FROM novel_readers WHERE novel_id = n.id),
+		GREATEST(n.updated_at, COALESCE(ch.latest_updated_at, n.updated_at))
+	FROM novels n
+	LEFT JOIN LATERAL (
+		SELECT COUNT(*) AS chapter_count, SUM(word_count) AS word_count,
+			MAX(published_at) AS latest_published_at, MAX(updated_at) AS latest_updated_at
+		FROM chapters WHERE novel_id = n.id AND visibility = 'published'
+	) ch ON true
+	LEFT JOIN LATERAL (
+		SELECT jsonb_object_agg(volume, chapters) AS volume_chapters
+		FROM (
+			SELECT volume, COUNT(*) AS chapters
+			FROM chapters WHERE novel_id = n.id AND visibility = 'published'
+			GROUP BY volume
+		) v
+	) vol ON true
+	LEFT JOIN LATERAL (
+		SELECT id, number FROM chapters
+		WHERE novel_id = n.id AND visibility = 'published'
+		ORDER BY number DESC, id DESC
+		LIMIT 1
+	) latest ON true
+	LEFT JOIN LATERAL (
+		SELECT COUNT(*) AS rating_count, ROUND(AVG(score)::NUMERIC, 2) AS rating_average
+		FROM ratings WHERE novel_id = n.id
+	) rt ON true
+	WHERE n.id = p_novel_id
+	ON CONFLICT (novel_id) DO UPDATE SET
+		chapter_count = EXCLUDED.chapter_count,
+		word_count = EXCLUDED.word_count,
+		volume_chapters = EXCLUDED.volume_chapters,
+		latest_chapter_id = EXCLUDED.latest_chapter_id,
+		latest_chapter_number = EXCLUDED.latest_chapter_number,
+		latest_published_at = EXCLUDED.latest_published_at,
+		follower_count = EXCLUDED.follower_count,
+		bookmark_count = EXCLUDED.bookmark_count,
+		rating_count = EXCLUDED.rating_count,
+		rating_average = EXCLUDED.rating_average,
+		reader_count = EXCLUDED.reader_count,
+		last_updated_at = EXCLUDED.last_updated_at;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Statement-level triggers recount each touched novel once per statement, so
+-- a multi-row chapter import costs one recount instead of one per row. Novels
+-- are visited in id order so concurrent statements take locks in the same
+-- order.
+CREATE OR REPLACE FUNCTION novel_stats_statement_trigger() RETURNS trigger AS $$
+DECLARE
+	target INTEGER;
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		FOR target IN SELECT DISTINCT novel_id FROM new_rows ORDER BY novel_id LOOP
+			PERFORM refresh_novel_stats(target);
+		END LOOP;
+	ELSIF TG_OP = 'DELETE' THEN
+		FOR target IN SELECT DISTINCT novel_id FROM old_rows ORDER BY novel_id LOOP
+			PERFORM refresh_novel_stats(target);
+		END LOOP;
+	ELSE
+		FOR target IN SELECT novel_id FROM new_rows UNION SELECT novel_id FROM old_rows ORDER BY 1 LOOP
+			PERFORM refresh_novel_stats(target);
+		END LOOP;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Follows and bookmarks never move between novels, so only inserts and
+-- deletes change their counts.
+DROP TRIGGER IF EXISTS chapters_stats ON chapters;
+DROP TRIGGER IF EXISTS follows_stats ON follows;
+DROP TRIGGER IF EXISTS bookmarks_stats ON bookmarks;
+DROP TRIGGER IF EXISTS ratings_stats ON ratings;
+
+CREATE TRIGGER chapters_stats_insert AFTER INSERT ON chapters
+	REFERENCING NEW TABLE AS new_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION novel_stats_statement_trigger();
+CREATE TRIGGER chapters_stats_update AFTER UPDATE ON chapters
+	REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION novel_stats_statement_trigger();
+CREATE TRIGGER chapters_stats_delete AFTER DELETE ON chapters
+	REFERENCING OLD TABLE AS old_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION novel_stats_statement_trigger();
+CREATE TRIGGER follows_stats_insert AFTER INSERT ON follows
+	REFERENCING NEW TABLE AS new_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION novel_stats_statement_trigger();
+CREATE TRIGGER follows_stats_delete AFTER DELETE ON follows
+	REFERENCING OLD TABLE AS old_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION novel_stats_statement_trigger();
+CREATE TRIGGER bookmarks_stats_insert AFTER INSERT ON bookmarks
+	REFERENCING NEW TABLE AS new_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION novel_stats_statement_trigger();
+CREATE TRIGGER bookmarks_stats_delete AFTER DELETE ON bookmarks
+	REFERENCING OLD TABLE AS old_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION novel_stats_statement_trigger();
+CREATE TRIGGER ratings_stats_insert AFTER INSERT ON ratings
+	REFERENCING NEW TABLE AS new_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION novel_stats_statement_trigger();
+CREATE TRIGGER ratings_stats_delete AFTER DELETE ON ratings
+	REFERENCING OLD TABLE AS old_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION novel_stats_statement_trigger();
+-- Transition tables rule out a column list, and ratings are updated for every
+-- helpful vote, so score changes keep the row trigger.
+CREATE TRIGGER ratings_stats_update AFTER UPDATE OF novel_id, score ON ratings
+	FOR EACH ROW EXECUTE FUNCTION novel_stats_row_trigger();
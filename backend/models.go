@@ -1,47 +1,124 @@
 package main
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Novel struct {
-	ID        int       `json:"id"`
-	Slug      string    `json:"slug"`
-	Title     string    `json:"title"`
-	Author    string    `json:"author"`
-	Summary   string    `json:"summary"`
-	Tags      []string  `json:"tags"`
-	CoverURL  string    `json:"coverUrl"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID          int        `json:"id"`
+	Slug        string     `json:"slug"`
+	Title       string     `json:"title"`
+	Author      string     `json:"author"`
+	Summary     string     `json:"summary"`
+	Tags        []string   `json:"tags"`
+	CoverURL    string     `json:"coverUrl"`
+	Status      string     `json:"status"`
+	Visibility  string     `json:"visibility"`
+	PublishedAt *time.Time `json:"publishedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
 }
 
 type Chapter struct {
-	ID        int       `json:"id"`
-	NovelID   int       `json:"novelId"`
-	Number    int       `json:"number"`
-	Volume    int       `json:"volume"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	WordCount int       `json:"wordCount"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID          int        `json:"id"`
+	NovelID     int        `json:"novelId"`
+	Number      int        `json:"number"`
+	Volume      int        `json:"volume"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`
+	WordCount   int        `json:"wordCount"`
+	Visibility  string     `json:"visibility"`
+	PublishedAt *time.Time `json:"publishedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
 }
 
+// ChapterRevision is an immutable snapshot written on every chapter save.
+// Content is omitted from revision listings.
+type ChapterRevision struct {
+	ID           int       `json:"id"`
+	ChapterID    int       `json:"chapterId"`
+	Revision     int       `json:"revision"`
+	EditorID     *int      `json:"editorId"`
+	Title        string    `json:"title"`
+	Content      string    `json:"content,omitempty"`
+	WordCount    int       `json:"wordCount"`
+	RestoredFrom *int      `json:"restoredFrom"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type RevisionDiff struct {
+	ChapterID int      `json:"chapterId"`
+	From      int      `json:"from"`
+	To        int      `json:"to"`
+	Added     int      `json:"added"`
+	Removed   int      `json:"removed"`
+	Ops       []DiffOp `json:"ops"`
+}
+
+// Comment is one node of a chapter's comment thread. Deleted comments keep
+// their place in the tree with the body and author blanked.
 type Comment struct {
-	ID        int       `json:"id"`
-	ChapterID int       `json:"chapterId"`
-	UserID    int       `json:"userId"`
-	Body      string    `json:"body"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID         int    `json:"id"`
+	ChapterID  int    `json:"chapterId"`
+	UserID     int    `json:"userId"`
+	AuthorName string `json:"authorName"`
+	ParentID   *int   `json:"parentId"`
+	Depth      int    `json:"depth"`
+	// ParagraphIndex anchors the thread to one paragraph of the chapter;
+	// Orphaned is set once that paragraph is gone.
+	ParagraphIndex *int              `json:"paragraphIndex"`
+	ParagraphHash  string            `json:"paragraphHash,omitempty"`
+	Orphaned       bool              `json:"orphaned"`
+	Body           string            `json:"body"`
+	Deleted        bool              `json:"deleted"`
+	EditedAt       *time.Time        `json:"editedAt"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	Reactions      []CommentReaction `json:"reactions"`
+	Replies        []*Comment        `json:"replies,omitempty"`
+}
+
+type ParagraphCommentCount struct {
+	ParagraphIndex int `json:"paragraphIndex"`
+	Count          int `json:"count"`
+}
+
+type CommentReaction struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
 }
 
+// Rating is a reader's score for a novel, optionally with a written review.
 type Rating struct {
-	ID      int       `json:"id"`
-	NovelID int       `json:"novelId"`
-	UserID  int       `json:"userId"`
-	Score   int       `json:"score"`
-	Note    string    `json:"note"`
-	At      time.Time `json:"at"`
+	ID      int    `json:"id"`
+	NovelID int    `json:"novelId"`
+	UserID  int    `json:"userId"`
+	Score   int    `json:"score"`
+	Note    string `json:"note"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Spoiler bool   `json:"spoiler"`
+	// ChaptersRead is how many chapters the reviewer had read when the review
+	// was last written.
+	ChaptersRead int       `json:"chaptersRead"`
+	Helpful      int       `json:"helpful"`
+	Unhelpful    int       `json:"unhelpful"`
+	At           time.Time `json:"at"`
+}
+
+type RatingSummary struct {
+	NovelID int     `json:"novelId"`
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+	Reviews int     `json:"reviews"`
+	// Histogram maps each score from 1 to 5 to its number of ratings.
+	Histogram map[int]int `json:"histogram"`
 }
 
 type User struct {
@@ -52,32 +129,245 @@ type User struct {
 }
 
 type AuthUser struct {
-	ID           int       `json:"id"`
-	Name         string    `json:"name"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	Role         string    `json:"role"`
-	Status       string    `json:"status"`
-	CreatedAt    time.Time `json:"createdAt"`
+	ID                 int        `json:"id"`
+	Name               string     `json:"name"`
+	Email              string     `json:"email"`
+	PasswordHash       string     `json:"-"`
+	Role               string     `json:"role"`
+	Status             string     `json:"status"`
+	EmailVerifiedAt    *time.Time `json:"emailVerifiedAt"`
+	TwoFactorEnabledAt *time.Time `json:"twoFactorEnabledAt"`
+	CreatedAt          time.Time  `json:"createdAt"`
+}
+
+// Role grants a set of permissions. Built-in roles are defined in code and
+// have no timestamps; custom roles are stored in the roles table.
+type Role struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Permissions []string   `json:"permissions"`
+	BuiltIn     bool       `json:"builtIn"`
+	CreatedAt   *time.Time `json:"createdAt"`
+	UpdatedAt   *time.Time `json:"updatedAt"`
+}
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// TwoFactor is a user's authenticator setup. Secret is sealed with
+// TWO_FACTOR_KEY and is set while enrolling or once enabled.
+type TwoFactor struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabledAt"`
+	RecoveryCodesLeft int        `json:"recoveryCodesLeft"`
+	Secret            string     `json:"-"`
+	LockedUntil       *time.Time `json:"-"`
+}
+
+// TwoFactorChallenge is the answer to a sign-in that still needs the second
+// factor. Challenge is posted back to /auth/2fa with the code.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"twoFactorRequired"`
+	Challenge         string    `json:"challenge"`
+	ExpiresAt         time.Time `json:"expiresAt"`
 }
 
+// Session is one signed-in device. Current marks the session of the request
+// that listed it.
+type Session struct {
+	ID          int        `json:"id"`
+	Device      string     `json:"device"`
+	IP          string     `json:"ip"`
+	UserAgent   string     `json:"userAgent"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastUsedAt  time.Time  `json:"lastUsedAt"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	TwoFactorAt *time.Time `json:"twoFactorAt"`
+	Current     bool       `json:"current"`
+}
+
+// Identity is an external sign-in linked to a user.
+type Identity struct {
+	ID          int       `json:"id"`
+	Provider    string    `json:"provider"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"createdAt"`
+	LastLoginAt time.Time `json:"lastLoginAt"`
+}
+
+// ExternalIdentity is the account a provider vouched for at the end of a
+// sign-in. Subject is the provider's stable ID for it.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OAuthState is a sign-in waiting for the provider's callback. LinkUserID is
+// set when a signed-in user is linking the provider to their account.
+type OAuthState struct {
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	LinkUserID   int
+	ExpiresAt    time.Time
+}
+
+// ReadingHistory is one chapter open. The novel and chapter names are read
+// through their IDs, so renames show up in old entries.
 type ReadingHistory struct {
-	ID           int       `json:"id"`
-	UserID       int       `json:"userId"`
-	NovelSlug    string    `json:"novelSlug"`
-	NovelTitle   string    `json:"novelTitle"`
-	ChapterID    int       `json:"chapterId"`
-	ChapterTitle string    `json:"chapterTitle"`
-	ReadAt       time.Time `json:"readAt"`
+	ID            int       `json:"id"`
+	UserID        int       `json:"userId"`
+	NovelID       int       `json:"novelId"`
+	NovelSlug     string    `json:"novelSlug"`
+	NovelTitle    string    `json:"novelTitle"`
+	ChapterID     int       `json:"chapterId"`
+	ChapterVolume int       `json:"chapterVolume"`
+	ChapterNumber int       `json:"chapterNumber"`
+	ChapterTitle  string    `json:"chapterTitle"`
+	ReadAt        time.Time `json:"readAt"`
+}
+
+// HistoryNovel groups a reader's history by novel.
+type HistoryNovel struct {
+	NovelID          int       `json:"novelId"`
+	NovelSlug        string    `json:"novelSlug"`
+	NovelTitle       string    `json:"novelTitle"`
+	CoverURL         string    `json:"coverUrl"`
+	Reads            int       `json:"reads"`
+	ChaptersRead     int       `json:"chaptersRead"`
+	LastChapterID    int       `json:"lastChapterId"`
+	LastChapterTitle string    `json:"lastChapterTitle"`
+	LastReadAt       time.Time `json:"lastReadAt"`
+}
+
+// ReadingProgress is where a reader stopped in a novel. ReadAt comes from the
+// reporting device; UpdatedAt is when the server stored it.
+type ReadingProgress struct {
+	UserID         int       `json:"userId"`
+	NovelID        int       `json:"novelId"`
+	ChapterID      int       `json:"chapterId"`
+	ScrollPercent  float64   `json:"scrollPercent"`
+	ParagraphIndex *int      `json:"paragraphIndex"`
+	Device         string    `json:"device"`
+	ReadAt         time.Time `json:"readAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// ContinueReading is one entry of the "continue reading" shelf.
+type ContinueReading struct {
+	ReadingProgress
+	NovelSlug      string `json:"novelSlug"`
+	NovelTitle     string `json:"novelTitle"`
+	CoverURL       string `json:"coverUrl"`
+	ChapterVolume  int    `json:"chapterVolume"`
+	ChapterNumber  int    `json:"chapterNumber"`
+	ChapterTitle   string `json:"chapterTitle"`
+	UnreadChapters int    `json:"unreadChapters"`
 }
 
 type Follow struct {
 	ID        int       `json:"id"`
 	UserID    int       `json:"userId"`
 	NovelID   int       `json:"novelId"`
+	Notify    bool      `json:"notify"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+// Notification is one inbox entry. Names are read through the IDs at list
+// time.
+type Notification struct {
+	ID            int        `json:"id"`
+	Kind          string     `json:"kind"`
+	NovelID       int        `json:"novelId"`
+	NovelSlug     string     `json:"novelSlug"`
+	NovelTitle    string     `json:"novelTitle"`
+	ChapterID     int        `json:"chapterId"`
+	ChapterVolume int        `json:"chapterVolume"`
+	ChapterNumber int        `json:"chapterNumber"`
+	ChapterTitle  string     `json:"chapterTitle"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	ReadAt        *time.Time `json:"readAt"`
+}
+
+// NotificationPreference says whether a followed novel sends notifications.
+type NotificationPreference struct {
+	NovelID    int    `json:"novelId"`
+	NovelTitle string `json:"novelTitle"`
+	Notify     bool   `json:"notify"`
+}
+
+// OutboxMail is a queued email. The rendered bodies stay in the database and
+// are not returned by the admin listing.
+type OutboxMail struct {
+	ID            int        `json:"id"`
+	Kind          string     `json:"kind"`
+	To            string     `json:"to"`
+	Subject       string     `json:"subject"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt"`
+	LastError     string     `json:"lastError"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	SentAt        *time.Time `json:"sentAt"`
+}
+
+type EmailPreferences struct {
+	Digest       string     `json:"digest"`
+	DigestSentAt *time.Time `json:"digestSentAt"`
+}
+
+// Webhook is an endpoint that receives content events. Format "discord" posts
+// a Discord embed instead of the raw event.
+type Webhook struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Format    string    `json:"format"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhookId"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"responseStatus"`
+	LastError      string          `json:"lastError"`
+	NextAttemptAt  time.Time       `json:"nextAttemptAt"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt"`
+}
+
+// DigestRecipient is a reader whose digest is due.
+type DigestRecipient struct {
+	UserID     int
+	Name       string
+	Email      string
+	Digest     string
+	LastSentAt *time.Time
+}
+
+type DigestChapter struct {
+	NovelID     int
+	NovelSlug   string
+	NovelTitle  string
+	ChapterID   int
+	Number      int
+	Title       string
+	PublishedAt time.Time
+}
+
 type Bookmark struct {
 	ID        int       `json:"id"`
 	UserID    int       `json:"userId"`
@@ -120,16 +410,22 @@ type Announcement struct {
 }
 
 type ReleaseQueueItem struct {
-	ID            int       `json:"id"`
-	NovelID       int       `json:"novelId"`
-	NovelTitle    string    `json:"novelTitle"`
-	ChapterNumber int       `json:"chapterNumber"`
-	Title         string    `json:"title"`
-	Status        string    `json:"status"`
-	Eta           string    `json:"eta"`
-	Notes         string    `json:"notes"`
-	CreatedAt     time.Time `json:"createdAt"`
-	UpdatedAt     time.Time `json:"updatedAt"`
+	ID            int        `json:"id"`
+	NovelID       int        `json:"novelId"`
+	NovelTitle    string     `json:"novelTitle"`
+	ChapterNumber int        `json:"chapterNumber"`
+	Volume        int        `json:"volume"`
+	Title         string     `json:"title"`
+	Content       string     `json:"content"`
+	Status        string     `json:"status"`
+	Eta           string     `json:"eta"`
+	Notes         string     `json:"notes"`
+	PublishAt     *time.Time `json:"publishAt"`
+	PublishedAt   *time.Time `json:"publishedAt"`
+	ChapterID     int        `json:"chapterId"`
+	LastError     string     `json:"lastError"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
 }
 
 type ModerationReport struct {
@@ -140,10 +436,57 @@ type ModerationReport struct {
 	CreatedAt  time.Time `json:"createdAt"`
 }
 
-type NovelChapterStat struct {
-	NovelID         int `json:"novelId"`
-	ChapterCount    int `json:"chapterCount"`
-	LatestChapterID int `json:"latestChapterId"`
+// NovelStats counts published chapters only. VolumeChapters maps a volume
+// number to its chapter count; LatestChapterID is the highest chapter number.
+type NovelStats struct {
+	NovelID             int         `json:"novelId"`
+	ChapterCount        int         `json:"chapterCount"`
+	WordCount           int         `json:"wordCount"`
+	VolumeChapters      map[int]int `json:"volumeChapters"`
+	LatestChapterID     int         `json:"latestChapterId"`
+	LatestChapterNumber int         `json:"latestChapterNumber"`
+	LatestPublishedAt   *time.Time  `json:"latestPublishedAt"`
+	FollowerCount       int         `json:"followerCount"`
+	BookmarkCount       int         `json:"bookmarkCount"`
+	RatingCount         int         `json:"ratingCount"`
+	AverageRating       float64     `json:"averageRating"`
+	ReaderCount         int         `json:"readerCount"`
+	LastUpdatedAt       time.Time   `json:"lastUpdatedAt"`
+}
+
+// ViewSeries is one novel's or chapter's deduplicated views per day, with
+// days without views filled in as zero.
+type ViewSeries struct {
+	NovelID   int         `json:"novelId,omitempty"`
+	ChapterID int         `json:"chapterId,omitempty"`
+	From      string      `json:"from"`
+	To        string      `json:"to"`
+	Total     int         `json:"total"`
+	Days      []ViewPoint `json:"days"`
+}
+
+type ViewPoint struct {
+	Date  string `json:"date"`
+	Views int    `json:"views"`
+}
+
+// ChapterDropOff is one step of a novel's reading sequence. Retention is
+// relative to the first chapter, DropOff to the previous one.
+type ChapterDropOff struct {
+	ChapterID int     `json:"chapterId"`
+	Volume    int     `json:"volume"`
+	Number    int     `json:"number"`
+	Title     string  `json:"title"`
+	Views     int     `json:"views"`
+	Retention float64 `json:"retention"`
+	DropOff   float64 `json:"dropOff"`
+}
+
+type NovelViewRank struct {
+	NovelID int    `json:"novelId"`
+	Slug    string `json:"slug"`
+	Title   string `json:"title"`
+	Views   int    `json:"views"`
 }
 
 type Illustration struct {
@@ -152,3 +495,47 @@ type Illustration struct {
 	OriginalName string    `json:"originalName"`
 	CreatedAt    time.Time `json:"createdAt"`
 }
+
+type NovelSearchHit struct {
+	Novel   *Novel  `json:"novel"`
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type ChapterSearchHit struct {
+	ChapterID  int     `json:"chapterId"`
+	NovelID    int     `json:"novelId"`
+	NovelSlug  string  `json:"novelSlug"`
+	NovelTitle string  `json:"novelTitle"`
+	Number     int     `json:"number"`
+	Volume     int     `json:"volume"`
+	Title      string  `json:"title"`
+	Rank       float64 `json:"rank"`
+	Snippet    string  `json:"snippet"`
+}
+
+type SearchResults struct {
+	Query        string              `json:"query"`
+	Novels       []*NovelSearchHit   `json:"novels"`
+	NovelTotal   int                 `json:"novelTotal"`
+	Chapters     []*ChapterSearchHit `json:"chapters"`
+	ChapterTotal int                 `json:"chapterTotal"`
+}
+
+type ImportPreviewChapter struct {
+	Number    int    `json:"number"`
+	Volume    int    `json:"volume"`
+	Title     string `json:"title"`
+	WordCount int    `json:"wordCount"`
+	Images    int    `json:"images"`
+	Excerpt   string `json:"excerpt"`
+}
+
+type ImportPreview struct {
+	Format   string                  `json:"format"`
+	Chapters []*ImportPreviewChapter `json:"chapters"`
+	Images   int                     `json:"images"`
+	Warnings []string                `json:"warnings"`
+	DryRun   bool                    `json:"dryRun"`
+	Created  []*Chapter              `json:"created,omitempty"`
+}
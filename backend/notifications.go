@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	notificationChapter = "chapter"
+
+	// notificationBatch is how many queued chapters one dispatcher pass fans
+	// out.
+	notificationBatch = 20
+)
+
+// runNotificationDispatcher fans queued chapter notifications out to
+// followers, and queues chapter.published webhooks, every interval until ctx
+// is cancelled. Jobs are claimed with SKIP LOCKED, so every replica may run
+// it.
+func runNotificationDispatcher(ctx context.Context, repo Repository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		processed, err := repo.DispatchNotifications(notificationBatch)
+		if err != nil {
+			log.Printf("notification dispatcher: %v", err)
+		}
+		// A full batch means more are waiting; keep going without a pause.
+		if err == nil && processed == notificationBatch && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
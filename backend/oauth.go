@@ -0,0 +1,519 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oauthDiscord = "discord"
+	oauthGoogle  = "google"
+	oauthOIDC    = "oidc"
+
+	oauthTimeout = 10 * time.Second
+	// jwksRefresh is the shortest gap between two fetches of a provider's
+	// signing keys, so tokens with unknown key IDs cannot hammer it.
+	jwksRefresh = time.Minute
+)
+
+var (
+	errOAuthProvider      = errors.New("unknown sign-in provider")
+	errOAuthState         = errors.New("sign-in request is invalid or has expired, start again")
+	errOAuthFailed        = errors.New("sign-in with the provider failed")
+	errIdentityEmail      = errors.New("the provider did not share a verified email address")
+	errIdentityUnverified = errors.New("an account with this email exists; sign in with your password and verify your email before using this provider")
+	errIdentityTaken      = errors.New("this provider account is linked to another user")
+	errIdentityLast       = errors.New("set a password or link another provider before removing this one")
+)
+
+type OAuthStart struct {
+	URL   string `json:"url"`
+	State string `json:"state"`
+}
+
+// oauthClient talks to the configured providers. Discovery documents and
+// signing keys are fetched on first use and kept for the process lifetime.
+type oauthClient struct {
+	http      *http.Client
+	siteURL   string
+	providers []*oauthProvider
+}
+
+type oauthProvider struct {
+	OAuthProvider
+
+	mu          sync.Mutex
+	discovered  bool
+	jwksURL     string
+	keys        map[string]any
+	keysFetched time.Time
+}
+
+func newOAuthClient(cfg Config) *oauthClient {
+	client := &oauthClient{http: &http.Client{Timeout: oauthTimeout}, siteURL: cfg.SiteURL}
+	for _, provider := range cfg.OAuthProviders {
+		client.providers = append(client.providers, &oauthProvider{OAuthProvider: provider})
+	}
+	return client
+}
+
+// list is what the sign-in page shows.
+func (o *oauthClient) list() []gin.H {
+	items := make([]gin.H, 0, len(o.providers))
+	for _, provider := range o.providers {
+		items = append(items, gin.H{"id": provider.ID, "name": provider.Name})
+	}
+	return items
+}
+
+func (o *oauthClient) provider(id string) (*oauthProvider, error) {
+	for _, provider := range o.providers {
+		if provider.ID == id {
+			return provider, nil
+		}
+	}
+	return nil, errOAuthProvider
+}
+
+// redirectURI is the frontend page the provider sends the browser back to.
+// It has to be registered with the provider.
+func (o *oauthClient) redirectURI(provider *oauthProvider) string {
+	return o.siteURL + "/auth/callback/" + provider.ID
+}
+
+func randomURLToken() string {
+	random := make([]byte, 32)
+	rand.Read(random)
+	return base64.RawURLEncoding.EncodeToString(random)
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// beginOAuth stores a state for a new sign-in and returns the provider URL to
+// send the browser to. linkUserID is the signed-in user when linking.
+func beginOAuth(ctx context.Context, repo Repository, o *oauthClient, providerID string, linkUserID int, ttl time.Duration) (OAuthStart, error) {
+	provider, err := o.provider(providerID)
+	if err != nil {
+		return OAuthStart{}, err
+	}
+	if err := provider.discover(ctx, o.http); err != nil {
+		return OAuthStart{}, fmt.Errorf("%w: %v", errOAuthFailed, err)
+	}
+	state, verifier, nonce := randomURLToken(), randomURLToken(), randomURLToken()
+	if err := repo.CreateOAuthState(hashAuthToken(state), OAuthState{
+		Provider:     provider.ID,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(ttl),
+	}); err != nil {
+		return OAuthStart{}, err
+	}
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.ClientID},
+		"redirect_uri":          {o.redirectURI(provider)},
+		"scope":                 {strings.Join(provider.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	if provider.Issuer != "" {
+		query.Set("nonce", nonce)
+	}
+	separator := "?"
+	if strings.Contains(provider.AuthURL, "?") {
+		separator = "&"
+	}
+	return OAuthStart{URL: provider.AuthURL + separator + query.Encode(), State: state}, nil
+}
+
+// finishOAuth uses up the state, trades the code for tokens and returns the
+// account the provider vouched for. The state must have been started for the
+// same provider and, when linking, by the same user.
+func finishOAuth(ctx context.Context, repo Repository, o *oauthClient, providerID string, input OAuthCallbackInput, linkUserID int) (ExternalIdentity, error) {
+	provider, err := o.provider(providerID)
+	if err != nil {
+		return ExternalIdentity{}, err
+	}
+	if input.Code == "" || input.State == "" {
+		return ExternalIdentity{}, errOAuthState
+	}
+	state, err := repo.ConsumeOAuthState(hashAuthToken(input.State), provider.ID)
+	if err != nil {
+		return ExternalIdentity{}, err
+	}
+	if state.LinkUserID != linkUserID {
+		return ExternalIdentity{}, errOAuthState
+	}
+	// The sign-in may have started on another replica.
+	if err := provider.discover(ctx, o.http); err != nil {
+		return ExternalIdentity{}, fmt.Errorf("%w: %v", errOAuthFailed, err)
+	}
+	tokens, err := o.exchange(ctx, provider, input.Code, state.CodeVerifier)
+	if err != nil {
+		return ExternalIdentity{}, fmt.Errorf("%w: %v", errOAuthFailed, err)
+	}
+	identity, err := o.identity(ctx, provider, tokens, state.Nonce)
+	if err != nil {
+		return ExternalIdentity{}, fmt.Errorf("%w: %v", errOAuthFailed, err)
+	}
+	return identity, nil
+}
+
+type oauthDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// discover reads the OpenID configuration of issuer providers once.
+func (p *oauthProvider) discover(ctx context.Context, client *http.Client) error {
+	if p.Issuer == "" {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovered {
+		return nil
+	}
+	var doc oauthDiscovery
+	if err := getJSON(ctx, client, p.Issuer+"/.well-known/openid-configuration", "", &doc); err != nil {
+		return err
+	}
+	if strings.TrimRight(doc.Issuer, "/") != p.Issuer {
+		return fmt.Errorf("discovery issuer %q does not match %q", doc.Issuer, p.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return errors.New("discovery document is missing endpoints")
+	}
+	p.AuthURL = doc.AuthorizationEndpoint
+	p.TokenURL = doc.TokenEndpoint
+	p.UserInfoURL = doc.UserInfoEndpoint
+	p.jwksURL = doc.JWKSURI
+	p.discovered = true
+	return nil
+}
+
+type oauthTokens struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (o *oauthClient) exchange(ctx context.Context, provider *oauthProvider, code string, verifier string) (*oauthTokens, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.redirectURI(provider)},
+		"client_id":     {provider.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+	resp, err := o.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tokens oauthTokens
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("token endpoint: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s %s %s", resp.Status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.AccessToken == "" {
+		return nil, errors.New("token endpoint returned no access token")
+	}
+	return &tokens, nil
+}
+
+// oauthProfile covers the user info fields of OpenID Connect and of Discord.
+type oauthProfile struct {
+	Sub               string `json:"sub"`
+	ID                string `json:"id"`
+	Email             string `json:"email"`
+	EmailVerified     any    `json:"email_verified"`
+	Verified          *bool  `json:"verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	GlobalName        string `json:"global_name"`
+	Username          string `json:"username"`
+}
+
+type idTokenClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     any    `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// identity reads the account from the ID token of OpenID Connect providers,
+// falling back to user info for a missing email, and from user info alone
+// for plain OAuth2 providers.
+func (o *oauthClient) identity(ctx context.Context, provider *oauthProvider, tokens *oauthTokens, nonce string) (ExternalIdentity, error) {
+	var profile oauthProfile
+	if provider.Issuer != "" {
+		claims, err := o.verifyIDToken(ctx, provider, tokens.IDToken, nonce)
+		if err != nil {
+			return ExternalIdentity{}, err
+		}
+		profile = oauthProfile{
+			Sub:               claims.Subject,
+			Email:             claims.Email,
+			EmailVerified:     claims.EmailVerified,
+			Name:              claims.Name,
+			PreferredUsername: claims.PreferredUsername,
+		}
+		if profile.Email == "" && provider.UserInfoURL != "" {
+			var info oauthProfile
+			if err := getJSON(ctx, o.http, provider.UserInfoURL, tokens.AccessToken, &info); err != nil {
+				return ExternalIdentity{}, err
+			}
+			if info.Sub != profile.Sub {
+				return ExternalIdentity{}, errors.New("user info subject does not match the ID token")
+			}
+			profile.Email, profile.EmailVerified = info.Email, info.EmailVerified
+		}
+	} else if err := getJSON(ctx, o.http, provider.UserInfoURL, tokens.AccessToken, &profile); err != nil {
+		return ExternalIdentity{}, err
+	}
+
+	identity := ExternalIdentity{
+		Provider: provider.ID,
+		Subject:  cmp.Or(profile.Sub, profile.ID),
+		Email:    normalizeEmail(profile.Email),
+		Name:     strings.TrimSpace(cmp.Or(profile.Name, profile.GlobalName, profile.PreferredUsername, profile.Username)),
+	}
+	if identity.Subject == "" {
+		return ExternalIdentity{}, errors.New("provider returned no account ID")
+	}
+	switch verified := profile.EmailVerified.(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	if profile.Verified != nil {
+		identity.EmailVerified = *profile.Verified
+	}
+	if identity.Email == "" {
+		identity.EmailVerified = false
+	}
+	if identity.Name == "" {
+		identity.Name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	identity.Name = truncateRunes(identity.Name, 80)
+	return identity, nil
+}
+
+// verifyIDToken checks the signature against the provider's published keys
+// and the issuer, audience, expiry and nonce claims.
+func (o *oauthClient) verifyIDToken(ctx context.Context, provider *oauthProvider, raw string, nonce string) (*idTokenClaims, error) {
+	if raw == "" {
+		return nil, errors.New("token endpoint returned no ID token")
+	}
+	claims := &idTokenClaims{}
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256"}),
+		jwt.WithAudience(provider.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return provider.signingKey(ctx, o.http, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Google documents both spellings of its issuer.
+	if strings.TrimRight(claims.Issuer, "/") != provider.Issuer && !(provider.ID == oauthGoogle && claims.Issuer == "accounts.google.com") {
+		return nil, fmt.Errorf("ID token issuer %q does not match", claims.Issuer)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != provider.ClientID {
+		return nil, errors.New("ID token was issued to another client")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+	return claims, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	decode := func(value string) (*big.Int, error) {
+		raw, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(raw), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// signingKey returns the key with ID kid, refetching the key set when the
+// provider has rotated to a key not seen yet.
+func (p *oauthProvider) signingKey(ctx context.Context, client *http.Client, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, client, p.jwksURL, "", &set); err != nil {
+		return nil, err
+	}
+	p.keys = make(map[string]any, len(set.Keys))
+	p.keysFetched = time.Now()
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		p.keys[jwk.Kid] = key
+	}
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds kid, or the only key when the token names none.
+func (p *oauthProvider) lookupKey(kid string) (any, bool) {
+	if key, ok := p.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// getJSON decodes the response of a GET, sending bearer when it is set.
+func getJSON(ctx context.Context, client *http.Client, target string, bearer string, value any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(value)
+}
+
+// oauthRole gives addresses in ADMIN_EMAILS the admin role, as registration
+// does, once the provider has verified them.
+func oauthRole(identity ExternalIdentity, cfg Config) string {
+	if identity.EmailVerified && isAdminEmail(identity.Email, cfg.AdminEmails) {
+		return "admin"
+	}
+	return "user"
+}
+
+func respondOAuthError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errOAuthProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errOAuthState), errors.Is(err, errIdentityEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errIdentityUnverified), errors.Is(err, errIdentityTaken), errors.Is(err, errIdentityLast):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errOAuthFailed):
+		// The provider's answer is logged rather than shown to the user.
+		log.Printf("oauth: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": errOAuthFailed.Error()})
+	default:
+		respondNotFound(c, err)
+	}
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	mockClientID     = "client-1"
+	mockClientSecret = "client-secret"
+)
+
+// mockOIDC is a local OpenID Connect provider. The test registers each
+// authorization code with the PKCE challenge and nonce of its sign-in, and
+// the token endpoint answers with the ID token built by idToken.
+type mockOIDC struct {
+	server  *httptest.Server
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	mu      sync.Mutex
+	codes   map[string][2]string
+	idToken func(nonce string) string
+}
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDC{rsaKey: rsaKey, ecKey: ecKey, codes: make(map[string][2]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oauthDiscovery{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			UserInfoEndpoint:      m.server.URL + "/userinfo",
+			JWKSURI:               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		encode := func(value *big.Int, size int) string {
+			return base64.RawURLEncoding.EncodeToString(value.FillBytes(make([]byte, size)))
+		}
+		rsaKey := m.rsaKey.PublicKey
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{
+			{Kty: "RSA", Kid: "rsa-1", Use: "sig", N: encode(rsaKey.N, rsaKey.Size()), E: encode(big.NewInt(int64(rsaKey.E)), 3)},
+			{Kty: "EC", Kid: "ec-1", Crv: "P-256", X: encode(m.ecKey.X, 32), Y: encode(m.ecKey.Y, 32)},
+			{Kty: "RSA", Kid: "enc-1", Use: "enc", N: encode(rsaKey.N, rsaKey.Size()), E: encode(big.NewInt(int64(rsaKey.E)), 3)},
+		}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		fail := func(reason string) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": reason})
+		}
+		if id, secret, ok := r.BasicAuth(); !ok || id != mockClientID || secret != mockClientSecret {
+			fail("invalid_client")
+			return
+		}
+		m.mu.Lock()
+		auth, ok := m.codes[r.PostFormValue("code")]
+		delete(m.codes, r.PostFormValue("code"))
+		m.mu.Unlock()
+		if !ok || r.PostFormValue("grant_type") != "authorization_code" || pkceChallenge(r.PostFormValue("code_verifier")) != auth[0] {
+			fail("invalid_grant")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "id_token": m.idToken(auth[1])})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockOIDC) client() *oauthClient {
+	return newOAuthClient(Config{
+		SiteURL: "http://reader.test",
+		OAuthProviders: []OAuthProvider{
+			{ID: oauthOIDC, Name: "Mock", ClientID: mockClientID, ClientSecret: mockClientSecret, Issuer: m.server.URL, Scopes: []string{"openid", "email"}},
+			{ID: oauthDiscord, Name: "Other", ClientID: "other", AuthURL: m.server.URL + "/authorize"},
+		},
+	})
+}
+
+// claims are those of a valid ID token for nonce.
+func (m *mockOIDC) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            mockClientID,
+		"sub":            "user-42",
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "Reader@Example.com",
+		"email_verified": true,
+		"name":           "Reader",
+	}
+}
+
+func (m *mockOIDC) sign(method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// begin starts a sign-in and authorizes it at the provider, returning the
+// callback the browser would bring back.
+func (m *mockOIDC) begin(t *testing.T, repo Repository, client *oauthClient, linkUserID int) OAuthCallbackInput {
+	t.Helper()
+	start, err := beginOAuth(context.Background(), repo, client, oauthOIDC, linkUserID, time.Minute)
+	if err != nil {
+		t.Fatalf("beginOAuth: %v", err)
+	}
+	target, err := url.Parse(start.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := target.Query()
+	if target.Path != "/authorize" || query.Get("code_challenge_method") != "S256" || query.Get("nonce") == "" || query.Get("state") != start.State {
+		t.Fatalf("authorization URL = %s", start.URL)
+	}
+	code := "code-" + start.State[:8]
+	m.mu.Lock()
+	m.codes[code] = [2]string{query.Get("code_challenge"), query.Get("nonce")}
+	m.mu.Unlock()
+	return OAuthCallbackInput{Code: code, State: start.State}
+}
+
+// oauthStateRepo keeps sign-in states in memory the way the Postgres
+// repository does. Other Repository methods are not used.
+type oauthStateRepo struct {
+	Repository
+	states map[string]OAuthState
+}
+
+func (r *oauthStateRepo) CreateOAuthState(stateHash string, state OAuthState) error {
+	r.states[stateHash] = state
+	return nil
+}
+
+func (r *oauthStateRepo) ConsumeOAuthState(stateHash string, provider string) (*OAuthState, error) {
+	state, ok := r.states[stateHash]
+	delete(r.states, stateHash)
+	if !ok || state.Provider != provider || !time.Now().Before(state.ExpiresAt) {
+		return nil, errOAuthState
+	}
+	return &state, nil
+}
+
+func TestFinishOAuthIDToken(t *testing.T) {
+	m := newMockOIDC(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs256 := func(edit func(claims jwt.MapClaims)) func(nonce string) string {
+		return func(nonce string) string {
+			claims := m.claims(nonce)
+			edit(claims)
+			return m.sign(jwt.SigningMethodRS256, "rsa-1", m.rsaKey, claims)
+		}
+	}
+	tests := []struct {
+		name         string
+		idToken      func(nonce string) string
+		wantErr      string
+		wantVerified bool
+	}{
+		{
+			name:         "valid RS256",
+			idToken:      rs256(func(jwt.MapClaims) {}),
+			wantVerified: true,
+		},
+		{
+			name: "valid ES256",
+			idToken: func(nonce string) string {
+				return m.sign(jwt.SigningMethodES256, "ec-1", m.ecKey, m.claims(nonce))
+			},
+			wantVerified: true,
+		},
+		{
+			name: "only key without kid",
+			idToken: func(nonce string) string {
+				return m.sign(jwt.SigningMethodRS256, "", m.rsaKey, m.claims(nonce))
+			},
+			wantErr: "unknown signing key",
+		},
+		{
+			name:    "wrong issuer",
+			idToken: rs256(func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }),
+			wantErr: "issuer",
+		},
+		{
+			name:    "wrong audience",
+			idToken: rs256(func(c jwt.MapClaims) { c["aud"] = "other-client" }),
+			wantErr: "aud",
+		},
+		{
+			name:    "extra audience without azp",
+			idToken: rs256(func(c jwt.MapClaims) { c["aud"] = []string{mockClientID, "other-client"} }),
+			wantErr: "another client",
+		},
+		{
+			name: "extra audience with azp",
+			idToken: rs256(func(c jwt.MapClaims) {
+				c["aud"], c["azp"] = []string{mockClientID, "other-client"}, mockClientID
+			}),
+			wantVerified: true,
+		},
+		{
+			name:    "nonce mismatch",
+			idToken: rs256(func(c jwt.MapClaims) { c["nonce"] = "replayed" }),
+			wantErr: "nonce",
+		},
+		{
+			name:    "expired",
+			idToken: rs256(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() }),
+			wantErr: "expired",
+		},
+		{
+			name:    "no expiry",
+			idToken: rs256(func(c jwt.MapClaims) { delete(c, "exp") }),
+			wantErr: "exp",
+		},
+		{
+			name: "unknown kid",
+			idToken: func(nonce string) string {
+				return m.sign(jwt.SigningMethodRS256, "rotated", m.rsaKey, m.claims(nonce))
+			},
+			wantErr: "unknown signing key",
+		},
+		{
+			name: "encryption key",
+			idToken: func(nonce string) string {
+				return m.sign(jwt.SigningMethodRS256, "enc-1", m.rsaKey, m.claims(nonce))
+			},
+			wantErr: "unknown signing key",
+		},
+		{
+			name: "bad signature",
+			idToken: func(nonce string) string {
+				return m.sign(jwt.SigningMethodRS256, "rsa-1", otherKey, m.claims(nonce))
+			},
+			wantErr: "verification error",
+		},
+		{
+			name: "HMAC signed",
+			idToken: func(nonce string) string {
+				return m.sign(jwt.SigningMethodHS256, "rsa-1", []byte(mockClientSecret), m.claims(nonce))
+			},
+			wantErr: "signing method",
+		},
+		{
+			name:    "unverified email",
+			idToken: rs256(func(c jwt.MapClaims) { c["email_verified"] = "false" }),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.idToken = tt.idToken
+			repo := &oauthStateRepo{states: make(map[string]OAuthState)}
+			client := m.client()
+			input := m.begin(t, repo, client, 0)
+			identity, err := finishOAuth(context.Background(), repo, client, oauthOIDC, input, 0)
+			if tt.wantErr != "" {
+				if !errors.Is(err, errOAuthFailed) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("finishOAuth error = %v, want errOAuthFailed mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("finishOAuth: %v", err)
+			}
+			want := ExternalIdentity{Provider: oauthOIDC, Subject: "user-42", Email: "reader@example.com", EmailVerified: tt.wantVerified, Name: "Reader"}
+			if identity != want {
+				t.Errorf("identity = %+v, want %+v", identity, want)
+			}
+		})
+	}
+}
+
+func TestFinishOAuthState(t *testing.T) {
+	m := newMockOIDC(t)
+	m.idToken = func(nonce string) string {
+		return m.sign(jwt.SigningMethodRS256, "rsa-1", m.rsaKey, m.claims(nonce))
+	}
+	tests := []struct {
+		name       string
+		linkUserID int
+		callback   func(repo *oauthStateRepo, client *oauthClient, input OAuthCallbackInput) error
+		wantErr    error
+	}{
+		{
+			name: "completes once",
+			callback: func(repo *oauthStateRepo, client *oauthClient, input OAuthCallbackInput) error {
+				_, err := finishOAuth(context.Background(), repo, client, oauthOIDC, input, 0)
+				return err
+			},
+		},
+		{
+			name: "replayed state",
+			callback: func(repo *oauthStateRepo, client *oauthClient, input OAuthCallbackInput) error {
+				if _, err := finishOAuth(context.Background(), repo, client, oauthOIDC, input, 0); err != nil {
+					return fmt.Errorf("first callback: %w", err)
+				}
+				_, err := finishOAuth(context.Background(), repo, client, oauthOIDC, input, 0)
+				return err
+			},
+			wantErr: errOAuthState,
+		},
+		{
+			name: "forged state",
+			callback: func(repo *oauthStateRepo, client *oauthClient, input OAuthCallbackInput) error {
+				input.State = "forged"
+				_, err := finishOAuth(context.Background(), repo, client, oauthOIDC, input, 0)
+				return err
+			},
+			wantErr: errOAuthState,
+		},
+		{
+			name: "missing code",
+			callback: func(repo *oauthStateRepo, client *oauthClient, input OAuthCallbackInput) error {
+				input.Code = ""
+				_, err := finishOAuth(context.Background(), repo, client, oauthOIDC, input, 0)
+				return err
+			},
+			wantErr: errOAuthState,
+		},
+		{
+			name: "other provider",
+			callback: func(repo *oauthStateRepo, client *oauthClient, input OAuthCallbackInput) error {
+				_, err := finishOAuth(context.Background(), repo, client, oauthDiscord, input, 0)
+				return err
+			},
+			wantErr: errOAuthState,
+		},
+		{
+			name:       "linking for another user",
+			linkUserID: 7,
+			callback: func(repo *oauthStateRepo, client *oauthClient, input OAuthCallbackInput) error {
+				_, err := finishOAuth(context.Background(), repo, client, oauthOIDC, input, 8)
+				return err
+			},
+			wantErr: errOAuthState,
+		},
+		{
+			name: "expired state",
+			callback: func(repo *oauthStateRepo, client *oauthClient, input OAuthCallbackInput) error {
+				for hash, state := range repo.states {
+					state.ExpiresAt = time.Now().Add(-time.Second)
+					repo.states[hash] = state
+				}
+				_, err := finishOAuth(context.Background(), repo, client, oauthOIDC, input, 0)
+				return err
+			},
+			wantErr: errOAuthState,
+		},
+		{
+			name: "wrong PKCE verifier",
+			callback: func(repo *oauthStateRepo, client *oauthClient, input OAuthCallbackInput) error {
+				for hash, state := range repo.states {
+					state.CodeVerifier = randomURLToken()
+					repo.states[hash] = state
+				}
+				_, err := finishOAuth(context.Background(), repo, client, oauthOIDC, input, 0)
+				return err
+			},
+			wantErr: errOAuthFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &oauthStateRepo{states: make(map[string]OAuthState)}
+			client := m.client()
+			input := m.begin(t, repo, client, tt.linkUserID)
+			if err := tt.callback(repo, client, input); !errors.Is(err, tt.wantErr) {
+				t.Errorf("finishOAuth error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type storedUser struct {
+	id       int
+	verified bool
+}
+
+// identityStore stands in for the auth_users and identities tables and
+// answers the statements SignInWithIdentity runs.
+type identityStore struct {
+	mu         sync.Mutex
+	users      map[string]storedUser
+	identities map[string]int
+	saved      struct {
+		users      map[string]storedUser
+		identities map[string]int
+	}
+}
+
+func (s *identityStore) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved.users, s.saved.identities = maps.Clone(s.users), maps.Clone(s.identities)
+}
+
+func (s *identityStore) commit() {}
+
+func (s *identityStore) rollback() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users, s.identities = s.saved.users, s.saved.identities
+}
+
+func (s *identityStore) run(query string, args []driver.Value) ([][]driver.Value, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	row := func(email string, user storedUser) [][]driver.Value {
+		var verifiedAt driver.Value
+		if user.verified {
+			verifiedAt = now
+		}
+		return [][]driver.Value{{int64(user.id), "Reader", email, "", roleUser, "active", now, verifiedAt, nil}}
+	}
+	switch {
+	case strings.HasPrefix(query, "SELECT "+authUserColumns+" FROM auth_users WHERE id = (SELECT user_id FROM identities"):
+		id, ok := s.identities[args[0].(string)+"|"+args[1].(string)]
+		for email, user := range s.users {
+			if ok && user.id == id {
+				return row(email, user), 0, nil
+			}
+		}
+		return nil, 0, nil
+	case strings.HasPrefix(query, "UPDATE identities SET email"):
+		return nil, 1, nil
+	case strings.HasPrefix(query, "SELECT "+authUserColumns+" FROM auth_users WHERE email = $1"):
+		if user, ok := s.users[args[0].(string)]; ok {
+			return row(args[0].(string), user), 0, nil
+		}
+		return nil, 0, nil
+	case strings.HasPrefix(query, "INSERT INTO auth_users"):
+		user := storedUser{id: len(s.users) + 1, verified: true}
+		s.users[args[1].(string)] = user
+		return row(args[1].(string), user), 1, nil
+	case strings.HasPrefix(query, "INSERT INTO identities"):
+		key := args[1].(string) + "|" + args[2].(string)
+		if _, ok := s.identities[key]; ok {
+			return nil, 0, nil
+		}
+		s.identities[key] = int(args[0].(int64))
+		return [][]driver.Value{{int64(len(s.identities)), args[1], args[3], now, now}}, 1, nil
+	}
+	return nil, 0, fmt.Errorf("unexpected statement: %s", query)
+}
+
+func TestSignInWithIdentity(t *testing.T) {
+	verified := ExternalIdentity{Provider: oauthOIDC, Subject: "user-42", Email: "reader@example.com", EmailVerified: true, Name: "Reader"}
+	unverified := verified
+	unverified.EmailVerified = false
+	tests := []struct {
+		name        string
+		users       map[string]storedUser
+		identities  map[string]int
+		identity    ExternalIdentity
+		wantErr     error
+		wantUserID  int
+		wantCreated bool
+		wantLinked  bool
+	}{
+		{
+			name:       "linked identity",
+			users:      map[string]storedUser{"old@example.com": {id: 3}},
+			identities: map[string]int{"oidc|user-42": 3},
+			identity:   unverified,
+			wantUserID: 3,
+			wantLinked: true,
+		},
+		{
+			name:        "new address",
+			identity:    verified,
+			wantUserID:  1,
+			wantCreated: true,
+			wantLinked:  true,
+		},
+		{
+			name:       "verified local account",
+			users:      map[string]storedUser{"reader@example.com": {id: 5, verified: true}},
+			identity:   verified,
+			wantUserID: 5,
+			wantLinked: true,
+		},
+		{
+			name:     "unverified local account",
+			users:    map[string]storedUser{"reader@example.com": {id: 5}},
+			identity: verified,
+			wantErr:  errIdentityUnverified,
+		},
+		{
+			name:     "provider did not verify the address",
+			users:    map[string]storedUser{"reader@example.com": {id: 5, verified: true}},
+			identity: unverified,
+			wantErr:  errIdentityEmail,
+		},
+		{
+			name:     "no address",
+			identity: ExternalIdentity{Provider: oauthDiscord, Subject: "99", Name: "Reader"},
+			wantErr:  errIdentityEmail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &identityStore{users: make(map[string]storedUser), identities: make(map[string]int)}
+			maps.Copy(store.users, tt.users)
+			maps.Copy(store.identities, tt.identities)
+			repo := NewAppRepository(nil, openFakeDB(store))
+
+			user, created, err := repo.SignInWithIdentity(tt.identity, roleUser)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SignInWithIdentity error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (user.ID != tt.wantUserID || created != tt.wantCreated) {
+				t.Errorf("SignInWithIdentity = user %d, created %t, want %d, %t", user.ID, created, tt.wantUserID, tt.wantCreated)
+			}
+			_, linked := store.identities[tt.identity.Provider+"|"+tt.identity.Subject]
+			if linked != tt.wantLinked {
+				t.Errorf("identity linked = %t, want %t", linked, tt.wantLinked)
+			}
+		})
+	}
+}
+
+func TestOAuthRole(t *testing.T) {
+	cfg := Config{AdminEmails: []string{"owner@example.com"}}
+	tests := []struct {
+		identity ExternalIdentity
+		want     string
+	}{
+		{ExternalIdentity{Email: "owner@example.com", EmailVerified: true}, roleAdmin},
+		{ExternalIdentity{Email: "owner@example.com"}, roleUser},
+		{ExternalIdentity{Email: "reader@example.com", EmailVerified: true}, roleUser},
+	}
+	for _, tt := range tests {
+		if got := oauthRole(tt.identity, cfg); got != tt.want {
+			t.Errorf("oauthRole(%+v) = %q, want %q", tt.identity, got, tt.want)
+		}
+	}
+}
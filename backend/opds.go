@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/xml"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	opdsNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	openSearchType      = "application/opensearchdescription+xml"
+	opdsPageSize        = 25
+)
+
+type opdsFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	DCNS    string      `xml:"xmlns:dc,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []opdsEntry `xml:"entry"`
+}
+
+type opdsEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomAuthor   `xml:"author"`
+	Language   string         `xml:"dc:language,omitempty"`
+	Categories []opdsCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+	Content    *opdsContent   `xml:"content,omitempty"`
+	Links      []atomLink     `xml:"link"`
+}
+
+type opdsCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type opdsContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type openSearchDescription struct {
+	XMLName     xml.Name        `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName   string          `xml:"ShortName"`
+	Description string          `xml:"Description"`
+	Encoding    string          `xml:"InputEncoding"`
+	URLs        []openSearchURL `xml:"Url"`
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// opdsCatalog builds the OPDS 1.2 feeds. base is API_URL or the API origin the
+// reader app used, so every link in the catalog is absolute.
+type opdsCatalog struct {
+	repo Repository
+	cfg  Config
+	base string
+}
+
+func (o opdsCatalog) newFeed(id, title, selfPath, kind string, updated time.Time) *opdsFeed {
+	return &opdsFeed{
+		DCNS:    "http://purl.org/dc/terms/",
+		ID:      "urn:novelreader:opds:" + id,
+		Title:   title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: o.base + selfPath, Rel: "self", Type: kind},
+			{Href: o.base + "/opds", Rel: "start", Type: opdsNavigationType},
+			{Href: o.base + "/opds/opensearch.xml", Rel: "search", Type: openSearchType},
+		},
+		Entries: make([]opdsEntry, 0),
+	}
+}
+
+func (o opdsCatalog) navigationEntry(id, title, description, href, rel, kind string, updated time.Time) opdsEntry {
+	return opdsEntry{
+		Title:   title,
+		ID:      "urn:novelreader:opds:" + id,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Content: &opdsContent{Type: "text", Value: description},
+		Links:   []atomLink{{Href: o.base + href, Rel: rel, Type: kind}},
+	}
+}
+
+func (o opdsCatalog) siteTitle() string {
+	title, _, _ := siteFeedTitle(o.repo, "")
+	return title
+}
+
+// Root is the navigation feed reader apps open first.
+func (o opdsCatalog) Root() (*opdsFeed, time.Time, error) {
+	updated := newestNovelUpdate(listedNovels(o.repo.ListNovels()))
+	feed := o.newFeed("root", o.siteTitle(), "/opds", opdsNavigationType, updated)
+	feed.Entries = append(feed.Entries,
+		o.navigationEntry("new", "Newest", "Recently added novels", "/opds/new", "http://opds-spec.org/sort/new", opdsAcquisitionType, updated),
+		o.navigationEntry("popular", "Most followed", "Novels with the most followers", "/opds/popular", "http://opds-spec.org/sort/popular", opdsAcquisitionType, updated),
+		o.navigationEntry("tags", "By tag", "Browse novels by tag", "/opds/tags", "subsection", opdsNavigationType, updated),
+		o.navigationEntry("status", "By status", "Browse ongoing and completed novels", "/opds/status", "subsection", opdsNavigationType, updated),
+	)
+	return feed, updated, nil
+}
+
+// Tags lists every tag in use with the number of novels carrying it.
+func (o opdsCatalog) Tags() (*opdsFeed, time.Time, error) {
+	novels := listedNovels(o.repo.ListNovels())
+	return o.groupFeed("tags", "By tag", "/opds/tags", novels, func(novel *Novel) []string { return novel.Tags })
+}
+
+// Statuses lists the publication statuses in use.
+func (o opdsCatalog) Statuses() (*opdsFeed, time.Time, error) {
+	novels := listedNovels(o.repo.ListNovels())
+	return o.groupFeed("status", "By status", "/opds/status", novels, func(novel *Novel) []string {
+		if novel.Status == "" {
+			return nil
+		}
+		return []string{strings.ToLower(novel.Status)}
+	})
+}
+
+func (o opdsCatalog) groupFeed(id, title, selfPath string, novels []*Novel, keys func(*Novel) []string) (*opdsFeed, time.Time, error) {
+	counts := make(map[string]int)
+	latest := make(map[string]time.Time)
+	for _, novel := range novels {
+		for _, key := range keys(novel) {
+			key = strings.TrimSpace(key)
+			if key == "" {
+				continue
+			}
+			counts[key]++
+			if novel.UpdatedAt.After(latest[key]) {
+				latest[key] = novel.UpdatedAt
+			}
+		}
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	updated := newestNovelUpdate(novels)
+	feed := o.newFeed(id, title, selfPath, opdsNavigationType, updated)
+	feed.Links = append(feed.Links, atomLink{Href: o.base + "/opds", Rel: "up", Type: opdsNavigationType})
+	for _, name := range names {
+		description := strconv.Itoa(counts[name]) + " novels"
+		if counts[name] == 1 {
+			description = "1 novel"
+		}
+		feed.Entries = append(feed.Entries, o.navigationEntry(
+			id+":"+name, name, description, selfPath+"/"+url.PathEscape(name), "subsection", opdsAcquisitionType, latest[name],
+		))
+	}
+	return feed, updated, nil
+}
+
+// Novels is a paginated acquisition feed over QueryNovels.
+func (o opdsCatalog) Novels(id, title, selfPath string, query NovelQuery) (*opdsFeed, time.Time, error) {
+	query.Limit = opdsPageSize
+	page, err := o.repo.QueryNovels(query)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	updated := newestNovelUpdate(page.Items)
+	feed := o.newFeed(id, title, selfPath, opdsAcquisitionType, updated)
+	feed.Links = append(feed.Links, atomLink{Href: o.base + "/opds", Rel: "up", Type: opdsNavigationType})
+	if page.NextCursor != "" {
+		next := o.base + selfPath + "?cursor=" + url.QueryEscape(page.NextCursor)
+		feed.Links = append(feed.Links, atomLink{Href: next, Rel: "next", Type: opdsAcquisitionType})
+	}
+	for _, novel := range page.Items {
+		feed.Entries = append(feed.Entries, o.novelEntry(novel))
+	}
+	return feed, updated, nil
+}
+
+// Search answers the OpenSearch template with matching novels.
+func (o opdsCatalog) Search(text string) (*opdsFeed, time.Time, error) {
+	results, err := o.repo.Search(SearchQuery{Text: text, Type: "novels", Limit: opdsPageSize})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	novels := make([]*Novel, 0, len(results.Novels))
+	for _, hit := range results.Novels {
+		novels = append(novels, hit.Novel)
+	}
+	updated := newestNovelUpdate(novels)
+	feed := o.newFeed("search", "Search: "+text, "/opds/search?q="+url.QueryEscape(text), opdsAcquisitionType, updated)
+	for _, novel := range novels {
+		feed.Entries = append(feed.Entries, o.novelEntry(novel))
+	}
+	return feed, updated, nil
+}
+
+// Novel is the acquisition feed for one novel: the complete EPUB followed by
+// one EPUB per volume.
+func (o opdsCatalog) Novel(id int) (*opdsFeed, time.Time, error) {
+	novel, err := o.repo.GetNovel(id)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !isViewable(novel.Visibility) {
+		return nil, time.Time{}, errNotFound
+	}
+	chapters, err := o.repo.ListChaptersByNovel(id)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	chapters = listedChapters(chapters)
+	updated := novel.UpdatedAt
+	volumes := make([]int, 0)
+	seen := make(map[int]bool)
+	for _, chapter := range chapters {
+		if chapter.UpdatedAt.After(updated) {
+			updated = chapter.UpdatedAt
+		}
+		if !seen[chapter.Volume] {
+			seen[chapter.Volume] = true
+			volumes = append(volumes, chapter.Volume)
+		}
+	}
+	sort.Ints(volumes)
+
+	feed := o.newFeed("novel:"+strconv.Itoa(id), novel.Title, "/opds/novels/"+strconv.Itoa(id), opdsAcquisitionType, updated)
+	feed.Entries = append(feed.Entries, o.novelEntry(novel))
+	if len(volumes) > 1 {
+		for _, volume := range volumes {
+			entry := o.novelEntry(novel)
+			entry.Title = novel.Title + " — Volume " + strconv.Itoa(volume)
+			entry.ID += ":volume:" + strconv.Itoa(volume)
+			entry.Links = o.novelLinks(novel, "?volume="+strconv.Itoa(volume))
+			feed.Entries = append(feed.Entries, entry)
+		}
+	}
+	return feed, updated, nil
+}
+
+func (o opdsCatalog) novelEntry(novel *Novel) opdsEntry {
+	entry := opdsEntry{
+		Title:    novel.Title,
+		ID:       "urn:novelreader:novel:" + strconv.Itoa(novel.ID),
+		Updated:  novel.UpdatedAt.UTC().Format(time.RFC3339),
+		Language: "en",
+		Summary:  novel.Summary,
+		Links:    o.novelLinks(novel, ""),
+	}
+	if novel.Author != "" {
+		entry.Authors = []atomAuthor{{Name: novel.Author}}
+	}
+	for _, tag := range novel.Tags {
+		entry.Categories = append(entry.Categories, opdsCategory{Term: tag, Label: tag})
+	}
+	return entry
+}
+
+func (o opdsCatalog) novelLinks(novel *Novel, exportQuery string) []atomLink {
+	id := strconv.Itoa(novel.ID)
+	links := []atomLink{
+		{Href: o.base + "/novels/" + id + "/export.epub" + exportQuery, Rel: "http://opds-spec.org/acquisition/open-access", Type: "application/epub+zip"},
+		{Href: o.cfg.SiteURL + "/novels/" + novel.Slug, Rel: "alternate", Type: "text/html"},
+		{Href: o.base + "/opds/novels/" + id, Rel: "related", Type: opdsAcquisitionType},
+	}
+	if cover := strings.TrimSpace(novel.CoverURL); cover != "" {
+		if strings.HasPrefix(cover, "/") {
+			cover = o.base + cover
+		}
+		coverType := mime.TypeByExtension(strings.ToLower(path.Ext(cover)))
+		if coverType == "" {
+			coverType = "image/jpeg"
+		}
+		links = append(links,
+			atomLink{Href: cover, Rel: "http://opds-spec.org/image", Type: coverType},
+			atomLink{Href: cover, Rel: "http://opds-spec.org/image/thumbnail", Type: coverType},
+		)
+	}
+	return links
+}
+
+func (o opdsCatalog) OpenSearch() []byte {
+	description := openSearchDescription{
+		ShortName:   o.siteTitle(),
+		Description: "Search novels in the " + o.siteTitle() + " catalog",
+		Encoding:    "UTF-8",
+		URLs: []openSearchURL{
+			{Type: opdsAcquisitionType, Template: o.base + "/opds/search?q={searchTerms}"},
+		},
+	}
+	body, _ := xml.MarshalIndent(description, "", "  ")
+	return append([]byte(xml.Header), body...)
+}
+
+func renderOPDS(feed *opdsFeed) ([]byte, error) {
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func newestNovelUpdate(novels []*Novel) time.Time {
+	newest := time.Time{}
+	for _, novel := range novels {
+		if novel.UpdatedAt.After(newest) {
+			newest = novel.UpdatedAt
+		}
+	}
+	return newest
+}
+
+// serveOPDS renders a catalog feed through the shared feed cache.
+func serveOPDS(c *gin.Context, cache *feedCache, repo Repository, cfg Config, kind string, build func(o opdsCatalog) (*opdsFeed, time.Time, error)) {
+	catalog := opdsCatalog{repo: repo, cfg: cfg, base: cache.baseURL(c)}
+	serveCachedXML(c, cache, feedCacheKey(c, catalog.base, "cursor", "q"), func() ([]byte, string, time.Time, error) {
+		feed, updated, err := build(catalog)
+		if err != nil {
+			return nil, "", time.Time{}, err
+		}
+		body, err := renderOPDS(feed)
+		return body, kind + ";charset=utf-8", updated, err
+	})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidCursor     = errors.New("invalid cursor")
+	errOffsetUnsupported = errors.New("offset is not supported here; pass the cursor from the X-Next-Cursor header instead")
+)
+
+// Page is one keyset-paginated slice of a list. NextCursor is empty on the
+// last page and Total counts every row matching the filters.
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+	Total      int
+}
+
+// pageCursor is the decoded form of the opaque cursor handed to clients: the
+// sort key it was issued for plus the sort value and ID of the last row.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"i"`
+}
+
+func encodeCursor(sort, value string, id int) string {
+	raw, _ := json.Marshal(pageCursor{Sort: sort, Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(raw string, sort string) (*pageCursor, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil || cursor.ID <= 0 {
+		return nil, errInvalidCursor
+	}
+	if cursor.Sort != sort {
+		return nil, errInvalidCursor
+	}
+	return &cursor, nil
+}
+
+func cursorTime(cursor *pageCursor) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339Nano, cursor.Value)
+	if err != nil {
+		return time.Time{}, errInvalidCursor
+	}
+	return parsed, nil
+}
+
+func cursorFloat(cursor *pageCursor) (float64, error) {
+	parsed, err := strconv.ParseFloat(cursor.Value, 64)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	return parsed, nil
+}
+
+func formatCursorTime(value time.Time) string {
+	return value.UTC().Format(time.RFC3339Nano)
+}
+
+func formatCursorFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sqlArgs collects positional arguments while a query is assembled.
+type sqlArgs []any
+
+func (a *sqlArgs) add(value any) string {
+	*a = append(*a, value)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// readCursorPagination reads the page size of a keyset-paginated list. These
+// lists ignore offset, so a request that still sends one is rejected rather
+// than quietly served the first page again.
+func readCursorPagination(c *gin.Context) (int, bool) {
+	if _, ok := c.GetQuery("offset"); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errOffsetUnsupported.Error()})
+		return 0, false
+	}
+	limit, _ := readPagination(c)
+	return limit, true
+}
+
+func writePageHeaders[T any](c *gin.Context, page *Page[T]) {
+	c.Header("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		c.Header("X-Next-Cursor", page.NextCursor)
+	}
+}
+
+func respondListError(c *gin.Context, err error) {
+	if errors.Is(err, errInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respondNotFound(c, err)
+}
+
+// keysetQuery pages through the rows of listing ordered by (column, id). The
+// listing must select id and column; total is appended as the last column.
+type keysetQuery struct {
+	listing   string
+	args      sqlArgs
+	column    string
+	ascending bool
+}
+
+func (q keysetQuery) build(cursorValue any, cursorID int, hasCursor bool, limit int) (string, []any) {
+	args := append(sqlArgs{}, q.args...)
+	direction, comparison := "DESC", "<"
+	if q.ascending {
+		direction, comparison = "ASC", ">"
+	}
+	where := ""
+	if hasCursor {
+		where = fmt.Sprintf("WHERE (%s, id) %s (%s, %s)", q.column, comparison, args.add(cursorValue), args.add(cursorID))
+	}
+	statement := fmt.Sprintf(
+		`WITH listing AS (%s)
+		 SELECT listing.*, (SELECT COUNT(*) FROM listing) AS total
+		 FROM listing
+		 %s
+		 ORDER BY %s %s, id %s
+		 LIMIT %s`,
+		q.listing, where, q.column, direction, direction, args.add(limit+1),
+	)
+	return statement, args
+}
+
+func (q keysetQuery) count(db *sql.DB) (int, error) {
+	var total int
+	err := db.QueryRow(`WITH listing AS (`+q.listing+`) SELECT COUNT(*) FROM listing`, q.args...).Scan(&total)
+	return total, err
+}
+
+// runKeysetQuery fetches one page of q and issues the cursor for the next page
+// when a further row exists. scan reads a row (storing the window total) and
+// returns the item with its sort value and ID.
+func runKeysetQuery[T any](
+	db *sql.DB,
+	q keysetQuery,
+	sort string,
+	cursor *pageCursor,
+	cursorValue any,
+	limit int,
+	scan func(rows *sql.Rows, total *int) (T, string, int, error),
+) (*Page[T], error) {
+	cursorID := 0
+	if cursor != nil {
+		cursorID = cursor.ID
+	}
+	statement, args := q.build(cursorValue, cursorID, cursor != nil, limit)
+	rows, err := db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &Page[T]{Items: make([]T, 0, limit)}
+	lastValue, lastID := "", 0
+	for rows.Next() {
+		item, value, id, err := scan(rows, &page.Total)
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Items) == limit {
+			page.NextCursor = encodeCursor(sort, lastValue, lastID)
+			break
+		}
+		page.Items = append(page.Items, item)
+		lastValue, lastID = value, id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(page.Items) == 0 && cursor != nil {
+		if page.Total, err = q.count(db); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	published := time.Date(2024, 3, 9, 18, 4, 5, 123456789, time.FixedZone("JST", 9*60*60))
+	tests := []struct {
+		name  string
+		sort  string
+		value string
+		id    int
+	}{
+		{"time", "latest", formatCursorTime(published), 42},
+		{"float", "rating", formatCursorFloat(4.625), 7},
+		{"zero float", "rating", formatCursorFloat(0), 1},
+		{"title with symbols", "title", `Re:Zero — "Starting" & Life`, 1 << 30},
+		{"empty value", "created", "", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := encodeCursor(tt.sort, tt.value, tt.id)
+			cursor, err := decodeCursor(" "+raw+"\n", tt.sort)
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			want := &pageCursor{Sort: tt.sort, Value: tt.value, ID: tt.id}
+			if !reflect.DeepEqual(cursor, want) {
+				t.Errorf("cursor = %+v, want %+v", cursor, want)
+			}
+		})
+	}
+}
+
+func TestCursorValues(t *testing.T) {
+	published := time.Date(2024, 3, 9, 18, 4, 5, 123456789, time.FixedZone("JST", 9*60*60))
+	parsed, err := cursorTime(&pageCursor{Value: formatCursorTime(published)})
+	if err != nil || !parsed.Equal(published) {
+		t.Errorf("cursorTime = %v, %v, want %v", parsed, err, published)
+	}
+	for _, value := range []float64{0, 3.5, 4.666666666666667, -1e-9} {
+		parsed, err := cursorFloat(&pageCursor{Value: formatCursorFloat(value)})
+		if err != nil || parsed != value {
+			t.Errorf("cursorFloat(%v) = %v, %v", value, parsed, err)
+		}
+	}
+	if _, err := cursorTime(&pageCursor{Value: "yesterday"}); !errors.Is(err, errInvalidCursor) {
+		t.Errorf("cursorTime(yesterday) error = %v, want errInvalidCursor", err)
+	}
+	if _, err := cursorFloat(&pageCursor{Value: "high"}); !errors.Is(err, errInvalidCursor) {
+		t.Errorf("cursorFloat(high) error = %v, want errInvalidCursor", err)
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"not base64", "!!!"},
+		{"not json", encode("latest:1")},
+		{"missing id", encode(`{"s":"latest","v":"x"}`)},
+		{"negative id", encode(`{"s":"latest","v":"x","i":-4}`)},
+		{"other sort", encodeCursor("title", "x", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := decodeCursor(tt.raw, "latest")
+			if !errors.Is(err, errInvalidCursor) || cursor != nil {
+				t.Errorf("decodeCursor = %+v, %v, want errInvalidCursor", cursor, err)
+			}
+		})
+	}
+
+	for _, blank := range []string{"", "   "} {
+		if cursor, err := decodeCursor(blank, "latest"); cursor != nil || err != nil {
+			t.Errorf("decodeCursor(%q) = %+v, %v, want the first page", blank, cursor, err)
+		}
+	}
+}
+
+func TestKeysetQueryBuild(t *testing.T) {
+	q := keysetQuery{listing: "SELECT id, title FROM novels WHERE status = $1", args: sqlArgs{"ongoing"}, column: "title", ascending: true}
+	tests := []struct {
+		name      string
+		hasCursor bool
+		wantArgs  []any
+		wantParts []string
+	}{
+		{"first page", false, []any{"ongoing", 21}, []string{"ORDER BY title ASC, id ASC", "LIMIT $2"}},
+		{"next page", true, []any{"ongoing", "Dawn", 9, 21}, []string{"WHERE (title, id) > ($2, $3)", "ORDER BY title ASC, id ASC", "LIMIT $4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, args := q.build("Dawn", 9, tt.hasCursor, 20)
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+			if !tt.hasCursor && strings.Contains(statement, "WHERE (") {
+				t.Errorf("first page statement %q has a keyset condition", statement)
+			}
+			for _, part := range tt.wantParts {
+				if !strings.Contains(statement, part) {
+					t.Errorf("statement %q lacks %q", statement, part)
+				}
+			}
+		})
+	}
+	descending := keysetQuery{listing: "SELECT id, published_at FROM chapters", column: "published_at"}
+	if statement, _ := descending.build(time.Time{}, 1, true, 10); !strings.Contains(statement, "(published_at, id) < ($1, $2)") ||
+		!strings.Contains(statement, "ORDER BY published_at DESC, id DESC") {
+		t.Errorf("descending statement = %q", statement)
+	}
+	if len(q.args) != 1 {
+		t.Errorf("build changed the shared args: %#v", q.args)
+	}
+}
+
+func TestReadCursorPagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		query     string
+		wantLimit int
+		wantOK    bool
+	}{
+		{"", 50, true},
+		{"limit=30", 30, true},
+		{"limit=1000", 200, true},
+		{"cursor=abc&limit=5", 5, true},
+		{"offset=40", 0, false},
+		{"offset=", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodGet, "/novels?"+tt.query, nil)
+			limit, ok := readCursorPagination(c)
+			if limit != tt.wantLimit || ok != tt.wantOK {
+				t.Errorf("readCursorPagination = %d, %t, want %d, %t", limit, ok, tt.wantLimit, tt.wantOK)
+			}
+			if !tt.wantOK && recorder.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", recorder.Code)
+			}
+		})
+	}
+}
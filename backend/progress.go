@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxProgressDevice = 80
+
+var (
+	errProgressStale    = errors.New("a newer reading position is already saved for this novel")
+	errProgressChapter  = errors.New("chapter does not belong to this novel")
+	errProgressPosition = errors.New("scrollPercent must be between 0 and 100 and paragraphIndex cannot be negative")
+)
+
+// normalizeProgress validates a reported position and settles the time it
+// was read. Devices send their own clock so uploads that arrive late lose to
+// newer reads; a clock ahead of the server is clamped to now so one device
+// cannot win every later conflict.
+func normalizeProgress(input ReadingProgressInput, now time.Time) (ReadingProgressInput, error) {
+	if input.ChapterID <= 0 {
+		return input, errProgressChapter
+	}
+	if input.ScrollPercent < 0 || input.ScrollPercent > 100 || (input.ParagraphIndex != nil && *input.ParagraphIndex < 0) {
+		return input, errProgressPosition
+	}
+	input.Device = strings.TrimSpace(input.Device)
+	if utf8.RuneCountInString(input.Device) > maxProgressDevice {
+		input.Device = string([]rune(input.Device)[:maxProgressDevice])
+	}
+	if input.ReadAt == nil || input.ReadAt.After(now) {
+		input.ReadAt = &now
+	}
+	return input, nil
+}
+
+// respondProgressError answers a stale upload with the stored position so
+// the device can jump to it.
+func respondProgressError(c *gin.Context, err error, current *ReadingProgress) {
+	switch {
+	case errors.Is(err, errProgressStale):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "progress": current})
+	case errors.Is(err, errProgressChapter), errors.Is(err, errProgressPosition):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondNotFound(c, err)
+	}
+}
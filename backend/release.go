@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	releaseQueued    = "Queued"
+	releaseScheduled = "Scheduled"
+	releasePublished = "Published"
+	releaseFailed    = "Failed"
+)
+
+var (
+	errReleaseTransition = errors.New("invalid release status transition")
+	errReleaseIncomplete = errors.New("a release needs a title, content and publishAt before it can be scheduled")
+	errReleaseStatus     = errors.New("status must be Queued, Scheduled, Published or Failed")
+	errReleaseLocked     = errors.New("published releases cannot be edited")
+)
+
+// releaseTransitions is the release queue state machine. Published is only
+// reached through the scheduler, which creates the chapter in the same
+// transaction.
+var releaseTransitions = map[string][]string{
+	releaseQueued:    {releaseScheduled},
+	releaseScheduled: {releaseQueued, releasePublished, releaseFailed},
+	releaseFailed:    {releaseQueued, releaseScheduled},
+	releasePublished: {},
+}
+
+func normalizeReleaseStatus(status string) (string, error) {
+	for known := range releaseTransitions {
+		if strings.EqualFold(strings.TrimSpace(status), known) {
+			return known, nil
+		}
+	}
+	return "", errReleaseStatus
+}
+
+func checkReleaseTransition(from, to string) error {
+	for _, allowed := range releaseTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s to %s", errReleaseTransition, from, to)
+}
+
+// releaseReady reports whether a draft has everything the scheduler needs.
+func releaseReady(title, content string, publishAt *time.Time) error {
+	if strings.TrimSpace(title) == "" || strings.TrimSpace(content) == "" || publishAt == nil {
+		return errReleaseIncomplete
+	}
+	return nil
+}
+
+func respondReleaseError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errReleaseTransition), errors.Is(err, errReleaseLocked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errReleaseIncomplete), errors.Is(err, errReleaseStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondNotFound(c, err)
+	}
+}
+
+// runReleaseScheduler publishes due release queue items every interval until
+// ctx is cancelled. Every replica may run it; row locks keep each item to a
+// single publisher.
+func runReleaseScheduler(ctx context.Context, repo Repository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		items, err := repo.PublishDueReleases(time.Now())
+		if err != nil {
+			log.Printf("release scheduler: %v", err)
+		}
+		for _, item := range items {
+			if item.Status == releasePublished {
+				log.Printf("release scheduler: published %q as chapter %d", item.Title, item.ChapterID)
+			} else {
+				log.Printf("release scheduler: release %d failed: %s", item.ID, item.LastError)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,20 +1,50 @@
 package main
 
+import (
+	"time"
+
+	"novelreader/mail"
+)
+
 type Repository interface {
 	ListNovels() []*Novel
+	QueryNovels(query NovelQuery) (*Page[*Novel], error)
 	GetNovel(id int) (*Novel, error)
 	CreateNovel(input NovelInput) (*Novel, error)
 	UpdateNovel(id int, input NovelInput) (*Novel, error)
 	DeleteNovel(id int) error
-	ListNovelChapterStats() []*NovelChapterStat
+	ListNovelStats(includeHidden bool) ([]*NovelStats, error)
+	GetNovelStats(novelID int) (*NovelStats, error)
+	RecordChapterView(chapterID int, visitorHash string, now time.Time, window time.Duration) (bool, error)
+	PruneChapterViewVisitors(before time.Time) (int64, error)
+	GetNovelViewSeries(novelID int, from, to time.Time) (*ViewSeries, error)
+	GetChapterViewSeries(chapterID int, from, to time.Time) (*ViewSeries, error)
+	ListNovelDropOff(novelID int, from, to time.Time) ([]*ChapterDropOff, error)
+	ListTopNovelsByViews(from, to time.Time, limit int) ([]*NovelViewRank, error)
 	ListChaptersByNovel(novelID int) ([]*Chapter, error)
+	ListLatestChapters(limit int) ([]*Chapter, error)
+	QueryChapters(query ChapterQuery) (*Page[*Chapter], error)
 	GetChapter(id int) (*Chapter, error)
 	CreateChapter(novelID int, input ChapterInput) (*Chapter, error)
+	CreateChapters(novelID int, inputs []ChapterInput) ([]*Chapter, error)
 	UpdateChapter(id int, input ChapterInput) (*Chapter, error)
+	ListChapterRevisions(chapterID int) ([]*ChapterRevision, error)
+	GetChapterRevision(chapterID int, revision int) (*ChapterRevision, error)
+	RestoreChapterRevision(chapterID int, revision int, editorID int) (*Chapter, error)
 	DeleteChapter(id int) error
 	ListCommentsByChapter(chapterID int) ([]*Comment, error)
+	QueryComments(query CommentQuery) (*Page[*Comment], error)
 	CreateComment(chapterID int, input CommentInput) (*Comment, error)
+	GetComment(id int) (*Comment, error)
+	ListParagraphCommentCounts(chapterID int) ([]*ParagraphCommentCount, error)
+	UpdateComment(id int, userID int, body string) (*Comment, error)
+	DeleteComment(id int, userID int, moderator bool) error
+	SetCommentReaction(commentID int, userID int, emoji string, active bool) ([]CommentReaction, error)
 	ListRatingsByNovel(novelID int) ([]*Rating, error)
+	QueryRatings(query RatingQuery) (*Page[*Rating], error)
+	GetRating(id int) (*Rating, error)
+	VoteRating(ratingID int, userID int, helpful *bool) (*Rating, error)
+	GetRatingSummary(novelID int) (*RatingSummary, error)
 	CreateRating(novelID int, input RatingInput) (*Rating, error)
 	ListUsers() []*User
 	CreateUser(name, role string) (*User, error)
@@ -24,10 +54,79 @@ type Repository interface {
 	ListAuthUsers() []*AuthUser
 	UpdateAuthUserRole(id int, role string) (*AuthUser, error)
 	UpdateAuthUserStatus(id int, status string) (*AuthUser, error)
+	ListRoles() ([]*Role, error)
+	GetRole(name string) (*Role, error)
+	CreateRole(input RoleInput) (*Role, error)
+	UpdateRole(input RoleInput) (*Role, error)
+	DeleteRole(name string) error
 	DeleteAuthUser(id int) error
-	ListReadingHistory(userID int) []*ReadingHistory
+	IssueAuthToken(userID int, purpose string, tokenHash string, email string, expiresAt time.Time) error
+	ResetPassword(tokenHash string, passwordHash string) (*AuthUser, error)
+	VerifyEmail(tokenHash string) (*AuthUser, error)
+	CreateSession(userID int, input SessionInput, tokenHash string, expiresAt time.Time) (*Session, error)
+	RotateSession(tokenHash string, newHash string, input SessionInput, expiresAt time.Time) (*Session, *AuthUser, error)
+	GetSessionUser(sessionID int, userID int) (*AuthUser, *time.Time, error)
+	ListSessions(userID int) ([]*Session, error)
+	RevokeSession(userID int, sessionID int, reason string) error
+	RevokeSessionByToken(tokenHash string, reason string) error
+	PruneSessions(before time.Time) (int64, error)
+	CreateOAuthState(stateHash string, state OAuthState) error
+	ConsumeOAuthState(stateHash string, provider string) (*OAuthState, error)
+	SignInWithIdentity(identity ExternalIdentity, role string) (*AuthUser, bool, error)
+	LinkIdentity(userID int, identity ExternalIdentity) (*Identity, error)
+	ListIdentities(userID int) ([]*Identity, error)
+	DeleteIdentity(userID int, id int) error
+	GetTwoFactor(userID int) (*TwoFactor, error)
+	SetTwoFactorSecret(userID int, sealed string) error
+	EnableTwoFactor(userID int, step int64, codeHashes []string, sessionID int) error
+	DisableTwoFactor(userID int) error
+	UseTOTPStep(userID int, step int64) error
+	UseRecoveryCode(userID int, codeHash string) error
+	RecordTwoFactorFailure(userID int) error
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	MarkSessionTwoFactor(userID int, sessionID int) (time.Time, error)
+	CreateTwoFactorChallenge(userID int, tokenHash string, device string, expiresAt time.Time) error
+	GetTwoFactorChallenge(tokenHash string) (int, string, error)
+	DeleteTwoFactorChallenge(tokenHash string) error
+	ListReadingHistory(userID int, includeHidden bool) ([]*ReadingHistory, error)
+	QueryReadingHistory(query HistoryQuery) (*Page[*ReadingHistory], error)
+	QueryHistoryNovels(query HistoryQuery) (*Page[*HistoryNovel], error)
 	AddReadingHistory(userID int, input ReadingHistoryInput) (*ReadingHistory, error)
+	DeleteReadingHistoryEntry(userID int, id int) error
+	DeleteNovelHistory(userID int, novelID int) error
 	ClearReadingHistory(userID int) error
+	PruneReadingHistory(before time.Time) (int64, error)
+	DispatchNotifications(limit int) (int, error)
+	QueryNotifications(query NotificationQuery) (*Page[*Notification], error)
+	CountUnreadNotifications(userID int) (int, error)
+	MarkNotificationRead(userID int, id int) error
+	MarkAllNotificationsRead(userID int) (int64, error)
+	ListNotificationPreferences(userID int) ([]*NotificationPreference, error)
+	SetNotificationPreference(userID int, novelID int, notify bool) (*NotificationPreference, error)
+	EnqueueMail(kind string, msg mail.Message) (*OutboxMail, error)
+	DeliverOutbox(mailer mail.Mailer, limit int) (int, error)
+	ListOutbox(status string, limit int) ([]*OutboxMail, error)
+	RetryOutbox(id int) (*OutboxMail, error)
+	GetEmailPreferences(userID int) (*EmailPreferences, error)
+	SetEmailDigest(userID int, digest string) (*EmailPreferences, error)
+	ListDueDigests(now time.Time) ([]*DigestRecipient, error)
+	ListDigestChapters(userID int, since, until time.Time) ([]*DigestChapter, error)
+	CompleteDigest(recipient *DigestRecipient, sentAt time.Time, msg *mail.Message) error
+	ListWebhooks() ([]*Webhook, error)
+	GetWebhook(id int) (*Webhook, error)
+	CreateWebhook(input WebhookInput) (*Webhook, error)
+	UpdateWebhook(id int, input WebhookInput) (*Webhook, error)
+	DeleteWebhook(id int) error
+	EnqueueWebhookEvent(event WebhookEvent) (int64, error)
+	QueueWebhookTest(id int, event WebhookEvent) (*WebhookDelivery, error)
+	DeliverWebhooks(send webhookSendFunc, limit int) (int, error)
+	DeliverWebhook(deliveryID int, send webhookSendFunc) (*WebhookDelivery, error)
+	ListWebhookDeliveries(webhookID int, status string, limit int) ([]*WebhookDelivery, error)
+	RetryWebhookDelivery(id int) (*WebhookDelivery, error)
+	GetReadingProgress(userID int, novelID int) (*ReadingProgress, error)
+	SaveReadingProgress(userID int, novelID int, input ReadingProgressInput) (*ReadingProgress, error)
+	DeleteReadingProgress(userID int, novelID int) error
+	ListContinueReading(userID int, limit int) ([]*ContinueReading, error)
 	ListFollows(userID int) []*Follow
 	AddFollow(userID int, novelID int) (*Follow, error)
 	RemoveFollow(userID int, novelID int) error
@@ -42,10 +141,13 @@ type Repository interface {
 	DeleteAnnouncement(id int) error
 	ListReleaseQueue() ([]*ReleaseQueueItem, error)
 	CreateReleaseQueue(input ReleaseQueueInput) (*ReleaseQueueItem, error)
+	UpdateReleaseQueue(id int, input ReleaseQueueInput) (*ReleaseQueueItem, error)
 	UpdateReleaseQueueStatus(id int, status string) (*ReleaseQueueItem, error)
+	PublishDueReleases(now time.Time) ([]*ReleaseQueueItem, error)
 	DeleteReleaseQueue(id int) error
 	ListModerationReports() ([]*ModerationReport, error)
 	CreateModerationReport(input ModerationReportInput) (*ModerationReport, error)
 	DeleteModerationReport(id int) error
 	CreateIllustration(input IllustrationInput) (*Illustration, error)
+	Search(query SearchQuery) (*SearchResults, error)
 }
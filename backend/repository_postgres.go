@@ -2,12 +2,17 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/lib/pq"
+
+	"novelreader/mail"
 )
 
 type AppRepository struct {
@@ -37,7 +42,7 @@ func (r *AppRepository) ListNovels() []*Novel {
 	r.cache.mu.RUnlock()
 
 	rows, err := r.db.Query(
-		`SELECT id, slug, title, author, summary, tags, cover_url, status, created_at, updated_at
+		`SELECT id, slug, title, author, summary, tags, cover_url, status, visibility, published_at, created_at, updated_at
 		 FROM novels
 		 ORDER BY updated_at DESC, id DESC`,
 	)
@@ -59,6 +64,8 @@ func (r *AppRepository) ListNovels() []*Novel {
 			pq.Array(&tags),
 			&novel.CoverURL,
 			&novel.Status,
+			&novel.Visibility,
+			&novel.PublishedAt,
 			&novel.CreatedAt,
 			&novel.UpdatedAt,
 		); err != nil {
@@ -80,7 +87,7 @@ func (r *AppRepository) GetNovel(id int) (*Novel, error) {
 	var novel Novel
 	var tags []string
 	err := r.db.QueryRow(
-		`SELECT id, slug, title, author, summary, tags, cover_url, status, created_at, updated_at
+		`SELECT id, slug, title, author, summary, tags, cover_url, status, visibility, published_at, created_at, updated_at
 		 FROM novels WHERE id = $1`,
 		id,
 	).Scan(
@@ -92,6 +99,8 @@ func (r *AppRepository) GetNovel(id int) (*Novel, error) {
 		pq.Array(&tags),
 		&novel.CoverURL,
 		&novel.Status,
+		&novel.Visibility,
+		&novel.PublishedAt,
 		&novel.CreatedAt,
 		&novel.UpdatedAt,
 	)
@@ -119,12 +128,17 @@ func (r *AppRepository) CreateNovel(input NovelInput) (*Novel, error) {
 	novel.Tags = input.Tags
 	novel.CoverURL = strings.TrimSpace(input.CoverURL)
 	novel.Status = strings.TrimSpace(input.Status)
+	novel.Visibility = input.Visibility
+	if novel.Visibility == "" {
+		novel.Visibility = visibilityPublished
+	}
+	novel.PublishedAt = firstPublishedAt(novel.Visibility, nil, now)
 	novel.CreatedAt = now
 	novel.UpdatedAt = now
 
 	err := r.db.QueryRow(
-		`INSERT INTO novels (slug, title, author, summary, tags, cover_url, status, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`INSERT INTO novels (slug, title, author, summary, tags, cover_url, status, visibility, published_at, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		 RETURNING id`,
 		novel.Slug,
 		novel.Title,
@@ -133,6 +147,8 @@ func (r *AppRepository) CreateNovel(input NovelInput) (*Novel, error) {
 		pq.Array(novel.Tags),
 		novel.CoverURL,
 		novel.Status,
+		novel.Visibility,
+		novel.PublishedAt,
 		novel.CreatedAt,
 		novel.UpdatedAt,
 	).Scan(&novel.ID)
@@ -157,12 +173,17 @@ func (r *AppRepository) UpdateNovel(id int, input NovelInput) (*Novel, error) {
 	if strings.TrimSpace(input.Slug) != "" {
 		current.Slug = strings.TrimSpace(input.Slug)
 	}
+	if input.Visibility != "" {
+		current.Visibility = input.Visibility
+	}
 	current.UpdatedAt = time.Now()
+	current.PublishedAt = firstPublishedAt(current.Visibility, current.PublishedAt, current.UpdatedAt)
 
 	_, err = r.db.Exec(
 		`UPDATE novels
-		 SET slug = $1, title = $2, author = $3, summary = $4, tags = $5, cover_url = $6, status = $7, updated_at = $8
-		 WHERE id = $9`,
+		 SET slug = $1, title = $2, author = $3, summary = $4, tags = $5, cover_url = $6, status = $7,
+			visibility = $8, published_at = $9, updated_at = $10
+		 WHERE id = $11`,
 		current.Slug,
 		current.Title,
 		current.Author,
@@ -170,6 +191,8 @@ func (r *AppRepository) UpdateNovel(id int, input NovelInput) (*Novel, error) {
 		pq.Array(current.Tags),
 		current.CoverURL,
 		current.Status,
+		current.Visibility,
+		current.PublishedAt,
 		current.UpdatedAt,
 		id,
 	)
@@ -195,7 +218,7 @@ func (r *AppRepository) DeleteNovel(id int) error {
 
 func (r *AppRepository) ListChaptersByNovel(novelID int) ([]*Chapter, error) {
 	rows, err := r.db.Query(
-		`SELECT id, novel_id, number, volume, title, content, word_count, created_at, updated_at
+		`SELECT id, novel_id, number, volume, title, content, word_count, visibility, published_at, created_at, updated_at
 		 FROM chapters
 		 WHERE novel_id = $1
 		 ORDER BY number ASC`,
@@ -217,6 +240,8 @@ func (r *AppRepository) ListChaptersByNovel(novelID int) ([]*Chapter, error) {
 			&chapter.Title,
 			&chapter.Content,
 			&chapter.WordCount,
+			&chapter.Visibility,
+			&chapter.PublishedAt,
 			&chapter.CreatedAt,
 			&chapter.UpdatedAt,
 		); err != nil {
@@ -228,10 +253,16 @@ func (r *AppRepository) ListChaptersByNovel(novelID int) ([]*Chapter, error) {
 }
 
 func (r *AppRepository) GetChapter(id int) (*Chapter, error) {
+	return getChapter(r.db, id, "")
+}
+
+// getChapter loads one chapter; pass lock as " FOR UPDATE" inside a
+// transaction.
+func getChapter(q dbQuerier, id int, lock string) (*Chapter, error) {
 	var chapter Chapter
-	err := r.db.QueryRow(
-		`SELECT id, novel_id, number, volume, title, content, word_count, created_at, updated_at
-		 FROM chapters WHERE id = $1`,
+	err := q.QueryRow(
+		`SELECT id, novel_id, number, volume, title, content, word_count, visibility, published_at, created_at, updated_at
+		 FROM chapters WHERE id = $1`+lock,
 		id,
 	).Scan(
 		&chapter.ID,
@@ -241,6 +272,8 @@ func (r *AppRepository) GetChapter(id int) (*Chapter, error) {
 		&chapter.Title,
 		&chapter.Content,
 		&chapter.WordCount,
+		&chapter.Visibility,
+		&chapter.PublishedAt,
 		&chapter.CreatedAt,
 		&chapter.UpdatedAt,
 	)
@@ -253,29 +286,146 @@ func (r *AppRepository) GetChapter(id int) (*Chapter, error) {
 	return &chapter, nil
 }
 
+// dbQuerier is satisfied by both *sql.DB and *sql.Tx so row helpers can run
+// inside or outside a transaction.
+type dbQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 func (r *AppRepository) CreateChapter(novelID int, input ChapterInput) (*Chapter, error) {
 	if _, err := r.GetNovel(novelID); err != nil {
 		return nil, err
 	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	chapter, err := insertChapter(tx, novelID, input)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return chapter, nil
+}
+
+// CreateChapters inserts every chapter in a single transaction.
+func (r *AppRepository) CreateChapters(novelID int, inputs []ChapterInput) ([]*Chapter, error) {
+	if _, err := r.GetNovel(novelID); err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return []*Chapter{}, nil
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Ids are drawn up front so the batch goes in as a single INSERT, and the
+	// statement-level stats triggers recount the novel once, not per chapter.
+	rows, err := tx.Query(`SELECT nextval(pg_get_serial_sequence('chapters', 'id')) FROM generate_series(1, $1)`, len(inputs))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(inputs))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	now := time.Now()
+	chapters := make([]*Chapter, len(inputs))
+	numbers := make([]int64, len(inputs))
+	volumes := make([]int64, len(inputs))
+	titles := make([]string, len(inputs))
+	contents := make([]string, len(inputs))
+	wordCounts := make([]int64, len(inputs))
+	visibilities := make([]string, len(inputs))
+	for i, input := range inputs {
+		chapter := newChapter(novelID, input, now)
+		chapter.ID = int(ids[i])
+		chapters[i] = chapter
+		numbers[i] = int64(chapter.Number)
+		volumes[i] = int64(chapter.Volume)
+		titles[i] = chapter.Title
+		contents[i] = chapter.Content
+		wordCounts[i] = int64(chapter.WordCount)
+		visibilities[i] = chapter.Visibility
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO chapters (id, novel_id, number, volume, title, content, word_count, visibility, published_at, created_at, updated_at)
+		 SELECT t.id, $1, t.number, t.volume, t.title, t.content, t.word_count, t.visibility,
+		 CASE WHEN t.visibility = $3 THEN $2::TIMESTAMPTZ END, $2, $2
+		 FROM unnest($4::INTEGER[], $5::INTEGER[], $6::INTEGER[], $7::TEXT[], $8::TEXT[], $9::INTEGER[], $10::TEXT[])
+		 AS t(id, number, volume, title, content, word_count, visibility)`,
+		novelID,
+		now,
+		visibilityPublished,
+		pq.Array(ids),
+		pq.Array(numbers),
+		pq.Array(volumes),
+		pq.Array(titles),
+		pq.Array(contents),
+		pq.Array(wordCounts),
+		pq.Array(visibilities),
+	); err != nil {
+		return nil, err
+	}
+	for i, chapter := range chapters {
+		if _, err := insertChapterRevision(tx, chapter, inputs[i].EditorID, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return chapters, nil
+}
+
+// newChapter applies the defaults a new chapter is stored with.
+func newChapter(novelID int, input ChapterInput, now time.Time) *Chapter {
 	volume := input.Volume
 	if volume < 1 {
 		volume = 1
 	}
 	chapter := &Chapter{
-		NovelID:   novelID,
-		Number:    input.Number,
-		Volume:    volume,
-		Title:     strings.TrimSpace(input.Title),
-		Content:   strings.TrimSpace(input.Content),
-		WordCount: len(strings.Fields(input.Content)),
-		CreatedAt: now,
-		UpdatedAt: now,
+		NovelID:    novelID,
+		Number:     input.Number,
+		Volume:     volume,
+		Title:      strings.TrimSpace(input.Title),
+		Content:    strings.TrimSpace(input.Content),
+		WordCount:  len(strings.Fields(input.Content)),
+		Visibility: input.Visibility,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if chapter.Visibility == "" {
+		chapter.Visibility = visibilityPublished
 	}
+	chapter.PublishedAt = firstPublishedAt(chapter.Visibility, nil, now)
+	return chapter
+}
 
-	err := r.db.QueryRow(
-		`INSERT INTO chapters (novel_id, number, volume, title, content, word_count, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+func insertChapter(q dbQuerier, novelID int, input ChapterInput) (*Chapter, error) {
+	chapter := newChapter(novelID, input, time.Now())
+	err := q.QueryRow(
+		`INSERT INTO chapters (novel_id, number, volume, title, content, word_count, visibility, published_at, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		 RETURNING id`,
 		chapter.NovelID,
 		chapter.Number,
@@ -283,20 +433,66 @@ func (r *AppRepository) CreateChapter(novelID int, input ChapterInput) (*Chapter
 		chapter.Title,
 		chapter.Content,
 		chapter.WordCount,
+		chapter.Visibility,
+		chapter.PublishedAt,
 		chapter.CreatedAt,
 		chapter.UpdatedAt,
 	).Scan(&chapter.ID)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := insertChapterRevision(q, chapter, input.EditorID, nil); err != nil {
+		return nil, err
+	}
 	return chapter, nil
 }
 
+// insertChapterRevision snapshots chapter as its next revision. Callers hold
+// the chapter row (or have just inserted it) so revision numbers stay dense.
+func insertChapterRevision(q dbQuerier, chapter *Chapter, editorID int, restoredFrom *int) (*ChapterRevision, error) {
+	revision := &ChapterRevision{
+		ChapterID:    chapter.ID,
+		Title:        chapter.Title,
+		Content:      chapter.Content,
+		WordCount:    chapter.WordCount,
+		RestoredFrom: restoredFrom,
+		CreatedAt:    chapter.UpdatedAt,
+	}
+	if editorID > 0 {
+		revision.EditorID = &editorID
+	}
+	err := q.QueryRow(
+		`INSERT INTO chapter_revisions (chapter_id, revision, editor_id, title, content, word_count, restored_from, created_at)
+		 SELECT $1::INTEGER, COALESCE(MAX(revision), 0) + 1, $2::INTEGER, $3::TEXT, $4::TEXT, $5::INTEGER, $6::INTEGER, $7::TIMESTAMPTZ
+		 FROM chapter_revisions WHERE chapter_id = $1
+		 RETURNING id, revision`,
+		revision.ChapterID,
+		revision.EditorID,
+		revision.Title,
+		revision.Content,
+		revision.WordCount,
+		revision.RestoredFrom,
+		revision.CreatedAt,
+	).Scan(&revision.ID, &revision.Revision)
+	if err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// UpdateChapter saves the chapter and its new revision in one transaction.
 func (r *AppRepository) UpdateChapter(id int, input ChapterInput) (*Chapter, error) {
-	chapter, err := r.GetChapter(id)
+	tx, err := r.db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	chapter, err := getChapter(tx, id, " FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	previousContent := chapter.Content
 	chapter.Number = input.Number
 	if input.Volume >= 1 {
 		chapter.Volume = input.Volume
@@ -304,21 +500,219 @@ func (r *AppRepository) UpdateChapter(id int, input ChapterInput) (*Chapter, err
 	chapter.Title = strings.TrimSpace(input.Title)
 	chapter.Content = strings.TrimSpace(input.Content)
 	chapter.WordCount = len(strings.Fields(input.Content))
+	if input.Visibility != "" {
+		chapter.Visibility = input.Visibility
+	}
 	chapter.UpdatedAt = time.Now()
+	chapter.PublishedAt = firstPublishedAt(chapter.Visibility, chapter.PublishedAt, chapter.UpdatedAt)
 
-	_, err = r.db.Exec(
-		`UPDATE chapters SET number = $1, volume = $2, title = $3, content = $4, word_count = $5, updated_at = $6 WHERE id = $7`,
+	if err := saveChapter(tx, chapter); err != nil {
+		return nil, err
+	}
+	if err := reanchorChapterComments(tx, chapter.ID, previousContent, chapter.Content); err != nil {
+		return nil, err
+	}
+	if _, err := insertChapterRevision(tx, chapter, input.EditorID, nil); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return chapter, nil
+}
+
+func saveChapter(q dbQuerier, chapter *Chapter) error {
+	_, err := q.Exec(
+		`UPDATE chapters
+		 SET number = $1, volume = $2, title = $3, content = $4, word_count = $5, visibility = $6, published_at = $7, updated_at = $8
+		 WHERE id = $9`,
 		chapter.Number,
 		chapter.Volume,
 		chapter.Title,
 		chapter.Content,
 		chapter.WordCount,
+		chapter.Visibility,
+		chapter.PublishedAt,
 		chapter.UpdatedAt,
 		chapter.ID,
 	)
+	return err
+}
+
+// reanchorChapterComments moves paragraph anchors after the chapter content
+// changes, orphaning comments whose paragraph was removed.
+func reanchorChapterComments(q dbQuerier, chapterID int, previousContent, content string) error {
+	if previousContent == content {
+		return nil
+	}
+	rows, err := q.Query(
+		`SELECT id, paragraph_index, paragraph_hash, orphaned
+		 FROM comments
+		 WHERE chapter_id = $1 AND paragraph_index IS NOT NULL
+		 FOR UPDATE`,
+		chapterID,
+	)
+	if err != nil {
+		return err
+	}
+	anchors := make([]commentAnchor, 0)
+	for rows.Next() {
+		var anchor commentAnchor
+		if err := rows.Scan(&anchor.CommentID, &anchor.Index, &anchor.Hash, &anchor.Orphaned); err != nil {
+			rows.Close()
+			return err
+		}
+		anchors = append(anchors, anchor)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, anchor := range reanchorComments(previousContent, content, anchors) {
+		_, err := q.Exec(
+			`UPDATE comments SET paragraph_index = $1, paragraph_hash = $2, orphaned = $3 WHERE id = $4`,
+			anchor.Index,
+			anchor.Hash,
+			anchor.Orphaned,
+			anchor.CommentID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListParagraphCommentCounts counts the live comments anchored to each
+// paragraph of a chapter, replies included.
+func (r *AppRepository) ListParagraphCommentCounts(chapterID int) ([]*ParagraphCommentCount, error) {
+	rows, err := r.db.Query(
+		`SELECT paragraph_index, COUNT(*)
+		 FROM comments
+		 WHERE chapter_id = $1 AND paragraph_index IS NOT NULL AND NOT orphaned AND deleted_at IS NULL
+		 GROUP BY paragraph_index
+		 ORDER BY paragraph_index`,
+		chapterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*ParagraphCommentCount, 0)
+	for rows.Next() {
+		var item ParagraphCommentCount
+		if err := rows.Scan(&item.ParagraphIndex, &item.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *AppRepository) ListChapterRevisions(chapterID int) ([]*ChapterRevision, error) {
+	if _, err := r.GetChapter(chapterID); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(
+		`SELECT id, chapter_id, revision, editor_id, title, word_count, restored_from, created_at
+		 FROM chapter_revisions
+		 WHERE chapter_id = $1
+		 ORDER BY revision DESC`,
+		chapterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*ChapterRevision, 0)
+	for rows.Next() {
+		var item ChapterRevision
+		if err := rows.Scan(
+			&item.ID,
+			&item.ChapterID,
+			&item.Revision,
+			&item.EditorID,
+			&item.Title,
+			&item.WordCount,
+			&item.RestoredFrom,
+			&item.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *AppRepository) GetChapterRevision(chapterID int, revision int) (*ChapterRevision, error) {
+	return getChapterRevision(r.db, chapterID, revision)
+}
+
+func getChapterRevision(q dbQuerier, chapterID int, revision int) (*ChapterRevision, error) {
+	var item ChapterRevision
+	err := q.QueryRow(
+		`SELECT id, chapter_id, revision, editor_id, title, content, word_count, restored_from, created_at
+		 FROM chapter_revisions
+		 WHERE chapter_id = $1 AND revision = $2`,
+		chapterID,
+		revision,
+	).Scan(
+		&item.ID,
+		&item.ChapterID,
+		&item.Revision,
+		&item.EditorID,
+		&item.Title,
+		&item.Content,
+		&item.WordCount,
+		&item.RestoredFrom,
+		&item.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errNotFound
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// RestoreChapterRevision copies an old revision's title and content back onto
+// the chapter and records the result as a new revision.
+func (r *AppRepository) RestoreChapterRevision(chapterID int, revision int, editorID int) (*Chapter, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	chapter, err := getChapter(tx, chapterID, " FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	source, err := getChapterRevision(tx, chapterID, revision)
 	if err != nil {
 		return nil, err
 	}
+	previousContent := chapter.Content
+	chapter.Title = source.Title
+	chapter.Content = source.Content
+	chapter.WordCount = source.WordCount
+	chapter.UpdatedAt = time.Now()
+	if err := saveChapter(tx, chapter); err != nil {
+		return nil, err
+	}
+	if err := reanchorChapterComments(tx, chapter.ID, previousContent, chapter.Content); err != nil {
+		return nil, err
+	}
+	if _, err := insertChapterRevision(tx, chapter, editorID, &source.Revision); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return chapter, nil
 }
 
@@ -334,11 +728,47 @@ func (r *AppRepository) DeleteChapter(id int) error {
 	return nil
 }
 
+// commentSelect joins the author's display name; comment listings must keep
+// the id and created_at column names for keyset pagination.
+const commentSelect = `SELECT c.id, c.chapter_id, c.user_id, COALESCE(u.name, '') AS author_name, c.parent_id, c.depth,
+		c.paragraph_index, COALESCE(c.paragraph_hash, '') AS paragraph_hash, c.orphaned,
+		c.body, c.edited_at, c.deleted_at, c.created_at
+	FROM comments c
+	LEFT JOIN auth_users u ON u.id = c.user_id`
+
+func scanComment(scan func(dest ...any) error, extra ...any) (*Comment, error) {
+	var comment Comment
+	var deletedAt *time.Time
+	dest := []any{
+		&comment.ID,
+		&comment.ChapterID,
+		&comment.UserID,
+		&comment.AuthorName,
+		&comment.ParentID,
+		&comment.Depth,
+		&comment.ParagraphIndex,
+		&comment.ParagraphHash,
+		&comment.Orphaned,
+		&comment.Body,
+		&comment.EditedAt,
+		&deletedAt,
+		&comment.CreatedAt,
+	}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if deletedAt != nil {
+		redactComment(&comment)
+	}
+	comment.Reactions = make([]CommentReaction, 0)
+	return &comment, nil
+}
+
 func (r *AppRepository) ListCommentsByChapter(chapterID int) ([]*Comment, error) {
 	rows, err := r.db.Query(
-		`SELECT id, chapter_id, user_id, body, created_at
-		 FROM comments WHERE chapter_id = $1
-		 ORDER BY created_at DESC`,
+		commentSelect+`
+		 WHERE c.chapter_id = $1
+		 ORDER BY c.created_at DESC`,
 		chapterID,
 	)
 	if err != nil {
@@ -348,127 +778,487 @@ func (r *AppRepository) ListCommentsByChapter(chapterID int) ([]*Comment, error)
 
 	items := make([]*Comment, 0)
 	for rows.Next() {
-		var comment Comment
-		if err := rows.Scan(
-			&comment.ID,
-			&comment.ChapterID,
-			&comment.UserID,
-			&comment.Body,
-			&comment.CreatedAt,
-		); err != nil {
+		comment, err := scanComment(rows.Scan)
+		if err != nil {
 			continue
 		}
-		items = append(items, &comment)
+		items = append(items, comment)
 	}
 	return items, nil
 }
 
-func (r *AppRepository) CreateComment(chapterID int, input CommentInput) (*Comment, error) {
-	now := time.Now()
-	comment := &Comment{
-		ChapterID: chapterID,
-		UserID:    input.UserID,
-		Body:      strings.TrimSpace(input.Body),
-		CreatedAt: now,
+func (r *AppRepository) GetComment(id int) (*Comment, error) {
+	comment, err := scanComment(r.db.QueryRow(commentSelect+` WHERE c.id = $1`, id).Scan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errNotFound
+		}
+		return nil, err
+	}
+	if err := r.attachCommentReactions([]*Comment{comment}); err != nil {
+		return nil, err
 	}
-	if comment.Body == "" {
+	return comment, nil
+}
+
+func (r *AppRepository) CreateComment(chapterID int, input CommentInput) (*Comment, error) {
+	body := strings.TrimSpace(input.Body)
+	if body == "" {
 		return nil, errors.New("comment body required")
 	}
+	var parentID, paragraphIndex *int
+	var paragraphHash *string
+	depth := 0
+	if input.ParentID > 0 {
+		parent, err := r.GetComment(input.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if depth, err = replyDepth(parent, chapterID); err != nil {
+			return nil, err
+		}
+		parentID = &parent.ID
+		if parent.ParagraphIndex != nil {
+			paragraphIndex, paragraphHash = parent.ParagraphIndex, &parent.ParagraphHash
+		}
+	} else if input.ParagraphIndex != nil {
+		chapter, err := r.GetChapter(chapterID)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := anchorParagraph(chapter.Content, *input.ParagraphIndex)
+		if err != nil {
+			return nil, err
+		}
+		paragraphIndex, paragraphHash = input.ParagraphIndex, &hash
+	}
 
+	var id int
 	err := r.db.QueryRow(
-		`INSERT INTO comments (chapter_id, user_id, body, created_at)
-		 VALUES ($1, $2, $3, $4)
+		`INSERT INTO comments (chapter_id, user_id, parent_id, depth, paragraph_index, paragraph_hash, body, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		 RETURNING id`,
-		comment.ChapterID,
-		comment.UserID,
-		comment.Body,
-		comment.CreatedAt,
-	).Scan(&comment.ID)
+		chapterID,
+		input.UserID,
+		parentID,
+		depth,
+		paragraphIndex,
+		paragraphHash,
+		body,
+		time.Now(),
+	).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
-	return comment, nil
+	return r.GetComment(id)
 }
 
-func (r *AppRepository) ListRatingsByNovel(novelID int) ([]*Rating, error) {
-	rows, err := r.db.Query(
-		`SELECT id, novel_id, user_id, score, note, at
-		 FROM ratings WHERE novel_id = $1
-		 ORDER BY at DESC`,
-		novelID,
+// UpdateComment lets the author correct a comment and stamps edited_at.
+func (r *AppRepository) UpdateComment(id int, userID int, body string) (*Comment, error) {
+	current, err := r.GetComment(id)
+	if err != nil {
+		return nil, err
+	}
+	if current.Deleted {
+		return nil, errCommentDeleted
+	}
+	if current.UserID != userID {
+		return nil, errCommentForbidden
+	}
+	_, err = r.db.Exec(
+		`UPDATE comments SET body = $1, edited_at = $2 WHERE id = $3`,
+		strings.TrimSpace(body),
+		time.Now(),
+		id,
 	)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return r.GetComment(id)
+}
 
-	items := make([]*Rating, 0)
-	for rows.Next() {
-		var rating Rating
-		if err := rows.Scan(
-			&rating.ID,
-			&rating.NovelID,
-			&rating.UserID,
-			&rating.Score,
-			&rating.Note,
-			&rating.At,
-		); err != nil {
-			continue
-		}
-		items = append(items, &rating)
+// DeleteComment soft-deletes a comment so its replies keep their parent.
+// Moderators may delete any comment.
+func (r *AppRepository) DeleteComment(id int, userID int, moderator bool) error {
+	current, err := r.GetComment(id)
+	if err != nil {
+		return err
 	}
-	return items, nil
+	if current.Deleted {
+		return nil
+	}
+	if !moderator && current.UserID != userID {
+		return errCommentForbidden
+	}
+	_, err = r.db.Exec(`UPDATE comments SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`, time.Now(), id)
+	return err
 }
 
-func (r *AppRepository) CreateRating(novelID int, input RatingInput) (*Rating, error) {
-	now := time.Now()
-	rating := &Rating{
-		NovelID: novelID,
-		UserID:  input.UserID,
-		Score:   input.Score,
-		Note:    strings.TrimSpace(input.Note),
-		At:      now,
+// SetCommentReaction adds or removes one user's emoji reaction and returns the
+// comment's updated counts.
+func (r *AppRepository) SetCommentReaction(commentID int, userID int, emoji string, active bool) ([]CommentReaction, error) {
+	comment, err := r.GetComment(commentID)
+	if err != nil {
+		return nil, err
+	}
+	if active {
+		if comment.Deleted {
+			return nil, errCommentDeleted
+		}
+		_, err = r.db.Exec(
+			`INSERT INTO comment_reactions (comment_id, user_id, emoji, created_at)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT DO NOTHING`,
+			commentID,
+			userID,
+			emoji,
+			time.Now(),
+		)
+	} else {
+		_, err = r.db.Exec(
+			`DELETE FROM comment_reactions WHERE comment_id = $1 AND user_id = $2 AND emoji = $3`,
+			commentID,
+			userID,
+			emoji,
+		)
 	}
-
-	err := r.db.QueryRow(
-		`INSERT INTO ratings (novel_id, user_id, score, note, at)
-		 VALUES ($1, $2, $3, $4, $5)
-		 ON CONFLICT (novel_id, user_id)
-		 DO UPDATE SET score = EXCLUDED.score, note = EXCLUDED.note, at = EXCLUDED.at
-		 RETURNING id`,
-		rating.NovelID,
-		rating.UserID,
-		rating.Score,
-		rating.Note,
-		rating.At,
-	).Scan(&rating.ID)
 	if err != nil {
 		return nil, err
 	}
-	return rating, nil
+	comment.Reactions = make([]CommentReaction, 0)
+	if err := r.attachCommentReactions([]*Comment{comment}); err != nil {
+		return nil, err
+	}
+	return comment.Reactions, nil
 }
 
-func (r *AppRepository) ListUsers() []*User {
+// attachCommentThreads loads every reply below roots and the reactions of the
+// whole tree.
+func (r *AppRepository) attachCommentThreads(roots []*Comment) error {
+	if len(roots) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(roots))
+	for _, root := range roots {
+		ids = append(ids, int64(root.ID))
+	}
 	rows, err := r.db.Query(
-		`SELECT id, name, role, created_at FROM auth_users ORDER BY id`,
+		`WITH RECURSIVE thread AS (
+			SELECT id FROM comments WHERE parent_id = ANY($1)
+			UNION ALL
+			SELECT child.id FROM comments child JOIN thread ON child.parent_id = thread.id
+		 )
+		 `+commentSelect+`
+		 WHERE c.id IN (SELECT id FROM thread)`,
+		pq.Array(ids),
 	)
 	if err != nil {
-		return []*User{}
+		return err
 	}
 	defer rows.Close()
 
-	items := make([]*User, 0)
+	replies := make([]*Comment, 0)
 	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Role, &user.CreatedAt); err != nil {
-			continue
+		comment, err := scanComment(rows.Scan)
+		if err != nil {
+			return err
 		}
-		items = append(items, &user)
+		replies = append(replies, comment)
 	}
-	return items
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	buildCommentThreads(roots, replies)
+	return r.attachCommentReactions(append(append([]*Comment{}, roots...), replies...))
 }
 
-func (r *AppRepository) CreateUser(name, role string) (*User, error) {
+func (r *AppRepository) attachCommentReactions(comments []*Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	byID := make(map[int]*Comment, len(comments))
+	ids := make([]int64, 0, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+		ids = append(ids, int64(comment.ID))
+	}
+	rows, err := r.db.Query(
+		`SELECT comment_id, emoji, COUNT(*)
+		 FROM comment_reactions
+		 WHERE comment_id = ANY($1)
+		 GROUP BY comment_id, emoji
+		 ORDER BY comment_id, COUNT(*) DESC, emoji`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID int
+		var reaction CommentReaction
+		if err := rows.Scan(&commentID, &reaction.Emoji, &reaction.Count); err != nil {
+			return err
+		}
+		if comment, ok := byID[commentID]; ok {
+			comment.Reactions = append(comment.Reactions, reaction)
+		}
+	}
+	return rows.Err()
+}
+
+// ratingSelect lists rating columns; listings must keep id, at and
+// helpful_score for keyset pagination.
+const ratingSelect = `SELECT id, novel_id, user_id, score, note, title, body, spoiler, chapters_read,
+		helpful_count, unhelpful_count, at, helpful_count - unhelpful_count AS helpful_score
+	FROM ratings`
+
+func scanRating(scan func(dest ...any) error, extra ...any) (*Rating, int, error) {
+	var rating Rating
+	var helpfulScore int
+	dest := []any{
+		&rating.ID,
+		&rating.NovelID,
+		&rating.UserID,
+		&rating.Score,
+		&rating.Note,
+		&rating.Title,
+		&rating.Body,
+		&rating.Spoiler,
+		&rating.ChaptersRead,
+		&rating.Helpful,
+		&rating.Unhelpful,
+		&rating.At,
+		&helpfulScore,
+	}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return nil, 0, err
+	}
+	return &rating, helpfulScore, nil
+}
+
+func (r *AppRepository) ListRatingsByNovel(novelID int) ([]*Rating, error) {
+	rows, err := r.db.Query(
+		ratingSelect+`
+		 WHERE novel_id = $1
+		 ORDER BY at DESC`,
+		novelID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*Rating, 0)
+	for rows.Next() {
+		rating, _, err := scanRating(rows.Scan)
+		if err != nil {
+			continue
+		}
+		items = append(items, rating)
+	}
+	return items, nil
+}
+
+func (r *AppRepository) GetRating(id int) (*Rating, error) {
+	return getRating(r.db, id, "")
+}
+
+func getRating(q dbQuerier, id int, lock string) (*Rating, error) {
+	rating, _, err := scanRating(q.QueryRow(ratingSelect+` WHERE id = $1`+lock, id).Scan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errNotFound
+		}
+		return nil, err
+	}
+	return rating, nil
+}
+
+// CreateRating upserts the reader's rating. Writing a review also records how
+// many of the novel's chapters the reader had opened.
+func (r *AppRepository) CreateRating(novelID int, input RatingInput) (*Rating, error) {
+	reviewed := input.Title != nil || input.Body != nil || input.Spoiler != nil
+	title, body, spoiler := "", "", false
+	if input.Title != nil {
+		title = strings.TrimSpace(*input.Title)
+	}
+	if input.Body != nil {
+		body = strings.TrimSpace(*input.Body)
+	}
+	if input.Spoiler != nil {
+		spoiler = *input.Spoiler
+	}
+	chaptersRead := 0
+	if reviewed {
+		err := r.db.QueryRow(
+			`SELECT COUNT(DISTINCT h.chapter_id)
+			 FROM reading_history h
+			 JOIN chapters c ON c.id = h.chapter_id
+			 WHERE h.user_id = $1 AND c.novel_id = $2`,
+			input.UserID,
+			novelID,
+		).Scan(&chaptersRead)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var id int
+	err := r.db.QueryRow(
+		`INSERT INTO ratings (novel_id, user_id, score, note, at, title, body, spoiler, chapters_read)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 ON CONFLICT (novel_id, user_id)
+		 DO UPDATE SET score = EXCLUDED.score, note = EXCLUDED.note, at = EXCLUDED.at,
+			title = CASE WHEN $10 AND $11 THEN EXCLUDED.title ELSE ratings.title END,
+			body = CASE WHEN $10 AND $12 THEN EXCLUDED.body ELSE ratings.body END,
+			spoiler = CASE WHEN $10 AND $13 THEN EXCLUDED.spoiler ELSE ratings.spoiler END,
+			chapters_read = CASE WHEN $10 THEN EXCLUDED.chapters_read ELSE ratings.chapters_read END
+		 RETURNING id`,
+		novelID,
+		input.UserID,
+		input.Score,
+		strings.TrimSpace(input.Note),
+		time.Now(),
+		title,
+		body,
+		spoiler,
+		chaptersRead,
+		reviewed,
+		input.Title != nil,
+		input.Body != nil,
+		input.Spoiler != nil,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetRating(id)
+}
+
+// VoteRating records whether a reader found a review helpful; a nil helpful
+// withdraws the vote. Counts on the rating are kept in the same transaction.
+func (r *AppRepository) VoteRating(ratingID int, userID int, helpful *bool) (*Rating, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rating, err := getRating(tx, ratingID, " FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	if rating.UserID == userID {
+		return nil, errOwnReviewVote
+	}
+	var previous *bool
+	err = tx.QueryRow(
+		`SELECT helpful FROM rating_votes WHERE rating_id = $1 AND user_id = $2`,
+		ratingID,
+		userID,
+	).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if helpful == nil {
+		_, err = tx.Exec(`DELETE FROM rating_votes WHERE rating_id = $1 AND user_id = $2`, ratingID, userID)
+	} else {
+		_, err = tx.Exec(
+			`INSERT INTO rating_votes (rating_id, user_id, helpful, created_at)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (rating_id, user_id) DO UPDATE SET helpful = EXCLUDED.helpful, created_at = EXCLUDED.created_at`,
+			ratingID,
+			userID,
+			*helpful,
+			time.Now(),
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tally := func(vote *bool, weight int) {
+		if vote == nil {
+			return
+		}
+		if *vote {
+			rating.Helpful += weight
+		} else {
+			rating.Unhelpful += weight
+		}
+	}
+	tally(previous, -1)
+	tally(helpful, 1)
+	_, err = tx.Exec(
+		`UPDATE ratings SET helpful_count = $1, unhelpful_count = $2 WHERE id = $3`,
+		rating.Helpful,
+		rating.Unhelpful,
+		ratingID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rating, nil
+}
+
+func (r *AppRepository) GetRatingSummary(novelID int) (*RatingSummary, error) {
+	if _, err := r.GetNovel(novelID); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(
+		`SELECT score, COUNT(*), COUNT(*) FILTER (WHERE body <> '')
+		 FROM ratings
+		 WHERE novel_id = $1
+		 GROUP BY score`,
+		novelID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := make(map[int]int)
+	reviews := 0
+	for rows.Next() {
+		var score, count, reviewCount int
+		if err := rows.Scan(&score, &count, &reviewCount); err != nil {
+			return nil, err
+		}
+		scores[score] = count
+		reviews += reviewCount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newRatingSummary(novelID, scores, reviews), nil
+}
+
+func (r *AppRepository) ListUsers() []*User {
+	rows, err := r.db.Query(
+		`SELECT id, name, role, created_at FROM auth_users ORDER BY id`,
+	)
+	if err != nil {
+		return []*User{}
+	}
+	defer rows.Close()
+
+	items := make([]*User, 0)
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Role, &user.CreatedAt); err != nil {
+			continue
+		}
+		items = append(items, &user)
+	}
+	return items
+}
+
+func (r *AppRepository) CreateUser(name, role string) (*User, error) {
 	return r.store.CreateUser(name, role)
 }
 
@@ -519,48 +1309,72 @@ func (r *AppRepository) CreateAuthUser(input AuthRegisterInput) (*AuthUser, erro
 	return &user, nil
 }
 
+const authUserColumns = `id, name, email, password_hash, role, status, created_at, email_verified_at, totp_enabled_at`
+
+func scanAuthUser(scan func(dest ...any) error, extra ...any) (*AuthUser, error) {
+	var user AuthUser
+	var verifiedAt, twoFactorAt sql.NullTime
+	dest := []any{
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Role,
+		&user.Status,
+		&user.CreatedAt,
+		&verifiedAt,
+		&twoFactorAt,
+	}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
+	}
+	if twoFactorAt.Valid {
+		user.TwoFactorEnabledAt = &twoFactorAt.Time
+	}
+	return &user, nil
+}
+
 func (r *AppRepository) GetAuthUserByEmail(email string) (*AuthUser, error) {
 	key := normalizeEmail(email)
 	if key == "" {
 		return nil, errNotFound
 	}
-	var user AuthUser
-	err := r.db.QueryRow(
-		`SELECT id, name, email, password_hash, role, status, created_at
-		 FROM auth_users WHERE email = $1`,
+	user, err := scanAuthUser(r.db.QueryRow(
+		`SELECT `+authUserColumns+` FROM auth_users WHERE email = $1`,
 		key,
-	).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.Role, &user.Status, &user.CreatedAt)
+	).Scan)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errNotFound
 		}
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
 func (r *AppRepository) GetAuthUserByID(id int) (*AuthUser, error) {
 	if id <= 0 {
 		return nil, errNotFound
 	}
-	var user AuthUser
-	err := r.db.QueryRow(
-		`SELECT id, name, email, password_hash, role, status, created_at
-		 FROM auth_users WHERE id = $1`,
+	user, err := scanAuthUser(r.db.QueryRow(
+		`SELECT `+authUserColumns+` FROM auth_users WHERE id = $1`,
 		id,
-	).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.Role, &user.Status, &user.CreatedAt)
+	).Scan)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errNotFound
 		}
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
 func (r *AppRepository) ListAuthUsers() []*AuthUser {
 	rows, err := r.db.Query(
-		`SELECT id, name, email, role, status, created_at FROM auth_users ORDER BY id`,
+		`SELECT ` + authUserColumns + ` FROM auth_users ORDER BY id`,
 	)
 	if err != nil {
 		return []*AuthUser{}
@@ -569,11 +1383,11 @@ func (r *AppRepository) ListAuthUsers() []*AuthUser {
 
 	items := make([]*AuthUser, 0)
 	for rows.Next() {
-		var user AuthUser
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Status, &user.CreatedAt); err != nil {
+		user, err := scanAuthUser(rows.Scan)
+		if err != nil {
 			continue
 		}
-		items = append(items, &user)
+		items = append(items, user)
 	}
 	return items
 }
@@ -582,170 +1396,2340 @@ func (r *AppRepository) UpdateAuthUserRole(id int, role string) (*AuthUser, erro
 	if id <= 0 {
 		return nil, errNotFound
 	}
-	var user AuthUser
-	err := r.db.QueryRow(
+	user, err := scanAuthUser(r.db.QueryRow(
 		`UPDATE auth_users SET role = $1 WHERE id = $2
-		 RETURNING id, name, email, password_hash, role, status, created_at`,
+		 RETURNING `+authUserColumns,
 		strings.TrimSpace(role), id,
-	).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.Role, &user.Status, &user.CreatedAt)
+	).Scan)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errNotFound
 		}
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
+// UpdateAuthUserStatus changes the account status. Banning also revokes
+// every session, so the user's tokens stop working right away.
 func (r *AppRepository) UpdateAuthUserStatus(id int, status string) (*AuthUser, error) {
 	if id <= 0 {
 		return nil, errNotFound
 	}
-	var user AuthUser
-	err := r.db.QueryRow(
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user, err := scanAuthUser(tx.QueryRow(
 		`UPDATE auth_users SET status = $1 WHERE id = $2
-		 RETURNING id, name, email, password_hash, role, status, created_at`,
+		 RETURNING `+authUserColumns,
 		strings.TrimSpace(status), id,
-	).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.Role, &user.Status, &user.CreatedAt)
+	).Scan)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errNotFound
 		}
 		return nil, err
 	}
-	return &user, nil
+	if strings.EqualFold(user.Status, "banned") {
+		if err := revokeUserSessions(tx, user.ID, sessionRevokedBanned); err != nil {
+			return nil, err
+		}
+	}
+	return user, tx.Commit()
 }
 
-func (r *AppRepository) DeleteAuthUser(id int) error {
-	if id <= 0 {
-		return errNotFound
-	}
-	result, err := r.db.Exec(`DELETE FROM auth_users WHERE id = $1`, id)
-	if err != nil {
-		return err
-	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return err
+const roleColumns = `name, description, permissions, created_at, updated_at`
+
+func scanRole(scan func(dest ...any) error) (*Role, error) {
+	var role Role
+	var createdAt, updatedAt time.Time
+	if err := scan(&role.Name, &role.Description, pq.Array(&role.Permissions), &createdAt, &updatedAt); err != nil {
+		return nil, err
 	}
-	if rows == 0 {
-		return errNotFound
+	if role.Permissions == nil {
+		role.Permissions = []string{}
 	}
-	return nil
+	role.CreatedAt = &createdAt
+	role.UpdatedAt = &updatedAt
+	return &role, nil
 }
 
-func (r *AppRepository) ListReadingHistory(userID int) []*ReadingHistory {
-	rows, err := r.db.Query(
-		`SELECT id, user_id, novel_slug, novel_title, chapter_id, chapter_title, read_at
-		 FROM reading_history
-		 WHERE user_id = $1
-		 ORDER BY read_at DESC`,
-		userID,
-	)
+// ListRoles returns the custom roles; built-in ones are not stored.
+func (r *AppRepository) ListRoles() ([]*Role, error) {
+	rows, err := r.db.Query(`SELECT ` + roleColumns + ` FROM roles ORDER BY name`)
 	if err != nil {
-		return []*ReadingHistory{}
+		return nil, err
 	}
 	defer rows.Close()
 
-	items := make([]*ReadingHistory, 0)
+	items := make([]*Role, 0)
 	for rows.Next() {
-		var entry ReadingHistory
-		if err := rows.Scan(
-			&entry.ID,
-			&entry.UserID,
-			&entry.NovelSlug,
-			&entry.NovelTitle,
-			&entry.ChapterID,
-			&entry.ChapterTitle,
-			&entry.ReadAt,
-		); err != nil {
-			continue
+		role, err := scanRole(rows.Scan)
+		if err != nil {
+			return nil, err
 		}
-		items = append(items, &entry)
+		items = append(items, role)
 	}
-	return items
+	return items, rows.Err()
 }
 
-func (r *AppRepository) AddReadingHistory(userID int, input ReadingHistoryInput) (*ReadingHistory, error) {
-	entry := &ReadingHistory{
-		UserID:       userID,
-		NovelSlug:    strings.TrimSpace(input.NovelSlug),
-		NovelTitle:   strings.TrimSpace(input.NovelTitle),
-		ChapterID:    input.ChapterID,
-		ChapterTitle: strings.TrimSpace(input.ChapterTitle),
-		ReadAt:       time.Now(),
+func (r *AppRepository) GetRole(name string) (*Role, error) {
+	role, err := scanRole(r.db.QueryRow(`SELECT `+roleColumns+` FROM roles WHERE name = $1`, name).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
 	}
+	return role, err
+}
 
-	err := r.db.QueryRow(
-		`INSERT INTO reading_history (user_id, novel_slug, novel_title, chapter_id, chapter_title, read_at)
-		 VALUES ($1, $2, $3, $4, $5, $6)
-		 RETURNING id`,
-		entry.UserID, entry.NovelSlug, entry.NovelTitle, entry.ChapterID, entry.ChapterTitle, entry.ReadAt,
-	).Scan(&entry.ID)
-	if err != nil {
-		return nil, err
+func (r *AppRepository) CreateRole(input RoleInput) (*Role, error) {
+	role, err := scanRole(r.db.QueryRow(
+		`INSERT INTO roles (name, description, permissions, created_at, updated_at)
+		 VALUES ($1, $2, $3, now(), now())
+		 ON CONFLICT (name) DO NOTHING
+		 RETURNING `+roleColumns,
+		input.Name,
+		input.Description,
+		pq.Array(input.Permissions),
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errRoleExists
 	}
-	return entry, nil
+	return role, err
 }
 
-func (r *AppRepository) ClearReadingHistory(userID int) error {
-	_, err := r.db.Exec(
-		"DELETE FROM reading_history WHERE user_id = $1",
-		userID,
-	)
-	return err
+func (r *AppRepository) UpdateRole(input RoleInput) (*Role, error) {
+	role, err := scanRole(r.db.QueryRow(
+		`UPDATE roles SET description = $2, permissions = $3, updated_at = now()
+		 WHERE name = $1
+		 RETURNING `+roleColumns,
+		input.Name,
+		input.Description,
+		pq.Array(input.Permissions),
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	return role, err
 }
 
-func (r *AppRepository) ListFollows(userID int) []*Follow {
-	rows, err := r.db.Query(
-		`SELECT id, user_id, novel_id, created_at
-		 FROM follows WHERE user_id = $1
-		 ORDER BY created_at DESC`,
-		userID,
-	)
+// DeleteRole removes a custom role that no account holds.
+func (r *AppRepository) DeleteRole(name string) error {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return []*Follow{}
+		return err
 	}
-	defer rows.Close()
-	items := make([]*Follow, 0)
-	for rows.Next() {
-		var item Follow
-		if err := rows.Scan(&item.ID, &item.UserID, &item.NovelID, &item.CreatedAt); err != nil {
-			continue
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(`SELECT name FROM roles WHERE name = $1 FOR UPDATE`, name).Scan(&name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errNotFound
 		}
-		items = append(items, &item)
+		return err
 	}
-	return items
-}
-
-func (r *AppRepository) AddFollow(userID int, novelID int) (*Follow, error) {
-	entry := &Follow{UserID: userID, NovelID: novelID, CreatedAt: time.Now()}
-	err := r.db.QueryRow(
-		`INSERT INTO follows (user_id, novel_id, created_at)
-		 VALUES ($1, $2, $3)
-		 ON CONFLICT (user_id, novel_id) DO UPDATE SET created_at = EXCLUDED.created_at
-		 RETURNING id`,
-		entry.UserID,
-		entry.NovelID,
-		entry.CreatedAt,
-	).Scan(&entry.ID)
-	if err != nil {
-		return nil, err
+	var assigned bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM auth_users WHERE role = $1)`, name).Scan(&assigned); err != nil {
+		return err
 	}
-	return entry, nil
+	if assigned {
+		return errRoleInUse
+	}
+	if _, err := tx.Exec(`DELETE FROM roles WHERE name = $1`, name); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (r *AppRepository) RemoveFollow(userID int, novelID int) error {
-	result, err := r.db.Exec("DELETE FROM follows WHERE user_id = $1 AND novel_id = $2", userID, novelID)
+// IssueAuthToken stores a new token for purpose, replacing the user's earlier
+// ones of that purpose. It refuses when one was issued within
+// authTokenCooldown, which keeps the endpoints from being used to flood an
+// inbox.
+func (r *AppRepository) IssueAuthToken(userID int, purpose string, tokenHash string, email string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
-	count, err := result.RowsAffected()
-	if err == nil && count == 0 {
+	defer tx.Rollback()
+
+	var locked int
+	err = tx.QueryRow("SELECT id FROM auth_users WHERE id = $1 FOR UPDATE", userID).Scan(&locked)
+	if errors.Is(err, sql.ErrNoRows) {
 		return errNotFound
 	}
-	return nil
-}
+	if err != nil {
+		return err
+	}
+	var recent bool
+	if err := tx.QueryRow(
+		`SELECT EXISTS (
+		 SELECT 1 FROM auth_tokens
+		 WHERE user_id = $1 AND purpose = $2 AND created_at > now() - $3 * interval '1 second')`,
+		userID,
+		purpose,
+		int64(authTokenCooldown/time.Second),
+	).Scan(&recent); err != nil {
+		return err
+	}
+	if recent {
+		return errAuthTokenCooldown
+	}
+	if _, err := tx.Exec(
+		"DELETE FROM auth_tokens WHERE user_id = $1 AND (purpose = $2 OR expires_at <= now())",
+		userID,
+		purpose,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO auth_tokens (user_id, purpose, token_hash, email, expires_at, created_at)
+		 VALUES ($1, $2, $3, $4, $5, now())`,
+		userID,
+		purpose,
+		tokenHash,
+		email,
+		expiresAt,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// consumeAuthToken deletes the token so it cannot be used twice and returns
+// the user and address it was issued for.
+func consumeAuthToken(q dbQuerier, purpose string, tokenHash string) (int, string, error) {
+	var userID int
+	var email string
+	var expiresAt time.Time
+	err := q.QueryRow(
+		`DELETE FROM auth_tokens WHERE token_hash = $1 AND purpose = $2
+		 RETURNING user_id, email, expires_at`,
+		tokenHash,
+		purpose,
+	).Scan(&userID, &email, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", errAuthTokenInvalid
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if !time.Now().Before(expiresAt) {
+		return 0, "", errAuthTokenInvalid
+	}
+	return userID, email, nil
+}
+
+// ResetPassword sets a new password with a reset token and signs the user
+// out everywhere. Following the link proves the address, so it also verifies
+// the email when it is unchanged.
+func (r *AppRepository) ResetPassword(tokenHash string, passwordHash string) (*AuthUser, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userID, email, err := consumeAuthToken(tx, tokenPasswordReset, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	user, err := scanAuthUser(tx.QueryRow(
+		`UPDATE auth_users
+		 SET password_hash = $2,
+		 email_verified_at = CASE WHEN email = $3 THEN COALESCE(email_verified_at, now()) ELSE email_verified_at END
+		 WHERE id = $1 AND status <> 'banned'
+		 RETURNING `+authUserColumns,
+		userID,
+		passwordHash,
+		email,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errAuthTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM auth_tokens WHERE user_id = $1 AND purpose = $2", userID, tokenPasswordReset); err != nil {
+		return nil, err
+	}
+	if err := revokeUserSessions(tx, userID, sessionRevokedPassword); err != nil {
+		return nil, err
+	}
+	return user, tx.Commit()
+}
+
+// VerifyEmail marks the address a verification token was sent to as
+// verified, as long as it is still the account's address.
+func (r *AppRepository) VerifyEmail(tokenHash string) (*AuthUser, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userID, email, err := consumeAuthToken(tx, tokenEmailVerify, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	user, err := scanAuthUser(tx.QueryRow(
+		`UPDATE auth_users SET email_verified_at = COALESCE(email_verified_at, now())
+		 WHERE id = $1 AND email = $2
+		 RETURNING `+authUserColumns,
+		userID,
+		email,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errAuthTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, tx.Commit()
+}
+
+const sessionColumns = `s.id, s.device, s.ip, s.user_agent, s.created_at, s.last_used_at, s.expires_at, s.two_factor_at`
+
+func scanSession(scan func(dest ...any) error, extra ...any) (*Session, error) {
+	var session Session
+	var twoFactorAt sql.NullTime
+	dest := []any{
+		&session.ID,
+		&session.Device,
+		&session.IP,
+		&session.UserAgent,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&twoFactorAt,
+	}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if twoFactorAt.Valid {
+		session.TwoFactorAt = &twoFactorAt.Time
+	}
+	return &session, nil
+}
+
+func revokeUserSessions(q dbQuerier, userID int, reason string) error {
+	_, err := q.Exec(
+		"UPDATE sessions SET revoked_at = now(), revoked_reason = $2 WHERE user_id = $1 AND revoked_at IS NULL",
+		userID,
+		reason,
+	)
+	return err
+}
+
+func (r *AppRepository) CreateSession(userID int, input SessionInput, tokenHash string, expiresAt time.Time) (*Session, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session, err := scanSession(tx.QueryRow(
+		`INSERT INTO sessions AS s (user_id, device, ip, user_agent, created_at, last_used_at, expires_at, two_factor_at)
+		 VALUES ($1, $2, $3, $4, now(), now(), $5, CASE WHEN $6::boolean THEN now() END)
+		 RETURNING `+sessionColumns,
+		userID,
+		input.Device,
+		input.IP,
+		input.UserAgent,
+		expiresAt,
+		input.TwoFactor,
+	).Scan)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO session_tokens (token_hash, session_id, expires_at, created_at) VALUES ($1, $2, $3, now())",
+		tokenHash,
+		session.ID,
+		expiresAt,
+	); err != nil {
+		return nil, err
+	}
+	return session, tx.Commit()
+}
+
+// RotateSession exchanges a refresh token for newHash and extends the
+// session. A token that was already exchanged means it leaked or was
+// replayed, so the whole session is revoked and errSessionReused returned.
+func (r *AppRepository) RotateSession(tokenHash string, newHash string, input SessionInput, expiresAt time.Time) (*Session, *AuthUser, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var sessionID int
+	var replacedAt sql.NullTime
+	var tokenExpiresAt time.Time
+	err = tx.QueryRow(
+		"SELECT session_id, replaced_at, expires_at FROM session_tokens WHERE token_hash = $1 FOR UPDATE",
+		tokenHash,
+	).Scan(&sessionID, &replacedAt, &tokenExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errSessionInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if replacedAt.Valid {
+		if _, err := tx.Exec(
+			"UPDATE sessions SET revoked_at = now(), revoked_reason = $2 WHERE id = $1 AND revoked_at IS NULL",
+			sessionID,
+			sessionRevokedReuse,
+		); err != nil {
+			return nil, nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errSessionReused
+	}
+	if !time.Now().Before(tokenExpiresAt) {
+		return nil, nil, errSessionInvalid
+	}
+
+	var userID int
+	err = tx.QueryRow(
+		"SELECT user_id FROM sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > now() FOR UPDATE",
+		sessionID,
+	).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errSessionInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := scanAuthUser(tx.QueryRow(
+		`SELECT `+authUserColumns+` FROM auth_users WHERE id = $1 AND status <> 'banned'`,
+		userID,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errSessionInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE session_tokens SET replaced_at = now() WHERE token_hash = $1", tokenHash); err != nil {
+		return nil, nil, err
+	}
+	if _, err := tx.Exec(
+		"DELETE FROM session_tokens WHERE session_id = $1 AND replaced_at IS NOT NULL AND expires_at <= now()",
+		sessionID,
+	); err != nil {
+		return nil, nil, err
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO session_tokens (token_hash, session_id, expires_at, created_at) VALUES ($1, $2, $3, now())",
+		newHash,
+		sessionID,
+		expiresAt,
+	); err != nil {
+		return nil, nil, err
+	}
+	session, err := scanSession(tx.QueryRow(
+		`UPDATE sessions s SET last_used_at = now(), ip = $2, user_agent = $3, expires_at = $4
+		 WHERE s.id = $1
+		 RETURNING `+sessionColumns,
+		sessionID,
+		input.IP,
+		input.UserAgent,
+		expiresAt,
+	).Scan)
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, user, tx.Commit()
+}
+
+// GetSessionUser loads the user an access token belongs to and when its
+// session last passed a second-factor check, failing when the session has
+// been revoked or has expired.
+func (r *AppRepository) GetSessionUser(sessionID int, userID int) (*AuthUser, *time.Time, error) {
+	var twoFactorAt sql.NullTime
+	user, err := scanAuthUser(r.db.QueryRow(
+		`SELECT `+authUserColumns+`, session_two_factor_at FROM auth_users,
+		 (SELECT two_factor_at AS session_two_factor_at FROM sessions
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > now()) s
+		 WHERE id = $2`,
+		sessionID,
+		userID,
+	).Scan, &twoFactorAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if twoFactorAt.Valid {
+		return user, &twoFactorAt.Time, nil
+	}
+	return user, nil, nil
+}
+
+func (r *AppRepository) ListSessions(userID int) ([]*Session, error) {
+	rows, err := r.db.Query(
+		`SELECT `+sessionColumns+` FROM sessions s
+		 WHERE s.user_id = $1 AND s.revoked_at IS NULL AND s.expires_at > now()
+		 ORDER BY s.last_used_at DESC, s.id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, session)
+	}
+	return items, rows.Err()
+}
+
+func (r *AppRepository) RevokeSession(userID int, sessionID int, reason string) error {
+	result, err := r.db.Exec(
+		`UPDATE sessions SET revoked_at = now(), revoked_reason = $3
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		sessionID,
+		userID,
+		reason,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// RevokeSessionByToken ends the session a refresh token belongs to. Unknown
+// tokens are ignored so logging out twice is harmless.
+func (r *AppRepository) RevokeSessionByToken(tokenHash string, reason string) error {
+	_, err := r.db.Exec(
+		`UPDATE sessions SET revoked_at = now(), revoked_reason = $2
+		 WHERE id = (SELECT session_id FROM session_tokens WHERE token_hash = $1) AND revoked_at IS NULL`,
+		tokenHash,
+		reason,
+	)
+	return err
+}
+
+func (r *AppRepository) PruneSessions(before time.Time) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM sessions WHERE expires_at < $1 OR revoked_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CreateOAuthState stores a sign-in waiting for its callback and drops the
+// expired ones left by sign-ins that were never finished.
+func (r *AppRepository) CreateOAuthState(stateHash string, state OAuthState) error {
+	if _, err := r.db.Exec("DELETE FROM oauth_states WHERE expires_at <= now()"); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(
+		`INSERT INTO oauth_states (state_hash, provider, code_verifier, nonce, link_user_id, expires_at, created_at)
+		 VALUES ($1, $2, $3, $4, NULLIF($5::int, 0), $6, now())`,
+		stateHash,
+		state.Provider,
+		state.CodeVerifier,
+		state.Nonce,
+		state.LinkUserID,
+		state.ExpiresAt,
+	)
+	return err
+}
+
+// ConsumeOAuthState deletes the state so a callback cannot be replayed.
+func (r *AppRepository) ConsumeOAuthState(stateHash string, provider string) (*OAuthState, error) {
+	var state OAuthState
+	var linkUserID sql.NullInt64
+	err := r.db.QueryRow(
+		`DELETE FROM oauth_states WHERE state_hash = $1
+		 RETURNING provider, code_verifier, nonce, link_user_id, expires_at`,
+		stateHash,
+	).Scan(&state.Provider, &state.CodeVerifier, &state.Nonce, &linkUserID, &state.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errOAuthState
+	}
+	if err != nil {
+		return nil, err
+	}
+	if state.Provider != provider || !time.Now().Before(state.ExpiresAt) {
+		return nil, errOAuthState
+	}
+	state.LinkUserID = int(linkUserID.Int64)
+	return &state, nil
+}
+
+// insertIdentity links identity to the user. It reports errIdentityTaken when
+// the provider account is already linked to someone.
+func insertIdentity(q dbQuerier, userID int, identity ExternalIdentity) (*Identity, error) {
+	var item Identity
+	err := q.QueryRow(
+		`INSERT INTO identities (user_id, provider, subject, email, created_at, last_login_at)
+		 VALUES ($1, $2, $3, $4, now(), now())
+		 ON CONFLICT (provider, subject) DO NOTHING
+		 RETURNING id, provider, email, created_at, last_login_at`,
+		userID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+	).Scan(&item.ID, &item.Provider, &item.Email, &item.CreatedAt, &item.LastLoginAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errIdentityTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// SignInWithIdentity finds the user behind an external account. An account
+// seen before signs in its linked user. Otherwise a verified email links it to
+// the user with that address, or creates one without a password. A local
+// account whose address was never verified is not linked: whoever registered
+// it may not own the address. The bool reports whether a user was created.
+func (r *AppRepository) SignInWithIdentity(identity ExternalIdentity, role string) (*AuthUser, bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	user, err := scanAuthUser(tx.QueryRow(
+		`SELECT `+authUserColumns+` FROM auth_users
+		 WHERE id = (SELECT user_id FROM identities WHERE provider = $1 AND subject = $2)`,
+		identity.Provider,
+		identity.Subject,
+	).Scan)
+	if err == nil {
+		if _, err := tx.Exec(
+			"UPDATE identities SET email = $3, last_login_at = now() WHERE provider = $1 AND subject = $2",
+			identity.Provider,
+			identity.Subject,
+			identity.Email,
+		); err != nil {
+			return nil, false, err
+		}
+		return user, false, tx.Commit()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, false, errIdentityEmail
+	}
+
+	created := false
+	user, err = scanAuthUser(tx.QueryRow(
+		`SELECT `+authUserColumns+` FROM auth_users WHERE email = $1 FOR UPDATE`,
+		identity.Email,
+	).Scan)
+	switch {
+	case err == nil:
+		if user.EmailVerifiedAt == nil {
+			return nil, false, errIdentityUnverified
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		user, err = scanAuthUser(tx.QueryRow(
+			`INSERT INTO auth_users (name, email, password_hash, role, status, created_at, email_verified_at)
+			 VALUES ($1, $2, '', $3, 'active', now(), now())
+			 ON CONFLICT (email) DO NOTHING
+			 RETURNING `+authUserColumns,
+			identity.Name,
+			identity.Email,
+			role,
+		).Scan)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, errConflict
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		created = true
+	default:
+		return nil, false, err
+	}
+	if _, err := insertIdentity(tx, user.ID, identity); err != nil {
+		return nil, false, err
+	}
+	return user, created, tx.Commit()
+}
+
+// LinkIdentity adds an external account to a signed-in user. Linking an
+// account the user already has just refreshes it.
+func (r *AppRepository) LinkIdentity(userID int, identity ExternalIdentity) (*Identity, error) {
+	var item Identity
+	err := r.db.QueryRow(
+		`UPDATE identities SET email = $4, last_login_at = now()
+		 WHERE user_id = $1 AND provider = $2 AND subject = $3
+		 RETURNING id, provider, email, created_at, last_login_at`,
+		userID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+	).Scan(&item.ID, &item.Provider, &item.Email, &item.CreatedAt, &item.LastLoginAt)
+	if err == nil {
+		return &item, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return insertIdentity(r.db, userID, identity)
+}
+
+func (r *AppRepository) ListIdentities(userID int) ([]*Identity, error) {
+	rows, err := r.db.Query(
+		`SELECT id, provider, email, created_at, last_login_at FROM identities
+		 WHERE user_id = $1 ORDER BY created_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*Identity, 0)
+	for rows.Next() {
+		var item Identity
+		if err := rows.Scan(&item.ID, &item.Provider, &item.Email, &item.CreatedAt, &item.LastLoginAt); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+// DeleteIdentity unlinks an external account, refusing to remove the last
+// way into an account that has no password.
+func (r *AppRepository) DeleteIdentity(userID int, id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hasPassword bool
+	var others int
+	err = tx.QueryRow(
+		`SELECT password_hash <> '',
+		 (SELECT COUNT(*) FROM identities WHERE user_id = u.id AND id <> $2)
+		 FROM auth_users u WHERE u.id = $1 FOR UPDATE`,
+		userID,
+		id,
+	).Scan(&hasPassword, &others)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNotFound
+	}
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM identities WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errNotFound
+	}
+	if !hasPassword && others == 0 {
+		return errIdentityLast
+	}
+	return tx.Commit()
+}
+
+func (r *AppRepository) GetTwoFactor(userID int) (*TwoFactor, error) {
+	var state TwoFactor
+	var enabledAt, lockedUntil sql.NullTime
+	err := r.db.QueryRow(
+		`SELECT totp_secret, totp_enabled_at, totp_locked_until,
+		 (SELECT COUNT(*) FROM recovery_codes WHERE user_id = u.id)
+		 FROM auth_users u WHERE id = $1`,
+		userID,
+	).Scan(&state.Secret, &enabledAt, &lockedUntil, &state.RecoveryCodesLeft)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		state.Enabled = true
+		state.EnabledAt = &enabledAt.Time
+	}
+	if lockedUntil.Valid {
+		state.LockedUntil = &lockedUntil.Time
+	}
+	return &state, nil
+}
+
+// SetTwoFactorSecret stores the secret of an enrollment in progress,
+// replacing an earlier unfinished one.
+func (r *AppRepository) SetTwoFactorSecret(userID int, sealed string) error {
+	result, err := r.db.Exec(
+		"UPDATE auth_users SET totp_secret = $2 WHERE id = $1 AND totp_enabled_at IS NULL",
+		userID,
+		sealed,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err := r.GetAuthUserByID(userID); err != nil {
+			return err
+		}
+		return errTwoFactorOn
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(q dbQuerier, userID int, codeHashes []string) error {
+	if _, err := q.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	_, err := q.Exec(
+		`INSERT INTO recovery_codes (user_id, code_hash, created_at)
+		 SELECT $1, code_hash, now() FROM unnest($2::text[]) AS code_hash`,
+		userID,
+		pq.Array(codeHashes),
+	)
+	return err
+}
+
+// EnableTwoFactor finishes enrollment once the user has entered a code for
+// step. The session that enrolled counts as having passed the check.
+func (r *AppRepository) EnableTwoFactor(userID int, step int64, codeHashes []string, sessionID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE auth_users SET totp_enabled_at = now(), totp_last_step = $2, totp_failures = 0, totp_locked_until = NULL
+		 WHERE id = $1 AND totp_enabled_at IS NULL AND totp_secret <> ''`,
+		userID,
+		step,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errTwoFactorSetup
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"UPDATE sessions SET two_factor_at = now() WHERE id = $1 AND user_id = $2",
+		sessionID,
+		userID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *AppRepository) DisableTwoFactor(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE auth_users SET totp_secret = '', totp_enabled_at = NULL, totp_last_step = 0,
+		 totp_failures = 0, totp_locked_until = NULL
+		 WHERE id = $1`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errNotFound
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM two_factor_challenges WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the code of step was used, failing with
+// errTwoFactorCode when it or a later one already was.
+func (r *AppRepository) UseTOTPStep(userID int, step int64) error {
+	result, err := r.db.Exec(
+		`UPDATE auth_users SET totp_last_step = $2, totp_failures = 0
+		 WHERE id = $1 AND totp_enabled_at IS NOT NULL AND totp_last_step < $2`,
+		userID,
+		step,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errTwoFactorCode
+	}
+	return nil
+}
+
+// UseRecoveryCode deletes a recovery code so it works only once.
+func (r *AppRepository) UseRecoveryCode(userID int, codeHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1 AND code_hash = $2", userID, codeHash)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errTwoFactorCode
+	}
+	if _, err := tx.Exec("UPDATE auth_users SET totp_failures = 0 WHERE id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordTwoFactorFailure counts a wrong code and locks code entry for
+// twoFactorLockout after maxTwoFactorFailures in a row.
+func (r *AppRepository) RecordTwoFactorFailure(userID int) error {
+	_, err := r.db.Exec(
+		`UPDATE auth_users SET
+		 totp_locked_until = CASE WHEN totp_failures + 1 >= $2 THEN now() + $3 * interval '1 second' ELSE totp_locked_until END,
+		 totp_failures = CASE WHEN totp_failures + 1 >= $2 THEN 0 ELSE totp_failures + 1 END
+		 WHERE id = $1`,
+		userID,
+		maxTwoFactorFailures,
+		int64(twoFactorLockout/time.Second),
+	)
+	return err
+}
+
+func (r *AppRepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MarkSessionTwoFactor records a step-up check on the session.
+func (r *AppRepository) MarkSessionTwoFactor(userID int, sessionID int) (time.Time, error) {
+	var at time.Time
+	err := r.db.QueryRow(
+		`UPDATE sessions SET two_factor_at = now()
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		 RETURNING two_factor_at`,
+		sessionID,
+		userID,
+	).Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, errNotFound
+	}
+	return at, err
+}
+
+// CreateTwoFactorChallenge stores a sign-in waiting for the second factor
+// and drops expired ones.
+func (r *AppRepository) CreateTwoFactorChallenge(userID int, tokenHash string, device string, expiresAt time.Time) error {
+	if _, err := r.db.Exec("DELETE FROM two_factor_challenges WHERE expires_at <= now()"); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(
+		`INSERT INTO two_factor_challenges (token_hash, user_id, device, expires_at, created_at)
+		 VALUES ($1, $2, $3, $4, now())`,
+		tokenHash,
+		userID,
+		device,
+		expiresAt,
+	)
+	return err
+}
+
+// GetTwoFactorChallenge returns the user and device of an unexpired
+// challenge. A wrong code leaves it in place for another try.
+func (r *AppRepository) GetTwoFactorChallenge(tokenHash string) (int, string, error) {
+	var userID int
+	var device string
+	err := r.db.QueryRow(
+		"SELECT user_id, device FROM two_factor_challenges WHERE token_hash = $1 AND expires_at > now()",
+		tokenHash,
+	).Scan(&userID, &device)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", errTwoFactorChallenge
+	}
+	return userID, device, err
+}
+
+// DeleteTwoFactorChallenge uses up a challenge. It fails when another request
+// already did.
+func (r *AppRepository) DeleteTwoFactorChallenge(tokenHash string) error {
+	result, err := r.db.Exec("DELETE FROM two_factor_challenges WHERE token_hash = $1", tokenHash)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errTwoFactorChallenge
+	}
+	return nil
+}
+
+func (r *AppRepository) DeleteAuthUser(id int) error {
+	if id <= 0 {
+		return errNotFound
+	}
+	result, err := r.db.Exec(`DELETE FROM auth_users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+const historySelect = `SELECT h.id, h.user_id, h.novel_id, n.slug AS novel_slug, n.title AS novel_title,
+	h.chapter_id, c.volume, c.number, c.title AS chapter_title, h.read_at
+	FROM reading_history h
+	JOIN novels n ON n.id = h.novel_id
+	JOIN chapters c ON c.id = h.chapter_id`
+
+// historyViewable keeps the history entries whose novel and chapter the reader
+// may still open, matching isViewable.
+const historyViewable = `n.visibility IN ('published', 'unlisted') AND c.visibility IN ('published', 'unlisted')`
+
+func scanReadingHistory(scan func(dest ...any) error, extra ...any) (*ReadingHistory, error) {
+	var entry ReadingHistory
+	dest := []any{
+		&entry.ID,
+		&entry.UserID,
+		&entry.NovelID,
+		&entry.NovelSlug,
+		&entry.NovelTitle,
+		&entry.ChapterID,
+		&entry.ChapterVolume,
+		&entry.ChapterNumber,
+		&entry.ChapterTitle,
+		&entry.ReadAt,
+	}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func getReadingHistoryEntry(q dbQuerier, id int) (*ReadingHistory, error) {
+	entry, err := scanReadingHistory(q.QueryRow(historySelect+" WHERE h.id = $1", id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	return entry, err
+}
+
+// ListReadingHistory returns a reader's whole history, newest first, for
+// export. Entries for hidden novels and chapters are left out unless
+// includeHidden is set.
+func (r *AppRepository) ListReadingHistory(userID int, includeHidden bool) ([]*ReadingHistory, error) {
+	where := " WHERE h.user_id = $1"
+	if !includeHidden {
+		where += " AND " + historyViewable
+	}
+	rows, err := r.db.Query(historySelect+where+" ORDER BY h.read_at DESC, h.id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*ReadingHistory, 0)
+	for rows.Next() {
+		entry, err := scanReadingHistory(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, entry)
+	}
+	return items, rows.Err()
+}
+
+func (r *AppRepository) QueryReadingHistory(query HistoryQuery) (*Page[*ReadingHistory], error) {
+	cursor, err := decodeCursor(query.Cursor, "read")
+	if err != nil {
+		return nil, err
+	}
+	var cursorValue any
+	if cursor != nil {
+		if cursorValue, err = cursorTime(cursor); err != nil {
+			return nil, err
+		}
+	}
+	args := sqlArgs{}
+	filters := []string{"h.user_id = " + args.add(query.UserID)}
+	if query.NovelID > 0 {
+		filters = append(filters, "h.novel_id = "+args.add(query.NovelID))
+	}
+	if !query.IncludeHidden {
+		filters = append(filters, historyViewable)
+	}
+	q := keysetQuery{
+		listing: historySelect + `
+			WHERE ` + strings.Join(filters, " AND "),
+		args:   args,
+		column: "read_at",
+	}
+	return runKeysetQuery(r.db, q, "read", cursor, cursorValue, query.Limit, func(rows *sql.Rows, total *int) (*ReadingHistory, string, int, error) {
+		entry, err := scanReadingHistory(rows.Scan, total)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		return entry, formatCursorTime(entry.ReadAt), entry.ID, nil
+	})
+}
+
+// QueryHistoryNovels pages through the novels in a reader's history, most
+// recently read first, keyed by novel ID.
+func (r *AppRepository) QueryHistoryNovels(query HistoryQuery) (*Page[*HistoryNovel], error) {
+	cursor, err := decodeCursor(query.Cursor, "novel")
+	if err != nil {
+		return nil, err
+	}
+	var cursorValue any
+	if cursor != nil {
+		if cursorValue, err = cursorTime(cursor); err != nil {
+			return nil, err
+		}
+	}
+	args := sqlArgs{}
+	filter := "h.user_id = " + args.add(query.UserID)
+	if !query.IncludeHidden {
+		filter += " AND " + historyViewable
+	}
+	q := keysetQuery{
+		listing: `SELECT g.novel_id AS id, n.slug, n.title, n.cover_url, g.reads, g.chapters_read,
+				l.chapter_id, c.title AS chapter_title, g.read_at
+			FROM (
+				SELECT h.novel_id, COUNT(*) AS reads, COUNT(DISTINCT h.chapter_id) AS chapters_read, MAX(h.read_at) AS read_at
+				FROM reading_history h
+				JOIN novels n ON n.id = h.novel_id
+				JOIN chapters c ON c.id = h.chapter_id
+				WHERE ` + filter + `
+				GROUP BY h.novel_id
+			) g
+			JOIN novels n ON n.id = g.novel_id
+			JOIN LATERAL (
+				SELECT h.chapter_id FROM reading_history h
+				JOIN novels n ON n.id = h.novel_id
+				JOIN chapters c ON c.id = h.chapter_id
+				WHERE ` + filter + ` AND h.novel_id = g.novel_id
+				ORDER BY h.read_at DESC, h.id DESC
+				LIMIT 1
+			) l ON true
+			JOIN chapters c ON c.id = l.chapter_id`,
+		args:   args,
+		column: "read_at",
+	}
+	return runKeysetQuery(r.db, q, "novel", cursor, cursorValue, query.Limit, func(rows *sql.Rows, total *int) (*HistoryNovel, string, int, error) {
+		var item HistoryNovel
+		if err := rows.Scan(
+			&item.NovelID,
+			&item.NovelSlug,
+			&item.NovelTitle,
+			&item.CoverURL,
+			&item.Reads,
+			&item.ChaptersRead,
+			&item.LastChapterID,
+			&item.LastChapterTitle,
+			&item.LastReadAt,
+			total,
+		); err != nil {
+			return nil, "", 0, err
+		}
+		return &item, formatCursorTime(item.LastReadAt), item.NovelID, nil
+	})
+}
+
+// AddReadingHistory records a chapter open. Reopening the chapter read last
+// only moves that entry's time forward instead of adding a row.
+func (r *AppRepository) AddReadingHistory(userID int, input ReadingHistoryInput) (*ReadingHistory, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var novelID int
+	err = tx.QueryRow("SELECT novel_id FROM chapters WHERE id = $1", input.ChapterID).Scan(&novelID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A reader with no history has no row to lock, so opens are serialized
+	// per user instead; otherwise two first opens would both insert.
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('reading_history'), $1)", userID); err != nil {
+		return nil, err
+	}
+	var lastID, lastChapterID int
+	err = tx.QueryRow(
+		`SELECT id, chapter_id FROM reading_history
+		 WHERE user_id = $1
+		 ORDER BY read_at DESC, id DESC
+		 LIMIT 1`,
+		userID,
+	).Scan(&lastID, &lastChapterID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	id := lastID
+	if lastID > 0 && lastChapterID == input.ChapterID {
+		_, err = tx.Exec("UPDATE reading_history SET read_at = $1 WHERE id = $2", time.Now(), lastID)
+	} else {
+		err = tx.QueryRow(
+			`INSERT INTO reading_history (user_id, novel_id, chapter_id, read_at)
+			 VALUES ($1, $2, $3, $4)
+			 RETURNING id`,
+			userID, novelID, input.ChapterID, time.Now(),
+		).Scan(&id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry, err := getReadingHistoryEntry(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return entry, tx.Commit()
+}
+
+func (r *AppRepository) DeleteReadingHistoryEntry(userID int, id int) error {
+	result, err := r.db.Exec("DELETE FROM reading_history WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (r *AppRepository) DeleteNovelHistory(userID int, novelID int) error {
+	result, err := r.db.Exec("DELETE FROM reading_history WHERE user_id = $1 AND novel_id = $2", userID, novelID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (r *AppRepository) PruneReadingHistory(before time.Time) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM reading_history WHERE read_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const readingProgressColumns = `p.user_id, p.novel_id, p.chapter_id, p.scroll_percent, p.paragraph_index, p.device, p.read_at, p.updated_at`
+
+func scanReadingProgress(scan func(dest ...any) error, extra ...any) (*ReadingProgress, error) {
+	var progress ReadingProgress
+	var paragraph sql.NullInt64
+	dest := []any{
+		&progress.UserID,
+		&progress.NovelID,
+		&progress.ChapterID,
+		&progress.ScrollPercent,
+		&paragraph,
+		&progress.Device,
+		&progress.ReadAt,
+		&progress.UpdatedAt,
+	}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if paragraph.Valid {
+		index := int(paragraph.Int64)
+		progress.ParagraphIndex = &index
+	}
+	return &progress, nil
+}
+
+func (r *AppRepository) GetReadingProgress(userID int, novelID int) (*ReadingProgress, error) {
+	progress, err := scanReadingProgress(r.db.QueryRow(
+		`SELECT `+readingProgressColumns+` FROM reading_progress p WHERE p.user_id = $1 AND p.novel_id = $2`,
+		userID,
+		novelID,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	return progress, err
+}
+
+// SaveReadingProgress upserts the position unless the stored one was read
+// later, in which case it returns the stored position with errProgressStale.
+func (r *AppRepository) SaveReadingProgress(userID int, novelID int, input ReadingProgressInput) (*ReadingProgress, error) {
+	input, err := normalizeProgress(input, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	var chapterNovelID int
+	err = r.db.QueryRow("SELECT novel_id FROM chapters WHERE id = $1", input.ChapterID).Scan(&chapterNovelID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if chapterNovelID != novelID {
+		return nil, errProgressChapter
+	}
+
+	progress, err := scanReadingProgress(r.db.QueryRow(
+		`INSERT INTO reading_progress AS p (user_id, novel_id, chapter_id, scroll_percent, paragraph_index, device, read_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, now())
+		 ON CONFLICT (user_id, novel_id) DO UPDATE SET
+			chapter_id = EXCLUDED.chapter_id,
+			scroll_percent = EXCLUDED.scroll_percent,
+			paragraph_index = EXCLUDED.paragraph_index,
+			device = EXCLUDED.device,
+			read_at = EXCLUDED.read_at,
+			updated_at = EXCLUDED.updated_at
+		 WHERE p.read_at <= EXCLUDED.read_at
+		 RETURNING `+readingProgressColumns,
+		userID,
+		novelID,
+		input.ChapterID,
+		input.ScrollPercent,
+		input.ParagraphIndex,
+		input.Device,
+		*input.ReadAt,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		current, err := r.GetReadingProgress(userID, novelID)
+		if err != nil {
+			return nil, err
+		}
+		return current, errProgressStale
+	}
+	return progress, err
+}
+
+func (r *AppRepository) DeleteReadingProgress(userID int, novelID int) error {
+	result, err := r.db.Exec("DELETE FROM reading_progress WHERE user_id = $1 AND novel_id = $2", userID, novelID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// ListContinueReading returns the reader's novels, most recently read first,
+// with the published chapters after the current one counted as unread.
+func (r *AppRepository) ListContinueReading(userID int, limit int) ([]*ContinueReading, error) {
+	rows, err := r.db.Query(
+		`SELECT `+readingProgressColumns+`, n.slug, n.title, n.cover_url, c.volume, c.number, c.title,
+			(SELECT COUNT(*) FROM chapters u
+			 WHERE u.novel_id = p.novel_id AND u.visibility = 'published' AND u.number > c.number)
+		 FROM reading_progress p
+		 JOIN novels n ON n.id = p.novel_id
+		 JOIN chapters c ON c.id = p.chapter_id
+		 WHERE p.user_id = $1 AND n.visibility IN ('published', 'unlisted')
+		 ORDER BY p.read_at DESC, p.novel_id
+		 LIMIT $2`,
+		userID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*ContinueReading, 0)
+	for rows.Next() {
+		var item ContinueReading
+		progress, err := scanReadingProgress(
+			rows.Scan,
+			&item.NovelSlug,
+			&item.NovelTitle,
+			&item.CoverURL,
+			&item.ChapterVolume,
+			&item.ChapterNumber,
+			&item.ChapterTitle,
+			&item.UnreadChapters,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.ReadingProgress = *progress
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *AppRepository) ClearReadingHistory(userID int) error {
+	_, err := r.db.Exec(
+		"DELETE FROM reading_history WHERE user_id = $1",
+		userID,
+	)
+	return err
+}
+
+func (r *AppRepository) ListFollows(userID int) []*Follow {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, novel_id, notify, created_at
+		 FROM follows WHERE user_id = $1
+		 ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return []*Follow{}
+	}
+	defer rows.Close()
+	items := make([]*Follow, 0)
+	for rows.Next() {
+		var item Follow
+		if err := rows.Scan(&item.ID, &item.UserID, &item.NovelID, &item.Notify, &item.CreatedAt); err != nil {
+			continue
+		}
+		items = append(items, &item)
+	}
+	return items
+}
+
+func (r *AppRepository) AddFollow(userID int, novelID int) (*Follow, error) {
+	entry := &Follow{UserID: userID, NovelID: novelID, CreatedAt: time.Now()}
+	err := r.db.QueryRow(
+		`INSERT INTO follows (user_id, novel_id, created_at)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (user_id, novel_id) DO UPDATE SET created_at = EXCLUDED.created_at
+		 RETURNING id, notify`,
+		entry.UserID,
+		entry.NovelID,
+		entry.CreatedAt,
+	).Scan(&entry.ID, &entry.Notify)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (r *AppRepository) RemoveFollow(userID int, novelID int) error {
+	result, err := r.db.Exec("DELETE FROM follows WHERE user_id = $1 AND novel_id = $2", userID, novelID)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err == nil && count == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// DispatchNotifications fans out up to limit queued chapters, each in its own
+// transaction, and returns how many jobs it finished. Chapters or novels that
+// are no longer visible finish with no recipients.
+func (r *AppRepository) DispatchNotifications(limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		done, err := r.dispatchNotificationJob()
+		if err != nil || !done {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+func (r *AppRepository) dispatchNotificationJob() (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var jobID, chapterID int
+	err = tx.QueryRow(
+		`SELECT id, chapter_id FROM notification_jobs
+		 WHERE processed_at IS NULL
+		 ORDER BY id
+		 LIMIT 1
+		 FOR UPDATE SKIP LOCKED`,
+	).Scan(&jobID, &chapterID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(
+		`INSERT INTO notifications (user_id, kind, novel_id, chapter_id, created_at)
+		 SELECT f.user_id, $2, c.novel_id, c.id, now()
+		 FROM chapters c
+		 JOIN novels n ON n.id = c.novel_id
+		 JOIN follows f ON f.novel_id = c.novel_id AND f.notify
+		 JOIN auth_users u ON u.id = f.user_id AND u.status <> 'banned'
+		 WHERE c.id = $1 AND c.visibility = 'published' AND n.visibility IN ('published', 'unlisted')
+		 ON CONFLICT (user_id, chapter_id) DO NOTHING`,
+		chapterID,
+		notificationChapter,
+	)
+	if err != nil {
+		return false, err
+	}
+	recipients, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if err := queueChapterWebhook(tx, chapterID); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(
+		"UPDATE notification_jobs SET processed_at = now(), recipients = $1 WHERE id = $2",
+		recipients,
+		jobID,
+	); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *AppRepository) QueryNotifications(query NotificationQuery) (*Page[*Notification], error) {
+	cursor, err := decodeCursor(query.Cursor, "created")
+	if err != nil {
+		return nil, err
+	}
+	var cursorValue any
+	if cursor != nil {
+		if cursorValue, err = cursorTime(cursor); err != nil {
+			return nil, err
+		}
+	}
+	args := sqlArgs{}
+	filters := []string{"nt.user_id = " + args.add(query.UserID)}
+	if query.UnreadOnly {
+		filters = append(filters, "nt.read_at IS NULL")
+	}
+	q := keysetQuery{
+		listing: `SELECT nt.id, nt.kind, nt.novel_id, n.slug, n.title AS novel_title, nt.chapter_id,
+				c.volume, c.number, c.title AS chapter_title, nt.created_at, nt.read_at
+			FROM notifications nt
+			JOIN novels n ON n.id = nt.novel_id
+			JOIN chapters c ON c.id = nt.chapter_id
+			WHERE ` + strings.Join(filters, " AND "),
+		args:   args,
+		column: "created_at",
+	}
+	return runKeysetQuery(r.db, q, "created", cursor, cursorValue, query.Limit, func(rows *sql.Rows, total *int) (*Notification, string, int, error) {
+		var item Notification
+		var readAt sql.NullTime
+		if err := rows.Scan(
+			&item.ID,
+			&item.Kind,
+			&item.NovelID,
+			&item.NovelSlug,
+			&item.NovelTitle,
+			&item.ChapterID,
+			&item.ChapterVolume,
+			&item.ChapterNumber,
+			&item.ChapterTitle,
+			&item.CreatedAt,
+			&readAt,
+			total,
+		); err != nil {
+			return nil, "", 0, err
+		}
+		if readAt.Valid {
+			item.ReadAt = &readAt.Time
+		}
+		return &item, formatCursorTime(item.CreatedAt), item.ID, nil
+	})
+}
+
+func (r *AppRepository) CountUnreadNotifications(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL",
+		userID,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *AppRepository) MarkNotificationRead(userID int, id int) error {
+	result, err := r.db.Exec(
+		"UPDATE notifications SET read_at = COALESCE(read_at, now()) WHERE id = $1 AND user_id = $2",
+		id,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (r *AppRepository) MarkAllNotificationsRead(userID int) (int64, error) {
+	result, err := r.db.Exec(
+		"UPDATE notifications SET read_at = now() WHERE user_id = $1 AND read_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *AppRepository) ListNotificationPreferences(userID int) ([]*NotificationPreference, error) {
+	rows, err := r.db.Query(
+		`SELECT f.novel_id, n.title, f.notify
+		 FROM follows f
+		 JOIN novels n ON n.id = f.novel_id
+		 WHERE f.user_id = $1
+		 ORDER BY n.title, f.novel_id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*NotificationPreference, 0)
+	for rows.Next() {
+		var item NotificationPreference
+		if err := rows.Scan(&item.NovelID, &item.NovelTitle, &item.Notify); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+// SetNotificationPreference switches notifications for a followed novel;
+// novels the reader does not follow are not found.
+func (r *AppRepository) SetNotificationPreference(userID int, novelID int, notify bool) (*NotificationPreference, error) {
+	item := &NotificationPreference{NovelID: novelID, Notify: notify}
+	err := r.db.QueryRow(
+		`UPDATE follows f SET notify = $3
+		 FROM novels n
+		 WHERE n.id = f.novel_id AND f.user_id = $1 AND f.novel_id = $2
+		 RETURNING n.title`,
+		userID,
+		novelID,
+		notify,
+	).Scan(&item.NovelTitle)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+const outboxColumns = `id, kind, to_address, subject, status, attempts, next_attempt_at, last_error, created_at, sent_at`
+
+func scanOutboxMail(scan func(dest ...any) error, extra ...any) (*OutboxMail, error) {
+	var item OutboxMail
+	var sentAt sql.NullTime
+	dest := []any{
+		&item.ID,
+		&item.Kind,
+		&item.To,
+		&item.Subject,
+		&item.Status,
+		&item.Attempts,
+		&item.NextAttemptAt,
+		&item.LastError,
+		&item.CreatedAt,
+		&sentAt,
+	}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if sentAt.Valid {
+		item.SentAt = &sentAt.Time
+	}
+	return &item, nil
+}
+
+func insertOutboxMail(q dbQuerier, kind string, msg mail.Message) (*OutboxMail, error) {
+	return scanOutboxMail(q.QueryRow(
+		`INSERT INTO mail_outbox (kind, to_address, subject, text_body, html_body, status, next_attempt_at, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, now(), now())
+		 RETURNING `+outboxColumns,
+		kind,
+		msg.To,
+		msg.Subject,
+		msg.Text,
+		msg.HTML,
+		outboxPending,
+	).Scan)
+}
+
+func (r *AppRepository) EnqueueMail(kind string, msg mail.Message) (*OutboxMail, error) {
+	return insertOutboxMail(r.db, kind, msg)
+}
+
+// DeliverOutbox sends up to limit due messages, each in its own transaction
+// so a slow or failing recipient does not hold back the rest.
+func (r *AppRepository) DeliverOutbox(mailer mail.Mailer, limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		done, err := r.deliverOutboxMail(mailer)
+		if err != nil || !done {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+func (r *AppRepository) deliverOutboxMail(mailer mail.Mailer) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var id, attempts int
+	var msg mail.Message
+	err = tx.QueryRow(
+		`SELECT id, attempts, to_address, subject, text_body, html_body FROM mail_outbox
+		 WHERE status = $1 AND next_attempt_at <= now()
+		 ORDER BY next_attempt_at, id
+		 LIMIT 1
+		 FOR UPDATE SKIP LOCKED`,
+		outboxPending,
+	).Scan(&id, &attempts, &msg.To, &msg.Subject, &msg.Text, &msg.HTML)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if sendErr := mailer.Send(msg); sendErr != nil {
+		attempts++
+		status := outboxPending
+		if attempts >= maxMailAttempts {
+			status = outboxFailed
+		}
+		if _, err := tx.Exec(
+			`UPDATE mail_outbox
+			 SET status = $2, attempts = $3, last_error = $4, next_attempt_at = now() + $5 * interval '1 second'
+			 WHERE id = $1`,
+			id,
+			status,
+			attempts,
+			sendErr.Error(),
+			int64(retryBackoff(attempts)/time.Second),
+		); err != nil {
+			return false, err
+		}
+		return true, tx.Commit()
+	}
+	if _, err := tx.Exec(
+		`UPDATE mail_outbox SET status = $2, attempts = attempts + 1, last_error = '', sent_at = now() WHERE id = $1`,
+		id,
+		outboxSent,
+	); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *AppRepository) ListOutbox(status string, limit int) ([]*OutboxMail, error) {
+	args := sqlArgs{}
+	where := ""
+	if status != "" {
+		where = " WHERE status = " + args.add(status)
+	}
+	rows, err := r.db.Query(
+		`SELECT `+outboxColumns+` FROM mail_outbox`+where+` ORDER BY created_at DESC, id DESC LIMIT `+args.add(limit),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*OutboxMail, 0)
+	for rows.Next() {
+		item, err := scanOutboxMail(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// RetryOutbox puts a pending or failed message back at the front of the
+// queue with a fresh attempt budget.
+func (r *AppRepository) RetryOutbox(id int) (*OutboxMail, error) {
+	item, err := scanOutboxMail(r.db.QueryRow(
+		`UPDATE mail_outbox
+		 SET status = $2, attempts = 0, last_error = '', next_attempt_at = now()
+		 WHERE id = $1 AND status <> $3
+		 RETURNING `+outboxColumns,
+		id,
+		outboxPending,
+		outboxSent,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		if err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM mail_outbox WHERE id = $1)", id).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, errOutboxSent
+		}
+		return nil, errNotFound
+	}
+	return item, err
+}
+
+func (r *AppRepository) GetEmailPreferences(userID int) (*EmailPreferences, error) {
+	var prefs EmailPreferences
+	var sentAt sql.NullTime
+	err := r.db.QueryRow(
+		"SELECT email_digest, digest_sent_at FROM auth_users WHERE id = $1",
+		userID,
+	).Scan(&prefs.Digest, &sentAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sentAt.Valid {
+		prefs.DigestSentAt = &sentAt.Time
+	}
+	return &prefs, nil
+}
+
+// SetEmailDigest changes the digest mode. Switching it on starts the window
+// now, so the first digest only covers chapters published afterwards.
+func (r *AppRepository) SetEmailDigest(userID int, digest string) (*EmailPreferences, error) {
+	result, err := r.db.Exec(
+		`UPDATE auth_users
+		 SET digest_sent_at = CASE WHEN email_digest = 'off' AND $2 <> 'off' THEN now() ELSE digest_sent_at END,
+		 email_digest = $2
+		 WHERE id = $1`,
+		userID,
+		digest,
+	)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, errNotFound
+	}
+	return r.GetEmailPreferences(userID)
+}
+
+func (r *AppRepository) ListDueDigests(now time.Time) ([]*DigestRecipient, error) {
+	rows, err := r.db.Query(
+		`SELECT id, name, email, email_digest, digest_sent_at FROM auth_users
+		 WHERE status <> 'banned' AND email <> '' AND email_digest <> 'off'
+		 AND (digest_sent_at IS NULL OR digest_sent_at <= $1::timestamptz - CASE email_digest WHEN 'daily' THEN interval '1 day' ELSE interval '7 days' END)
+		 ORDER BY id`,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*DigestRecipient, 0)
+	for rows.Next() {
+		var item DigestRecipient
+		var sentAt sql.NullTime
+		if err := rows.Scan(&item.UserID, &item.Name, &item.Email, &item.Digest, &sentAt); err != nil {
+			return nil, err
+		}
+		if sentAt.Valid {
+			item.LastSentAt = &sentAt.Time
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+// ListDigestChapters lists chapters published in (since, until] for novels the
+// reader follows with notifications on.
+func (r *AppRepository) ListDigestChapters(userID int, since, until time.Time) ([]*DigestChapter, error) {
+	rows, err := r.db.Query(
+		`SELECT n.id, n.slug, n.title, c.id, c.number, c.title, c.published_at
+		 FROM follows f
+		 JOIN novels n ON n.id = f.novel_id AND n.visibility IN ('published', 'unlisted')
+		 JOIN chapters c ON c.novel_id = n.id AND c.visibility = 'published'
+		 WHERE f.user_id = $1 AND f.notify AND c.published_at > $2 AND c.published_at <= $3
+		 ORDER BY n.title, n.id, c.volume, c.number, c.id`,
+		userID,
+		since,
+		until,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*DigestChapter, 0)
+	for rows.Next() {
+		var item DigestChapter
+		if err := rows.Scan(&item.NovelID, &item.NovelSlug, &item.NovelTitle, &item.ChapterID, &item.Number, &item.Title, &item.PublishedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+// CompleteDigest moves the reader's digest window to sentAt and queues msg
+// when there is one. The window only moves if nobody else has moved it since
+// the recipient was listed, so two replicas never send the same digest.
+func (r *AppRepository) CompleteDigest(recipient *DigestRecipient, sentAt time.Time, msg *mail.Message) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE auth_users SET digest_sent_at = $2
+		 WHERE id = $1 AND digest_sent_at IS NOT DISTINCT FROM $3::timestamptz`,
+		recipient.UserID,
+		sentAt,
+		recipient.LastSentAt,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return nil
+	}
+	if msg != nil {
+		if _, err := insertOutboxMail(tx, "digest", *msg); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const webhookColumns = `w.id, w.name, w.url, w.secret, w.format, w.events, w.active, w.created_at, w.updated_at`
+
+func scanWebhook(scan func(dest ...any) error, extra ...any) (*Webhook, error) {
+	var hook Webhook
+	dest := []any{
+		&hook.ID,
+		&hook.Name,
+		&hook.URL,
+		&hook.Secret,
+		&hook.Format,
+		pq.Array(&hook.Events),
+		&hook.Active,
+		&hook.CreatedAt,
+		&hook.UpdatedAt,
+	}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+const webhookDeliveryColumns = `d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.response_status, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at`
+
+func scanWebhookDelivery(scan func(dest ...any) error, extra ...any) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var payload []byte
+	var deliveredAt sql.NullTime
+	dest := []any{
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.Event,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.ResponseStatus,
+		&delivery.LastError,
+		&delivery.NextAttemptAt,
+		&delivery.CreatedAt,
+		&deliveredAt,
+	}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	delivery.Payload = json.RawMessage(payload)
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+	return &delivery, nil
+}
+
+func (r *AppRepository) ListWebhooks() ([]*Webhook, error) {
+	rows, err := r.db.Query(`SELECT ` + webhookColumns + ` FROM webhooks w ORDER BY w.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*Webhook, 0)
+	for rows.Next() {
+		hook, err := scanWebhook(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, hook)
+	}
+	return items, rows.Err()
+}
+
+func (r *AppRepository) GetWebhook(id int) (*Webhook, error) {
+	hook, err := scanWebhook(r.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks w WHERE w.id = $1`, id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	return hook, err
+}
+
+func (r *AppRepository) CreateWebhook(input WebhookInput) (*Webhook, error) {
+	active := true
+	if input.Active != nil {
+		active = *input.Active
+	}
+	return scanWebhook(r.db.QueryRow(
+		`INSERT INTO webhooks AS w (name, url, secret, format, events, active, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, now(), now())
+		 RETURNING `+webhookColumns,
+		input.Name,
+		input.URL,
+		input.Secret,
+		input.Format,
+		pq.Array(input.Events),
+		active,
+	).Scan)
+}
+
+// UpdateWebhook replaces the webhook settings; an empty secret and a missing
+// active flag keep their current values.
+func (r *AppRepository) UpdateWebhook(id int, input WebhookInput) (*Webhook, error) {
+	hook, err := scanWebhook(r.db.QueryRow(
+		`UPDATE webhooks w
+		 SET name = $2, url = $3, secret = COALESCE(NULLIF($4, ''), w.secret), format = $5, events = $6,
+		 active = COALESCE($7, w.active), updated_at = now()
+		 WHERE w.id = $1
+		 RETURNING `+webhookColumns,
+		id,
+		input.Name,
+		input.URL,
+		input.Secret,
+		input.Format,
+		pq.Array(input.Events),
+		input.Active,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	return hook, err
+}
+
+func (r *AppRepository) DeleteWebhook(id int) error {
+	result, err := r.db.Exec("DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// enqueueWebhookEvent adds a delivery for every active webhook subscribed to
+// the event and returns how many were queued.
+func enqueueWebhookEvent(q dbQuerier, event WebhookEvent) (int64, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	result, err := q.Exec(
+		`INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt_at, created_at)
+		 SELECT id, $1::text, $2::jsonb, now(), now()
+		 FROM webhooks
+		 WHERE active AND $1::text = ANY(events)`,
+		event.Event,
+		string(payload),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *AppRepository) EnqueueWebhookEvent(event WebhookEvent) (int64, error) {
+	return enqueueWebhookEvent(r.db, event)
+}
+
+// queueChapterWebhook queues chapter.published for a chapter the notification
+// dispatcher just picked up, as long as it is publicly listed.
+func queueChapterWebhook(q dbQuerier, chapterID int) error {
+	var novel webhookNovel
+	var chapter webhookChapter
+	var publishedAt time.Time
+	err := q.QueryRow(
+		`SELECT n.id, n.slug, n.title, n.author, n.cover_url, c.id, c.volume, c.number, c.title, COALESCE(c.published_at, now())
+		 FROM chapters c
+		 JOIN novels n ON n.id = c.novel_id
+		 WHERE c.id = $1 AND c.visibility = 'published' AND n.visibility = 'published'`,
+		chapterID,
+	).Scan(&novel.ID, &novel.Slug, &novel.Title, &novel.Author, &novel.CoverURL, &chapter.ID, &chapter.Volume, &chapter.Number, &chapter.Title, &publishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = enqueueWebhookEvent(q, chapterPublishedEvent(novel, chapter, publishedAt))
+	return err
+}
+
+// QueueWebhookTest queues event for one webhook, whatever it subscribes to
+// and even when it is inactive.
+func (r *AppRepository) QueueWebhookTest(id int, event WebhookEvent) (*WebhookDelivery, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := scanWebhookDelivery(r.db.QueryRow(
+		`INSERT INTO webhook_deliveries AS d (webhook_id, event, payload, next_attempt_at, created_at)
+		 SELECT id, $2::text, $3::jsonb, now(), now() FROM webhooks WHERE id = $1
+		 RETURNING `+webhookDeliveryColumns,
+		id,
+		event.Event,
+		string(payload),
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	return delivery, err
+}
+
+// DeliverWebhooks sends up to limit due deliveries, each in its own
+// transaction.
+func (r *AppRepository) DeliverWebhooks(send webhookSendFunc, limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		delivery, err := r.deliverWebhook(0, send)
+		if err != nil || delivery == nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// DeliverWebhook sends one pending delivery right away, regardless of its
+// schedule.
+func (r *AppRepository) DeliverWebhook(deliveryID int, send webhookSendFunc) (*WebhookDelivery, error) {
+	delivery, err := r.deliverWebhook(deliveryID, send)
+	if err == nil && delivery == nil {
+		return nil, errNotFound
+	}
+	return delivery, err
+}
+
+// deliverWebhook claims the delivery with the given ID, or the next due one
+// when deliveryID is zero, sends it and records the outcome. It returns nil
+// when there was nothing to claim.
+func (r *AppRepository) deliverWebhook(deliveryID int, send webhookSendFunc) (*WebhookDelivery, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow(
+		`SELECT `+webhookDeliveryColumns+`, `+webhookColumns+`
+		 FROM webhook_deliveries d
+		 JOIN webhooks w ON w.id = d.webhook_id
+		 WHERE d.status = $2 AND (d.id = $1 OR ($1 = 0 AND w.active AND d.next_attempt_at <= now()))
+		 ORDER BY d.next_attempt_at, d.id
+		 LIMIT 1
+		 FOR UPDATE OF d SKIP LOCKED`,
+		deliveryID,
+		deliveryPending,
+	)
+	var delivery *WebhookDelivery
+	hook, err := scanWebhook(func(hookDest ...any) error {
+		var err error
+		delivery, err = scanWebhookDelivery(row.Scan, hookDest...)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	responseStatus, sendErr := send(hook, delivery)
+	attempts := delivery.Attempts + 1
+	if sendErr == nil {
+		delivery, err = scanWebhookDelivery(tx.QueryRow(
+			`UPDATE webhook_deliveries d
+			 SET status = $2, attempts = $3, response_status = $4, last_error = '', delivered_at = now()
+			 WHERE d.id = $1
+			 RETURNING `+webhookDeliveryColumns,
+			delivery.ID,
+			deliveryDelivered,
+			attempts,
+			responseStatus,
+		).Scan)
+	} else {
+		status := deliveryPending
+		if attempts >= maxWebhookAttempts {
+			status = deliveryFailed
+		}
+		delivery, err = scanWebhookDelivery(tx.QueryRow(
+			`UPDATE webhook_deliveries d
+			 SET status = $2, attempts = $3, response_status = $4, last_error = $5,
+			 next_attempt_at = now() + $6 * interval '1 second'
+			 WHERE d.id = $1
+			 RETURNING `+webhookDeliveryColumns,
+			delivery.ID,
+			status,
+			attempts,
+			responseStatus,
+			sendErr.Error(),
+			int64(retryBackoff(attempts)/time.Second),
+		).Scan)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return delivery, tx.Commit()
+}
+
+func (r *AppRepository) ListWebhookDeliveries(webhookID int, status string, limit int) ([]*WebhookDelivery, error) {
+	if _, err := r.GetWebhook(webhookID); err != nil {
+		return nil, err
+	}
+	args := sqlArgs{webhookID}
+	where := " WHERE d.webhook_id = $1"
+	if status != "" {
+		where += " AND d.status = " + args.add(status)
+	}
+	rows, err := r.db.Query(
+		`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries d`+where+` ORDER BY d.created_at DESC, d.id DESC LIMIT `+args.add(limit),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, delivery)
+	}
+	return items, rows.Err()
+}
+
+// RetryWebhookDelivery puts a pending or failed delivery back at the front of
+// the queue with a fresh attempt budget.
+func (r *AppRepository) RetryWebhookDelivery(id int) (*WebhookDelivery, error) {
+	delivery, err := scanWebhookDelivery(r.db.QueryRow(
+		`UPDATE webhook_deliveries d
+		 SET status = $2, attempts = 0, last_error = '', next_attempt_at = now()
+		 WHERE d.id = $1 AND d.status <> $3
+		 RETURNING `+webhookDeliveryColumns,
+		id,
+		deliveryPending,
+		deliveryDelivered,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		if err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE id = $1)", id).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, errDeliveryClosed
+		}
+		return nil, errNotFound
+	}
+	return delivery, err
+}
 
 func (r *AppRepository) ListBookmarks(userID int) []*Bookmark {
 	rows, err := r.db.Query(
@@ -1043,13 +4027,57 @@ func (r *AppRepository) DeleteAnnouncement(id int) error {
 	return nil
 }
 
+const releaseQueueSelect = `SELECT rq.id, rq.novel_id, n.title, rq.chapter_number, rq.volume, rq.title, rq.content,
+		rq.status, rq.eta, rq.notes, rq.publish_at, rq.published_at, COALESCE(rq.chapter_id, 0), rq.last_error,
+		rq.created_at, rq.updated_at
+	 FROM release_queue rq
+	 JOIN novels n ON n.id = rq.novel_id`
+
+// releaseBatchSize caps how many due releases one scheduler tick publishes.
+const releaseBatchSize = 50
+
+func scanReleaseQueueItem(row interface{ Scan(...any) error }) (*ReleaseQueueItem, error) {
+	var item ReleaseQueueItem
+	var publishAt, publishedAt sql.NullTime
+	if err := row.Scan(
+		&item.ID,
+		&item.NovelID,
+		&item.NovelTitle,
+		&item.ChapterNumber,
+		&item.Volume,
+		&item.Title,
+		&item.Content,
+		&item.Status,
+		&item.Eta,
+		&item.Notes,
+		&publishAt,
+		&publishedAt,
+		&item.ChapterID,
+		&item.LastError,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if publishAt.Valid {
+		item.PublishAt = &publishAt.Time
+	}
+	if publishedAt.Valid {
+		item.PublishedAt = &publishedAt.Time
+	}
+	return &item, nil
+}
+
+func getReleaseQueueItem(q dbQuerier, id int) (*ReleaseQueueItem, error) {
+	item, err := scanReleaseQueueItem(q.QueryRow(releaseQueueSelect+` WHERE rq.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, errNotFound
+	}
+	return item, err
+}
+
 func (r *AppRepository) ListReleaseQueue() ([]*ReleaseQueueItem, error) {
-	rows, err := r.db.Query(
-		`SELECT rq.id, rq.novel_id, n.title, rq.chapter_number, rq.title, rq.status, rq.eta, rq.notes, rq.created_at, rq.updated_at
-		 FROM release_queue rq
-		 JOIN novels n ON n.id = rq.novel_id
-		 ORDER BY rq.created_at DESC`,
-	)
+	rows, err := r.db.Query(releaseQueueSelect + ` ORDER BY rq.created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -1057,22 +4085,11 @@ func (r *AppRepository) ListReleaseQueue() ([]*ReleaseQueueItem, error) {
 
 	items := make([]*ReleaseQueueItem, 0)
 	for rows.Next() {
-		var item ReleaseQueueItem
-		if err := rows.Scan(
-			&item.ID,
-			&item.NovelID,
-			&item.NovelTitle,
-			&item.ChapterNumber,
-			&item.Title,
-			&item.Status,
-			&item.Eta,
-			&item.Notes,
-			&item.CreatedAt,
-			&item.UpdatedAt,
-		); err != nil {
+		item, err := scanReleaseQueueItem(rows)
+		if err != nil {
 			continue
 		}
-		items = append(items, &item)
+		items = append(items, item)
 	}
 	return items, nil
 }
@@ -1087,91 +4104,262 @@ func (r *AppRepository) CreateReleaseQueue(input ReleaseQueueInput) (*ReleaseQue
 	if strings.TrimSpace(input.Title) == "" || input.ChapterNumber <= 0 {
 		return nil, errors.New("title and chapterNumber required")
 	}
-	status := strings.TrimSpace(input.Status)
-	if status == "" {
-		status = "Queued"
+	status := releaseQueued
+	if strings.TrimSpace(input.Status) != "" {
+		normalized, err := normalizeReleaseStatus(input.Status)
+		if err != nil {
+			return nil, err
+		}
+		if normalized != releaseQueued && normalized != releaseScheduled {
+			return nil, fmt.Errorf("%w: new releases start as %s or %s", errReleaseTransition, releaseQueued, releaseScheduled)
+		}
+		status = normalized
+	} else if releaseReady(input.Title, input.Content, input.PublishAt) == nil {
+		status = releaseScheduled
+	}
+	if status == releaseScheduled {
+		if err := releaseReady(input.Title, input.Content, input.PublishAt); err != nil {
+			return nil, err
+		}
 	}
-	item := &ReleaseQueueItem{
-		NovelID:       input.NovelID,
-		ChapterNumber: input.ChapterNumber,
-		Title:         strings.TrimSpace(input.Title),
-		Status:        status,
-		Eta:           strings.TrimSpace(input.Eta),
-		Notes:         strings.TrimSpace(input.Notes),
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+	volume := input.Volume
+	if volume < 1 {
+		volume = 1
 	}
+	now := time.Now()
 
+	var id int
 	if err := r.db.QueryRow(
-		`INSERT INTO release_queue (novel_id, chapter_number, title, status, eta, notes, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`INSERT INTO release_queue (novel_id, chapter_number, volume, title, content, status, eta, notes, publish_at, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		 RETURNING id`,
-		item.NovelID,
-		item.ChapterNumber,
-		item.Title,
-		item.Status,
-		item.Eta,
-		item.Notes,
-		item.CreatedAt,
-		item.UpdatedAt,
-	).Scan(&item.ID); err != nil {
+		input.NovelID,
+		input.ChapterNumber,
+		volume,
+		strings.TrimSpace(input.Title),
+		strings.TrimSpace(input.Content),
+		status,
+		strings.TrimSpace(input.Eta),
+		strings.TrimSpace(input.Notes),
+		input.PublishAt,
+		now,
+		now,
+	).Scan(&id); err != nil {
 		return nil, err
 	}
+	return getReleaseQueueItem(r.db, id)
+}
 
-	if err := r.db.QueryRow(
-		`SELECT title FROM novels WHERE id = $1`,
-		item.NovelID,
-	).Scan(&item.NovelTitle); err != nil {
+// UpdateReleaseQueue replaces the draft of an unpublished release. A scheduled
+// release must stay complete enough to publish.
+func (r *AppRepository) UpdateReleaseQueue(id int, input ReleaseQueueInput) (*ReleaseQueueItem, error) {
+	if strings.TrimSpace(input.Title) == "" || input.ChapterNumber <= 0 {
+		return nil, errors.New("title and chapterNumber required")
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
+	var status string
+	err = tx.QueryRow(`SELECT status FROM release_queue WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status == releasePublished {
+		return nil, errReleaseLocked
+	}
+	if status == releaseScheduled {
+		if err := releaseReady(input.Title, input.Content, input.PublishAt); err != nil {
+			return nil, err
+		}
+	}
+	volume := input.Volume
+	if volume < 1 {
+		volume = 1
+	}
+	if _, err := tx.Exec(
+		`UPDATE release_queue
+		 SET chapter_number = $1, volume = $2, title = $3, content = $4, eta = $5, notes = $6, publish_at = $7, updated_at = $8
+		 WHERE id = $9`,
+		input.ChapterNumber,
+		volume,
+		strings.TrimSpace(input.Title),
+		strings.TrimSpace(input.Content),
+		strings.TrimSpace(input.Eta),
+		strings.TrimSpace(input.Notes),
+		input.PublishAt,
+		time.Now(),
+		id,
+	); err != nil {
+		return nil, err
+	}
+	item, err := getReleaseQueueItem(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return item, nil
 }
 
 func (r *AppRepository) UpdateReleaseQueueStatus(id int, status string) (*ReleaseQueueItem, error) {
-	status = strings.TrimSpace(status)
-	if status == "" {
-		return nil, errors.New("status required")
+	next, err := normalizeReleaseStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
 	}
-	item := &ReleaseQueueItem{}
-	item.Status = status
-	item.UpdatedAt = time.Now()
+	defer tx.Rollback()
 
-	result, err := r.db.Exec(
-		`UPDATE release_queue SET status = $1, updated_at = $2 WHERE id = $3`,
-		item.Status,
-		item.UpdatedAt,
-		id,
-	)
+	if _, err := tx.Exec(`SELECT 1 FROM release_queue WHERE id = $1 FOR UPDATE`, id); err != nil {
+		return nil, err
+	}
+	current, err := getReleaseQueueItem(tx, id)
 	if err != nil {
 		return nil, err
 	}
-	count, err := result.RowsAffected()
-	if err == nil && count == 0 {
-		return nil, errNotFound
+	if current.Status == next {
+		return current, nil
 	}
-
-	row := r.db.QueryRow(
-		`SELECT rq.id, rq.novel_id, n.title, rq.chapter_number, rq.title, rq.status, rq.eta, rq.notes, rq.created_at, rq.updated_at
-		 FROM release_queue rq
-		 JOIN novels n ON n.id = rq.novel_id
-		 WHERE rq.id = $1`,
+	if next == releasePublished {
+		return nil, fmt.Errorf("%w: releases are published by the scheduler", errReleaseTransition)
+	}
+	if err := checkReleaseTransition(current.Status, next); err != nil {
+		return nil, err
+	}
+	if next == releaseScheduled {
+		if err := releaseReady(current.Title, current.Content, current.PublishAt); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(
+		`UPDATE release_queue SET status = $1, last_error = '', updated_at = $2 WHERE id = $3`,
+		next,
+		time.Now(),
 		id,
-	)
-	if err := row.Scan(
-		&item.ID,
-		&item.NovelID,
-		&item.NovelTitle,
-		&item.ChapterNumber,
-		&item.Title,
-		&item.Status,
-		&item.Eta,
-		&item.Notes,
-		&item.CreatedAt,
-		&item.UpdatedAt,
 	); err != nil {
 		return nil, err
 	}
+	item, err := getReleaseQueueItem(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// PublishDueReleases promotes every scheduled release whose publish time has
+// passed into a chapter and returns the items it settled.
+func (r *AppRepository) PublishDueReleases(now time.Time) ([]*ReleaseQueueItem, error) {
+	items := make([]*ReleaseQueueItem, 0)
+	for len(items) < releaseBatchSize {
+		item, err := r.publishNextRelease(now)
+		if err != nil {
+			return items, err
+		}
+		if item == nil {
+			break
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// publishNextRelease claims one due release with FOR UPDATE SKIP LOCKED, so
+// concurrent schedulers never pick the same row, and creates its chapter in
+// the same transaction that marks it Published. Chapter errors mark it Failed.
+func (r *AppRepository) publishNextRelease(now time.Time) (*ReleaseQueueItem, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id, novelID, number, volume int
+	var title, content string
+	err = tx.QueryRow(
+		`SELECT id, novel_id, chapter_number, volume, title, content
+		 FROM release_queue
+		 WHERE status = 'Scheduled' AND publish_at <= $1
+		 ORDER BY publish_at, id
+		 LIMIT 1
+		 FOR UPDATE SKIP LOCKED`,
+		now,
+	).Scan(&id, &novelID, &number, &volume, &title, &content)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	failure := ""
+	chapterID := 0
+	var exists bool
+	if err := tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM chapters WHERE novel_id = $1 AND number = $2)`,
+		novelID,
+		number,
+	).Scan(&exists); err != nil {
+		return nil, err
+	}
+	switch {
+	case exists:
+		failure = "chapter " + strconv.Itoa(number) + " already exists"
+	case strings.TrimSpace(content) == "":
+		failure = "draft content is empty"
+	default:
+		if _, err := tx.Exec(`SAVEPOINT publish_release`); err != nil {
+			return nil, err
+		}
+		chapter, err := insertChapter(tx, novelID, ChapterInput{Number: number, Volume: volume, Title: title, Content: content})
+		if err != nil {
+			if _, rollbackErr := tx.Exec(`ROLLBACK TO SAVEPOINT publish_release`); rollbackErr != nil {
+				return nil, rollbackErr
+			}
+			failure = err.Error()
+		} else {
+			chapterID = chapter.ID
+		}
+	}
+
+	if failure == "" {
+		_, err = tx.Exec(
+			`UPDATE release_queue
+			 SET status = 'Published', chapter_id = $1, published_at = $2, last_error = '', updated_at = $2
+			 WHERE id = $3`,
+			chapterID,
+			now,
+			id,
+		)
+	} else {
+		_, err = tx.Exec(
+			`UPDATE release_queue SET status = 'Failed', last_error = $1, updated_at = $2 WHERE id = $3`,
+			failure,
+			now,
+			id,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	item, err := getReleaseQueueItem(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return item, nil
 }
 
@@ -1291,24 +4479,690 @@ func (r *AppRepository) CreateIllustration(input IllustrationInput) (*Illustrati
 	return illustration, nil
 }
 
-func (r *AppRepository) ListNovelChapterStats() []*NovelChapterStat {
+const novelStatsSelect = `SELECT s.novel_id, s.chapter_count, s.word_count, s.volume_chapters,
+	COALESCE(s.latest_chapter_id, 0), COALESCE(s.latest_chapter_number, 0), s.latest_published_at,
+	s.follower_count, s.bookmark_count, s.rating_count, s.rating_average, s.reader_count, s.last_updated_at
+	FROM novel_stats s`
+
+func scanNovelStats(scan func(dest ...any) error) (*NovelStats, error) {
+	var stats NovelStats
+	var volumes []byte
+	var publishedAt sql.NullTime
+	if err := scan(
+		&stats.NovelID,
+		&stats.ChapterCount,
+		&stats.WordCount,
+		&volumes,
+		&stats.LatestChapterID,
+		&stats.LatestChapterNumber,
+		&publishedAt,
+		&stats.FollowerCount,
+		&stats.BookmarkCount,
+		&stats.RatingCount,
+		&stats.AverageRating,
+		&stats.ReaderCount,
+		&stats.LastUpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	stats.VolumeChapters = make(map[int]int)
+	if err := json.Unmarshal(volumes, &stats.VolumeChapters); err != nil {
+		return nil, err
+	}
+	if publishedAt.Valid {
+		stats.LatestPublishedAt = &publishedAt.Time
+	}
+	return &stats, nil
+}
+
+// ListNovelStats reads the novel_stats table, which triggers keep current on
+// every write to chapters, follows, bookmarks, ratings and reading history.
+func (r *AppRepository) ListNovelStats(includeHidden bool) ([]*NovelStats, error) {
 	rows, err := r.db.Query(
-		`SELECT novel_id, COUNT(*) AS chapter_count, COALESCE(MAX(id), 0) AS latest_chapter_id
-		 FROM chapters
-		 GROUP BY novel_id`,
+		novelStatsSelect+`
+		 JOIN novels n ON n.id = s.novel_id
+		 WHERE $1 OR n.visibility = 'published'
+		 ORDER BY s.novel_id`,
+		includeHidden,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*NovelStats, 0)
+	for rows.Next() {
+		stats, err := scanNovelStats(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, stats)
+	}
+	return items, rows.Err()
+}
+
+func (r *AppRepository) GetNovelStats(novelID int) (*NovelStats, error) {
+	stats, err := scanNovelStats(r.db.QueryRow(novelStatsSelect+" WHERE s.novel_id = $1", novelID).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	return stats, err
+}
+
+// RecordChapterView counts a view unless the visitor already viewed the
+// chapter in the current window. It reports whether the view was counted.
+func (r *AppRepository) RecordChapterView(chapterID int, visitorHash string, now time.Time, window time.Duration) (bool, error) {
+	result, err := r.db.Exec(
+		`WITH chapter AS (
+			SELECT id, novel_id FROM chapters WHERE id = $1
+		), fresh AS (
+			INSERT INTO chapter_view_visitors (chapter_id, visitor_hash, window_start)
+			SELECT id, $2::TEXT, $3::TIMESTAMPTZ FROM chapter
+			ON CONFLICT DO NOTHING
+			RETURNING chapter_id
+		)
+		INSERT INTO chapter_views_daily (chapter_id, novel_id, day, views)
+		SELECT f.chapter_id, c.novel_id, $4::DATE, 1
+		FROM fresh f
+		JOIN chapter c ON c.id = f.chapter_id
+		ON CONFLICT (chapter_id, day) DO UPDATE SET views = chapter_views_daily.views + 1`,
+		chapterID,
+		visitorHash,
+		now.Truncate(window),
+		now.UTC().Format(analyticsDateLayout),
+	)
+	if err != nil {
+		return false, err
+	}
+	counted, err := result.RowsAffected()
+	return counted > 0, err
+}
+
+func (r *AppRepository) PruneChapterViewVisitors(before time.Time) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM chapter_view_visitors WHERE window_start < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *AppRepository) GetNovelViewSeries(novelID int, from, to time.Time) (*ViewSeries, error) {
+	if _, err := r.GetNovel(novelID); err != nil {
+		return nil, err
+	}
+	series := &ViewSeries{NovelID: novelID}
+	return series, r.fillViewSeries(series, "novel_id", novelID, from, to)
+}
+
+func (r *AppRepository) GetChapterViewSeries(chapterID int, from, to time.Time) (*ViewSeries, error) {
+	if _, err := getChapter(r.db, chapterID, ""); err != nil {
+		return nil, err
+	}
+	series := &ViewSeries{ChapterID: chapterID}
+	return series, r.fillViewSeries(series, "chapter_id", chapterID, from, to)
+}
+
+// fillViewSeries sums the daily rollups matching column = id, one row per day
+// of the range.
+func (r *AppRepository) fillViewSeries(series *ViewSeries, column string, id int, from, to time.Time) error {
+	series.From = from.Format(analyticsDateLayout)
+	series.To = to.Format(analyticsDateLayout)
+	series.Days = make([]ViewPoint, 0)
+	rows, err := r.db.Query(
+		fmt.Sprintf(
+			`SELECT d::DATE, COALESCE(SUM(v.views), 0)
+			 FROM generate_series($2::DATE, $3::DATE, INTERVAL '1 day') AS d
+			 LEFT JOIN chapter_views_daily v ON v.day = d::DATE AND v.%s = $1
+			 GROUP BY d
+			 ORDER BY d`,
+			column,
+		),
+		id,
+		series.From,
+		series.To,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day time.Time
+		var point ViewPoint
+		if err := rows.Scan(&day, &point.Views); err != nil {
+			return err
+		}
+		point.Date = day.Format(analyticsDateLayout)
+		series.Total += point.Views
+		series.Days = append(series.Days, point)
+	}
+	return rows.Err()
+}
+
+// ListNovelDropOff lists views per published chapter in reading order.
+func (r *AppRepository) ListNovelDropOff(novelID int, from, to time.Time) ([]*ChapterDropOff, error) {
+	if _, err := r.GetNovel(novelID); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(
+		`SELECT c.id, c.volume, c.number, c.title, COALESCE(SUM(v.views), 0)
+		 FROM chapters c
+		 LEFT JOIN chapter_views_daily v ON v.chapter_id = c.id AND v.day BETWEEN $2::DATE AND $3::DATE
+		 WHERE c.novel_id = $1 AND c.visibility = 'published'
+		 GROUP BY c.id
+		 ORDER BY c.volume, c.number, c.id`,
+		novelID,
+		from.Format(analyticsDateLayout),
+		to.Format(analyticsDateLayout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*ChapterDropOff, 0)
+	for rows.Next() {
+		var item ChapterDropOff
+		if err := rows.Scan(&item.ChapterID, &item.Volume, &item.Number, &item.Title, &item.Views); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	computeDropOff(items)
+	return items, nil
+}
+
+// ListTopNovelsByViews ranks novels by views between from and to; a zero from
+// counts every day up to to.
+func (r *AppRepository) ListTopNovelsByViews(from, to time.Time, limit int) ([]*NovelViewRank, error) {
+	var since any
+	if !from.IsZero() {
+		since = from.Format(analyticsDateLayout)
+	}
+	rows, err := r.db.Query(
+		`SELECT n.id, n.slug, n.title, SUM(v.views) AS views
+		 FROM chapter_views_daily v
+		 JOIN novels n ON n.id = v.novel_id
+		 WHERE ($1::DATE IS NULL OR v.day >= $1::DATE) AND v.day <= $2::DATE
+		 GROUP BY n.id
+		 ORDER BY views DESC, n.id
+		 LIMIT $3`,
+		since,
+		to.Format(analyticsDateLayout),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*NovelViewRank, 0)
+	for rows.Next() {
+		var item NovelViewRank
+		if err := rows.Scan(&item.NovelID, &item.Slug, &item.Title, &item.Views); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *AppRepository) Search(query SearchQuery) (*SearchResults, error) {
+	results := &SearchResults{
+		Query:    query.Text,
+		Novels:   make([]*NovelSearchHit, 0),
+		Chapters: make([]*ChapterSearchHit, 0),
+	}
+	if searchIncludes(query, "novels") {
+		if err := r.searchNovels(query, results); err != nil {
+			return nil, err
+		}
+	}
+	if searchIncludes(query, "chapters") {
+		if err := r.searchChapters(query, results); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (r *AppRepository) searchNovels(query SearchQuery, results *SearchResults) error {
+	rows, err := r.db.Query(
+		`WITH q AS (
+			SELECT websearch_to_tsquery('english', $1) || websearch_to_tsquery('simple', $1) AS query
+		 ), matches AS (
+			SELECT n.id, ts_rank_cd(n.search_vector, q.query) AS rank, COUNT(*) OVER () AS total
+			FROM novels n, q
+			WHERE n.search_vector @@ q.query
+			  AND ($2 = '' OR n.tags @> ARRAY[$2]::TEXT[])
+			  AND ($3 = '' OR lower(n.status) = lower($3))
+			  AND ($4 = 0 OR n.id = $4)
+			  AND ($8 OR n.visibility = 'published')
+			ORDER BY rank DESC, n.id DESC
+			LIMIT $5 OFFSET $6
+		 )
+		 SELECT n.id, n.slug, n.title, n.author, n.summary, n.tags, n.cover_url, n.status, n.visibility, n.published_at, n.created_at, n.updated_at,
+			m.rank, m.total, ts_headline('english', n.summary, q.query, $7)
+		 FROM matches m
+		 JOIN novels n ON n.id = m.id
+		 CROSS JOIN q
+		 ORDER BY m.rank DESC, n.id DESC`,
+		query.Text,
+		query.Tag,
+		query.Status,
+		query.NovelID,
+		query.Limit,
+		query.Offset,
+		snippetHeadlineOptions,
+		query.IncludeHidden,
 	)
 	if err != nil {
-		return []*NovelChapterStat{}
+		return err
 	}
 	defer rows.Close()
 
-	items := make([]*NovelChapterStat, 0)
 	for rows.Next() {
-		var stat NovelChapterStat
-		if err := rows.Scan(&stat.NovelID, &stat.ChapterCount, &stat.LatestChapterID); err != nil {
+		var novel Novel
+		var tags []string
+		var hit NovelSearchHit
+		var snippet string
+		if err := rows.Scan(
+			&novel.ID,
+			&novel.Slug,
+			&novel.Title,
+			&novel.Author,
+			&novel.Summary,
+			pq.Array(&tags),
+			&novel.CoverURL,
+			&novel.Status,
+			&novel.Visibility,
+			&novel.PublishedAt,
+			&novel.CreatedAt,
+			&novel.UpdatedAt,
+			&hit.Rank,
+			&results.NovelTotal,
+			&snippet,
+		); err != nil {
 			continue
 		}
-		items = append(items, &stat)
+		novel.Tags = tags
+		hit.Novel = &novel
+		hit.Snippet = renderSnippet(snippet)
+		results.Novels = append(results.Novels, &hit)
 	}
-	return items
+	return rows.Err()
+}
+
+func (r *AppRepository) searchChapters(query SearchQuery, results *SearchResults) error {
+	rows, err := r.db.Query(
+		`WITH q AS (
+			SELECT websearch_to_tsquery('english', $1) AS query
+		 ), matches AS (
+			SELECT c.id, ts_rank_cd(c.search_vector, q.query) AS rank, COUNT(*) OVER () AS total
+			FROM chapters c
+			JOIN novels n ON n.id = c.novel_id, q
+			WHERE c.search_vector @@ q.query
+			  AND ($2 = '' OR n.tags @> ARRAY[$2]::TEXT[])
+			  AND ($3 = '' OR lower(n.status) = lower($3))
+			  AND ($4 = 0 OR c.novel_id = $4)
+			  AND ($8 OR (c.visibility = 'published' AND n.visibility = 'published'))
+			ORDER BY rank DESC, c.id DESC
+			LIMIT $5 OFFSET $6
+		 )
+		 SELECT c.id, c.novel_id, n.slug, n.title, c.number, c.volume, c.title,
+			m.rank, m.total, ts_headline('english', c.content, q.query, $7)
+		 FROM matches m
+		 JOIN chapters c ON c.id = m.id
+		 JOIN novels n ON n.id = c.novel_id
+		 CROSS JOIN q
+		 ORDER BY m.rank DESC, c.id DESC`,
+		query.Text,
+		query.Tag,
+		query.Status,
+		query.NovelID,
+		query.Limit,
+		query.Offset,
+		snippetHeadlineOptions,
+		query.IncludeHidden,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hit ChapterSearchHit
+		var snippet string
+		if err := rows.Scan(
+			&hit.ChapterID,
+			&hit.NovelID,
+			&hit.NovelSlug,
+			&hit.NovelTitle,
+			&hit.Number,
+			&hit.Volume,
+			&hit.Title,
+			&hit.Rank,
+			&results.ChapterTotal,
+			&snippet,
+		); err != nil {
+			continue
+		}
+		hit.Snippet = renderSnippet(snippet)
+		results.Chapters = append(results.Chapters, &hit)
+	}
+	return rows.Err()
+}
+
+// novelSortColumns maps the NovelQuery sort keys to the listing column used for
+// keyset pagination. Every key except title sorts descending.
+var novelSortColumns = map[string]string{
+	"latest":         "updated_at",
+	"created":        "created_at",
+	"title":          "sort_title",
+	"rating":         "rating",
+	"popularity":     "popularity",
+	"latest_chapter": "latest_chapter_at",
+}
+
+func (r *AppRepository) QueryNovels(query NovelQuery) (*Page[*Novel], error) {
+	sortKey := query.Sort
+	if sortKey == "" {
+		sortKey = "latest"
+	}
+	column, ok := novelSortColumns[sortKey]
+	if !ok {
+		return nil, errors.New("unknown sort " + sortKey)
+	}
+	cursor, err := decodeCursor(query.Cursor, sortKey)
+	if err != nil {
+		return nil, err
+	}
+	var cursorValue any
+	if cursor != nil {
+		switch sortKey {
+		case "title":
+			cursorValue = cursor.Value
+		case "rating":
+			cursorValue, err = cursorFloat(cursor)
+		case "popularity":
+			cursorValue, err = strconv.Atoi(cursor.Value)
+		default:
+			cursorValue, err = cursorTime(cursor)
+		}
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+	}
+
+	args := sqlArgs{}
+	filters := []string{"TRUE"}
+	if len(query.Tags) > 0 {
+		operator := "&&"
+		if query.MatchAll {
+			operator = "@>"
+		}
+		filters = append(filters, "n.tags "+operator+" "+args.add(pq.Array(query.Tags))+"::TEXT[]")
+	}
+	if query.Status != "" {
+		filters = append(filters, "lower(n.status) = lower("+args.add(query.Status)+")")
+	}
+	if query.Author != "" {
+		filters = append(filters, "lower(n.author) = lower("+args.add(query.Author)+")")
+	}
+	chapterFilter := "WHERE visibility = 'published'"
+	if query.IncludeHidden {
+		chapterFilter = ""
+		if query.Visibility != "" {
+			filters = append(filters, "n.visibility = "+args.add(query.Visibility))
+		}
+	} else {
+		filters = append(filters, "n.visibility = 'published'")
+	}
+
+	q := keysetQuery{
+		listing: `SELECT n.id, n.slug, n.title, n.author, n.summary, n.tags, n.cover_url, n.status, n.visibility, n.published_at, n.created_at, n.updated_at,
+				lower(n.title) AS sort_title,
+				COALESCE(rt.rating, 0)::FLOAT8 AS rating,
+				COALESCE(fl.popularity, 0) AS popularity,
+				COALESCE(ch.latest_chapter_at, n.created_at) AS latest_chapter_at
+			FROM novels n
+			LEFT JOIN (SELECT novel_id, AVG(score) AS rating FROM ratings GROUP BY novel_id) rt ON rt.novel_id = n.id
+			LEFT JOIN (SELECT novel_id, COUNT(*) AS popularity FROM follows GROUP BY novel_id) fl ON fl.novel_id = n.id
+			LEFT JOIN (SELECT novel_id, MAX(created_at) AS latest_chapter_at FROM chapters ` + chapterFilter + ` GROUP BY novel_id) ch ON ch.novel_id = n.id
+			WHERE ` + strings.Join(filters, " AND "),
+		args:      args,
+		column:    column,
+		ascending: sortKey == "title",
+	}
+	return runKeysetQuery(r.db, q, sortKey, cursor, cursorValue, query.Limit, func(rows *sql.Rows, total *int) (*Novel, string, int, error) {
+		var novel Novel
+		var tags []string
+		var sortTitle string
+		var rating float64
+		var popularity int
+		var latestChapterAt time.Time
+		if err := rows.Scan(
+			&novel.ID,
+			&novel.Slug,
+			&novel.Title,
+			&novel.Author,
+			&novel.Summary,
+			pq.Array(&tags),
+			&novel.CoverURL,
+			&novel.Status,
+			&novel.Visibility,
+			&novel.PublishedAt,
+			&novel.CreatedAt,
+			&novel.UpdatedAt,
+			&sortTitle,
+			&rating,
+			&popularity,
+			&latestChapterAt,
+			total,
+		); err != nil {
+			return nil, "", 0, err
+		}
+		novel.Tags = tags
+		var value string
+		switch sortKey {
+		case "title":
+			value = sortTitle
+		case "rating":
+			value = formatCursorFloat(rating)
+		case "popularity":
+			value = strconv.Itoa(popularity)
+		case "created":
+			value = formatCursorTime(novel.CreatedAt)
+		case "latest_chapter":
+			value = formatCursorTime(latestChapterAt)
+		default:
+			value = formatCursorTime(novel.UpdatedAt)
+		}
+		return &novel, value, novel.ID, nil
+	})
+}
+
+func (r *AppRepository) ListLatestChapters(limit int) ([]*Chapter, error) {
+	rows, err := r.db.Query(
+		`SELECT c.id, c.novel_id, c.number, c.volume, c.title, c.content, c.word_count, c.visibility, c.published_at, c.created_at, c.updated_at
+		 FROM chapters c
+		 JOIN novels n ON n.id = c.novel_id
+		 WHERE c.visibility = 'published' AND n.visibility = 'published'
+		 ORDER BY c.created_at DESC, c.id DESC
+		 LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*Chapter, 0, limit)
+	for rows.Next() {
+		var chapter Chapter
+		if err := rows.Scan(
+			&chapter.ID,
+			&chapter.NovelID,
+			&chapter.Number,
+			&chapter.Volume,
+			&chapter.Title,
+			&chapter.Content,
+			&chapter.WordCount,
+			&chapter.Visibility,
+			&chapter.PublishedAt,
+			&chapter.CreatedAt,
+			&chapter.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &chapter)
+	}
+	return items, rows.Err()
+}
+
+func (r *AppRepository) QueryChapters(query ChapterQuery) (*Page[*Chapter], error) {
+	sortKey := "number"
+	if query.Descending {
+		sortKey = "number_desc"
+	}
+	cursor, err := decodeCursor(query.Cursor, sortKey)
+	if err != nil {
+		return nil, err
+	}
+	var cursorValue any
+	if cursor != nil {
+		if cursorValue, err = strconv.Atoi(cursor.Value); err != nil {
+			return nil, errInvalidCursor
+		}
+	}
+	args := sqlArgs{}
+	filters := []string{"novel_id = " + args.add(query.NovelID)}
+	if query.Volume > 0 {
+		filters = append(filters, "volume = "+args.add(query.Volume))
+	}
+	if !query.IncludeHidden {
+		filters = append(filters, "visibility = 'published'")
+	}
+	q := keysetQuery{
+		listing: `SELECT id, novel_id, number, volume, title, content, word_count, visibility, published_at, created_at, updated_at
+			FROM chapters
+			WHERE ` + strings.Join(filters, " AND "),
+		args:      args,
+		column:    "number",
+		ascending: !query.Descending,
+	}
+	return runKeysetQuery(r.db, q, sortKey, cursor, cursorValue, query.Limit, func(rows *sql.Rows, total *int) (*Chapter, string, int, error) {
+		var chapter Chapter
+		if err := rows.Scan(
+			&chapter.ID,
+			&chapter.NovelID,
+			&chapter.Number,
+			&chapter.Volume,
+			&chapter.Title,
+			&chapter.Content,
+			&chapter.WordCount,
+			&chapter.Visibility,
+			&chapter.PublishedAt,
+			&chapter.CreatedAt,
+			&chapter.UpdatedAt,
+			total,
+		); err != nil {
+			return nil, "", 0, err
+		}
+		return &chapter, strconv.Itoa(chapter.Number), chapter.ID, nil
+	})
+}
+
+// QueryComments pages through a chapter's top-level comments and attaches
+// each one's full reply thread.
+func (r *AppRepository) QueryComments(query CommentQuery) (*Page[*Comment], error) {
+	cursor, err := decodeCursor(query.Cursor, "created")
+	if err != nil {
+		return nil, err
+	}
+	var cursorValue any
+	if cursor != nil {
+		if cursorValue, err = cursorTime(cursor); err != nil {
+			return nil, err
+		}
+	}
+	args := sqlArgs{}
+	filters := []string{"c.parent_id IS NULL", "c.chapter_id = " + args.add(query.ChapterID)}
+	if query.Paragraph != nil {
+		filters = append(filters, "c.paragraph_index = "+args.add(*query.Paragraph))
+	}
+	q := keysetQuery{
+		listing: commentSelect + `
+			WHERE ` + strings.Join(filters, " AND "),
+		args:   args,
+		column: "created_at",
+	}
+	page, err := runKeysetQuery(r.db, q, "created", cursor, cursorValue, query.Limit, func(rows *sql.Rows, total *int) (*Comment, string, int, error) {
+		comment, err := scanComment(rows.Scan, total)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		return comment, formatCursorTime(comment.CreatedAt), comment.ID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.attachCommentThreads(page.Items); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (r *AppRepository) QueryRatings(query RatingQuery) (*Page[*Rating], error) {
+	sortKey := query.Sort
+	if sortKey == "" {
+		sortKey = "newest"
+	}
+	column, ok := ratingSortColumns[sortKey]
+	if !ok {
+		return nil, errors.New("unknown sort " + sortKey)
+	}
+	// Newest keeps the original "at" cursor name so existing cursors stay valid.
+	cursorName := "at"
+	if sortKey == "helpful" {
+		cursorName = "helpful"
+	}
+	cursor, err := decodeCursor(query.Cursor, cursorName)
+	if err != nil {
+		return nil, err
+	}
+	var cursorValue any
+	if cursor != nil {
+		if sortKey == "helpful" {
+			cursorValue, err = strconv.Atoi(cursor.Value)
+		} else {
+			cursorValue, err = cursorTime(cursor)
+		}
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+	}
+	args := sqlArgs{}
+	filters := []string{"novel_id = " + args.add(query.NovelID)}
+	if query.ReviewsOnly {
+		filters = append(filters, "body <> ''")
+	}
+	q := keysetQuery{
+		listing: ratingSelect + `
+			WHERE ` + strings.Join(filters, " AND "),
+		args:   args,
+		column: column,
+	}
+	return runKeysetQuery(r.db, q, cursorName, cursor, cursorValue, query.Limit, func(rows *sql.Rows, total *int) (*Rating, string, int, error) {
+		rating, helpfulScore, err := scanRating(rows.Scan, total)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		if sortKey == "helpful" {
+			return rating, strconv.Itoa(helpfulScore), rating.ID, nil
+		}
+		return rating, formatCursorTime(rating.At), rating.ID, nil
+	})
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxReviewTitle = 200
+	maxReviewBody  = 20000
+)
+
+var (
+	errReviewTooLong = errors.New("review title or body is too long")
+	errOwnReviewVote = errors.New("you cannot vote on your own review")
+)
+
+// ratingSortColumns maps RatingQuery sorts to the listing column used for
+// keyset pagination.
+var ratingSortColumns = map[string]string{
+	"newest":  "at",
+	"helpful": "helpful_score",
+}
+
+func validateReview(input RatingInput) error {
+	if input.Title != nil && utf8.RuneCountInString(strings.TrimSpace(*input.Title)) > maxReviewTitle {
+		return errReviewTooLong
+	}
+	if input.Body != nil && utf8.RuneCountInString(strings.TrimSpace(*input.Body)) > maxReviewBody {
+		return errReviewTooLong
+	}
+	return nil
+}
+
+// newRatingSummary builds the aggregate from per-score counts.
+func newRatingSummary(novelID int, scores map[int]int, reviews int) *RatingSummary {
+	summary := &RatingSummary{NovelID: novelID, Reviews: reviews, Histogram: make(map[int]int, 5)}
+	total := 0
+	for score := 1; score <= 5; score++ {
+		summary.Histogram[score] = scores[score]
+		summary.Count += scores[score]
+		total += score * scores[score]
+	}
+	if summary.Count > 0 {
+		summary.Average = math.Round(float64(total)/float64(summary.Count)*100) / 100
+	}
+	return summary
+}
+
+func respondReviewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errOwnReviewVote):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, errReviewTooLong):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondNotFound(c, err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	roleUser  = "user"
+	roleAdmin = "admin"
+
+	permNovelEdit       = "novel.edit"
+	permChapterEdit     = "chapter.edit"
+	permChapterPublish  = "chapter.publish"
+	permCommentModerate = "comment.moderate"
+	permUserManage      = "user.manage"
+	permSettingsEdit    = "settings.edit"
+	permAnalyticsView   = "analytics.view"
+	permRoleManage      = "role.manage"
+)
+
+// permissionCatalog lists every permission a role can grant.
+var permissionCatalog = []Permission{
+	{Name: permNovelEdit, Description: "Create, edit and delete novels and their covers"},
+	{Name: permChapterEdit, Description: "Write and import chapter drafts and browse revisions"},
+	{Name: permChapterPublish, Description: "Publish, schedule, edit and delete live chapters"},
+	{Name: permCommentModerate, Description: "Remove any comment and handle reports"},
+	{Name: permUserManage, Description: "Change account roles, ban and delete accounts"},
+	{Name: permSettingsEdit, Description: "Site settings, announcements, webhooks and mail"},
+	{Name: permAnalyticsView, Description: "View readership analytics"},
+	{Name: permRoleManage, Description: "Define custom roles"},
+}
+
+// builtinRoles are always available and cannot be edited. Custom roles are
+// stored in the roles table.
+var builtinRoles = []Role{
+	{Name: roleUser, Description: "Reader without studio access", Permissions: []string{}},
+	{Name: "translator", Description: "Writes chapter drafts", Permissions: []string{permChapterEdit}},
+	{
+		Name:        "editor",
+		Description: "Manages novels and publishes chapters",
+		Permissions: []string{permNovelEdit, permChapterEdit, permChapterPublish, permAnalyticsView},
+	},
+	{Name: "moderator", Description: "Handles comments, reports and accounts", Permissions: []string{permCommentModerate, permUserManage}},
+	{Name: roleAdmin, Description: "Full access", Permissions: allPermissions()},
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+var (
+	errRoleName        = errors.New("role name must be 2-32 lowercase letters, digits, - or _ and start with a letter")
+	errRoleBuiltIn     = errors.New("built-in roles cannot be changed")
+	errRoleExists      = errors.New("a role with that name already exists")
+	errRoleInUse       = errors.New("role is still assigned to accounts")
+	errRoleUnknown     = errors.New("invalid role")
+	errRolePermission  = errors.New("permissions must be listed in GET /admin/permissions")
+	errRoleEscalation  = errors.New("you cannot grant permissions you do not have")
+	errUserOutranks    = errors.New("this account has permissions you do not have")
+	errPublishRequired = errors.New("publishing needs the chapter.publish permission; save it as a draft")
+)
+
+func allPermissions() []string {
+	names := make([]string, 0, len(permissionCatalog))
+	for _, permission := range permissionCatalog {
+		names = append(names, permission.Name)
+	}
+	return names
+}
+
+func builtinRole(name string) (*Role, bool) {
+	for _, role := range builtinRoles {
+		if role.Name == name {
+			role.Permissions = slices.Clone(role.Permissions)
+			role.BuiltIn = true
+			return &role, true
+		}
+	}
+	return nil, false
+}
+
+// listRoles returns the built-in roles followed by custom ones.
+func listRoles(repo Repository) ([]*Role, error) {
+	custom, err := repo.ListRoles()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*Role, 0, len(builtinRoles)+len(custom))
+	for _, role := range builtinRoles {
+		item, _ := builtinRole(role.Name)
+		items = append(items, item)
+	}
+	return append(items, custom...), nil
+}
+
+func findRole(repo Repository, name string) (*Role, error) {
+	if role, ok := builtinRole(name); ok {
+		return role, nil
+	}
+	role, err := repo.GetRole(name)
+	if errors.Is(err, errNotFound) {
+		return nil, errRoleUnknown
+	}
+	return role, err
+}
+
+// rolePermissions is what a role grants. Unknown roles, such as a custom role
+// that failed to load, grant nothing.
+func rolePermissions(repo Repository, name string) []string {
+	role, err := findRole(repo, name)
+	if err != nil {
+		return []string{}
+	}
+	return role.Permissions
+}
+
+// normalizeRoleInput validates a custom role. Updates take the name from the
+// path.
+func normalizeRoleInput(input RoleInput) (RoleInput, error) {
+	input.Name = normalizeRole(input.Name)
+	if !roleNamePattern.MatchString(input.Name) {
+		return input, errRoleName
+	}
+	if _, ok := builtinRole(input.Name); ok {
+		return input, errRoleBuiltIn
+	}
+	input.Description = strings.TrimSpace(input.Description)
+	known := allPermissions()
+	permissions := make([]string, 0, len(input.Permissions))
+	for _, permission := range input.Permissions {
+		permission = strings.ToLower(strings.TrimSpace(permission))
+		if !slices.Contains(known, permission) {
+			return input, errRolePermission
+		}
+		if !slices.Contains(permissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	input.Permissions = permissions
+	return input, nil
+}
+
+// coversPermissions reports whether have includes everything in need.
+func coversPermissions(have []string, need []string) bool {
+	for _, permission := range need {
+		if !slices.Contains(have, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasPermission checks the permissions adminAccess stored for the caller.
+func hasPermission(c *gin.Context, permission string) bool {
+	return slices.Contains(c.GetStringSlice("permissions"), permission)
+}
+
+// requirePermission runs after adminAccess and stops callers whose role does
+// not grant permission.
+func requirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "missing permission " + permission})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// canPublish reports whether the caller may leave a chapter at visibility.
+// Anything but a draft is visible to readers and needs chapter.publish.
+func canPublish(c *gin.Context, visibility string) bool {
+	return visibility == visibilityDraft || hasPermission(c, permChapterPublish)
+}
+
+// canManageUser stops staff from acting on accounts whose role grants more
+// than their own, such as a moderator banning an admin.
+func canManageUser(c *gin.Context, repo Repository, target *AuthUser) bool {
+	return coversPermissions(c.GetStringSlice("permissions"), rolePermissions(repo, target.Role))
+}
+
+func respondRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errRoleName), errors.Is(err, errRolePermission), errors.Is(err, errRoleUnknown):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errRoleEscalation), errors.Is(err, errUserOutranks):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, errRoleExists), errors.Is(err, errRoleInUse), errors.Is(err, errRoleBuiltIn):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondNotFound(c, err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Snippets are produced with control-character markers around matches so the
+// surrounding text can be escaped before the markers become <mark> tags.
+const (
+	snippetStart = "\x01"
+	snippetStop  = "\x02"
+)
+
+var snippetHeadlineOptions = "StartSel=" + snippetStart + ", StopSel=" + snippetStop + ", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" … \""
+
+var imageMarkerPattern = regexp.MustCompile(`\[\[img:[^\]]*\]\]`)
+
+func searchIncludes(query SearchQuery, kind string) bool {
+	return query.Type == "" || query.Type == "all" || query.Type == kind
+}
+
+func renderSnippet(raw string) string {
+	clean := imageMarkerPattern.ReplaceAllString(raw, "")
+	escaped := html.EscapeString(strings.TrimSpace(clean))
+	escaped = strings.ReplaceAll(escaped, snippetStart, "<mark>")
+	return strings.ReplaceAll(escaped, snippetStop, "</mark>")
+}
+
+// searchTerms lowercases the query into plain words, dropping the operators
+// websearch_to_tsquery understands so the in-memory store sees the same terms.
+func searchTerms(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	terms := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field == "or" {
+			continue
+		}
+		terms = append(terms, field)
+	}
+	return terms
+}
+
+// termScore counts how often each term occurs in text and reports which terms
+// were seen at least once.
+func termScore(text string, terms []string, seen map[string]bool) int {
+	lower := strings.ToLower(text)
+	score := 0
+	for _, term := range terms {
+		count := strings.Count(lower, term)
+		if count > 0 {
+			seen[term] = true
+			score += count
+		}
+	}
+	return score
+}
+
+func naiveSnippet(text string, terms []string, maxWords int) string {
+	words := strings.Fields(imageMarkerPattern.ReplaceAllString(text, ""))
+	if len(words) == 0 {
+		return ""
+	}
+	isMatch := func(word string) bool {
+		lower := strings.ToLower(word)
+		for _, term := range terms {
+			if strings.Contains(lower, term) {
+				return true
+			}
+		}
+		return false
+	}
+	first := 0
+	for i, word := range words {
+		if isMatch(word) {
+			first = i
+			break
+		}
+	}
+	start := first - maxWords/3
+	if start < 0 {
+		start = 0
+	}
+	end := start + maxWords
+	if end > len(words) {
+		end = len(words)
+	}
+
+	parts := make([]string, 0, end-start)
+	for _, word := range words[start:end] {
+		if isMatch(word) {
+			word = snippetStart + word + snippetStop
+		}
+		parts = append(parts, word)
+	}
+	snippet := strings.Join(parts, " ")
+	if start > 0 {
+		snippet = "… " + snippet
+	}
+	if end < len(words) {
+		snippet += " …"
+	}
+	return snippet
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxSessionDevice    = 80
+	maxSessionUserAgent = 512
+
+	// sessionRetention is how long expired and revoked sessions are kept
+	// before the cleanup deletes them.
+	sessionRetention = 7 * 24 * time.Hour
+
+	sessionRevokedLogout   = "logout"
+	sessionRevokedUser     = "revoked"
+	sessionRevokedReuse    = "reuse"
+	sessionRevokedPassword = "password_reset"
+	sessionRevokedBanned   = "banned"
+)
+
+var (
+	errSessionInvalid = errors.New("session expired or revoked")
+	errSessionReused  = errors.New("refresh token was already used; the session has been revoked")
+)
+
+func newSessionInput(c *gin.Context, device string) SessionInput {
+	return SessionInput{
+		Device:    truncateRunes(device, maxSessionDevice),
+		IP:        c.ClientIP(),
+		UserAgent: truncateRunes(c.Request.UserAgent(), maxSessionUserAgent),
+	}
+}
+
+// newAuthResponse signs an access token for the session and pairs it with
+// the session's current refresh token.
+func newAuthResponse(repo Repository, cfg Config, user *AuthUser, sessionID int, refreshToken string) (AuthResponse, error) {
+	token, err := generateToken(user.ID, sessionID, user.Role, cfg.JWTSecret, cfg.JWTTTL)
+	if err != nil {
+		return AuthResponse{}, err
+	}
+	return AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(cfg.JWTTTL),
+		User:         toAuthUserInfo(user, rolePermissions(repo, user.Role)),
+	}, nil
+}
+
+// startSession opens a session for a user who just signed in. twoFactor
+// records that the sign-in passed a second-factor check.
+func startSession(c *gin.Context, repo Repository, cfg Config, user *AuthUser, device string, twoFactor bool) (AuthResponse, error) {
+	refreshToken, hash := newAuthToken()
+	input := newSessionInput(c, device)
+	input.TwoFactor = twoFactor
+	session, err := repo.CreateSession(user.ID, input, hash, time.Now().Add(cfg.RefreshTTL))
+	if err != nil {
+		return AuthResponse{}, err
+	}
+	return newAuthResponse(repo, cfg, user, session.ID, refreshToken)
+}
+
+func respondSessionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errSessionInvalid), errors.Is(err, errSessionReused):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		respondNotFound(c, err)
+	}
+}
+
+// runSessionCleanup deletes sessions that expired or were revoked more than
+// sessionRetention ago, every interval until ctx is cancelled.
+func runSessionCleanup(ctx context.Context, repo Repository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		removed, err := repo.PruneSessions(time.Now().Add(-sessionRetention))
+		if err != nil {
+			log.Printf("session cleanup: %v", err)
+		} else if removed > 0 {
+			log.Printf("session cleanup: removed %d sessions", removed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type storedToken struct {
+	sessionID int
+	replaced  bool
+	expiresAt time.Time
+}
+
+type storedSession struct {
+	userID        int
+	revokedReason string
+	expiresAt     time.Time
+}
+
+// sessionStore stands in for the sessions, session_tokens and auth_users
+// tables. It answers only the statements RotateSession runs, and a rollback
+// restores the state from the start of the transaction.
+type sessionStore struct {
+	mu       sync.Mutex
+	tokens   map[string]storedToken
+	sessions map[int]storedSession
+	users    map[int]string
+	inTx     bool
+	saved    struct {
+		tokens   map[string]storedToken
+		sessions map[int]storedSession
+	}
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{
+		tokens:   make(map[string]storedToken),
+		sessions: make(map[int]storedSession),
+		users:    make(map[int]string),
+	}
+}
+
+func (s *sessionStore) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inTx = true
+	s.saved.tokens, s.saved.sessions = maps.Clone(s.tokens), maps.Clone(s.sessions)
+}
+
+func (s *sessionStore) commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inTx = false
+}
+
+func (s *sessionStore) rollback() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inTx = false
+	s.tokens, s.sessions = s.saved.tokens, s.saved.sessions
+}
+
+func (s *sessionStore) run(query string, args []driver.Value) ([][]driver.Value, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	switch {
+	case strings.HasPrefix(query, "SELECT session_id, replaced_at, expires_at FROM session_tokens"):
+		token, ok := s.tokens[args[0].(string)]
+		if !ok {
+			return nil, 0, nil
+		}
+		var replacedAt driver.Value
+		if token.replaced {
+			replacedAt = now
+		}
+		return [][]driver.Value{{int64(token.sessionID), replacedAt, token.expiresAt}}, 0, nil
+	case strings.HasPrefix(query, "UPDATE sessions SET revoked_at"):
+		id := int(args[0].(int64))
+		session, ok := s.sessions[id]
+		if !ok || session.revokedReason != "" {
+			return nil, 0, nil
+		}
+		session.revokedReason = args[1].(string)
+		s.sessions[id] = session
+		return nil, 1, nil
+	case strings.HasPrefix(query, "SELECT user_id FROM sessions"):
+		session, ok := s.sessions[int(args[0].(int64))]
+		if !ok || session.revokedReason != "" || !session.expiresAt.After(now) {
+			return nil, 0, nil
+		}
+		return [][]driver.Value{{int64(session.userID)}}, 0, nil
+	case strings.HasPrefix(query, "SELECT "+authUserColumns+" FROM auth_users"):
+		id := args[0].(int64)
+		status, ok := s.users[int(id)]
+		if !ok || status == "banned" {
+			return nil, 0, nil
+		}
+		return [][]driver.Value{{id, "Reader", "reader@example.com", "", roleUser, status, now, nil, nil}}, 0, nil
+	case strings.HasPrefix(query, "UPDATE session_tokens SET replaced_at"):
+		token := s.tokens[args[0].(string)]
+		token.replaced = true
+		s.tokens[args[0].(string)] = token
+		return nil, 1, nil
+	case strings.HasPrefix(query, "DELETE FROM session_tokens WHERE session_id"):
+		removed := int64(0)
+		for hash, token := range s.tokens {
+			if token.sessionID == int(args[0].(int64)) && token.replaced && !token.expiresAt.After(now) {
+				delete(s.tokens, hash)
+				removed++
+			}
+		}
+		return nil, removed, nil
+	case strings.HasPrefix(query, "INSERT INTO session_tokens"):
+		s.tokens[args[0].(string)] = storedToken{sessionID: int(args[1].(int64)), expiresAt: args[2].(time.Time)}
+		return nil, 1, nil
+	case strings.HasPrefix(query, "UPDATE sessions s SET last_used_at"):
+		id := int(args[0].(int64))
+		session := s.sessions[id]
+		session.expiresAt = args[3].(time.Time)
+		s.sessions[id] = session
+		return [][]driver.Value{{int64(id), "", args[1], args[2], now, now, session.expiresAt, nil}}, 1, nil
+	}
+	return nil, 0, fmt.Errorf("unexpected statement: %s", query)
+}
+
+func TestRotateSession(t *testing.T) {
+	live := time.Now().Add(time.Hour)
+	tests := []struct {
+		name        string
+		present     string
+		setup       func(s *sessionStore)
+		wantErr     error
+		wantRevoked string
+		wantTokens  map[string]bool
+	}{
+		{
+			name:       "current token",
+			present:    "first",
+			setup:      func(s *sessionStore) {},
+			wantTokens: map[string]bool{"first": true, "next": false},
+		},
+		{
+			name:    "already exchanged token",
+			present: "first",
+			setup: func(s *sessionStore) {
+				s.tokens["first"] = storedToken{sessionID: 1, replaced: true, expiresAt: live}
+				s.tokens["second"] = storedToken{sessionID: 1, expiresAt: live}
+			},
+			wantErr:     errSessionReused,
+			wantRevoked: sessionRevokedReuse,
+			wantTokens:  map[string]bool{"first": true, "second": false},
+		},
+		{
+			name:       "unknown token",
+			present:    "forged",
+			setup:      func(s *sessionStore) {},
+			wantErr:    errSessionInvalid,
+			wantTokens: map[string]bool{"first": false},
+		},
+		{
+			name:    "expired token",
+			present: "first",
+			setup: func(s *sessionStore) {
+				s.tokens["first"] = storedToken{sessionID: 1, expiresAt: time.Now().Add(-time.Minute)}
+			},
+			wantErr:    errSessionInvalid,
+			wantTokens: map[string]bool{"first": false},
+		},
+		{
+			name:    "revoked session",
+			present: "first",
+			setup: func(s *sessionStore) {
+				s.sessions[1] = storedSession{userID: 1, revokedReason: sessionRevokedLogout, expiresAt: live}
+			},
+			wantErr:     errSessionInvalid,
+			wantRevoked: sessionRevokedLogout,
+			wantTokens:  map[string]bool{"first": false},
+		},
+		{
+			name:       "banned user",
+			present:    "first",
+			setup:      func(s *sessionStore) { s.users[1] = "banned" },
+			wantErr:    errSessionInvalid,
+			wantTokens: map[string]bool{"first": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newSessionStore()
+			store.users[1] = "active"
+			store.sessions[1] = storedSession{userID: 1, expiresAt: live}
+			store.tokens["first"] = storedToken{sessionID: 1, expiresAt: live}
+			tt.setup(store)
+			repo := NewAppRepository(nil, openFakeDB(store))
+
+			session, user, err := repo.RotateSession(tt.present, "next", SessionInput{IP: "203.0.113.9"}, live.Add(time.Hour))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RotateSession error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (session.ID != 1 || user.ID != 1 || session.IP != "203.0.113.9") {
+				t.Errorf("RotateSession = session %+v, user %+v", session, user)
+			}
+			if store.inTx {
+				t.Error("transaction left open")
+			}
+			if reason := store.sessions[1].revokedReason; reason != tt.wantRevoked {
+				t.Errorf("revoked reason = %q, want %q", reason, tt.wantRevoked)
+			}
+			if _, ok := store.tokens["next"]; ok != (tt.wantErr == nil) {
+				t.Errorf("next token stored = %t, want %t", ok, tt.wantErr == nil)
+			}
+			for hash, replaced := range tt.wantTokens {
+				if token, ok := store.tokens[hash]; ok && token.replaced != replaced {
+					t.Errorf("token %q replaced = %t, want %t", hash, token.replaced, replaced)
+				}
+			}
+		})
+	}
+}
+
+// Replaying an exchanged refresh token revokes the session, so the token
+// that replaced it stops working too.
+func TestRotateSessionReuseRevokesSession(t *testing.T) {
+	live := time.Now().Add(time.Hour)
+	store := newSessionStore()
+	store.users[1] = "active"
+	store.sessions[1] = storedSession{userID: 1, expiresAt: live}
+	store.tokens["first"] = storedToken{sessionID: 1, expiresAt: live}
+	repo := NewAppRepository(nil, openFakeDB(store))
+
+	steps := []struct {
+		present string
+		next    string
+		want    error
+	}{
+		{"first", "second", nil},
+		{"second", "third", nil},
+		{"first", "stolen", errSessionReused},
+		{"third", "fourth", errSessionInvalid},
+		{"first", "again", errSessionReused},
+	}
+	for i, step := range steps {
+		if _, _, err := repo.RotateSession(step.present, step.next, SessionInput{}, live); !errors.Is(err, step.want) {
+			t.Fatalf("step %d: presenting %q = %v, want %v", i+1, step.present, err, step.want)
+		}
+	}
+	if reason := store.sessions[1].revokedReason; reason != sessionRevokedReuse {
+		t.Errorf("revoked reason = %q, want %q", reason, sessionRevokedReuse)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"math"
 	"sort"
 	"strings"
 	"sync"
@@ -35,6 +36,9 @@ type Store struct {
 	settings           *SiteSettings
 	announcements      map[int]*Announcement
 	nextAnnouncementID int
+	revisions          map[int][]*ChapterRevision
+	nextRevisionID     int
+	progress           map[[2]int]*ReadingProgress
 }
 
 func NewStore() *Store {
@@ -60,6 +64,9 @@ func NewStore() *Store {
 		bookmarks:          make(map[int]*Bookmark),
 		announcements:      make(map[int]*Announcement),
 		nextAnnouncementID: 1,
+		revisions:          make(map[int][]*ChapterRevision),
+		nextRevisionID:     1,
+		progress:           make(map[[2]int]*ReadingProgress),
 	}
 	s.seed()
 	return s
@@ -193,36 +200,201 @@ func (s *Store) DeleteAuthUser(id int) error {
 	return nil
 }
 
-func (s *Store) ListReadingHistory(userID int) []*ReadingHistory {
+func (s *Store) ListReadingHistory(userID int, includeHidden bool) ([]*ReadingHistory, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	items := make([]*ReadingHistory, 0)
+	for _, entry := range s.userHistory(userID) {
+		novel, okNovel := s.novels[entry.NovelID]
+		chapter, okChapter := s.chapters[entry.ChapterID]
+		if okNovel && okChapter && chapterViewable(novel, chapter, includeHidden) {
+			items = append(items, entry)
+		}
+	}
+	return items, nil
+}
+
+// userHistory lists userID's entries newest first. Callers hold s.mu.
+func (s *Store) userHistory(userID int) []*ReadingHistory {
 	items := make([]*ReadingHistory, 0)
 	for _, entry := range s.history {
 		if entry.UserID == userID {
 			items = append(items, entry)
 		}
 	}
-	sort.Slice(items, func(i, j int) bool { return items[i].ReadAt.After(items[j].ReadAt) })
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ReadAt.Equal(items[j].ReadAt) {
+			return items[i].ID > items[j].ID
+		}
+		return items[i].ReadAt.After(items[j].ReadAt)
+	})
 	return items
 }
 
 func (s *Store) AddReadingHistory(userID int, input ReadingHistoryInput) (*ReadingHistory, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	chapter, ok := s.chapters[input.ChapterID]
+	if !ok {
+		return nil, errNotFound
+	}
+	novel, ok := s.novels[chapter.NovelID]
+	if !ok {
+		return nil, errNotFound
+	}
+	if history := s.userHistory(userID); len(history) > 0 && history[0].ChapterID == chapter.ID {
+		history[0].ReadAt = time.Now()
+		return history[0], nil
+	}
 	entry := &ReadingHistory{
-		ID:           s.nextHistoryID,
-		UserID:       userID,
-		NovelSlug:    strings.TrimSpace(input.NovelSlug),
-		NovelTitle:   strings.TrimSpace(input.NovelTitle),
-		ChapterID:    input.ChapterID,
-		ChapterTitle: strings.TrimSpace(input.ChapterTitle),
-		ReadAt:       time.Now(),
+		ID:            s.nextHistoryID,
+		UserID:        userID,
+		NovelID:       novel.ID,
+		NovelSlug:     novel.Slug,
+		NovelTitle:    novel.Title,
+		ChapterID:     chapter.ID,
+		ChapterVolume: chapter.Volume,
+		ChapterNumber: chapter.Number,
+		ChapterTitle:  chapter.Title,
+		ReadAt:        time.Now(),
 	}
 	s.history[entry.ID] = entry
 	s.nextHistoryID++
 	return entry, nil
 }
 
+func (s *Store) DeleteReadingHistoryEntry(userID int, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.history[id]
+	if !ok || entry.UserID != userID {
+		return errNotFound
+	}
+	delete(s.history, id)
+	return nil
+}
+
+func (s *Store) DeleteNovelHistory(userID int, novelID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for id, entry := range s.history {
+		if entry.UserID == userID && entry.NovelID == novelID {
+			delete(s.history, id)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (s *Store) PruneReadingHistory(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed int64
+	for id, entry := range s.history {
+		if entry.ReadAt.Before(before) {
+			delete(s.history, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (s *Store) GetReadingProgress(userID int, novelID int) (*ReadingProgress, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	progress, ok := s.progress[[2]int{userID, novelID}]
+	if !ok {
+		return nil, errNotFound
+	}
+	return progress, nil
+}
+
+func (s *Store) SaveReadingProgress(userID int, novelID int, input ReadingProgressInput) (*ReadingProgress, error) {
+	now := time.Now()
+	input, err := normalizeProgress(input, now)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chapter, ok := s.chapters[input.ChapterID]
+	if !ok {
+		return nil, errNotFound
+	}
+	if chapter.NovelID != novelID {
+		return nil, errProgressChapter
+	}
+	key := [2]int{userID, novelID}
+	if current, ok := s.progress[key]; ok && current.ReadAt.After(*input.ReadAt) {
+		return current, errProgressStale
+	}
+	progress := &ReadingProgress{
+		UserID:         userID,
+		NovelID:        novelID,
+		ChapterID:      input.ChapterID,
+		ScrollPercent:  input.ScrollPercent,
+		ParagraphIndex: input.ParagraphIndex,
+		Device:         input.Device,
+		ReadAt:         *input.ReadAt,
+		UpdatedAt:      now,
+	}
+	s.progress[key] = progress
+	return progress, nil
+}
+
+func (s *Store) DeleteReadingProgress(userID int, novelID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]int{userID, novelID}
+	if _, ok := s.progress[key]; !ok {
+		return errNotFound
+	}
+	delete(s.progress, key)
+	return nil
+}
+
+func (s *Store) ListContinueReading(userID int, limit int) ([]*ContinueReading, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make([]*ContinueReading, 0)
+	for key, progress := range s.progress {
+		novel, okNovel := s.novels[key[1]]
+		chapter, okChapter := s.chapters[progress.ChapterID]
+		if key[0] != userID || !okNovel || !okChapter || !isViewable(novel.Visibility) {
+			continue
+		}
+		item := &ContinueReading{
+			ReadingProgress: *progress,
+			NovelSlug:       novel.Slug,
+			NovelTitle:      novel.Title,
+			CoverURL:        novel.CoverURL,
+			ChapterVolume:   chapter.Volume,
+			ChapterNumber:   chapter.Number,
+			ChapterTitle:    chapter.Title,
+		}
+		for _, other := range s.chapters {
+			if other.NovelID == novel.ID && isListed(other.Visibility) && other.Number > chapter.Number {
+				item.UnreadChapters++
+			}
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ReadAt.Equal(items[j].ReadAt) {
+			return items[i].NovelID < items[j].NovelID
+		}
+		return items[i].ReadAt.After(items[j].ReadAt)
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
 func (s *Store) ClearReadingHistory(userID int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -260,6 +432,7 @@ func (s *Store) AddFollow(userID int, novelID int) (*Follow, error) {
 		ID:        s.nextFollowID,
 		UserID:    userID,
 		NovelID:   novelID,
+		Notify:    true,
 		CreatedAt: time.Now(),
 	}
 	s.follows[entry.ID] = entry
@@ -463,20 +636,25 @@ func (s *Store) CreateNovel(input NovelInput) (*Novel, error) {
 	defer s.mu.Unlock()
 	now := time.Now()
 	novel := &Novel{
-		ID:        s.nextNovelID,
-		Slug:      strings.TrimSpace(input.Slug),
-		Title:     strings.TrimSpace(input.Title),
-		Author:    strings.TrimSpace(input.Author),
-		Summary:   strings.TrimSpace(input.Summary),
-		Tags:      input.Tags,
-		CoverURL:  strings.TrimSpace(input.CoverURL),
-		Status:    strings.TrimSpace(input.Status),
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:         s.nextNovelID,
+		Slug:       strings.TrimSpace(input.Slug),
+		Title:      strings.TrimSpace(input.Title),
+		Author:     strings.TrimSpace(input.Author),
+		Summary:    strings.TrimSpace(input.Summary),
+		Tags:       input.Tags,
+		CoverURL:   strings.TrimSpace(input.CoverURL),
+		Status:     strings.TrimSpace(input.Status),
+		Visibility: input.Visibility,
+		CreatedAt:  now,
+		UpdatedAt:  now,
 	}
 	if novel.Slug == "" {
 		novel.Slug = slugify(novel.Title)
 	}
+	if novel.Visibility == "" {
+		novel.Visibility = visibilityPublished
+	}
+	novel.PublishedAt = firstPublishedAt(novel.Visibility, nil, now)
 	s.novels[novel.ID] = novel
 	s.nextNovelID++
 	return novel, nil
@@ -498,7 +676,11 @@ func (s *Store) UpdateNovel(id int, input NovelInput) (*Novel, error) {
 	if input.Slug != "" {
 		novel.Slug = strings.TrimSpace(input.Slug)
 	}
+	if input.Visibility != "" {
+		novel.Visibility = input.Visibility
+	}
 	novel.UpdatedAt = time.Now()
+	novel.PublishedAt = firstPublishedAt(novel.Visibility, novel.PublishedAt, novel.UpdatedAt)
 	return novel, nil
 }
 
@@ -512,6 +694,7 @@ func (s *Store) DeleteNovel(id int) error {
 	for chapterID, chapter := range s.chapters {
 		if chapter.NovelID == id {
 			delete(s.chapters, chapterID)
+			delete(s.revisions, chapterID)
 			for commentID, comment := range s.comments {
 				if comment.ChapterID == chapterID {
 					delete(s.comments, commentID)
@@ -543,6 +726,28 @@ func (s *Store) ListChaptersByNovel(novelID int) ([]*Chapter, error) {
 	return items, nil
 }
 
+func (s *Store) ListLatestChapters(limit int) ([]*Chapter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make([]*Chapter, 0, len(s.chapters))
+	for _, chapter := range s.chapters {
+		novel, ok := s.novels[chapter.NovelID]
+		if ok && isListed(novel.Visibility) && isListed(chapter.Visibility) {
+			items = append(items, chapter)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].ID > items[j].ID
+		}
+		return items[i].CreatedAt.After(items[j].CreatedAt)
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
 func (s *Store) GetChapter(id int) (*Chapter, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -559,48 +764,231 @@ func (s *Store) CreateChapter(novelID int, input ChapterInput) (*Chapter, error)
 	if _, ok := s.novels[novelID]; !ok {
 		return nil, errNotFound
 	}
+	return s.insertChapter(novelID, input), nil
+}
+
+func (s *Store) CreateChapters(novelID int, inputs []ChapterInput) ([]*Chapter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.novels[novelID]; !ok {
+		return nil, errNotFound
+	}
+	chapters := make([]*Chapter, 0, len(inputs))
+	for _, input := range inputs {
+		chapters = append(chapters, s.insertChapter(novelID, input))
+	}
+	return chapters, nil
+}
+
+// insertChapter expects s.mu to be held for writing.
+func (s *Store) insertChapter(novelID int, input ChapterInput) *Chapter {
 	now := time.Now()
 	volume := input.Volume
 	if volume < 1 {
 		volume = 1
 	}
 	chapter := &Chapter{
-		ID:        s.nextChapterID,
-		NovelID:   novelID,
-		Number:    input.Number,
-		Volume:    volume,
-		Title:     strings.TrimSpace(input.Title),
-		Content:   strings.TrimSpace(input.Content),
-		WordCount: len(strings.Fields(input.Content)),
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:         s.nextChapterID,
+		NovelID:    novelID,
+		Number:     input.Number,
+		Volume:     volume,
+		Title:      strings.TrimSpace(input.Title),
+		Content:    strings.TrimSpace(input.Content),
+		WordCount:  len(strings.Fields(input.Content)),
+		Visibility: input.Visibility,
+		CreatedAt:  now,
+		UpdatedAt:  now,
 	}
+	if chapter.Visibility == "" {
+		chapter.Visibility = visibilityPublished
+	}
+	chapter.PublishedAt = firstPublishedAt(chapter.Visibility, nil, now)
 	s.chapters[chapter.ID] = chapter
 	s.nextChapterID++
+	s.addRevision(chapter, input.EditorID, nil)
+	return chapter
+}
+
+// addRevision expects s.mu to be held for writing.
+func (s *Store) addRevision(chapter *Chapter, editorID int, restoredFrom *int) {
+	revision := &ChapterRevision{
+		ID:           s.nextRevisionID,
+		ChapterID:    chapter.ID,
+		Revision:     len(s.revisions[chapter.ID]) + 1,
+		Title:        chapter.Title,
+		Content:      chapter.Content,
+		WordCount:    chapter.WordCount,
+		RestoredFrom: restoredFrom,
+		CreatedAt:    chapter.UpdatedAt,
+	}
+	if editorID > 0 {
+		revision.EditorID = &editorID
+	}
+	s.revisions[chapter.ID] = append(s.revisions[chapter.ID], revision)
+	s.nextRevisionID++
+}
+
+// reanchorComments expects s.mu to be held for writing.
+func (s *Store) reanchorComments(chapterID int, previousContent, content string) {
+	if previousContent == content {
+		return
+	}
+	anchors := make([]commentAnchor, 0)
+	for _, comment := range s.comments {
+		if comment.ChapterID == chapterID && comment.ParagraphIndex != nil {
+			anchors = append(anchors, commentAnchor{
+				CommentID: comment.ID,
+				Index:     *comment.ParagraphIndex,
+				Hash:      comment.ParagraphHash,
+				Orphaned:  comment.Orphaned,
+			})
+		}
+	}
+	for _, anchor := range reanchorComments(previousContent, content, anchors) {
+		comment := s.comments[anchor.CommentID]
+		index := anchor.Index
+		comment.ParagraphIndex = &index
+		comment.ParagraphHash = anchor.Hash
+		comment.Orphaned = anchor.Orphaned
+	}
+}
+
+func (s *Store) ListParagraphCommentCounts(chapterID int) ([]*ParagraphCommentCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.chapters[chapterID]; !ok {
+		return nil, errNotFound
+	}
+	counts := make(map[int]int)
+	for _, comment := range s.comments {
+		if comment.ChapterID == chapterID && comment.ParagraphIndex != nil && !comment.Orphaned && !comment.Deleted {
+			counts[*comment.ParagraphIndex]++
+		}
+	}
+	items := make([]*ParagraphCommentCount, 0, len(counts))
+	for index, count := range counts {
+		items = append(items, &ParagraphCommentCount{ParagraphIndex: index, Count: count})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ParagraphIndex < items[j].ParagraphIndex })
+	return items, nil
+}
+
+func (s *Store) ListChapterRevisions(chapterID int) ([]*ChapterRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.chapters[chapterID]; !ok {
+		return nil, errNotFound
+	}
+	revisions := s.revisions[chapterID]
+	items := make([]*ChapterRevision, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		item := *revisions[i]
+		item.Content = ""
+		items = append(items, &item)
+	}
+	return items, nil
+}
+
+func (s *Store) GetChapterRevision(chapterID int, revision int) (*ChapterRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revisions := s.revisions[chapterID]
+	if revision < 1 || revision > len(revisions) {
+		return nil, errNotFound
+	}
+	return revisions[revision-1], nil
+}
+
+func (s *Store) RestoreChapterRevision(chapterID int, revision int, editorID int) (*Chapter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chapter, ok := s.chapters[chapterID]
+	revisions := s.revisions[chapterID]
+	if !ok || revision < 1 || revision > len(revisions) {
+		return nil, errNotFound
+	}
+	source := revisions[revision-1]
+	s.reanchorComments(chapter.ID, chapter.Content, source.Content)
+	chapter.Title = source.Title
+	chapter.Content = source.Content
+	chapter.WordCount = source.WordCount
+	chapter.UpdatedAt = time.Now()
+	s.addRevision(chapter, editorID, &source.Revision)
 	return chapter, nil
 }
 
-func (s *Store) ListNovelChapterStats() []*NovelChapterStat {
+func (s *Store) ListNovelStats(includeHidden bool) ([]*NovelStats, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	statsByNovel := make(map[int]*NovelChapterStat)
+	items := make([]*NovelStats, 0, len(s.novels))
+	for _, novel := range s.novels {
+		if includeHidden || isListed(novel.Visibility) {
+			items = append(items, s.novelStats(novel))
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].NovelID < items[j].NovelID })
+	return items, nil
+}
+
+func (s *Store) GetNovelStats(novelID int) (*NovelStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	novel, ok := s.novels[novelID]
+	if !ok {
+		return nil, errNotFound
+	}
+	return s.novelStats(novel), nil
+}
+
+// novelStats computes on read what Postgres keeps in novel_stats.
+func (s *Store) novelStats(novel *Novel) *NovelStats {
+	stats := &NovelStats{NovelID: novel.ID, VolumeChapters: make(map[int]int), LastUpdatedAt: novel.UpdatedAt}
 	for _, chapter := range s.chapters {
-		stat, ok := statsByNovel[chapter.NovelID]
-		if !ok {
-			stat = &NovelChapterStat{NovelID: chapter.NovelID}
-			statsByNovel[chapter.NovelID] = stat
+		if chapter.NovelID != novel.ID || !isListed(chapter.Visibility) {
+			continue
+		}
+		stats.ChapterCount++
+		stats.WordCount += chapter.WordCount
+		stats.VolumeChapters[chapter.Volume]++
+		if stats.LatestChapterID == 0 || chapter.Number > stats.LatestChapterNumber ||
+			(chapter.Number == stats.LatestChapterNumber && chapter.ID > stats.LatestChapterID) {
+			stats.LatestChapterID, stats.LatestChapterNumber = chapter.ID, chapter.Number
+		}
+		if chapter.PublishedAt != nil && (stats.LatestPublishedAt == nil || chapter.PublishedAt.After(*stats.LatestPublishedAt)) {
+			stats.LatestPublishedAt = chapter.PublishedAt
 		}
-		stat.ChapterCount++
-		if chapter.ID > stat.LatestChapterID {
-			stat.LatestChapterID = chapter.ID
+		if chapter.UpdatedAt.After(stats.LastUpdatedAt) {
+			stats.LastUpdatedAt = chapter.UpdatedAt
 		}
 	}
-	items := make([]*NovelChapterStat, 0, len(statsByNovel))
-	for _, stat := range statsByNovel {
-		items = append(items, stat)
+	for _, follow := range s.follows {
+		if follow.NovelID == novel.ID {
+			stats.FollowerCount++
+		}
 	}
-	sort.Slice(items, func(i, j int) bool { return items[i].NovelID < items[j].NovelID })
-	return items
+	for _, bookmark := range s.bookmarks {
+		if bookmark.NovelID == novel.ID {
+			stats.BookmarkCount++
+		}
+	}
+	total := 0
+	for _, rating := range s.ratings {
+		if rating.NovelID == novel.ID {
+			stats.RatingCount++
+			total += rating.Score
+		}
+	}
+	if stats.RatingCount > 0 {
+		stats.AverageRating = math.Round(float64(total)/float64(stats.RatingCount)*100) / 100
+	}
+	readers := make(map[int]bool)
+	for _, entry := range s.history {
+		if chapter, ok := s.chapters[entry.ChapterID]; ok && chapter.NovelID == novel.ID {
+			readers[entry.UserID] = true
+		}
+	}
+	stats.ReaderCount = len(readers)
+	return stats
 }
 
 func (s *Store) UpdateChapter(id int, input ChapterInput) (*Chapter, error) {
@@ -610,6 +998,7 @@ func (s *Store) UpdateChapter(id int, input ChapterInput) (*Chapter, error) {
 	if !ok {
 		return nil, errNotFound
 	}
+	previousContent := chapter.Content
 	chapter.Number = input.Number
 	if input.Volume >= 1 {
 		chapter.Volume = input.Volume
@@ -617,7 +1006,13 @@ func (s *Store) UpdateChapter(id int, input ChapterInput) (*Chapter, error) {
 	chapter.Title = strings.TrimSpace(input.Title)
 	chapter.Content = strings.TrimSpace(input.Content)
 	chapter.WordCount = len(strings.Fields(input.Content))
+	if input.Visibility != "" {
+		chapter.Visibility = input.Visibility
+	}
 	chapter.UpdatedAt = time.Now()
+	chapter.PublishedAt = firstPublishedAt(chapter.Visibility, chapter.PublishedAt, chapter.UpdatedAt)
+	s.reanchorComments(chapter.ID, previousContent, chapter.Content)
+	s.addRevision(chapter, input.EditorID, nil)
 	return chapter, nil
 }
 
@@ -628,6 +1023,7 @@ func (s *Store) DeleteChapter(id int) error {
 		return errNotFound
 	}
 	delete(s.chapters, id)
+	delete(s.revisions, id)
 	for commentID, comment := range s.comments {
 		if comment.ChapterID == id {
 			delete(s.comments, commentID)
@@ -664,6 +1060,32 @@ func (s *Store) CreateComment(chapterID int, input CommentInput) (*Comment, erro
 		UserID:    input.UserID,
 		Body:      strings.TrimSpace(input.Body),
 		CreatedAt: time.Now(),
+		Reactions: make([]CommentReaction, 0),
+	}
+	if input.ParentID > 0 {
+		parent, ok := s.comments[input.ParentID]
+		if !ok {
+			return nil, errNotFound
+		}
+		depth, err := replyDepth(parent, chapterID)
+		if err != nil {
+			return nil, err
+		}
+		comment.ParentID = &parent.ID
+		comment.Depth = depth
+		comment.ParagraphIndex = parent.ParagraphIndex
+		comment.ParagraphHash = parent.ParagraphHash
+	} else if input.ParagraphIndex != nil {
+		hash, err := anchorParagraph(s.chapters[chapterID].Content, *input.ParagraphIndex)
+		if err != nil {
+			return nil, err
+		}
+		index := *input.ParagraphIndex
+		comment.ParagraphIndex = &index
+		comment.ParagraphHash = hash
+	}
+	if user, ok := s.users[input.UserID]; ok {
+		comment.AuthorName = user.Name
 	}
 	s.comments[comment.ID] = comment
 	s.nextCommentID++
@@ -692,19 +1114,52 @@ func (s *Store) CreateRating(novelID int, input RatingInput) (*Rating, error) {
 	if _, ok := s.novels[novelID]; !ok {
 		return nil, errNotFound
 	}
-	rating := &Rating{
-		ID:      s.nextRatingID,
-		NovelID: novelID,
-		UserID:  input.UserID,
-		Score:   input.Score,
-		Note:    strings.TrimSpace(input.Note),
-		At:      time.Now(),
+	var rating *Rating
+	for _, existing := range s.ratings {
+		if existing.NovelID == novelID && existing.UserID == input.UserID {
+			rating = existing
+		}
+	}
+	if rating == nil {
+		rating = &Rating{ID: s.nextRatingID, NovelID: novelID, UserID: input.UserID}
+		s.ratings[rating.ID] = rating
+		s.nextRatingID++
+	}
+	rating.Score = input.Score
+	rating.Note = strings.TrimSpace(input.Note)
+	rating.At = time.Now()
+	if input.Title != nil {
+		rating.Title = strings.TrimSpace(*input.Title)
+	}
+	if input.Body != nil {
+		rating.Body = strings.TrimSpace(*input.Body)
+	}
+	if input.Spoiler != nil {
+		rating.Spoiler = *input.Spoiler
 	}
-	s.ratings[rating.ID] = rating
-	s.nextRatingID++
 	return rating, nil
 }
 
+func (s *Store) GetRatingSummary(novelID int) (*RatingSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.novels[novelID]; !ok {
+		return nil, errNotFound
+	}
+	scores := make(map[int]int)
+	reviews := 0
+	for _, rating := range s.ratings {
+		if rating.NovelID != novelID {
+			continue
+		}
+		scores[rating.Score]++
+		if rating.Body != "" {
+			reviews++
+		}
+	}
+	return newRatingSummary(novelID, scores, reviews), nil
+}
+
 func (s *Store) ListUsers() []*User {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -734,3 +1189,104 @@ func (s *Store) CreateUser(name, role string) (*User, error) {
 	s.nextUserID++
 	return user, nil
 }
+
+func (s *Store) Search(query SearchQuery) (*SearchResults, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results := &SearchResults{
+		Query:    query.Text,
+		Novels:   make([]*NovelSearchHit, 0),
+		Chapters: make([]*ChapterSearchHit, 0),
+	}
+	terms := searchTerms(query.Text)
+	if len(terms) == 0 {
+		return results, nil
+	}
+	novelMatches := func(novel *Novel) bool {
+		if query.NovelID > 0 && novel.ID != query.NovelID {
+			return false
+		}
+		if !query.IncludeHidden && !isListed(novel.Visibility) {
+			return false
+		}
+		if query.Status != "" && !strings.EqualFold(novel.Status, query.Status) {
+			return false
+		}
+		if query.Tag != "" {
+			for _, tag := range novel.Tags {
+				if tag == query.Tag {
+					return true
+				}
+			}
+			return false
+		}
+		return true
+	}
+
+	if searchIncludes(query, "novels") {
+		hits := make([]*NovelSearchHit, 0)
+		for _, novel := range s.novels {
+			if !novelMatches(novel) {
+				continue
+			}
+			seen := make(map[string]bool)
+			score := 4*termScore(novel.Title, terms, seen) +
+				2*termScore(novel.Author, terms, seen) +
+				2*termScore(strings.Join(novel.Tags, " "), terms, seen) +
+				termScore(novel.Summary, terms, seen)
+			if len(seen) < len(terms) {
+				continue
+			}
+			hits = append(hits, &NovelSearchHit{
+				Novel:   novel,
+				Rank:    float64(score),
+				Snippet: renderSnippet(naiveSnippet(novel.Summary, terms, 35)),
+			})
+		}
+		sort.Slice(hits, func(i, j int) bool {
+			if hits[i].Rank != hits[j].Rank {
+				return hits[i].Rank > hits[j].Rank
+			}
+			return hits[i].Novel.ID > hits[j].Novel.ID
+		})
+		results.NovelTotal = len(hits)
+		start, end := sliceRange(len(hits), query.Limit, query.Offset)
+		results.Novels = hits[start:end]
+	}
+
+	if searchIncludes(query, "chapters") {
+		hits := make([]*ChapterSearchHit, 0)
+		for _, chapter := range s.chapters {
+			novel, ok := s.novels[chapter.NovelID]
+			if !ok || !novelMatches(novel) || (!query.IncludeHidden && !isListed(chapter.Visibility)) {
+				continue
+			}
+			seen := make(map[string]bool)
+			score := 4*termScore(chapter.Title, terms, seen) + termScore(chapter.Content, terms, seen)
+			if len(seen) < len(terms) {
+				continue
+			}
+			hits = append(hits, &ChapterSearchHit{
+				ChapterID:  chapter.ID,
+				NovelID:    novel.ID,
+				NovelSlug:  novel.Slug,
+				NovelTitle: novel.Title,
+				Number:     chapter.Number,
+				Volume:     chapter.Volume,
+				Title:      chapter.Title,
+				Rank:       float64(score),
+				Snippet:    renderSnippet(naiveSnippet(chapter.Content, terms, 35)),
+			})
+		}
+		sort.Slice(hits, func(i, j int) bool {
+			if hits[i].Rank != hits[j].Rank {
+				return hits[i].Rank > hits[j].Rank
+			}
+			return hits[i].ChapterID > hits[j].ChapterID
+		})
+		results.ChapterTotal = len(hits)
+		start, end := sliceRange(len(hits), query.Limit, query.Offset)
+		results.Chapters = hits[start:end]
+	}
+	return results, nil
+}
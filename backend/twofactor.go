@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+
+	recoveryCodeCount = 10
+	// twoFactorChallengeTTL is how long a sign-in waits for the second factor.
+	twoFactorChallengeTTL = 5 * time.Minute
+	// After maxTwoFactorFailures wrong codes in a row the account stops
+	// accepting codes for twoFactorLockout.
+	maxTwoFactorFailures = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+var (
+	errTwoFactorCode      = errors.New("invalid two-factor code")
+	errTwoFactorLocked    = errors.New("too many wrong codes, try again in 15 minutes")
+	errTwoFactorOff       = errors.New("two-factor authentication is not enabled")
+	errTwoFactorOn        = errors.New("two-factor authentication is already enabled")
+	errTwoFactorSetup     = errors.New("start two-factor setup first")
+	errTwoFactorChallenge = errors.New("sign-in expired, start again")
+	errTwoFactorRequired  = errors.New("staff accounts must enable two-factor authentication")
+	errTwoFactorSession   = errors.New("sign in again with your two-factor code")
+	errStepUpRequired     = errors.New("confirm with your two-factor code to manage users")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newTOTPSecret() []byte {
+	secret := make([]byte, 20)
+	rand.Read(secret)
+	return secret
+}
+
+// totpCode is the RFC 6238 code for a time step: HMAC-SHA1, six digits.
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+// matchTOTP returns the time step code belongs to, allowing one step of
+// clock drift either way.
+func matchTOTP(secret []byte, code string, now time.Time) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for _, step := range []int64{current, current - 1, current + 1} {
+		if hmac.Equal([]byte(totpCode(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI is the otpauth:// URI authenticator apps read from a QR code.
+func totpURI(issuer string, account string, secret []byte) string {
+	query := url.Values{
+		"secret":    {totpEncoding.EncodeToString(secret)},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	// Some authenticator apps show a "+" literally, so spaces are sent as %20.
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+func twoFactorCipher(key string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealTOTPSecret encrypts a secret for storage with AES-GCM.
+func sealTOTPSecret(key string, secret []byte) (string, error) {
+	aead, err := twoFactorCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return base64.RawStdEncoding.EncodeToString(aead.Seal(nonce, nonce, secret, nil)), nil
+}
+
+func openTOTPSecret(key string, sealed string) ([]byte, error) {
+	aead, err := twoFactorCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return nil, errors.New("stored two-factor secret is corrupt")
+	}
+	secret, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("stored two-factor secret cannot be decrypted; was TWO_FACTOR_KEY changed?")
+	}
+	return secret, nil
+}
+
+// newRecoveryCodes returns codes to show once, formatted as xxxx-xxxx-xxxx-xxxx,
+// and the hashes to store.
+func newRecoveryCodes() ([]string, []string) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		random := make([]byte, 10)
+		rand.Read(random)
+		raw := strings.ToLower(totpEncoding.EncodeToString(random))
+		codes = append(codes, raw[0:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:16])
+		hashes = append(hashes, hashAuthToken(raw))
+	}
+	return codes, hashes
+}
+
+// normalizeTwoFactorCode drops the spaces and dashes people type or paste.
+func normalizeTwoFactorCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTwoFactor accepts a current authenticator code or an unused recovery
+// code for a user with two-factor authentication enabled. Wrong codes count
+// towards the lockout.
+func checkTwoFactor(repo Repository, cfg Config, userID int, code string) error {
+	state, err := repo.GetTwoFactor(userID)
+	if err != nil {
+		return err
+	}
+	if !state.Enabled {
+		return errTwoFactorOff
+	}
+	if state.LockedUntil != nil && time.Now().Before(*state.LockedUntil) {
+		return errTwoFactorLocked
+	}
+	code = normalizeTwoFactorCode(code)
+	if isTOTPCode(code) {
+		secret, err := openTOTPSecret(cfg.TwoFactorKey, state.Secret)
+		if err != nil {
+			return err
+		}
+		if step, ok := matchTOTP(secret, code, time.Now()); ok {
+			return repo.UseTOTPStep(userID, step)
+		}
+	} else if code != "" {
+		if err := repo.UseRecoveryCode(userID, hashAuthToken(code)); !errors.Is(err, errTwoFactorCode) {
+			return err
+		}
+	}
+	if err := repo.RecordTwoFactorFailure(userID); err != nil {
+		return err
+	}
+	return errTwoFactorCode
+}
+
+// signIn answers a successful password or provider sign-in. Users with
+// two-factor authentication get a challenge to complete at /auth/2fa instead
+// of a session.
+func signIn(c *gin.Context, repo Repository, cfg Config, user *AuthUser, device string, status int) {
+	if user.TwoFactorEnabledAt != nil {
+		challenge, hash := newAuthToken()
+		expiresAt := time.Now().Add(twoFactorChallengeTTL)
+		if err := repo.CreateTwoFactorChallenge(user.ID, hash, truncateRunes(device, maxSessionDevice), expiresAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, TwoFactorChallenge{TwoFactorRequired: true, Challenge: challenge, ExpiresAt: expiresAt})
+		return
+	}
+	response, err := startSession(c, repo, cfg, user, device, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(status, response)
+}
+
+// adminTwoFactorError is why a staff session may not use admin routes when
+// REQUIRE_ADMIN_2FA is on, or nil.
+func adminTwoFactorError(user *AuthUser, twoFactorAt *time.Time, required bool) error {
+	switch {
+	case !required:
+		return nil
+	case user.TwoFactorEnabledAt == nil:
+		return errTwoFactorRequired
+	case twoFactorAt == nil:
+		return errTwoFactorSession
+	default:
+		return nil
+	}
+}
+
+func respondTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errTwoFactorCode), errors.Is(err, errTwoFactorChallenge):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, errTwoFactorLocked):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, errTwoFactorOff), errors.Is(err, errTwoFactorOn), errors.Is(err, errTwoFactorSetup):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondNotFound(c, err)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key from the RFC 6238 test vectors.
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated from eight digits to six.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if code := totpCode(rfc6238Secret, tt.unix/totpPeriod); code != tt.code {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", totpCode(rfc6238Secret, current), current, true},
+		{"previous step", totpCode(rfc6238Secret, current-1), current - 1, true},
+		{"next step", totpCode(rfc6238Secret, current+1), current + 1, true},
+		{"two steps old", totpCode(rfc6238Secret, current-2), 0, false},
+		{"two steps ahead", totpCode(rfc6238Secret, current+2), 0, false},
+		{"wrong code", "000000", 0, false},
+		{"empty", "", 0, false},
+		{"longer code", totpCode(rfc6238Secret, current) + "0", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(rfc6238Secret, tt.code, now)
+			if step != tt.wantStep || ok != tt.wantOK {
+				t.Errorf("matchTOTP(%q) = %d, %t, want %d, %t", tt.code, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes := newRecoveryCodes()
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+	format := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`)
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q is not xxxx-xxxx-xxxx-xxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q repeated", code)
+		}
+		seen[code] = true
+		if hashAuthToken(normalizeTwoFactorCode(code)) != hashes[i] {
+			t.Errorf("hash %d does not match its normalized code", i)
+		}
+	}
+}
+
+func TestNormalizeTwoFactorCode(t *testing.T) {
+	tests := []struct {
+		in, want string
+		totp     bool
+	}{
+		{"123456", "123456", true},
+		{" 123 456 ", "123456", true},
+		{"123-456", "123456", true},
+		{"12345", "12345", false},
+		{"12345a", "12345a", false},
+		{"ABCD-EFGH-2345-67AB", "abcdefgh234567ab", false},
+		{"abcd efgh 2345 67ab", "abcdefgh234567ab", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got := normalizeTwoFactorCode(tt.in)
+		if got != tt.want {
+			t.Errorf("normalizeTwoFactorCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if isTOTPCode(got) != tt.totp {
+			t.Errorf("isTOTPCode(%q) = %t, want %t", got, !tt.totp, tt.totp)
+		}
+	}
+}
+
+// twoFactorRepo keeps the two-factor state of one user in memory the way the
+// Postgres repository does. Other Repository methods are not used.
+type twoFactorRepo struct {
+	Repository
+	state    TwoFactor
+	lastStep int64
+	codes    map[string]bool
+	failures int
+}
+
+func (r *twoFactorRepo) GetTwoFactor(userID int) (*TwoFactor, error) {
+	state := r.state
+	return &state, nil
+}
+
+func (r *twoFactorRepo) UseTOTPStep(userID int, step int64) error {
+	if step <= r.lastStep {
+		return errTwoFactorCode
+	}
+	r.lastStep, r.failures = step, 0
+	return nil
+}
+
+func (r *twoFactorRepo) UseRecoveryCode(userID int, codeHash string) error {
+	if !r.codes[codeHash] {
+		return errTwoFactorCode
+	}
+	delete(r.codes, codeHash)
+	r.failures = 0
+	return nil
+}
+
+func (r *twoFactorRepo) RecordTwoFactorFailure(userID int) error {
+	r.failures++
+	return nil
+}
+
+func TestCheckTwoFactor(t *testing.T) {
+	cfg := Config{TwoFactorKey: "test-key"}
+	sealed, err := sealTOTPSecret(cfg.TwoFactorKey, rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, hashes := newRecoveryCodes()
+	later := time.Now().Add(time.Minute)
+	current := func() string { return totpCode(rfc6238Secret, time.Now().Unix()/totpPeriod) }
+
+	tests := []struct {
+		name         string
+		disabled     bool
+		lockedUntil  *time.Time
+		attempts     []string
+		want         []error
+		wantFailures int
+		wantCodes    int
+	}{
+		{
+			name:      "authenticator code",
+			attempts:  []string{current()},
+			want:      []error{nil},
+			wantCodes: recoveryCodeCount,
+		},
+		{
+			// A replayed code is refused but is not a guess, so it does not
+			// count towards the lockout.
+			name:      "authenticator code replayed",
+			attempts:  []string{current(), current()},
+			want:      []error{nil, errTwoFactorCode},
+			wantCodes: recoveryCodeCount,
+		},
+		{
+			name:      "recovery code as typed",
+			attempts:  []string{strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))},
+			want:      []error{nil},
+			wantCodes: recoveryCodeCount - 1,
+		},
+		{
+			name:         "recovery code used twice",
+			attempts:     []string{codes[1], codes[1], codes[2]},
+			want:         []error{nil, errTwoFactorCode, nil},
+			wantFailures: 0,
+			wantCodes:    recoveryCodeCount - 2,
+		},
+		{
+			name:         "wrong codes",
+			attempts:     []string{"000000", "aaaa-bbbb-cccc-dddd", ""},
+			want:         []error{errTwoFactorCode, errTwoFactorCode, errTwoFactorCode},
+			wantFailures: 3,
+			wantCodes:    recoveryCodeCount,
+		},
+		{
+			name:        "locked",
+			lockedUntil: &later,
+			attempts:    []string{current(), codes[3]},
+			want:        []error{errTwoFactorLocked, errTwoFactorLocked},
+			wantCodes:   recoveryCodeCount,
+		},
+		{
+			name:      "not enabled",
+			disabled:  true,
+			attempts:  []string{current()},
+			want:      []error{errTwoFactorOff},
+			wantCodes: recoveryCodeCount,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &twoFactorRepo{
+				state: TwoFactor{Enabled: !tt.disabled, Secret: sealed, LockedUntil: tt.lockedUntil},
+				codes: make(map[string]bool),
+			}
+			for _, hash := range hashes {
+				repo.codes[hash] = true
+			}
+			for i, code := range tt.attempts {
+				if err := checkTwoFactor(repo, cfg, 1, code); !errors.Is(err, tt.want[i]) {
+					t.Errorf("attempt %d (%q) = %v, want %v", i+1, code, err, tt.want[i])
+				}
+			}
+			if repo.failures != tt.wantFailures {
+				t.Errorf("failures = %d, want %d", repo.failures, tt.wantFailures)
+			}
+			if len(repo.codes) != tt.wantCodes {
+				t.Errorf("recovery codes left = %d, want %d", len(repo.codes), tt.wantCodes)
+			}
+		})
+	}
+}
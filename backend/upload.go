@@ -16,23 +16,47 @@ func saveUploadedFile(file *multipart.FileHeader, prefix string, c *gin.Context)
 		return "", fmt.Errorf("file is required")
 	}
 
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	if ext == "" {
-		ext = ".png"
+	name, err := prepareUploadName(file.Filename, prefix)
+	if err != nil {
+		return "", err
 	}
 
-	if err := os.MkdirAll("uploads", 0o755); err != nil {
+	destination := filepath.Join("uploads", name)
+	if err := c.SaveUploadedFile(file, destination); err != nil {
 		return "", err
 	}
 
-	sanitized := strings.ReplaceAll(strings.ToLower(file.Filename), " ", "-")
-	name := fmt.Sprintf("%s-%d-%s%s", prefix, time.Now().UnixNano(), strings.TrimSuffix(sanitized, ext), ext)
-	name = strings.ReplaceAll(name, "..", "-")
+	return "/uploads/" + name, nil
+}
+
+// saveUploadBytes stores data extracted from another file (an imported EPUB or
+// DOCX) under uploads/ using the same naming scheme as direct uploads.
+func saveUploadBytes(filename, prefix string, data []byte) (string, error) {
+	name, err := prepareUploadName(filepath.Base(filename), prefix)
+	if err != nil {
+		return "", err
+	}
 
 	destination := filepath.Join("uploads", name)
-	if err := c.SaveUploadedFile(file, destination); err != nil {
+	if err := os.WriteFile(destination, data, 0o644); err != nil {
 		return "", err
 	}
 
 	return "/uploads/" + name, nil
 }
+
+func prepareUploadName(filename, prefix string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		ext = ".png"
+	}
+
+	if err := os.MkdirAll("uploads", 0o755); err != nil {
+		return "", err
+	}
+
+	sanitized := strings.ReplaceAll(strings.ToLower(filename), " ", "-")
+	name := fmt.Sprintf("%s-%d-%s%s", prefix, time.Now().UnixNano(), strings.TrimSuffix(sanitized, ext), ext)
+	name = strings.ReplaceAll(name, "..", "-")
+	return name, nil
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"novelreader/mail"
+)
+
+const (
+	webhookJSON    = "json"
+	webhookDiscord = "discord"
+
+	eventChapterPublished   = "chapter.published"
+	eventNovelCreated       = "novel.created"
+	eventAnnouncementPosted = "announcement.posted"
+	eventReportFiled        = "report.filed"
+	eventWebhookTest        = "webhook.test"
+
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+
+	// maxWebhookAttempts is how often delivery is tried before it is marked
+	// failed.
+	maxWebhookAttempts = 8
+	webhookBatch       = 20
+)
+
+// webhookEvents are the events a webhook can subscribe to.
+var webhookEvents = []string{eventChapterPublished, eventNovelCreated, eventAnnouncementPosted, eventReportFiled}
+
+var (
+	errWebhookURL     = errors.New("url must be an absolute http or https URL")
+	errWebhookFormat  = errors.New("format must be json or discord")
+	errWebhookEvents  = errors.New("events must list one or more of chapter.published, novel.created, announcement.posted, report.filed")
+	errDeliveryClosed = errors.New("delivery already succeeded")
+)
+
+// WebhookEvent is the payload stored for each delivery. URL is a site path and
+// is resolved against SITE_URL when the delivery is sent.
+type WebhookEvent struct {
+	Event       string    `json:"event"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Data        any       `json:"data"`
+	OccurredAt  time.Time `json:"occurredAt"`
+}
+
+type webhookNovel struct {
+	ID       int    `json:"id"`
+	Slug     string `json:"slug"`
+	Title    string `json:"title"`
+	Author   string `json:"author"`
+	CoverURL string `json:"coverUrl"`
+}
+
+type webhookChapter struct {
+	ID     int    `json:"id"`
+	Volume int    `json:"volume"`
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+}
+
+func newWebhookNovel(novel *Novel) webhookNovel {
+	return webhookNovel{ID: novel.ID, Slug: novel.Slug, Title: novel.Title, Author: novel.Author, CoverURL: novel.CoverURL}
+}
+
+func chapterPublishedEvent(novel webhookNovel, chapter webhookChapter, publishedAt time.Time) WebhookEvent {
+	return WebhookEvent{
+		Event:       eventChapterPublished,
+		Title:       fmt.Sprintf("%s: Chapter %d – %s", novel.Title, chapter.Number, chapter.Title),
+		URL:         "/read/" + novel.Slug + "/" + strconv.Itoa(chapter.ID),
+		Description: fmt.Sprintf("A new chapter of %s by %s is out.", novel.Title, novel.Author),
+		Data:        gin.H{"novel": novel, "chapter": chapter},
+		OccurredAt:  publishedAt,
+	}
+}
+
+func novelCreatedEvent(novel *Novel) WebhookEvent {
+	return WebhookEvent{
+		Event:       eventNovelCreated,
+		Title:       "New novel: " + novel.Title,
+		URL:         "/novels/" + novel.Slug,
+		Description: novel.Summary,
+		Data:        gin.H{"novel": newWebhookNovel(novel)},
+		OccurredAt:  novel.CreatedAt,
+	}
+}
+
+func announcementEvent(announcement *Announcement) WebhookEvent {
+	return WebhookEvent{
+		Event:       eventAnnouncementPosted,
+		Title:       announcement.Title,
+		URL:         "/updates#announcement-" + strconv.Itoa(announcement.ID),
+		Description: announcement.Body,
+		Data:        gin.H{"announcement": announcement},
+		OccurredAt:  announcement.CreatedAt,
+	}
+}
+
+func reportEvent(report *ModerationReport) WebhookEvent {
+	title := "Report filed"
+	if report.NovelTitle != "" {
+		title += ": " + report.NovelTitle
+	}
+	return WebhookEvent{
+		Event:       eventReportFiled,
+		Title:       title,
+		URL:         "/blogger-dashboard/moderation",
+		Description: report.Note,
+		Data:        gin.H{"report": report},
+		OccurredAt:  report.CreatedAt,
+	}
+}
+
+func testEvent(hook *Webhook, now time.Time) WebhookEvent {
+	return WebhookEvent{
+		Event:       eventWebhookTest,
+		Title:       "Test event",
+		URL:         "/",
+		Description: "This is a test delivery for the " + hook.Name + " webhook.",
+		Data:        gin.H{"webhookId": hook.ID},
+		OccurredAt:  now,
+	}
+}
+
+// emitWebhookEvent queues event for every subscribed webhook. The content was
+// already saved, so a failure is logged rather than returned to the client.
+func emitWebhookEvent(repo Repository, event WebhookEvent) {
+	if _, err := repo.EnqueueWebhookEvent(event); err != nil {
+		log.Printf("webhooks: queue %s: %v", event.Event, err)
+	}
+}
+
+func normalizeWebhookInput(input WebhookInput) (WebhookInput, error) {
+	input.URL = strings.TrimSpace(input.URL)
+	parsed, err := url.Parse(input.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return input, errWebhookURL
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		input.Name = parsed.Host
+	}
+	input.Secret = strings.TrimSpace(input.Secret)
+	switch input.Format = strings.ToLower(strings.TrimSpace(input.Format)); input.Format {
+	case "":
+		input.Format = webhookJSON
+	case webhookJSON, webhookDiscord:
+	default:
+		return input, errWebhookFormat
+	}
+	events := make([]string, 0, len(input.Events))
+	for _, event := range input.Events {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if !slices.Contains(webhookEvents, event) {
+			return input, errWebhookEvents
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		return input, errWebhookEvents
+	}
+	input.Events = events
+	return input, nil
+}
+
+func newWebhookSecret() string {
+	random := make([]byte, 32)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
+
+// signWebhook is the value of X-Webhook-Signature: an HMAC-SHA256 over the
+// timestamp, a dot and the raw body, so receivers can reject replays.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func respondWebhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errWebhookURL), errors.Is(err, errWebhookFormat), errors.Is(err, errWebhookEvents):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errDeliveryClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondNotFound(c, err)
+	}
+}
+
+// webhookSendFunc posts one delivery and reports the response status, which
+// is zero when no response arrived.
+type webhookSendFunc func(hook *Webhook, delivery *WebhookDelivery) (int, error)
+
+type webhookSender struct {
+	client  *http.Client
+	siteURL string
+	brand   mail.Branding
+}
+
+func newWebhookSender(repo Repository, client *http.Client, siteURL string) *webhookSender {
+	settings, _ := repo.GetSiteSettings()
+	return &webhookSender{client: client, siteURL: siteURL, brand: mailBranding(settings, siteURL)}
+}
+
+func (s *webhookSender) send(hook *Webhook, delivery *WebhookDelivery) (int, error) {
+	body, err := s.body(hook, delivery)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "NovelReader-Webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", signWebhook(hook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// body renders the stored event in the webhook's format.
+func (s *webhookSender) body(hook *Webhook, delivery *WebhookDelivery) ([]byte, error) {
+	var event WebhookEvent
+	if err := json.Unmarshal(delivery.Payload, &event); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(event.URL, "/") {
+		event.URL = s.siteURL + event.URL
+	}
+	if hook.Format == webhookDiscord {
+		return json.Marshal(discordPayload(event, s.brand))
+	}
+	return json.Marshal(struct {
+		DeliveryID int `json:"deliveryId"`
+		WebhookEvent
+	}{delivery.ID, event})
+}
+
+type discordMessage struct {
+	Username  string         `json:"username,omitempty"`
+	AvatarURL string         `json:"avatar_url,omitempty"`
+	Embeds    []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string        `json:"title"`
+	URL         string        `json:"url,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Color       int           `json:"color,omitempty"`
+	Timestamp   string        `json:"timestamp"`
+	Footer      discordFooter `json:"footer"`
+}
+
+type discordFooter struct {
+	Text string `json:"text"`
+}
+
+// discordPayload builds a Discord embed, trimming text to Discord's limits.
+func discordPayload(event WebhookEvent, brand mail.Branding) discordMessage {
+	message := discordMessage{Username: brand.SiteName}
+	if strings.HasPrefix(brand.LogoURL, "https://") || strings.HasPrefix(brand.LogoURL, "http://") {
+		message.AvatarURL = brand.LogoURL
+	}
+	embed := discordEmbed{
+		Title:       truncateRunes(event.Title, 256),
+		URL:         event.URL,
+		Description: truncateRunes(event.Description, 2000),
+		Timestamp:   event.OccurredAt.UTC().Format(time.RFC3339),
+		Footer:      discordFooter{Text: brand.SiteName + " · " + event.Event},
+	}
+	if color, err := strconv.ParseInt(strings.TrimPrefix(brand.AccentColor, "#"), 16, 32); err == nil && len(brand.AccentColor) == 7 {
+		embed.Color = int(color)
+	}
+	message.Embeds = []discordEmbed{embed}
+	return message
+}
+
+func truncateRunes(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// runWebhookDispatcher sends due deliveries every interval until ctx is
+// cancelled. Deliveries are claimed with SKIP LOCKED, so every replica may
+// run it.
+func runWebhookDispatcher(ctx context.Context, repo Repository, client *http.Client, siteURL string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sender := newWebhookSender(repo, client, siteURL)
+		processed, err := repo.DeliverWebhooks(sender.send, webhookBatch)
+		if err != nil {
+			log.Printf("webhook dispatcher: %v", err)
+		}
+		if err == nil && processed == webhookBatch && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"novelreader/mail"
+)
+
+// webhookReceiver records the last request it got and answers with status
+// after delay.
+type webhookReceiver struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	header http.Header
+	body   []byte
+	status int
+	delay  time.Duration
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	t.Helper()
+	r := &webhookReceiver{status: http.StatusNoContent}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.header, r.body = req.Header.Clone(), body
+		status, delay := r.status, r.delay
+		r.mu.Unlock()
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-req.Context().Done():
+			}
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, "receiver said no")
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func testDelivery(t *testing.T, event WebhookEvent) *WebhookDelivery {
+	t.Helper()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &WebhookDelivery{ID: 17, WebhookID: 3, Event: event.Event, Payload: payload, Status: deliveryPending}
+}
+
+var testWebhookEvent = WebhookEvent{
+	Event:       eventChapterPublished,
+	Title:       "Dawn: Chapter 4 – Ash",
+	URL:         "/read/dawn/40",
+	Description: "A new chapter of Dawn by Mira is out.",
+	Data:        map[string]int{"chapterId": 40},
+	OccurredAt:  time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+}
+
+func TestWebhookSendSignature(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	sender := &webhookSender{client: receiver.server.Client(), siteURL: "https://reader.test"}
+	hook := &Webhook{ID: 3, URL: receiver.server.URL + "/hook", Secret: "shh", Format: webhookJSON}
+
+	status, err := sender.send(hook, testDelivery(t, testWebhookEvent))
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("send = %d, %v, want 204", status, err)
+	}
+
+	header, body := receiver.header, receiver.body
+	mac := hmac.New(sha256.New, []byte(hook.Secret))
+	io.WriteString(mac, header.Get("X-Webhook-Timestamp")+".")
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); header.Get("X-Webhook-Signature") != want {
+		t.Errorf("signature = %q, want %q over the raw body", header.Get("X-Webhook-Signature"), want)
+	}
+	timestamp, err := strconv.ParseInt(header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)).Abs() > time.Minute {
+		t.Errorf("timestamp = %q", header.Get("X-Webhook-Timestamp"))
+	}
+	if signWebhook("other", timestamp, body) == header.Get("X-Webhook-Signature") ||
+		signWebhook(hook.Secret, timestamp, append(body, ' ')) == header.Get("X-Webhook-Signature") {
+		t.Error("signature does not depend on the secret and the exact body")
+	}
+	for name, want := range map[string]string{
+		"Content-Type":       "application/json",
+		"X-Webhook-Event":    eventChapterPublished,
+		"X-Webhook-Delivery": "17",
+	} {
+		if header.Get(name) != want {
+			t.Errorf("%s = %q, want %q", name, header.Get(name), want)
+		}
+	}
+
+	var got struct {
+		DeliveryID int    `json:"deliveryId"`
+		Event      string `json:"event"`
+		URL        string `json:"url"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.DeliveryID != 17 || got.Event != eventChapterPublished || got.URL != "https://reader.test/read/dawn/40" {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestWebhookSendDiscord(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	sender := &webhookSender{
+		client:  receiver.server.Client(),
+		siteURL: "https://reader.test",
+		brand:   mail.Branding{SiteName: "Reader", LogoURL: "https://reader.test/logo.png", AccentColor: "#3366ff"},
+	}
+	hook := &Webhook{ID: 3, URL: receiver.server.URL, Secret: "shh", Format: webhookDiscord}
+	event := testWebhookEvent
+	event.Title = strings.Repeat("é", 300)
+
+	if _, err := sender.send(hook, testDelivery(t, event)); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	var got discordMessage
+	if err := json.Unmarshal(receiver.body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != "Reader" || got.AvatarURL != "https://reader.test/logo.png" || len(got.Embeds) != 1 {
+		t.Fatalf("message = %+v", got)
+	}
+	embed := got.Embeds[0]
+	want := discordEmbed{
+		Title:       strings.Repeat("é", 255) + "…",
+		URL:         "https://reader.test/read/dawn/40",
+		Description: event.Description,
+		Color:       0x3366ff,
+		Timestamp:   "2024-05-01T12:30:00Z",
+		Footer:      discordFooter{Text: "Reader · chapter.published"},
+	}
+	if embed != want {
+		t.Errorf("embed = %+v, want %+v", embed, want)
+	}
+	if receiver.header.Get("X-Webhook-Signature") == "" {
+		t.Error("discord delivery is not signed")
+	}
+}
+
+func TestWebhookSendFailure(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	sender := &webhookSender{client: &http.Client{Timeout: 50 * time.Millisecond}, siteURL: "https://reader.test"}
+	hook := &Webhook{ID: 3, URL: receiver.server.URL, Format: webhookJSON}
+
+	receiver.status = http.StatusBadGateway
+	status, err := sender.send(hook, testDelivery(t, testWebhookEvent))
+	if status != http.StatusBadGateway || err == nil || !strings.Contains(err.Error(), "receiver said no") {
+		t.Errorf("send = %d, %v, want 502 with the response body", status, err)
+	}
+
+	receiver.status, receiver.delay = http.StatusOK, time.Second
+	if status, err := sender.send(hook, testDelivery(t, testWebhookEvent)); status != 0 || err == nil {
+		t.Errorf("send after timeout = %d, %v, want 0 and an error", status, err)
+	}
+}
+
+// deliveryStore stands in for the webhooks and webhook_deliveries tables with
+// one webhook and one delivery, answering the statements deliverWebhook runs.
+type deliveryStore struct {
+	mu         sync.Mutex
+	delivery   WebhookDelivery
+	backoff    int64
+	committed  int
+	rolledBack int
+}
+
+func (s *deliveryStore) begin() {}
+
+func (s *deliveryStore) commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.committed++
+}
+
+func (s *deliveryStore) rollback() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rolledBack++
+}
+
+func (s *deliveryStore) run(query string, args []driver.Value) ([][]driver.Value, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := &s.delivery
+	row := func() []driver.Value {
+		var deliveredAt driver.Value
+		if d.DeliveredAt != nil {
+			deliveredAt = *d.DeliveredAt
+		}
+		return []driver.Value{int64(d.ID), int64(d.WebhookID), d.Event, []byte(d.Payload), d.Status, int64(d.Attempts), int64(d.ResponseStatus), d.LastError, d.NextAttemptAt, d.CreatedAt, deliveredAt}
+	}
+	switch {
+	case strings.HasPrefix(query, "SELECT "+webhookDeliveryColumns+", "+webhookColumns):
+		if d.Status != args[1].(string) || (args[0].(int64) != 0 && args[0].(int64) != int64(d.ID)) ||
+			(args[0].(int64) == 0 && d.NextAttemptAt.After(time.Now())) {
+			return nil, 0, nil
+		}
+		hook := []driver.Value{int64(d.WebhookID), "Discord", "https://hooks.example/x", "shh", webhookJSON, "{chapter.published}", true, d.CreatedAt, d.CreatedAt}
+		return [][]driver.Value{append(row(), hook...)}, 0, nil
+	case strings.HasPrefix(query, "UPDATE webhook_deliveries d SET status = $2, attempts = $3, response_status = $4"):
+		now := time.Now()
+		d.Status, d.Attempts, d.ResponseStatus = args[1].(string), int(args[2].(int64)), int(args[3].(int64))
+		if len(args) == 4 {
+			d.LastError, d.DeliveredAt = "", &now
+		} else {
+			d.LastError, s.backoff = args[4].(string), args[5].(int64)
+			d.NextAttemptAt = now.Add(time.Duration(s.backoff) * time.Second)
+		}
+		return [][]driver.Value{row()}, 1, nil
+	}
+	return nil, 0, errors.New("unexpected statement: " + query)
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	timeout := errors.New("Post \"https://hooks.example/x\": context deadline exceeded")
+	tests := []struct {
+		name         string
+		attempts     int
+		status       int
+		sendErr      error
+		wantStatus   string
+		wantAttempts int
+		wantBackoff  time.Duration
+	}{
+		{"delivered", 0, http.StatusNoContent, nil, deliveryDelivered, 1, 0},
+		{"server error", 0, http.StatusServiceUnavailable, errors.New("503 Service Unavailable: busy"), deliveryPending, 1, time.Minute},
+		{"timeout", 2, 0, timeout, deliveryPending, 3, 4 * time.Minute},
+		{"last attempt", maxWebhookAttempts - 1, http.StatusInternalServerError, errors.New("500 Internal Server Error"), deliveryFailed, maxWebhookAttempts, retryBackoff(maxWebhookAttempts)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &deliveryStore{delivery: *testDelivery(t, testWebhookEvent)}
+			store.delivery.Attempts = tt.attempts
+			repo := NewAppRepository(nil, openFakeDB(store))
+			sent := 0
+			send := func(hook *Webhook, delivery *WebhookDelivery) (int, error) {
+				sent++
+				if hook.ID != delivery.WebhookID || delivery.ID != 17 {
+					t.Errorf("send(%+v, %+v)", hook, delivery)
+				}
+				return tt.status, tt.sendErr
+			}
+
+			processed, err := repo.DeliverWebhooks(send, webhookBatch)
+			if err != nil {
+				t.Fatalf("DeliverWebhooks: %v", err)
+			}
+			if processed != 1 || sent != 1 {
+				t.Errorf("processed %d, sent %d, want 1 each", processed, sent)
+			}
+			d := store.delivery
+			if d.Status != tt.wantStatus || d.Attempts != tt.wantAttempts || d.ResponseStatus != tt.status {
+				t.Errorf("delivery status %q, attempts %d, response %d, want %q, %d, %d", d.Status, d.Attempts, d.ResponseStatus, tt.wantStatus, tt.wantAttempts, tt.status)
+			}
+			if tt.sendErr == nil {
+				if d.DeliveredAt == nil || d.LastError != "" {
+					t.Errorf("delivered at %v, last error %q", d.DeliveredAt, d.LastError)
+				}
+			} else if d.LastError != tt.sendErr.Error() || time.Duration(store.backoff)*time.Second != tt.wantBackoff {
+				t.Errorf("last error %q, backoff %ds, want %q, %v", d.LastError, store.backoff, tt.sendErr, tt.wantBackoff)
+			}
+			if store.committed != 1 {
+				t.Errorf("committed %d times, want 1", store.committed)
+			}
+		})
+	}
+}
+
+// A delivery waiting out its backoff is not sent by the dispatcher, but an
+// admin can still send it right away.
+func TestDeliverWebhookSchedule(t *testing.T) {
+	store := &deliveryStore{delivery: *testDelivery(t, testWebhookEvent)}
+	store.delivery.NextAttemptAt = time.Now().Add(time.Hour)
+	repo := NewAppRepository(nil, openFakeDB(store))
+	send := func(*Webhook, *WebhookDelivery) (int, error) { return http.StatusOK, nil }
+
+	if processed, err := repo.DeliverWebhooks(send, webhookBatch); processed != 0 || err != nil {
+		t.Fatalf("DeliverWebhooks = %d, %v, want nothing due", processed, err)
+	}
+	delivery, err := repo.DeliverWebhook(17, send)
+	if err != nil || delivery.Status != deliveryDelivered {
+		t.Fatalf("DeliverWebhook = %+v, %v", delivery, err)
+	}
+	if _, err := repo.DeliverWebhook(17, send); !errors.Is(err, errNotFound) {
+		t.Errorf("resending a delivered delivery = %v, want errNotFound", err)
+	}
+}
@@ -4,8 +4,7 @@ import Image from "next/image";
 import Link from "next/link";
 import { useEffect, useMemo, useState } from "react";
 
-import { fetchBookmarks, fetchNovels, type AdminNovel, type BookmarkEntry } from "@/lib/api";
-import { clearSession } from "@/lib/auth";
+import { fetchBookmarks, fetchNovels, signOut, type AdminNovel, type BookmarkEntry } from "@/lib/api";
 import { useAuthSession } from "@/lib/use-auth-session";
 import { SiteNav } from "@/components/site/site-nav";
 import { Badge } from "@/components/ui/badge";
@@ -109,7 +108,7 @@ export default function BookmarksPage() {
             <Button
               variant="ghost"
               onClick={() => {
-                clearSession();
+                signOut();
                 window.location.href = "/";
               }}
             >
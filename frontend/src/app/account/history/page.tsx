@@ -3,8 +3,7 @@
 import Link from "next/link";
 import { useEffect, useState } from "react";
 
-import { clearReadingHistory, fetchReadingHistory } from "@/lib/api";
-import { clearSession } from "@/lib/auth";
+import { clearReadingHistory, fetchReadingHistory, signOut } from "@/lib/api";
 import { useAuthSession } from "@/lib/use-auth-session";
 import { SiteNav } from "@/components/site/site-nav";
 import { Badge } from "@/components/ui/badge";
@@ -16,6 +15,8 @@ type HistoryItem = {
   novelSlug: string;
   novelTitle: string;
   chapterId: number;
+  chapterVolume: number;
+  chapterNumber: number;
   chapterTitle: string;
   readAt: string;
 };
@@ -117,7 +118,7 @@ export default function ReadingHistoryPage() {
             <Button
               variant="ghost"
               onClick={() => {
-                clearSession();
+                signOut();
                 window.location.href = "/";
               }}
             >
@@ -143,7 +144,9 @@ export default function ReadingHistoryPage() {
               <CardContent className="flex flex-wrap items-center justify-between gap-3 py-4">
                 <div>
                   <p className="text-sm text-muted-foreground">{item.novelTitle}</p>
-                  <p className="font-medium">{item.chapterTitle}</p>
+                  <p className="font-medium">
+                    Volume {item.chapterVolume} · Chapter {item.chapterNumber}: {item.chapterTitle}
+                  </p>
                   <p className="text-xs text-muted-foreground">{new Date(item.readAt).toLocaleString()}</p>
                 </div>
                 <div className="flex items-center gap-2">
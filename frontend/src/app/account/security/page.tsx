@@ -0,0 +1,230 @@
+"use client";
+
+import Link from "next/link";
+import { useEffect, useState } from "react";
+
+import {
+  disableTwoFactor,
+  enableTwoFactor,
+  fetchTwoFactorStatus,
+  regenerateRecoveryCodes,
+  setupTwoFactor,
+  type TwoFactorStatus,
+} from "@/lib/api";
+import { useAuthSession } from "@/lib/use-auth-session";
+import { SiteNav } from "@/components/site/site-nav";
+import { Badge } from "@/components/ui/badge";
+import { Button } from "@/components/ui/button";
+import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
+import { Input } from "@/components/ui/input";
+
+export default function AccountSecurityPage() {
+  const session = useAuthSession();
+  const [status, setStatus] = useState<TwoFactorStatus | null>(null);
+  const [setup, setSetup] = useState<{ secret: string; otpauthUri: string } | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+  const [code, setCode] = useState("");
+  const [error, setError] = useState("");
+  const [busy, setBusy] = useState(false);
+
+  useEffect(() => {
+    if (!session) {
+      return;
+    }
+    fetchTwoFactorStatus(session.token)
+      .then(setStatus)
+      .catch(() => setError("Unable to load two-factor settings."));
+  }, [session]);
+
+  const run = async (action: () => Promise<void>) => {
+    setError("");
+    setBusy(true);
+    try {
+      await action();
+      setCode("");
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Something went wrong.");
+    } finally {
+      setBusy(false);
+    }
+  };
+
+  if (session === undefined) {
+    return (
+      <div className="min-h-screen bg-background text-foreground">
+        <SiteNav />
+        <div className="mx-auto flex min-h-screen w-full max-w-3xl items-center px-6 py-16">
+          <Card className="w-full">
+            <CardHeader>
+              <CardTitle>Security</CardTitle>
+            </CardHeader>
+            <CardContent className="text-sm text-muted-foreground">
+              Loading session...
+            </CardContent>
+          </Card>
+        </div>
+      </div>
+    );
+  }
+
+  if (!session) {
+    return (
+      <div className="min-h-screen bg-background text-foreground">
+        <SiteNav />
+        <div className="mx-auto flex min-h-screen w-full max-w-3xl items-center px-6 py-16">
+          <Card className="w-full">
+            <CardHeader>
+              <CardTitle>Security</CardTitle>
+            </CardHeader>
+            <CardContent className="space-y-4 text-sm text-muted-foreground">
+              <p>Sign in to manage two-factor authentication.</p>
+              <Button asChild className="bg-amber-200 text-zinc-950 hover:bg-amber-200/90">
+                <Link href="/auth/sign-in">Login</Link>
+              </Button>
+            </CardContent>
+          </Card>
+        </div>
+      </div>
+    );
+  }
+
+  const codeInput = (
+    <Input
+      placeholder="123456"
+      autoComplete="one-time-code"
+      value={code}
+      onChange={(event) => setCode(event.target.value)}
+    />
+  );
+
+  return (
+    <div className="min-h-screen bg-background text-foreground">
+      <SiteNav />
+      <div className="mx-auto w-full max-w-3xl px-6 py-16">
+        <div className="flex flex-wrap items-center justify-between gap-3">
+          <div>
+            <h1 className="text-3xl font-semibold tracking-tight">Security</h1>
+            <p className="text-sm text-muted-foreground">{session.user.email}</p>
+          </div>
+          <Button variant="outline" asChild>
+            <Link href="/">Back</Link>
+          </Button>
+        </div>
+        <Card className="mt-6">
+          <CardHeader>
+            <CardTitle className="flex items-center gap-2">
+              Two-factor authentication
+              {status && (
+                <Badge variant="outline">{status.enabled ? "On" : "Off"}</Badge>
+              )}
+            </CardTitle>
+          </CardHeader>
+          <CardContent className="space-y-4 text-sm">
+            {!status && !error && <p className="text-muted-foreground">Loading...</p>}
+            {status?.enabled && (
+              <>
+                <p className="text-muted-foreground">
+                  Enabled {status.enabledAt ? new Date(status.enabledAt).toLocaleDateString() : ""} ·{" "}
+                  {status.recoveryCodesLeft} recovery codes left
+                </p>
+                <p className="text-muted-foreground">
+                  Enter a current code to replace your recovery codes or turn two-factor off.
+                </p>
+                {codeInput}
+                <div className="flex flex-wrap gap-2">
+                  <Button
+                    variant="outline"
+                    disabled={busy || !code}
+                    onClick={() =>
+                      run(async () => {
+                        const codes = await regenerateRecoveryCodes(session.token, code);
+                        setRecoveryCodes(codes);
+                        setStatus({ ...status, recoveryCodesLeft: codes.length });
+                      })
+                    }
+                  >
+                    New recovery codes
+                  </Button>
+                  <Button
+                    variant="ghost"
+                    disabled={busy || !code}
+                    onClick={() =>
+                      run(async () => {
+                        await disableTwoFactor(session.token, code);
+                        setRecoveryCodes([]);
+                        setStatus({ enabled: false, enabledAt: null, recoveryCodesLeft: 0 });
+                      })
+                    }
+                  >
+                    Turn off
+                  </Button>
+                </div>
+              </>
+            )}
+            {status && !status.enabled && !setup && (
+              <>
+                <p className="text-muted-foreground">
+                  Ask for a code from an authenticator app whenever you sign in.
+                </p>
+                <Button
+                  className="bg-amber-200 text-zinc-950 hover:bg-amber-200/90"
+                  disabled={busy}
+                  onClick={() => run(async () => setSetup(await setupTwoFactor(session.token)))}
+                >
+                  Set up
+                </Button>
+              </>
+            )}
+            {status && !status.enabled && setup && (
+              <>
+                <p className="text-muted-foreground">
+                  Add this key to your authenticator app, or open the link on your phone, then enter
+                  the six-digit code it shows.
+                </p>
+                <p className="break-all rounded-md border border-border/50 px-3 py-2 font-mono">
+                  {setup.secret}
+                </p>
+                <a href={setup.otpauthUri} className="text-amber-200 hover:text-amber-100">
+                  Open in authenticator app
+                </a>
+                {codeInput}
+                <Button
+                  className="bg-amber-200 text-zinc-950 hover:bg-amber-200/90"
+                  disabled={busy || !code}
+                  onClick={() =>
+                    run(async () => {
+                      const codes = await enableTwoFactor(session.token, code);
+                      setRecoveryCodes(codes);
+                      setSetup(null);
+                      setStatus({
+                        enabled: true,
+                        enabledAt: new Date().toISOString(),
+                        recoveryCodesLeft: codes.length,
+                      });
+                    })
+                  }
+                >
+                  Turn on
+                </Button>
+              </>
+            )}
+            {recoveryCodes.length > 0 && (
+              <div className="space-y-2 rounded-md border border-amber-200/40 bg-amber-200/10 px-3 py-2">
+                <p className="text-amber-200">
+                  Save these recovery codes somewhere safe. Each works once, and they will not be
+                  shown again.
+                </p>
+                <ul className="grid gap-1 font-mono sm:grid-cols-2">
+                  {recoveryCodes.map((recoveryCode) => (
+                    <li key={recoveryCode}>{recoveryCode}</li>
+                  ))}
+                </ul>
+              </div>
+            )}
+            {error && <p className="text-red-400">{error}</p>}
+          </CardContent>
+        </Card>
+      </div>
+    </div>
+  );
+}
@@ -23,6 +23,7 @@ import {
   uploadNovelCover,
   type AdminNovel,
 } from "@/lib/api";
+import { hasPermission } from "@/lib/auth";
 import { useAuthSession } from "@/lib/use-auth-session";
 import { loadDraft, removeDraft, saveDraft as persistDraft } from "@/lib/draft-storage";
 import { serializePlateToText } from "@/lib/plate-content";
@@ -65,7 +66,7 @@ export default function EditNovelPage() {
   const router = useRouter();
   const novelId = Number(Array.isArray(params.id) ? params.id[0] : params.id);
   const session = useAuthSession();
-  const isAdmin = session?.user.role === "admin";
+  const isAdmin = hasPermission(session?.user, "novel.edit") || hasPermission(session?.user, "chapter.edit");
   const [novel, setNovel] = useState<AdminNovel | null>(null);
   const [status, setStatus] = useState("Ongoing");
   const [title, setTitle] = useState("");
@@ -1,5 +1,6 @@
 "use client";
 
+import { isStaff } from "@/lib/auth";
 import { useAuthSession } from "@/lib/use-auth-session";
 
 import { BloggerDashboard } from "@/components/blogger-dashboard";
@@ -9,7 +10,7 @@ import { SiteNav } from "@/components/site/site-nav";
 
 export default function AdminPage() {
   const session = useAuthSession();
-  const isAdmin = session?.user.role === "admin";
+  const isAdmin = isStaff(session?.user);
 
   if (session === undefined) {
     return (
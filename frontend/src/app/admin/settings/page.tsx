@@ -19,12 +19,13 @@ import {
   updateAnnouncement,
   updateSiteSettings,
 } from "@/lib/api";
+import { hasPermission } from "@/lib/auth";
 import { useAuthSession } from "@/lib/use-auth-session";
 import { resolveAssetUrl } from "@/lib/utils";
 
 export default function AdminSettingsPage() {
   const session = useAuthSession();
-  const isAdmin = session?.user.role === "admin";
+  const isAdmin = hasPermission(session?.user, "settings.edit");
   const [notice, setNotice] = useState("");
   const [settings, setSettings] = useState({
     title: "Malaz Translation",
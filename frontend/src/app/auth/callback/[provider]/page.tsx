@@ -0,0 +1,81 @@
+"use client";
+
+import Link from "next/link";
+import { useParams, useRouter, useSearchParams } from "next/navigation";
+import { useEffect, useRef, useState } from "react";
+
+import { completeOAuthSignIn, needsTwoFactor } from "@/lib/api";
+import { OAUTH_STATE_KEY, TWO_FACTOR_CHALLENGE_KEY, saveSession } from "@/lib/auth";
+import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
+
+export default function OAuthCallbackPage() {
+  const router = useRouter();
+  const params = useParams<{ provider: string }>();
+  const searchParams = useSearchParams();
+  const started = useRef(false);
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    // The state can only be used once, so never post it twice.
+    if (started.current) {
+      return;
+    }
+    started.current = true;
+
+    const provider = params.provider;
+    const code = searchParams.get("code") ?? "";
+    const state = searchParams.get("state") ?? "";
+    const pending = window.sessionStorage.getItem(OAUTH_STATE_KEY);
+    window.sessionStorage.removeItem(OAUTH_STATE_KEY);
+
+    if (searchParams.get("error")) {
+      setError(searchParams.get("error_description") || "Sign-in was cancelled.");
+      return;
+    }
+    let expected: { provider?: string; state?: string } = {};
+    try {
+      expected = pending ? JSON.parse(pending) : {};
+    } catch {
+      expected = {};
+    }
+    // Only finish sign-ins this browser started.
+    if (!code || !state || expected.provider !== provider || expected.state !== state) {
+      setError("This sign-in link is invalid or was started elsewhere. Please try again.");
+      return;
+    }
+    completeOAuthSignIn(provider, { code, state })
+      .then((result) => {
+        if (needsTwoFactor(result)) {
+          window.sessionStorage.setItem(TWO_FACTOR_CHALLENGE_KEY, result.challenge);
+          router.replace("/auth/sign-in?twoFactor=1");
+          return;
+        }
+        saveSession(result);
+        router.replace("/");
+      })
+      .catch((err) => {
+        setError(err instanceof Error ? err.message : "Sign-in failed.");
+      });
+  }, [params.provider, router, searchParams]);
+
+  return (
+    <div className="min-h-screen bg-background text-foreground">
+      <div className="mx-auto flex min-h-screen w-full max-w-md items-center px-6 py-16">
+        <Card className="w-full">
+          <CardHeader>
+            <CardTitle>Signing in</CardTitle>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            {!error && <p className="text-sm text-muted-foreground">Finishing sign-in...</p>}
+            {error && <p className="text-sm text-red-400">{error}</p>}
+            <p className="text-sm text-muted-foreground">
+              <Link href="/auth/sign-in" className="text-amber-200 hover:text-amber-100">
+                Back to sign in
+              </Link>
+            </p>
+          </CardContent>
+        </Card>
+      </div>
+    </div>
+  );
+}
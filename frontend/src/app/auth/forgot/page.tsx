@@ -0,0 +1,78 @@
+"use client";
+
+import Link from "next/link";
+import { useState } from "react";
+
+import { requestPasswordReset } from "@/lib/api";
+import { Button } from "@/components/ui/button";
+import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
+import { Input } from "@/components/ui/input";
+
+export default function ForgotPasswordPage() {
+  const [email, setEmail] = useState("");
+  const [sent, setSent] = useState(false);
+  const [error, setError] = useState("");
+  const [loading, setLoading] = useState(false);
+
+  const handleSubmit = async (event: React.FormEvent<HTMLFormElement>) => {
+    event.preventDefault();
+    setError("");
+    setLoading(true);
+    try {
+      await requestPasswordReset(email);
+      setSent(true);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Failed to request a reset link.");
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen bg-background text-foreground">
+      <div className="mx-auto flex min-h-screen w-full max-w-md items-center px-6 py-16">
+        <Card className="w-full">
+          <CardHeader>
+            <CardTitle>Forgot password</CardTitle>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            {sent ? (
+              <p className="rounded-md border border-amber-200/40 bg-amber-200/10 px-3 py-2 text-xs text-amber-200">
+                If {email} has an account, a reset link is on its way. Check your inbox.
+              </p>
+            ) : (
+              <form className="space-y-4" onSubmit={handleSubmit}>
+                <div className="space-y-2">
+                  <label className="text-sm text-muted-foreground" htmlFor="email">
+                    Email
+                  </label>
+                  <Input
+                    id="email"
+                    type="email"
+                    value={email}
+                    onChange={(event) => setEmail(event.target.value)}
+                    required
+                  />
+                </div>
+                {error && <p className="text-sm text-red-400">{error}</p>}
+                <Button
+                  type="submit"
+                  className="w-full bg-amber-200 text-zinc-950 hover:bg-amber-200/90"
+                  disabled={loading}
+                >
+                  {loading ? "Sending..." : "Send reset link"}
+                </Button>
+              </form>
+            )}
+            <p className="text-sm text-muted-foreground">
+              Remembered it?{" "}
+              <Link href="/auth/sign-in" className="text-amber-200 hover:text-amber-100">
+                Login
+              </Link>
+            </p>
+          </CardContent>
+        </Card>
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,96 @@
+"use client";
+
+import Link from "next/link";
+import { useRouter, useSearchParams } from "next/navigation";
+import { useState } from "react";
+
+import { resetPassword } from "@/lib/api";
+import { Button } from "@/components/ui/button";
+import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
+import { Input } from "@/components/ui/input";
+
+export default function ResetPasswordPage() {
+  const router = useRouter();
+  const searchParams = useSearchParams();
+  const token = searchParams.get("token") ?? "";
+  const [password, setPassword] = useState("");
+  const [confirm, setConfirm] = useState("");
+  const [error, setError] = useState("");
+  const [loading, setLoading] = useState(false);
+
+  const handleSubmit = async (event: React.FormEvent<HTMLFormElement>) => {
+    event.preventDefault();
+    setError("");
+    if (password !== confirm) {
+      setError("Passwords do not match.");
+      return;
+    }
+    setLoading(true);
+    try {
+      await resetPassword({ token, password });
+      router.push("/auth/sign-in?reset=1");
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Failed to reset password.");
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen bg-background text-foreground">
+      <div className="mx-auto flex min-h-screen w-full max-w-md items-center px-6 py-16">
+        <Card className="w-full">
+          <CardHeader>
+            <CardTitle>Choose a new password</CardTitle>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            {!token ? (
+              <p className="text-sm text-red-400">This reset link is incomplete.</p>
+            ) : (
+              <form className="space-y-4" onSubmit={handleSubmit}>
+                <div className="space-y-2">
+                  <label className="text-sm text-muted-foreground" htmlFor="password">
+                    New password
+                  </label>
+                  <Input
+                    id="password"
+                    type="password"
+                    value={password}
+                    onChange={(event) => setPassword(event.target.value)}
+                    required
+                  />
+                </div>
+                <div className="space-y-2">
+                  <label className="text-sm text-muted-foreground" htmlFor="confirm">
+                    Confirm password
+                  </label>
+                  <Input
+                    id="confirm"
+                    type="password"
+                    value={confirm}
+                    onChange={(event) => setConfirm(event.target.value)}
+                    required
+                  />
+                </div>
+                {error && <p className="text-sm text-red-400">{error}</p>}
+                <Button
+                  type="submit"
+                  className="w-full bg-amber-200 text-zinc-950 hover:bg-amber-200/90"
+                  disabled={loading}
+                >
+                  {loading ? "Saving..." : "Set password"}
+                </Button>
+              </form>
+            )}
+            <p className="text-sm text-muted-foreground">
+              Link expired?{" "}
+              <Link href="/auth/forgot" className="text-amber-200 hover:text-amber-100">
+                Request a new one
+              </Link>
+            </p>
+          </CardContent>
+        </Card>
+      </div>
+    </div>
+  );
+}
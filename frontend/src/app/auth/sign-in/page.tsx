@@ -3,10 +3,17 @@
 import Link from "next/link";
 import { useRouter } from "next/navigation";
 import { useSearchParams } from "next/navigation";
-import { useState } from "react";
+import { useEffect, useState } from "react";
 
-import { loginUser } from "@/lib/api";
-import { saveSession } from "@/lib/auth";
+import {
+  completeTwoFactorSignIn,
+  fetchOAuthProviders,
+  loginUser,
+  needsTwoFactor,
+  startOAuthSignIn,
+  type OAuthProvider,
+} from "@/lib/api";
+import { OAUTH_STATE_KEY, TWO_FACTOR_CHALLENGE_KEY, saveSession } from "@/lib/auth";
 import { Button } from "@/components/ui/button";
 import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
 import { Input } from "@/components/ui/input";
@@ -18,15 +25,68 @@ export default function SignInPage() {
   const [password, setPassword] = useState("");
   const [error, setError] = useState("");
   const [loading, setLoading] = useState(false);
+  const [providers, setProviders] = useState<OAuthProvider[]>([]);
+  const [challenge, setChallenge] = useState("");
+  const [code, setCode] = useState("");
 
-  const handleSubmit = async (event: React.FormEvent<HTMLFormElement>) => {
+  useEffect(() => {
+    fetchOAuthProviders()
+      .then(setProviders)
+      .catch(() => setProviders([]));
+  }, []);
+
+  // A social sign-in that needs the second factor lands here with its challenge.
+  useEffect(() => {
+    if (searchParams.get("twoFactor") !== "1") {
+      return;
+    }
+    const pending = window.sessionStorage.getItem(TWO_FACTOR_CHALLENGE_KEY);
+    window.sessionStorage.removeItem(TWO_FACTOR_CHALLENGE_KEY);
+    if (pending) {
+      setChallenge(pending);
+    }
+  }, [searchParams]);
+
+  const handleCode = async (event: React.FormEvent<HTMLFormElement>) => {
     event.preventDefault();
     setError("");
     setLoading(true);
     try {
-      const session = await loginUser({ email, password });
+      const session = await completeTwoFactorSignIn(challenge, code);
       saveSession(session);
       router.push("/");
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Invalid code.");
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleProvider = async (provider: string) => {
+    setError("");
+    setLoading(true);
+    try {
+      const { url, state } = await startOAuthSignIn(provider);
+      window.sessionStorage.setItem(OAUTH_STATE_KEY, JSON.stringify({ provider, state }));
+      window.location.href = url;
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Sign-in failed.");
+      setLoading(false);
+    }
+  };
+
+  const handleSubmit = async (event: React.FormEvent<HTMLFormElement>) => {
+    event.preventDefault();
+    setError("");
+    setLoading(true);
+    try {
+      const result = await loginUser({ email, password });
+      if (needsTwoFactor(result)) {
+        setChallenge(result.challenge);
+        return;
+      }
+      saveSession(result);
+      router.push("/");
     } catch (err) {
       setError(err instanceof Error ? err.message : "Login failed.");
     } finally {
@@ -42,12 +102,41 @@ export default function SignInPage() {
             <CardTitle>Login</CardTitle>
           </CardHeader>
           <CardContent className="space-y-4">
+            {challenge ? (
+              <form className="space-y-4" onSubmit={handleCode}>
+                <div className="space-y-2">
+                  <label className="text-sm text-muted-foreground" htmlFor="code">
+                    Enter the code from your authenticator app, or a recovery code.
+                  </label>
+                  <Input
+                    id="code"
+                    autoComplete="one-time-code"
+                    value={code}
+                    onChange={(event) => setCode(event.target.value)}
+                    required
+                  />
+                </div>
+                {error && <p className="text-sm text-red-400">{error}</p>}
+                <Button
+                  type="submit"
+                  className="w-full bg-amber-200 text-zinc-950 hover:bg-amber-200/90"
+                  disabled={loading}
+                >
+                  {loading ? "Checking..." : "Verify"}
+                </Button>
+              </form>
+            ) : (
             <form className="space-y-4" onSubmit={handleSubmit}>
               {searchParams.get("registered") === "1" && (
                 <p className="rounded-md border border-amber-200/40 bg-amber-200/10 px-3 py-2 text-xs text-amber-200">
                   Account created. Please sign in to continue.
                 </p>
               )}
+              {searchParams.get("reset") === "1" && (
+                <p className="rounded-md border border-amber-200/40 bg-amber-200/10 px-3 py-2 text-xs text-amber-200">
+                  Password updated. Sign in with your new password.
+                </p>
+              )}
               <div className="space-y-2">
                 <label className="text-sm text-muted-foreground" htmlFor="email">
                   Email
@@ -81,6 +170,28 @@ export default function SignInPage() {
                 {loading ? "Logging in..." : "Login"}
               </Button>
             </form>
+            )}
+            {!challenge && providers.length > 0 && (
+              <div className="space-y-2">
+                {providers.map((provider) => (
+                  <Button
+                    key={provider.id}
+                    type="button"
+                    variant="outline"
+                    className="w-full"
+                    disabled={loading}
+                    onClick={() => handleProvider(provider.id)}
+                  >
+                    Continue with {provider.name}
+                  </Button>
+                ))}
+              </div>
+            )}
+            <p className="text-sm text-muted-foreground">
+              <Link href="/auth/forgot" className="text-amber-200 hover:text-amber-100">
+                Forgot your password?
+              </Link>
+            </p>
             <p className="text-sm text-muted-foreground">
               Need an account?{" "}
               <Link href="/auth/register" className="text-amber-200 hover:text-amber-100">
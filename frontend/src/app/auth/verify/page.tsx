@@ -0,0 +1,55 @@
+"use client";
+
+import Link from "next/link";
+import { useSearchParams } from "next/navigation";
+import { useEffect, useState } from "react";
+
+import { verifyEmail } from "@/lib/api";
+import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
+
+export default function VerifyEmailPage() {
+  const searchParams = useSearchParams();
+  const token = searchParams.get("token") ?? "";
+  const [status, setStatus] = useState<"pending" | "verified" | "failed">("pending");
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    if (!token) {
+      setStatus("failed");
+      setError("This verification link is incomplete.");
+      return;
+    }
+    verifyEmail(token)
+      .then(() => setStatus("verified"))
+      .catch((err) => {
+        setStatus("failed");
+        setError(err instanceof Error ? err.message : "Failed to verify email.");
+      });
+  }, [token]);
+
+  return (
+    <div className="min-h-screen bg-background text-foreground">
+      <div className="mx-auto flex min-h-screen w-full max-w-md items-center px-6 py-16">
+        <Card className="w-full">
+          <CardHeader>
+            <CardTitle>Email verification</CardTitle>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            {status === "pending" && <p className="text-sm text-muted-foreground">Verifying...</p>}
+            {status === "verified" && (
+              <p className="rounded-md border border-amber-200/40 bg-amber-200/10 px-3 py-2 text-xs text-amber-200">
+                Your email address is confirmed.
+              </p>
+            )}
+            {status === "failed" && <p className="text-sm text-red-400">{error}</p>}
+            <p className="text-sm text-muted-foreground">
+              <Link href="/" className="text-amber-200 hover:text-amber-100">
+                Back to reading
+              </Link>
+            </p>
+          </CardContent>
+        </Card>
+      </div>
+    </div>
+  );
+}
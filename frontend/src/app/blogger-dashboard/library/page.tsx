@@ -32,6 +32,7 @@ import {
   uploadNovelCover,
   type AdminNovel,
 } from "@/lib/api";
+import { isStaff } from "@/lib/auth";
 import { useAuthSession } from "@/lib/use-auth-session";
 import { resolveAssetUrl } from "@/lib/utils";
 
@@ -39,7 +40,7 @@ export default function BloggerLibraryPage() {
   const [novels, setNovels] = useState<AdminNovel[]>([]);
   const [notice, setNotice] = useState("");
   const session = useAuthSession();
-  const isAdmin = session?.user.role === "admin";
+  const isAdmin = isStaff(session?.user);
   const [newPostOpen, setNewPostOpen] = useState(false);
   const [newTitle, setNewTitle] = useState("");
   const [newAuthor, setNewAuthor] = useState("");
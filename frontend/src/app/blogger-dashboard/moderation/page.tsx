@@ -11,10 +11,14 @@ import {
   clearUserHistory,
   deleteUser,
   fetchAdminUsers,
+  fetchRoles,
+  stepUpTwoFactor,
   updateUserRole,
   updateUserStatus,
   type AdminUser,
+  type Role,
 } from "@/lib/api";
+import { hasPermission } from "@/lib/auth";
 import { useAuthSession } from "@/lib/use-auth-session";
 
 const formatDate = (value: string) => {
@@ -60,6 +64,7 @@ type BulkAction = "make-admin" | "make-user" | "ban" | "unban" | "delete" | "cle
 
 export default function AccountModerationPage() {
   const [users, setUsers] = useState<AdminUser[]>([]);
+  const [roles, setRoles] = useState<Role[]>([]);
   const [notice, setNotice] = useState("");
   const [query, setQuery] = useState("");
   const [isAdmin, setIsAdmin] = useState(false);
@@ -78,8 +83,13 @@ export default function AccountModerationPage() {
   const loadUsers = async () => {
     setNotice("");
     try {
-      const data = await fetchAdminUsers();
+      // Listing roles needs role.manage; without it only the current role is shown.
+      const [data, roleList] = await Promise.all([
+        fetchAdminUsers(),
+        hasPermission(session?.user, "role.manage") ? fetchRoles() : Promise.resolve([]),
+      ]);
       setUsers(data);
+      setRoles(roleList);
       return true;
     } catch (err) {
       const message = err instanceof Error ? err.message : "Failed to load users.";
@@ -89,11 +99,11 @@ export default function AccountModerationPage() {
   };
 
   useEffect(() => {
-    setIsAdmin(session?.user.role === "admin");
-  }, [session?.user.role]);
+    setIsAdmin(hasPermission(session?.user, "user.manage"));
+  }, [session?.user]);
 
   useEffect(() => {
-    if (session?.user.role !== "admin" || typeof window === "undefined") {
+    if (!hasPermission(session?.user, "user.manage") || typeof window === "undefined") {
       return;
     }
     const stored = window.sessionStorage.getItem("moderationPassword") ?? "";
@@ -103,7 +113,7 @@ export default function AccountModerationPage() {
     } else {
       setIsUnlocked(false);
     }
-  }, [session?.user.role]);
+  }, [session?.user]);
 
   useEffect(() => {
     if (!isAdmin || !isUnlocked) {
@@ -238,13 +248,28 @@ export default function AccountModerationPage() {
     });
   };
 
+  const requestRoleChange = (user: AdminUser, role: string) => {
+    requestConfirm({
+      title: "Confirm action",
+      description: `Change this account's role from ${user.role} to ${role}?`,
+      confirmLabel: "Change role",
+      onConfirm: async () => {
+        try {
+          await updateUserRole(user.id, role);
+          await loadUsers();
+        } catch (err) {
+          setNotice(err instanceof Error ? err.message : "Action failed.");
+          throw err;
+        }
+      },
+    });
+  };
+
   const requestUserAction = (
     user: AdminUser,
-    action: "make-admin" | "make-user" | "ban" | "unban" | "delete" | "clear-history"
+    action: "ban" | "unban" | "delete" | "clear-history"
   ) => {
-    const label = action === "make-admin" ? "Make admin" :
-      action === "make-user" ? "Make user" :
-      action === "ban" ? "Ban" :
+    const label = action === "ban" ? "Ban" :
       action === "unban" ? "Unban" :
       action === "delete" ? "Delete" : "Clear history";
     const description =
@@ -260,11 +285,7 @@ export default function AccountModerationPage() {
       tone: action === "delete" ? "danger" : undefined,
       onConfirm: async () => {
         try {
-          if (action === "make-admin") {
-            await updateUserRole(user.id, "admin");
-          } else if (action === "make-user") {
-            await updateUserRole(user.id, "user");
-          } else if (action === "ban") {
+          if (action === "ban") {
             await updateUserStatus(user.id, "banned");
           } else if (action === "unban") {
             await updateUserStatus(user.id, "active");
@@ -286,10 +307,25 @@ export default function AccountModerationPage() {
     setUnlockError("");
     const trimmed = moderationPassword.trim();
     if (!trimmed) {
-      setUnlockError("Enter the moderation password.");
+      setUnlockError("Enter the moderation password or a two-factor code.");
       return;
     }
     setIsUnlocking(true);
+    // Authenticator and recovery codes confirm the session itself (step-up),
+    // so nothing is kept in the browser.
+    if (session && /^(\d{6}|[a-z2-7]{4}(-?[a-z2-7]{4}){3})$/i.test(trimmed)) {
+      try {
+        await stepUpTwoFactor(session.token, trimmed);
+        await loadUsers();
+        setIsUnlocked(true);
+      } catch (err) {
+        setUnlockError(err instanceof Error ? err.message : "Invalid code.");
+        setIsUnlocked(false);
+      } finally {
+        setIsUnlocking(false);
+      }
+      return;
+    }
     if (typeof window !== "undefined") {
       window.sessionStorage.setItem("moderationPassword", trimmed);
     }
@@ -339,11 +375,12 @@ export default function AccountModerationPage() {
             </CardHeader>
             <CardContent className="space-y-4">
               <p className="text-sm text-muted-foreground">
-                Enter the moderation password to manage user accounts.
+                Enter the moderation password, or a two-factor code if step-up is enabled, to
+                manage user accounts.
               </p>
               <Input
                 type="password"
-                placeholder="Moderation password"
+                placeholder="Moderation password or two-factor code"
                 value={moderationPassword}
                 onChange={(event) => setModerationPassword(event.target.value)}
               />
@@ -464,7 +501,6 @@ export default function AccountModerationPage() {
               {pagedUsers.map((user) => {
                 const isSelf = session?.user.id === user.id;
                 const isBanned = user.status.toLowerCase() === "banned";
-                const nextRole = user.role === "admin" ? "user" : "admin";
 
                 return (
                   <div
@@ -493,15 +529,21 @@ export default function AccountModerationPage() {
                       >
                         {user.status}
                       </Badge>
-                      <Button
-                        variant="outline"
-                        size="sm"
-                        disabled={isSelf}
-                        className="w-full sm:w-auto"
-                        onClick={() => requestUserAction(user, nextRole === "admin" ? "make-admin" : "make-user")}
+                      <select
+                        className="h-9 w-full rounded-md border border-input bg-background/60 px-3 text-sm sm:w-auto"
+                        value={user.role}
+                        disabled={isSelf || roles.length === 0}
+                        onChange={(event) => requestRoleChange(user, event.target.value)}
                       >
-                        Make {nextRole}
-                      </Button>
+                        {!roles.some((role) => role.name === user.role) && (
+                          <option value={user.role}>{user.role}</option>
+                        )}
+                        {roles.map((role) => (
+                          <option key={role.name} value={role.name} title={role.description}>
+                            {role.name}
+                          </option>
+                        ))}
+                      </select>
                       <Button
                         variant="outline"
                         size="sm"
@@ -14,6 +14,7 @@ import {
   updateSiteSettings,
   uploadLogo,
 } from "@/lib/api";
+import { hasPermission } from "@/lib/auth";
 import { useAuthSession } from "@/lib/use-auth-session";
 
 export default function BloggerSettingsPage() {
@@ -45,7 +46,7 @@ export default function BloggerSettingsPage() {
   const [footerLink5Url, setFooterLink5Url] = useState("");
   const [notice, setNotice] = useState("");
   const session = useAuthSession();
-  const isAdmin = session?.user.role === "admin";
+  const isAdmin = hasPermission(session?.user, "settings.edit");
 
   useEffect(() => {
     if (session === undefined) {
@@ -153,7 +153,7 @@ export default function NovelPage() {
         setComments(
           data.map((item) => ({
             id: item.id,
-            name: `Reader ${item.userId}`,
+            name: item.authorName || `Reader ${item.userId}`,
             note: item.body,
             time: new Date(item.createdAt).toLocaleString(),
           }))
@@ -523,7 +523,7 @@ export default function NovelPage() {
                       setComments(
                         data.map((item) => ({
                           id: item.id,
-                          name: `Reader ${item.userId}`,
+                          name: item.authorName || `Reader ${item.userId}`,
                           note: item.body,
                           time: new Date(item.createdAt).toLocaleString(),
                         }))
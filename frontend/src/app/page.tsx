@@ -13,6 +13,7 @@ import { Button } from "@/components/ui/button";
 import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
 import { Input } from "@/components/ui/input";
 import { fetchNovels, fetchReadingHistory, fetchSiteSettings, type AdminNovel, type SiteSettings } from "@/lib/api";
+import { isStaff } from "@/lib/auth";
 import { useAuthSession } from "@/lib/use-auth-session";
 import { resolveAssetUrl } from "@/lib/utils";
 
@@ -24,7 +25,7 @@ const parseDate = (value: string) => {
 export default function Home() {
   const router = useRouter();
   const session = useAuthSession();
-  const isAdmin = session?.user.role === "admin";
+  const isAdmin = isStaff(session?.user);
   const [novels, setNovels] = useState<AdminNovel[]>([]);
   const [notice, setNotice] = useState("");
   const [searchQuery, setSearchQuery] = useState("");
@@ -9,7 +9,14 @@ import { ChevronLeft, ChevronRight, Copy, Palette, Sliders, Text } from "lucide-
 import { Badge } from "@/components/ui/badge";
 import { Button } from "@/components/ui/button";
 import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
-import { fetchChaptersByNovel, fetchNovels, recordReadingHistory, type AdminNovel, type Chapter } from "@/lib/api";
+import {
+  fetchChaptersByNovel,
+  fetchNovels,
+  recordChapterView,
+  recordReadingHistory,
+  type AdminNovel,
+  type Chapter,
+} from "@/lib/api";
 import { useAuthSession } from "@/lib/use-auth-session";
 import { coerceContentToText } from "@/lib/plate-content";
 import { resolveAssetUrl } from "@/lib/utils";
@@ -150,6 +157,13 @@ export default function ReaderPage() {
     window.localStorage.setItem(prefsKey, JSON.stringify(payload));
   }, [fontScale, width, theme, prefsKey]);
 
+  useEffect(() => {
+    if (!chapter.id) {
+      return;
+    }
+    recordChapterView(chapter.id).catch(() => null);
+  }, [chapter.id]);
+
   useEffect(() => {
     if (typeof window === "undefined") {
       return;
@@ -157,13 +171,8 @@ export default function ReaderPage() {
     if (!session || !chapter.id || !novel) {
       return;
     }
-    recordReadingHistory(session.token, {
-      novelSlug: novel.slug,
-      novelTitle: novel.title,
-      chapterId: chapter.id,
-      chapterTitle: `Volume ${chapter.volume} · Chapter ${chapter.number}: ${chapter.title}`,
-    }).catch(() => null);
-  }, [chapter.id, chapter.number, chapter.title, chapter.volume, novel, session]);
+    recordReadingHistory(session.token, { chapterId: chapter.id }).catch(() => null);
+  }, [chapter.id, novel, session]);
 
   const widthClass =
     width === "narrow"
@@ -52,6 +52,7 @@ import {
   uploadNovelCover,
   type AdminNovel,
 } from "@/lib/api";
+import { isStaff } from "@/lib/auth";
 import { useAuthSession } from "@/lib/use-auth-session";
 import { resolveAssetUrl } from "@/lib/utils";
 
@@ -68,7 +69,7 @@ export function BloggerDashboard() {
   const [chapterCounts, setChapterCounts] = useState<Record<number, number>>({});
   const [notice, setNotice] = useState("");
   const session = useAuthSession();
-  const isAdmin = session?.user.role === "admin";
+  const isAdmin = isStaff(session?.user);
   const [newPostOpen, setNewPostOpen] = useState(false);
   const [newTitle, setNewTitle] = useState("");
   const [newAuthor, setNewAuthor] = useState("");
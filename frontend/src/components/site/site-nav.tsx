@@ -3,12 +3,12 @@
 import Image from "next/image";
 import Link from "next/link";
 import { useEffect, useState } from "react";
-import { BookOpenText, Crown, Flame, Menu, User, X, History, Bookmark } from "lucide-react";
+import { BookOpenText, Crown, Flame, Menu, User, X, History, Bookmark, ShieldCheck } from "lucide-react";
 
 import { Button } from "@/components/ui/button";
-import { clearSession } from "@/lib/auth";
+import { isStaff } from "@/lib/auth";
 import { useAuthSession } from "@/lib/use-auth-session";
-import { fetchSiteSettings } from "@/lib/api";
+import { fetchSiteSettings, signOut } from "@/lib/api";
 import { resolveAssetUrl } from "@/lib/utils";
 
 export function SiteNav() {
@@ -20,8 +20,8 @@ export function SiteNav() {
   const resolvedLogoUrl = logoUrl ? resolveAssetUrl(logoUrl) : null;
   const isSignedIn = Boolean(session);
   const displayName = session?.user.name ?? "Profile";
-  const isAdmin = session?.user.role === "admin";
-  const displayRole = isAdmin ? "Admin" : "";
+  const isAdmin = isStaff(session?.user);
+  const displayRole = isAdmin && session ? session.user.role.charAt(0).toUpperCase() + session.user.role.slice(1) : "";
 
   useEffect(() => {
     fetchSiteSettings()
@@ -80,11 +80,14 @@ export function SiteNav() {
                     <Link href="/account/bookmarks" className="block rounded-md px-3 py-2 hover:bg-muted" onClick={() => setProfileOpen(false)}>
                       Bookmarks
                     </Link>
+                    <Link href="/account/security" className="block rounded-md px-3 py-2 hover:bg-muted" onClick={() => setProfileOpen(false)}>
+                      Security
+                    </Link>
                     <button
                       type="button"
                       className="w-full rounded-md px-3 py-2 text-left hover:bg-muted"
                       onClick={() => {
-                        clearSession();
+                        signOut();
                         setProfileOpen(false);
                       }}
                     >
@@ -140,6 +143,10 @@ export function SiteNav() {
                   <Bookmark className="h-4 w-4" />
                   Bookmarks
                 </Link>
+                <Link href="/account/security" className="flex items-center gap-2 hover:text-foreground" onClick={() => setMenuOpen(false)}>
+                  <ShieldCheck className="h-4 w-4" />
+                  Security
+                </Link>
                 <Button className="justify-start bg-amber-200 text-zinc-950 hover:bg-amber-200/90" asChild onClick={() => setMenuOpen(false)}>
                   <Link href="/library">Start reading</Link>
                 </Button>
@@ -147,7 +154,7 @@ export function SiteNav() {
                   variant="outline"
                   className="justify-start"
                   onClick={() => {
-                    clearSession();
+                    signOut();
                     setMenuOpen(false);
                   }}
                 >
@@ -1,4 +1,4 @@
-import { loadSession } from "@/lib/auth";
+import { clearSession, isStaff, loadSession, saveSession, type AuthSession } from "@/lib/auth";
 
 export type Novel = {
   id: number;
@@ -51,20 +51,49 @@ export type AuthUser = {
   email: string;
   role: string;
   status: string;
+  emailVerifiedAt: string | null;
   createdAt: string;
 };
 
 export type AuthResponse = {
   token: string;
+  refreshToken: string;
+  expiresAt: string;
   user: AuthUser;
 };
 
+export type TwoFactorChallenge = {
+  twoFactorRequired: true;
+  challenge: string;
+  expiresAt: string;
+};
+
+export type SignInResult = AuthResponse | TwoFactorChallenge;
+
+export function needsTwoFactor(result: SignInResult): result is TwoFactorChallenge {
+  return "twoFactorRequired" in result && result.twoFactorRequired;
+}
+
+export type TwoFactorStatus = {
+  enabled: boolean;
+  enabledAt: string | null;
+  recoveryCodesLeft: number;
+};
+
+export type OAuthProvider = {
+  id: string;
+  name: string;
+};
+
 export type ReadingHistoryEntry = {
   id: number;
   userId: number;
+  novelId: number;
   novelSlug: string;
   novelTitle: string;
   chapterId: number;
+  chapterVolume: number;
+  chapterNumber: number;
   chapterTitle: string;
   readAt: string;
 };
@@ -113,10 +142,27 @@ export type AdminUser = {
   createdAt: string;
 };
 
-export type NovelChapterStat = {
+export type Role = {
+  name: string;
+  description: string;
+  permissions: string[];
+  builtIn: boolean;
+};
+
+export type NovelStats = {
   novelId: number;
   chapterCount: number;
+  wordCount: number;
+  volumeChapters: Record<string, number>;
   latestChapterId: number;
+  latestChapterNumber: number;
+  latestPublishedAt: string | null;
+  followerCount: number;
+  bookmarkCount: number;
+  ratingCount: number;
+  averageRating: number;
+  readerCount: number;
+  lastUpdatedAt: string;
 };
 
 const API_BASE = process.env.NEXT_PUBLIC_API_URL ?? "http://localhost:8081";
@@ -133,7 +179,7 @@ async function getErrorMessage(response: Response, fallback: string) {
 
 function adminHeaders() {
   const session = typeof window !== "undefined" ? loadSession() : null;
-  const bearer = session?.user.role === "admin" ? { Authorization: `Bearer ${session.token}` } : {};
+  const bearer = session && isStaff(session.user) ? { Authorization: `Bearer ${session.token}` } : {};
   const key = ADMIN_API_KEY ? { "X-API-Key": ADMIN_API_KEY } : {};
   return { ...key, ...bearer };
 }
@@ -163,12 +209,12 @@ export async function fetchNovelsAdmin(): Promise<AdminNovel[]> {
   return (await response.json()) as AdminNovel[];
 }
 
-export async function fetchNovelStats(): Promise<NovelChapterStat[]> {
+export async function fetchNovelStats(): Promise<NovelStats[]> {
   const response = await fetch(`${API_BASE}/novels/stats`, { cache: "no-store" });
   if (!response.ok) {
     throw new Error(await getErrorMessage(response, "Failed to load novel stats"));
   }
-  return (await response.json()) as NovelChapterStat[];
+  return (await response.json()) as NovelStats[];
 }
 
 export async function fetchNovel(id: number): Promise<AdminNovel> {
@@ -275,6 +321,19 @@ export async function fetchAdminUsers(): Promise<AdminUser[]> {
   return (await response.json()) as AdminUser[];
 }
 
+export async function fetchRoles(): Promise<Role[]> {
+  const response = await fetch(`${API_BASE}/admin/roles`, {
+    headers: {
+      ...adminHeaders(),
+    },
+    cache: "no-store",
+  });
+  if (!response.ok) {
+    throw new Error(await getErrorMessage(response, "Failed to load roles"));
+  }
+  return (await response.json()) as Role[];
+}
+
 export async function updateUserRole(id: number, role: string): Promise<AdminUser> {
   const response = await fetch(`${API_BASE}/admin/users/${id}/role`, {
     method: "PUT",
@@ -368,7 +427,7 @@ export async function registerUser(input: {
 export async function loginUser(input: {
   email: string;
   password: string;
-}): Promise<AuthResponse> {
+}): Promise<SignInResult> {
   const response = await fetch(`${API_BASE}/auth/login`, {
     method: "POST",
     headers: { "Content-Type": "application/json" },
@@ -377,9 +436,191 @@ export async function loginUser(input: {
   if (!response.ok) {
     throw new Error(await getErrorMessage(response, "Login failed"));
   }
+  return (await response.json()) as SignInResult;
+}
+
+export async function completeTwoFactorSignIn(challenge: string, code: string): Promise<AuthResponse> {
+  const response = await fetch(`${API_BASE}/auth/2fa`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ challenge, code }),
+  });
+  if (!response.ok) {
+    throw new Error(await getErrorMessage(response, "Invalid code"));
+  }
   return (await response.json()) as AuthResponse;
 }
 
+// Refresh this long before the access token expires.
+export const REFRESH_MARGIN_MS = 60_000;
+
+// refreshSession swaps the stored refresh token for a new token pair. The
+// server revokes a session whose refresh token is used twice, so tabs take a
+// lock and skip the call when another tab already refreshed.
+export async function refreshSession(): Promise<AuthSession | null> {
+  const run = async () => {
+    const session = loadSession();
+    if (!session?.refreshToken) {
+      return session;
+    }
+    if (Date.parse(session.expiresAt) - Date.now() > REFRESH_MARGIN_MS) {
+      return session;
+    }
+    const response = await fetch(`${API_BASE}/auth/refresh`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ refreshToken: session.refreshToken }),
+    });
+    if (response.status === 401) {
+      clearSession();
+      return null;
+    }
+    if (!response.ok) {
+      throw new Error(await getErrorMessage(response, "Failed to refresh session"));
+    }
+    const next = (await response.json()) as AuthResponse;
+    saveSession(next);
+    return next;
+  };
+  if (typeof navigator !== "undefined" && navigator.locks) {
+    return navigator.locks.request("nocturne:auth-refresh", run);
+  }
+  return run();
+}
+
+export function signOut() {
+  const session = loadSession();
+  clearSession();
+  if (session?.refreshToken) {
+    fetch(`${API_BASE}/auth/logout`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ refreshToken: session.refreshToken }),
+      keepalive: true,
+    }).catch(() => null);
+  }
+}
+
+export async function fetchOAuthProviders(): Promise<OAuthProvider[]> {
+  const response = await fetch(`${API_BASE}/auth/oauth/providers`);
+  if (!response.ok) {
+    throw new Error(await getErrorMessage(response, "Failed to load sign-in providers"));
+  }
+  return (await response.json()) as OAuthProvider[];
+}
+
+export async function startOAuthSignIn(provider: string): Promise<{ url: string; state: string }> {
+  const response = await fetch(`${API_BASE}/auth/oauth/${encodeURIComponent(provider)}/start`, {
+    method: "POST",
+  });
+  if (!response.ok) {
+    throw new Error(await getErrorMessage(response, "Failed to start sign-in"));
+  }
+  return (await response.json()) as { url: string; state: string };
+}
+
+export async function completeOAuthSignIn(
+  provider: string,
+  input: { code: string; state: string },
+): Promise<SignInResult> {
+  const response = await fetch(`${API_BASE}/auth/oauth/${encodeURIComponent(provider)}/callback`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(input),
+  });
+  if (!response.ok) {
+    throw new Error(await getErrorMessage(response, "Sign-in failed"));
+  }
+  return (await response.json()) as SignInResult;
+}
+
+export async function requestPasswordReset(email: string): Promise<void> {
+  const response = await fetch(`${API_BASE}/auth/forgot`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ email }),
+  });
+  if (!response.ok) {
+    throw new Error(await getErrorMessage(response, "Failed to request a reset link"));
+  }
+}
+
+export async function resetPassword(input: { token: string; password: string }): Promise<AuthUser> {
+  const response = await fetch(`${API_BASE}/auth/reset`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(input),
+  });
+  if (!response.ok) {
+    throw new Error(await getErrorMessage(response, "Failed to reset password"));
+  }
+  return (await response.json()) as AuthUser;
+}
+
+export async function verifyEmail(token: string): Promise<AuthUser> {
+  const response = await fetch(`${API_BASE}/auth/verify`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ token }),
+  });
+  if (!response.ok) {
+    throw new Error(await getErrorMessage(response, "Failed to verify email"));
+  }
+  return (await response.json()) as AuthUser;
+}
+
+export async function fetchTwoFactorStatus(token: string): Promise<TwoFactorStatus> {
+  const response = await fetch(`${API_BASE}/me/2fa`, {
+    headers: { Authorization: `Bearer ${token}` },
+    cache: "no-store",
+  });
+  if (!response.ok) {
+    throw new Error(await getErrorMessage(response, "Failed to load two-factor settings"));
+  }
+  return (await response.json()) as TwoFactorStatus;
+}
+
+export async function setupTwoFactor(token: string): Promise<{ secret: string; otpauthUri: string }> {
+  const response = await fetch(`${API_BASE}/me/2fa/setup`, {
+    method: "POST",
+    headers: { Authorization: `Bearer ${token}` },
+  });
+  if (!response.ok) {
+    throw new Error(await getErrorMessage(response, "Failed to start two-factor setup"));
+  }
+  return (await response.json()) as { secret: string; otpauthUri: string };
+}
+
+async function postTwoFactorCode(token: string, path: string, code: string, fallback: string) {
+  const response = await fetch(`${API_BASE}/me/2fa/${path}`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json", Authorization: `Bearer ${token}` },
+    body: JSON.stringify({ code }),
+  });
+  if (!response.ok) {
+    throw new Error(await getErrorMessage(response, fallback));
+  }
+  return response;
+}
+
+export async function enableTwoFactor(token: string, code: string): Promise<string[]> {
+  const response = await postTwoFactorCode(token, "enable", code, "Failed to enable two-factor authentication");
+  return ((await response.json()) as { recoveryCodes: string[] }).recoveryCodes;
+}
+
+export async function disableTwoFactor(token: string, code: string) {
+  await postTwoFactorCode(token, "disable", code, "Failed to disable two-factor authentication");
+}
+
+export async function regenerateRecoveryCodes(token: string, code: string): Promise<string[]> {
+  const response = await postTwoFactorCode(token, "recovery-codes", code, "Failed to replace recovery codes");
+  return ((await response.json()) as { recoveryCodes: string[] }).recoveryCodes;
+}
+
+export async function stepUpTwoFactor(token: string, code: string) {
+  await postTwoFactorCode(token, "step-up", code, "Invalid code");
+}
+
 export async function fetchReadingHistory(token: string): Promise<ReadingHistoryEntry[]> {
   const response = await fetch(`${API_BASE}/me/history`, {
     headers: { Authorization: `Bearer ${token}` },
@@ -402,15 +643,14 @@ export async function fetchBookmarks(token: string): Promise<BookmarkEntry[]> {
   return (await response.json()) as BookmarkEntry[];
 }
 
-export async function recordReadingHistory(
-  token: string,
-  input: {
-    novelSlug: string;
-    novelTitle: string;
-    chapterId: number;
-    chapterTitle: string;
-  }
-): Promise<void> {
+export async function recordChapterView(chapterId: number): Promise<void> {
+  await fetch(`${API_BASE}/chapters/${chapterId}/views`, {
+    method: "POST",
+    keepalive: true,
+  });
+}
+
+export async function recordReadingHistory(token: string, input: { chapterId: number }): Promise<void> {
   const response = await fetch(`${API_BASE}/me/history`, {
     method: "POST",
     headers: {
@@ -511,6 +751,10 @@ export async function fetchComments(chapterId: number) {
     id: number;
     body: string;
     userId: number;
+    authorName: string;
+    parentId: number | null;
+    deleted: boolean;
+    editedAt: string | null;
     createdAt: string;
   }>;
 }
@@ -4,15 +4,33 @@ export type AuthUser = {
   email: string;
   role: string;
   status: string;
+  emailVerifiedAt: string | null;
+  // Sessions saved before roles existed lack this until they refresh.
+  permissions?: string[];
   createdAt: string;
 };
 
 export type AuthSession = {
   token: string;
+  refreshToken: string;
+  expiresAt: string;
   user: AuthUser;
 };
 
 export const AUTH_KEY = "nocturne:auth";
+// The provider and state of a social sign-in, checked by the callback page.
+export const OAUTH_STATE_KEY = "nocturne:oauth-state";
+// A sign-in challenge handed from the social callback to the sign-in page.
+export const TWO_FACTOR_CHALLENGE_KEY = "nocturne:2fa-challenge";
+
+export function hasPermission(user: AuthUser | null | undefined, permission: string) {
+  return user?.permissions?.includes(permission) ?? false;
+}
+
+// Staff are users whose role grants any permission, which opens the studio.
+export function isStaff(user: AuthUser | null | undefined) {
+  return (user?.permissions?.length ?? 0) > 0;
+}
 
 const notifyAuthChange = () => {
   if (typeof window === "undefined") {
@@ -1,7 +1,8 @@
 "use client";
 
-import { useSyncExternalStore } from "react";
+import { useEffect, useSyncExternalStore } from "react";
 
+import { REFRESH_MARGIN_MS, refreshSession } from "./api";
 import { AUTH_KEY, type AuthSession } from "./auth";
 
 let cachedRaw: string | null | undefined;
@@ -52,5 +53,20 @@ const subscribe = (callback: () => void) => {
 };
 
 export function useAuthSession(): AuthSession | null | undefined {
-  return useSyncExternalStore(subscribe, readSessionSnapshot, () => undefined);
+  const session = useSyncExternalStore(subscribe, readSessionSnapshot, () => undefined);
+  const expiresAt = session?.expiresAt;
+
+  // Keep the access token fresh while a component shows the session.
+  useEffect(() => {
+    if (!expiresAt) {
+      return;
+    }
+    const delay = Math.max(0, Date.parse(expiresAt) - Date.now() - REFRESH_MARGIN_MS);
+    const timer = window.setTimeout(() => {
+      refreshSession().catch(() => null);
+    }, delay);
+    return () => window.clearTimeout(timer);
+  }, [expiresAt]);
+
+  return session;
 }